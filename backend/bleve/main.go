@@ -36,8 +36,20 @@ const shardCount = 3
 
 // MarkerDB represents the structure of the marker data from DB.
 type MarkerDB struct {
-	MarkerID int    `json:"markerId"`
-	Address  string `json:"address"`
+	MarkerID    int     `json:"markerId"`
+	Address     string  `json:"address"`
+	Latitude    float64 `json:"latitude"`
+	Longitude   float64 `json:"longitude"`
+	Description string  `json:"description,omitempty"`
+	Comments    string  `json:"comments,omitempty"`
+	Captions    string  `json:"captions,omitempty"`
+	State       string  `json:"state"`
+}
+
+// GeoPoint is indexed as a geopoint field ("coordinates")
+type GeoPoint struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
 }
 
 type Marker struct {
@@ -47,6 +59,16 @@ type Marker struct {
 	Address           string `json:"address"` // such as Korean: 경기도 부천시 소사구 경인로29번길 32, 우성아파트
 	FullAddress       string `json:"fullAddress"`
 	InitialConsonants string `json:"initialConsonants"` // 초성
+
+	Latitude    float64   `json:"latitude,omitempty"`
+	Longitude   float64   `json:"longitude,omitempty"`
+	Coordinates *GeoPoint `json:"coordinates,omitempty"`
+
+	Description string `json:"description,omitempty"`
+	Comments    string `json:"comments,omitempty"` // non-deleted comments
+	Captions    string `json:"captions,omitempty"` // active story captions
+
+	State string `json:"state"` // unverified, verified or missing, removed markers aren't indexed
 }
 
 // Load environment variables from .env file
@@ -99,7 +121,14 @@ func saveJson() error {
 	defer db.Close()
 
 	// Query to select all rows from the Markers table
-	selectSQL := `SELECT MarkerID, Address FROM Markers`
+	selectSQL := `
+SELECT M.MarkerID, M.Address, ST_X(M.Location) AS Latitude, ST_Y(M.Location) AS Longitude,
+	COALESCE(M.Description, ''),
+	COALESCE((SELECT GROUP_CONCAT(C.CommentText ORDER BY C.PostedAt DESC SEPARATOR '\n') FROM Comments C WHERE C.MarkerID = M.MarkerID AND C.DeletedAt IS NULL), ''),
+	COALESCE((SELECT GROUP_CONCAT(S.Caption SEPARATOR '\n') FROM Stories S WHERE S.MarkerID = M.MarkerID AND S.ExpiresAt > NOW()), ''),
+	M.State
+FROM Markers M
+WHERE M.State <> 'removed'`
 
 	// Execute the query
 	rows, err := db.Query(selectSQL)
@@ -112,7 +141,8 @@ func saveJson() error {
 	var markers []MarkerDB
 	for rows.Next() {
 		var marker MarkerDB
-		err := rows.Scan(&marker.MarkerID, &marker.Address)
+		err := rows.Scan(&marker.MarkerID, &marker.Address, &marker.Latitude, &marker.Longitude,
+			&marker.Description, &marker.Comments, &marker.Captions, &marker.State)
 		if err != nil {
 			return fmt.Errorf("error scanning row: %v", err)
 		}
@@ -144,6 +174,10 @@ func saveJson() error {
 }
 
 // TODO: 영문 주소 인덱싱
+// main builds the marker index shards from markers.json (saveJson dumps it from the database).
+// The mapping is stored in the shards, so run it again after changing the mapping below,
+// for example to get the "coordinates" geopoint that station and area search use.
+// The server re-indexes outdated documents daily (CheckIndexes), but it can't change the mapping.
 func main() {
 	// Load environment variables
 	err := loadEnv()
@@ -220,9 +254,24 @@ func main() {
 	markerMapping.AddFieldMappingsAt("address", addressFieldMapping)
 	markerMapping.AddFieldMappingsAt("fullAddress", addressFieldMapping)
 	markerMapping.AddFieldMappingsAt("initialConsonants", addressFieldMapping)
+	markerMapping.AddFieldMappingsAt("aliases", addressFieldMapping)
+
+	// what users wrote about the marker, searched with lower weights than the address
+	markerMapping.AddFieldMappingsAt("description", addressFieldMapping)
+	markerMapping.AddFieldMappingsAt("comments", addressFieldMapping)
+	markerMapping.AddFieldMappingsAt("captions", addressFieldMapping)
+
+	// geo search (station, "search this area")
+	markerMapping.AddFieldMappingsAt("coordinates", bleve.NewGeoPointFieldMapping())
+
+	// lifecycle state, matched as a whole for the state filter
+	stateFieldMapping := bleve.NewKeywordFieldMapping()
+	stateFieldMapping.Store = true
+	markerMapping.AddFieldMappingsAt("state", stateFieldMapping)
 
 	// finalize
 	indexMapping.AddDocumentMapping("marker", markerMapping)
+	indexMapping.DefaultMapping = markerMapping // documents are indexed without a type field
 
 	// Create shards
 	indexes, err := createShards(indexMapping)
@@ -270,6 +319,9 @@ func main() {
 				marker.FullAddress = marker.Address
 				marker.Address = rest
 				marker.InitialConsonants = extractInitialConsonants(marker.FullAddress)
+				if marker.Latitude != 0 || marker.Longitude != 0 {
+					marker.Coordinates = &GeoPoint{Lat: marker.Latitude, Lon: marker.Longitude}
+				}
 				err = batches[shardIndex].Index(strconv.Itoa(marker.MarkerID), marker)
 				if err != nil {
 					log.Fatalf("Error indexing document: %v", err)
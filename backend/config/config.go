@@ -103,6 +103,58 @@ func NewZincSearchConfig() *ZincSearchConfig {
 	}
 }
 
+const (
+	SearchBackendBleve = "bleve"
+	SearchBackendZinc  = "zinc"
+)
+
+type SearchConfig struct {
+	Backend string // bleve (default) or zinc
+}
+
+func NewSearchConfig() *SearchConfig {
+	backend := os.Getenv("SEARCH_BACKEND")
+	if backend == "" {
+		backend = SearchBackendBleve
+	}
+	return &SearchConfig{
+		Backend: backend,
+	}
+}
+
+const (
+	ChatBrokerLocal = "local" // single node, events stay in the process
+	ChatBrokerRedis = "redis"
+	ChatBrokerAMQP  = "amqp"
+)
+
+type ChatConfig struct {
+	Broker  string // local (default), redis or amqp
+	AMQPURL string
+
+	Archive              bool // keep chat in MySQL beyond the Redis window
+	ArchiveRetentionDays int  // for rooms without their own setting
+}
+
+func NewChatConfig() *ChatConfig {
+	broker := os.Getenv("CHAT_BROKER")
+	if broker == "" {
+		broker = ChatBrokerLocal
+	}
+
+	retentionDays, err := strconv.Atoi(os.Getenv("CHAT_ARCHIVE_RETENTION_DAYS"))
+	if err != nil || retentionDays <= 0 {
+		retentionDays = 30
+	}
+
+	return &ChatConfig{
+		Broker:               broker,
+		AMQPURL:              os.Getenv("LAVINMQ_HOST"),
+		Archive:              os.Getenv("CHAT_ARCHIVE") == "mysql",
+		ArchiveRetentionDays: retentionDays,
+	}
+}
+
 type S3Config struct {
 	ImageCacheExpirationTime time.Duration
 	AwsRegion                string
@@ -135,6 +187,111 @@ func NewSmtpConfig() *SmtpConfig {
 	}
 }
 
+type WebPushConfig struct {
+	VAPIDPublicKey  string // base64url uncompressed P-256 point, derived from the private key when empty
+	VAPIDPrivateKey string // base64url P-256 scalar, Web Push is off without it
+	Subject         string // contact push services can reach, mailto: or https:
+	TTL             time.Duration
+}
+
+func NewWebPushConfig() *WebPushConfig {
+	subject := os.Getenv("VAPID_SUBJECT")
+	if subject == "" {
+		subject = "https://k-pullup.com"
+	}
+
+	ttl, err := strconv.Atoi(os.Getenv("WEB_PUSH_TTL_SECONDS"))
+	if err != nil || ttl <= 0 {
+		ttl = 24 * 60 * 60 // a day, push services drop it after that
+	}
+
+	return &WebPushConfig{
+		VAPIDPublicKey:  os.Getenv("VAPID_PUBLIC_KEY"),
+		VAPIDPrivateKey: os.Getenv("VAPID_PRIVATE_KEY"),
+		Subject:         subject,
+		TTL:             time.Duration(ttl) * time.Second,
+	}
+}
+
+// ReportTrustConfig holds the rules for trusted and throttled reporters.
+// Approval rates are smoothed, (approved+1)/(approved+denied+2), so a handful of reports can't reach the extremes.
+type ReportTrustConfig struct {
+	AutoApprove       bool    // auto-approve the reports of trusted reporters
+	MinDecided        int     // approved and denied reports a reporter needs to be trusted
+	MinApprovalRate   float64 // smoothed approval rate a reporter needs to be trusted
+	MinContribution   int     // contribution points a reporter needs to be trusted
+	ThrottleWindow    time.Duration
+	ThrottleMinDenied int     // denied reports in the window before a reporter can be throttled
+	ThrottleRate      float64 // throttled below this smoothed approval rate in the window
+	ThrottlePerDay    int     // reports a throttled reporter may file in 24 hours, 0 turns throttling off
+}
+
+func NewReportTrustConfig() *ReportTrustConfig {
+	return &ReportTrustConfig{
+		AutoApprove:       os.Getenv("REPORT_AUTO_APPROVE") == "true",
+		MinDecided:        envInt("REPORT_AUTO_APPROVE_MIN_DECIDED", 20),
+		MinApprovalRate:   envFloat("REPORT_AUTO_APPROVE_MIN_RATE", 0.9),
+		MinContribution:   envInt("REPORT_AUTO_APPROVE_MIN_CONTRIBUTION", 100),
+		ThrottleWindow:    time.Duration(envInt("REPORT_THROTTLE_WINDOW_DAYS", 30)) * 24 * time.Hour,
+		ThrottleMinDenied: envInt("REPORT_THROTTLE_MIN_DENIED", 5),
+		ThrottleRate:      envFloat("REPORT_THROTTLE_MAX_RATE", 0.3),
+		ThrottlePerDay:    envInt("REPORT_THROTTLE_PER_DAY", 1),
+	}
+}
+
+// ReportEvidenceConfig sets how report photos are checked against the location the report proposes
+type ReportEvidenceConfig struct {
+	MatchRadius  float64       // meters, a photo taken within this backs the report
+	FarRadius    float64       // meters, a photo taken beyond this was taken somewhere else
+	MaxAge       time.Duration // photos taken longer ago than this are stale
+	RequiredMove float64       // meters, moves farther than this need a verified photo, 0 turns it off
+}
+
+func NewReportEvidenceConfig() *ReportEvidenceConfig {
+	return &ReportEvidenceConfig{
+		MatchRadius:  float64(envInt("REPORT_EVIDENCE_MATCH_METERS", 50)),
+		FarRadius:    float64(envInt("REPORT_EVIDENCE_FAR_METERS", 1000)),
+		MaxAge:       time.Duration(envInt("REPORT_EVIDENCE_MAX_AGE_DAYS", 30)) * 24 * time.Hour,
+		RequiredMove: float64(envInt("REPORT_EVIDENCE_REQUIRED_MOVE_METERS", 0)),
+	}
+}
+
+// ReportVoteConfig sets when the community vote on a pending report settles it.
+// A vote weighs twice the voter's smoothed approval rate, nothing for someone without a reviewed report.
+type ReportVoteConfig struct {
+	Quorum          float64 // total weight of the votes needed
+	MinVoters       int     // voters whose vote weighs something
+	Majority        float64 // share of the weight one side needs
+	MinAccountAge   time.Duration
+	MinContribution int // contribution points a user needs to vote
+}
+
+func NewReportVoteConfig() *ReportVoteConfig {
+	return &ReportVoteConfig{
+		Quorum:          float64(envInt("REPORT_VOTE_QUORUM", 5)),
+		MinVoters:       envInt("REPORT_VOTE_MIN_VOTERS", 3),
+		Majority:        envFloat("REPORT_VOTE_MAJORITY", 0.7),
+		MinAccountAge:   time.Duration(envInt("REPORT_VOTE_MIN_ACCOUNT_DAYS", 30)) * 24 * time.Hour,
+		MinContribution: envInt("REPORT_VOTE_MIN_CONTRIBUTION", 30),
+	}
+}
+
+func envInt(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || value < 0 {
+		return fallback
+	}
+	return value
+}
+
+func envFloat(key string, fallback float64) float64 {
+	value, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil || value < 0 || value > 1 {
+		return fallback
+	}
+	return value
+}
+
 type TossPayConfig struct {
 	SecretKey  string
 	ConfirmAPI string
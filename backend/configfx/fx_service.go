@@ -12,8 +12,14 @@ var (
 			config.NewKakaoConfig,
 			config.NewRedisConfig,
 			config.NewZincSearchConfig,
+			config.NewSearchConfig,
+			config.NewChatConfig,
 			config.NewS3Config,
 			config.NewSmtpConfig,
+			config.NewWebPushConfig,
+			config.NewReportTrustConfig,
+			config.NewReportEvidenceConfig,
+			config.NewReportVoteConfig,
 			config.NewTossPayConfig,
 			config.NewOAuthConfig,
 		),
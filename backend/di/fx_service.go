@@ -20,6 +20,7 @@ var (
 			handler.NewAuthHandler,
 			handler.NewAdminHandler,
 			handler.NewKakaoBotHandler,
+			handler.NewDirectMessageHandler,
 		),
 	)
 
@@ -46,9 +47,17 @@ var (
 			service.NewMarkerFacilityService,
 			service.NewMarkerCommentService,
 			service.NewNotificationService,
+			service.NewWebPushService,
 			service.NewReportService,
+			service.NewReportReputationService,
+			service.NewReportEvidenceService,
+			service.NewReportVoteService,
 			service.NewMarkerCacheService,
+			service.NewMarkerStateService,
 			service.NewMarkerStoryService,
+			service.NewMeetupService,
+			service.NewEventBus,
+			service.NewNotificationDispatcher,
 		),
 	)
 
@@ -58,6 +67,10 @@ var (
 			service.NewS3Service,
 			service.NewZincSearchService,
 			service.NewBleveSearchService,
+			service.NewMarkerSearcher,
+			service.NewSearchAnalyticsService,
+			service.NewSearchSynonymService,
+			service.NewSearchIndexService,
 			service.NewSmtpService,
 		),
 	)
@@ -65,8 +78,11 @@ var (
 	FxChatModule = fx.Module("chat",
 		fx.Provide(
 			service.NewChatService,
+			service.NewChatBroker,
+			service.NewChatArchiveService,
+			service.NewChatAttachmentService,
+			service.NewDirectMessageService,
 			service.NewRoomConnectionManager,
-			// service.NewMqService,
 			// service.NewGeminiService,
 		),
 	)
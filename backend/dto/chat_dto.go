@@ -1,13 +1,50 @@
 package dto
 
+import "time"
+
 // ConnectionInfo structure to hold connection metadata
 type ConnectionInfo struct {
 	UserID   string `json:"userID"`
 	RoomID   string `json:"roomID"`
 	Username string `json:"username"`
 	ConnID   string `json:"connID"`
+
+	// presence, rewritten by the node holding the connection
+	AccountID   int    `json:"accountID,omitempty"` // logged-in users
+	AccountName string `json:"accountName,omitempty"`
+	JoinedAt    int64  `json:"joinedAt"`
+	LastSeen    int64  `json:"lastSeen"`
+	RefreshedAt int64  `json:"refreshedAt"` // entries a dead node left behind stop being refreshed
 }
 
+// ChatProtocolVersion is sent as "v" in every event on /ws/:markerID
+const ChatProtocolVersion = 1
+
+// Kinds of chat events
+const (
+	ChatKindChat     = "chat"
+	ChatKindSystem   = "system"   // server notices (new marker in the region etc.)
+	ChatKindPresence = "presence" // join, leave, user count
+	ChatKindTyping   = "typing"
+	ChatKindEdit     = "edit"
+	ChatKindDelete   = "delete"
+	ChatKindReaction = "reaction"
+	ChatKindAck      = "ack"
+	ChatKindReport   = "report" // client only, message is the reason
+
+	ChatPresenceJoin  = "join"
+	ChatPresenceLeave = "leave"
+	ChatPresenceCount = "count"
+
+	// sent when a user's idle status changes, typing events are sent at most every few seconds
+	// so clients should show the indicator for a little longer than that
+	ChatPresenceIdle   = "idle"
+	ChatPresenceActive = "active"
+)
+
+// BroadcastMessage is the envelope of every chat event.
+// Stored messages are msgpack arrays decoded by position, so only ever append fields
+// and keep the previous layout readable in decodeStoredMessage.
 type BroadcastMessage struct {
 	Timestamp    int64  `json:"timestamp"` // Unix timestamp
 	UID          string `json:"uid"`
@@ -16,6 +53,66 @@ type BroadcastMessage struct {
 	UserNickname string `json:"userNickname"`
 	RoomID       string `json:"roomID"`
 	// IsOwner      bool   `json:"isOwner,omitempty"`
+
+	Version   int            `json:"v"`
+	Kind      string         `json:"kind"`
+	TargetUID string         `json:"targetUid,omitempty"` // edit, delete, reaction, ack
+	Reaction  string         `json:"reaction,omitempty"`
+	Reactions map[string]int `json:"reactions,omitempty"` // on stored chat messages
+	EditedAt  int64          `json:"editedAt,omitempty"`
+	Deleted   bool           `json:"deleted,omitempty"`
+	Presence  string         `json:"presence,omitempty"`
+	UserCount int            `json:"userCount,omitempty"`
+	Error     string         `json:"error,omitempty"` // ack of a rejected frame
+
+	Attachment *ChatAttachment `json:"attachment,omitempty"` // chat messages with a photo
+	Location   *ChatLocation   `json:"location,omitempty"`   // chat messages with a pin
+}
+
+// ChatAttachment is a photo uploaded to POST /chat/:markerID/attachments
+type ChatAttachment struct {
+	URL          string `json:"url"`
+	ThumbnailURL string `json:"thumbnailUrl,omitempty"`
+	Blurhash     string `json:"blurhash,omitempty"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+}
+
+// ChatLocation is a pinned spot, it has to be in South Korea
+type ChatLocation struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Label     string  `json:"label,omitempty"`
+}
+
+// ChatAttachmentUpload is returned by the upload, send AttachmentID in a chat frame to post the photo
+type ChatAttachmentUpload struct {
+	AttachmentID string         `json:"attachmentId"`
+	Attachment   ChatAttachment `json:"attachment"`
+}
+
+// ChatClientFrame is a typed frame sent by clients, plain text frames are still read as chat messages
+type ChatClientFrame struct {
+	Version   int    `json:"v"`
+	Kind      string `json:"kind"`
+	UID       string `json:"uid,omitempty"` // client generated xid so resending after a reconnect is harmless
+	Message   string `json:"message,omitempty"`
+	TargetUID string `json:"targetUid,omitempty"`
+	Reaction  string `json:"reaction,omitempty"`
+
+	AttachmentID string        `json:"attachmentId,omitempty"` // chat, from the upload
+	Location     *ChatLocation `json:"location,omitempty"`     // chat
+}
+
+// ChatPresenceUser is an entry of GET /chat/:markerID/presence
+type ChatPresenceUser struct {
+	UserID      string `json:"userId"`
+	Nickname    string `json:"nickname"`
+	AccountID   int    `json:"accountId,omitempty"` // links to the profile of logged-in users
+	AccountName string `json:"accountName,omitempty"`
+	Status      string `json:"status"` // active, idle
+	JoinedAt    int64  `json:"joinedAt"`
+	LastSeen    int64  `json:"lastSeen"`
 }
 
 type UserCountMessage struct {
@@ -23,3 +120,78 @@ type UserCountMessage struct {
 	UserNickname string `json:"userNickname"`
 	UserCount    int    `json:"userCount"`
 }
+
+// ChatBanRequest is what admins send to ban someone from a room or from every room
+type ChatBanRequest struct {
+	MarkerID          string `json:"markerId"`
+	UserID            string `json:"userId"`
+	Reason            string `json:"reason"`
+	DurationInMinutes int    `json:"duration"`
+	Global            bool   `json:"global"`
+}
+
+type ChatBan struct {
+	MarkerID         string    `json:"markerId,omitempty"` // empty for global bans
+	UserID           string    `json:"userId"`
+	AccountID        int       `json:"accountId,omitempty"` // keeps the account out under any request-id
+	IP               string    `json:"ip,omitempty"`        // keeps an anonymous user out under any request-id
+	Reason           string    `json:"reason,omitempty"`
+	Global           bool      `json:"global"`
+	BannedBy         int       `json:"bannedBy,omitempty"`
+	BannedAt         time.Time `json:"bannedAt"`
+	ExpiresAt        time.Time `json:"expiresAt"`
+	RemainingSeconds int64     `json:"remainingSeconds"`
+}
+
+// ChatBanClose is the reason of the close frame a banned user receives
+type ChatBanClose struct {
+	Error            string `json:"error"`
+	Reason           string `json:"reason,omitempty"`
+	Global           bool   `json:"global,omitempty"`
+	RemainingSeconds int64  `json:"remainingSeconds"`
+}
+
+type ChatBanAudit struct {
+	AuditID         int       `json:"auditId" db:"AuditID"`
+	Action          string    `json:"action" db:"Action"` // ban, unban
+	MarkerID        string    `json:"markerId" db:"MarkerID"`
+	UserID          string    `json:"userId" db:"UserID"`
+	Reason          string    `json:"reason" db:"Reason"`
+	DurationSeconds int64     `json:"durationSeconds" db:"DurationSeconds"`
+	AdminUserID     int       `json:"adminUserId" db:"AdminUserID"`
+	CreatedAt       time.Time `json:"createdAt" db:"CreatedAt"`
+}
+
+// ChatReport is a user report on a chat message, Message is a copy since stored messages expire
+type ChatReport struct {
+	ReportID       int       `json:"reportId" db:"ReportID"`
+	MarkerID       string    `json:"markerId" db:"MarkerID"`
+	MessageUID     string    `json:"messageUid" db:"MessageUID"`
+	ReporterID     string    `json:"reporterId" db:"ReporterID"`
+	ReportedUserID string    `json:"reportedUserId" db:"ReportedUserID"`
+	Message        string    `json:"message" db:"Message"`
+	Reason         string    `json:"reason" db:"Reason"`
+	CreatedAt      time.Time `json:"createdAt" db:"CreatedAt"`
+}
+
+// ChatSlowModeRequest sets the seconds between two messages of a user in a room, 0 turns it off
+type ChatSlowModeRequest struct {
+	Seconds int `json:"seconds"`
+}
+
+type ChatMuteRequest struct {
+	UserID            string `json:"userId"`
+	DurationInMinutes int    `json:"duration"`
+}
+
+// ChatHistoryResponse is a page of older messages, oldest first. Pass NextBefore as ?before= for the next page.
+type ChatHistoryResponse struct {
+	Messages   []BroadcastMessage `json:"messages"`
+	NextBefore string             `json:"nextBefore,omitempty"`
+	HasMore    bool               `json:"hasMore"`
+}
+
+// ChatRetentionRequest sets how many days a room's chat is archived, 0 goes back to the default
+type ChatRetentionRequest struct {
+	Days int `json:"days"`
+}
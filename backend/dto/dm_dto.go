@@ -0,0 +1,52 @@
+package dto
+
+import "time"
+
+// Kinds of events on /ws/dm
+const (
+	DirectKindMessage = "dm"
+	DirectKindRead    = "read" // the user read a conversation on another device
+)
+
+type DirectMessage struct {
+	MessageID      int64     `json:"messageId" db:"MessageID"`
+	ConversationID int64     `json:"conversationId" db:"ConversationID"`
+	SenderID       int       `json:"senderId" db:"SenderID"`
+	SenderName     string    `json:"senderName,omitempty" db:"-"`
+	Body           string    `json:"body" db:"Body"`
+	CreatedAt      time.Time `json:"createdAt" db:"CreatedAt"`
+}
+
+type DirectMessageRequest struct {
+	Body string `json:"body"`
+}
+
+type DirectReadRequest struct {
+	MessageID int64 `json:"messageId"`
+}
+
+// DirectConversation is a row of the inbox, from the point of view of the user asking
+type DirectConversation struct {
+	ConversationID int64     `json:"conversationId" db:"ConversationID"`
+	OtherUserID    int       `json:"otherUserId" db:"OtherUserID"`
+	OtherUsername  string    `json:"otherUsername" db:"OtherUsername"`
+	LastMessage    string    `json:"lastMessage" db:"LastMessage"`
+	LastMessageAt  time.Time `json:"lastMessageAt" db:"LastMessageAt"`
+	UnreadCount    int       `json:"unreadCount" db:"UnreadCount"`
+}
+
+// DirectEvent is pushed to every connection of a user
+type DirectEvent struct {
+	Version        int            `json:"v"`
+	Kind           string         `json:"kind"`
+	UID            string         `json:"uid"`
+	Message        *DirectMessage `json:"message,omitempty"`
+	ConversationID int64          `json:"conversationId,omitempty"` // read
+	LastReadID     int64          `json:"lastReadId,omitempty"`     // read
+}
+
+type BlockedUser struct {
+	UserID    int       `json:"userId" db:"UserID"`
+	Username  string    `json:"username" db:"Username"`
+	CreatedAt time.Time `json:"createdAt" db:"CreatedAt"`
+}
@@ -46,6 +46,7 @@ type MarkerWithDistanceAndPhoto struct {
 	MarkerID    int     `db:"MarkerID" json:"markerId"`
 	Description string  `db:"Description" json:"description"`
 	Address     string  `db:"Address" json:"address"`
+	State       string  `db:"State" json:"state,omitempty"`
 	Thumbnail   *string `db:"Thumbnail" json:"thumbnail,omitempty"`
 }
 
@@ -63,6 +64,7 @@ type MarkerSimple struct {
 	Longitude float64 `json:"longitude" db:"Longitude"`
 	MarkerID  int     `json:"markerId" db:"MarkerID"`
 	HasPhoto  bool    `json:"hasPhoto,omitempty" db:"HasPhoto"`
+	State     string  `json:"state,omitempty" db:"State"`
 }
 
 type MarkerNewResponse struct {
@@ -73,6 +75,7 @@ type MarkerNewResponse struct {
 	Username  string  `json:"username,omitempty" db:"Username"`
 	MarkerID  int     `json:"markerId" db:"MarkerID"`
 	UserID    int     `json:"userId,omitempty" db:"UserID"`
+	State     string  `json:"state,omitempty" db:"State"`
 }
 
 type MarkerSimpleWithDescrption struct {
@@ -92,8 +95,11 @@ type MarkerSimpleWithAddr struct {
 }
 
 type MarkerOnlyWithAddr struct {
-	Address  string `json:"address,omitempty" db:"Address"`
-	MarkerID int    `json:"markerId" db:"MarkerID"`
+	Address   string  `json:"address,omitempty" db:"Address"`
+	MarkerID  int     `json:"markerId" db:"MarkerID"`
+	Latitude  float64 `json:"latitude,omitempty" db:"Latitude"`
+	Longitude float64 `json:"longitude,omitempty" db:"Longitude"`
+	State     string  `json:"state,omitempty" db:"State"`
 }
 
 type MarkerRSS struct {
@@ -164,3 +170,21 @@ type MarkersKakaoBot struct {
 	MarkerID  int     `json:"markerId" db:"MarkerID"`
 	UserID    int     `json:"userId,omitempty" db:"UserID"`
 }
+
+// MarkerState is where a marker is in its lifecycle after a confirmation or a restore
+type MarkerState struct {
+	MarkerID      int    `json:"markerId"`
+	State         string `json:"state"`
+	Confirmations int    `json:"confirmations"`
+}
+
+// MarkerStateChange is one transition in a marker's lifecycle, ReportID is set when a report caused it
+type MarkerStateChange struct {
+	HistoryID int       `json:"historyId" db:"HistoryID"`
+	FromState string    `json:"fromState" db:"FromState"`
+	ToState   string    `json:"toState" db:"ToState"`
+	Event     string    `json:"event" db:"Event"`
+	ActorID   *int      `json:"actorId,omitempty" db:"ActorID"`
+	ReportID  *int      `json:"reportId,omitempty" db:"ReportID"`
+	CreatedAt time.Time `json:"createdAt" db:"CreatedAt"`
+}
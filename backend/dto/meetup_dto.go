@@ -0,0 +1,42 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/Alfex4936/chulbong-kr/model"
+)
+
+// MeetupRequest creates a group workout at a marker, StartsAt is RFC 3339
+type MeetupRequest struct {
+	Title           string    `json:"title"`
+	Description     string    `json:"description"`
+	StartsAt        time.Time `json:"startsAt"`
+	DurationMinutes int       `json:"durationMinutes"`
+	Capacity        int       `json:"capacity"`
+}
+
+type Meetup struct {
+	MeetupID        int64      `json:"meetupId" db:"MeetupID"`
+	MarkerID        int        `json:"markerId" db:"MarkerID"`
+	CreatorID       int        `json:"creatorId" db:"CreatorID"`
+	CreatorName     string     `json:"creatorName" db:"CreatorName"`
+	Title           string     `json:"title" db:"Title"`
+	Description     string     `json:"description" db:"Description"`
+	StartsAt        time.Time  `json:"startsAt" db:"StartsAt"`
+	DurationMinutes int        `json:"durationMinutes" db:"DurationMinutes"`
+	Capacity        int        `json:"capacity" db:"Capacity"`
+	GoingCount      int        `json:"goingCount" db:"GoingCount"`
+	Going           bool       `json:"going" db:"Going"` // the user asking has RSVPed
+	CancelledAt     *time.Time `json:"cancelledAt,omitempty" db:"CancelledAt"`
+	CreatedAt       time.Time  `json:"createdAt" db:"CreatedAt"`
+
+	Address   *string `json:"address,omitempty" db:"Address"`
+	Latitude  float64 `json:"latitude" db:"Latitude"`
+	Longitude float64 `json:"longitude" db:"Longitude"`
+}
+
+// MarkerDetails is the response of /markers/:markerId/details
+type MarkerDetails struct {
+	*model.MarkerWithPhotos
+	Meetups []Meetup `json:"meetups"` // upcoming ones, soonest first
+}
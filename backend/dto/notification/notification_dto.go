@@ -1,6 +1,10 @@
 package notification
 
-import "github.com/goccy/go-json"
+import (
+	"time"
+
+	"github.com/goccy/go-json"
+)
 
 type NotificationRedis struct {
 	NotificationId   int64           `json:"notificationId" db:"NotificationId"`
@@ -19,7 +23,152 @@ type NotificationMarkerMetadata struct {
 }
 
 type NotificationLikeMetadata struct {
-	MarkerID int `json:"markerID"`
-	UserId   int `json:"userId"`
-	LikerId  int `json:"likerId"`
+	MarkerID int    `json:"markerID"`
+	UserId   int    `json:"userId"`
+	LikerId  int    `json:"likerId"`
+	Link     string `json:"link,omitempty"`
+}
+
+type NotificationDirectMessageMetadata struct {
+	ConversationID int64 `json:"conversationId"`
+	MessageID      int64 `json:"messageId"`
+	SenderID       int   `json:"senderId"`
+}
+
+type NotificationMeetupMetadata struct {
+	MeetupID int64  `json:"meetupId"`
+	MarkerID int    `json:"markerID"`
+	StartsAt string `json:"startsAt"`
+}
+
+// Link in the metadata below is the page the notification opens
+
+type NotificationCommentMetadata struct {
+	MarkerID    int    `json:"markerID"`
+	CommentID   int    `json:"commentId"`
+	CommenterID int    `json:"commenterId"`
+	Link        string `json:"link"`
+}
+
+type NotificationReportMetadata struct {
+	MarkerID int    `json:"markerID"`
+	ReportID int    `json:"reportId"`
+	Status   string `json:"status"` // PENDING for reports on the user's marker, APPROVED or DENIED for the user's own
+	Reason   string `json:"reason,omitempty"`
+	Link     string `json:"link"`
+}
+
+type NotificationStoryMetadata struct {
+	MarkerID  int    `json:"markerID"`
+	StoryID   int    `json:"storyId"`
+	ReactorID int    `json:"reactorId"`
+	Reaction  string `json:"reaction"`
+	Link      string `json:"link"`
+}
+
+// NotificationPreference picks the channels a type of personal notification is delivered on,
+// the type is off when both are
+type NotificationPreference struct {
+	Type  string `json:"type" db:"NotificationType"`
+	InApp bool   `json:"inApp" db:"InApp"`
+	Email bool   `json:"email" db:"Email"`
+}
+
+// NotificationSettings are a user's preferences for every personal notification type.
+// Quiet hours are "HH:MM" in KST and may wrap midnight, both empty means none.
+type NotificationSettings struct {
+	QuietHoursStart string                   `json:"quietHoursStart" db:"QuietHoursStart"`
+	QuietHoursEnd   string                   `json:"quietHoursEnd" db:"QuietHoursEnd"`
+	EmailMode       string                   `json:"emailMode" db:"EmailMode"` // off, instant, daily or weekly
+	Preferences     []NotificationPreference `json:"preferences" db:"-"`
+}
+
+// PushSubscription is what the browser's PushSubscription.toJSON() gives
+type PushSubscription struct {
+	Endpoint       string `json:"endpoint"`
+	ExpirationTime *int64 `json:"expirationTime"` // unix milliseconds
+	Keys           struct {
+		P256dh string `json:"p256dh"`
+		Auth   string `json:"auth"`
+	} `json:"keys"`
+}
+
+// NotificationPush is the Web Push payload the service worker shows
+type NotificationPush struct {
+	NotificationId int64  `json:"notificationId"`
+	Type           string `json:"type"`
+	Title          string `json:"title"`
+	Body           string `json:"body"`
+	URL            string `json:"url"`
+}
+
+// InboxNotification is a notification with what the user did with it
+type InboxNotification struct {
+	NotificationId   int64           `json:"notificationId" db:"NotificationId"`
+	NotificationType string          `json:"type" db:"NotificationType"`
+	Title            string          `json:"title" db:"Title"`
+	Message          string          `json:"message" db:"Message"`
+	Metadata         json.RawMessage `json:"metadata" db:"Metadata"`
+	CreatedAt        time.Time       `json:"createdAt" db:"CreatedAt"`
+	Read             bool            `json:"read" db:"IsRead"`
+	Archived         bool            `json:"archived" db:"Archived"`
+}
+
+type NotificationInbox struct {
+	Notifications []InboxNotification `json:"notifications"`
+	UnreadCount   int                 `json:"unreadCount"`
+	CurrentPage   int                 `json:"currentPage"`
+	TotalPages    int                 `json:"totalPages"`
+}
+
+// NotificationBulkRequest applies one action to many notifications of the inbox
+type NotificationBulkRequest struct {
+	Action string  `json:"action"` // read, archive, unarchive or delete
+	IDs    []int64 `json:"ids"`
+}
+
+// BroadcastAudience picks who a broadcast goes to, only the fields of its type are used
+type BroadcastAudience struct {
+	Type     string `json:"type"` // province, district, active or marker
+	Province string `json:"province,omitempty"`
+	District string `json:"district,omitempty"` // 종로구, 수원시 and so on
+	Days     int    `json:"days,omitempty"`
+	MarkerID int    `json:"markerId,omitempty"`
+}
+
+type BroadcastRequest struct {
+	Title       string            `json:"title"`
+	Message     string            `json:"message"`
+	Link        string            `json:"link"` // a page on the site like /pullup/123
+	Audience    BroadcastAudience `json:"audience"`
+	ScheduledAt *time.Time        `json:"scheduledAt"` // right away when empty
+}
+
+// Broadcast is a targeted announcement with how far it got,
+// delivered counts the recipients a socket or a push reached and opened the ones who read it
+type Broadcast struct {
+	BroadcastID int64           `json:"broadcastId" db:"BroadcastID"`
+	Title       string          `json:"title" db:"Title"`
+	Message     string          `json:"message" db:"Message"`
+	Link        string          `json:"link" db:"Link"`
+	Audience    json.RawMessage `json:"audience" db:"Audience"`
+	Status      string          `json:"status" db:"Status"`
+	ScheduledAt time.Time       `json:"scheduledAt" db:"ScheduledAt"`
+	SentAt      *time.Time      `json:"sentAt" db:"SentAt"`
+	CreatedBy   int             `json:"createdBy" db:"CreatedBy"`
+	CreatedAt   time.Time       `json:"createdAt" db:"CreatedAt"`
+	Recipients  int             `json:"recipients" db:"Recipients"`
+	Delivered   int             `json:"delivered" db:"Delivered"`
+	Opened      int             `json:"opened" db:"Opened"`
+}
+
+type BroadcastList struct {
+	Broadcasts  []Broadcast `json:"broadcasts"`
+	CurrentPage int         `json:"currentPage"`
+	TotalPages  int         `json:"totalPages"`
+}
+
+type NotificationBroadcastMetadata struct {
+	BroadcastID int64  `json:"broadcastId"`
+	Link        string `json:"link,omitempty"`
 }
@@ -1,6 +1,7 @@
 package dto
 
 import (
+	"encoding/json"
 	"time"
 )
 
@@ -28,6 +29,7 @@ type MarkerReportResponse struct {
 	PhotoURLs    []string  `json:"photoUrls,omitempty"` // Array to store multiple photo URLs
 	Status       string    `json:"status" db:"Status"`
 	Address      string    `json:"address,omitempty" db:"Address"`
+	Reason       string    `json:"reason,omitempty" db:"Reason"` // why it was approved or denied
 	DoesExist    bool      `json:"doesExist,omitempty" db:"DoesExist"`
 }
 
@@ -80,3 +82,149 @@ type GroupedReportsResponse struct {
 	TotalReports int                 `json:"totalReports"`
 	Markers      []MarkerWithReports `json:"markers"`
 }
+
+// ReportQueueFilter narrows the review queue, zero values don't filter
+type ReportQueueFilter struct {
+	Status      string `query:"status"`   // PENDING when empty, APPROVED or DENIED
+	Type        string `query:"type"`     // moved or removed, DoesExist tells them apart
+	Region      string `query:"region"`   // a region code like so or gg, or a province name
+	Assignee    string `query:"assignee"` // me, none or a user ID
+	MinAgeHours int    `query:"minAge"`
+	MaxAgeHours int    `query:"maxAge"`
+	Overdue     bool   `query:"overdue"`
+	Page        int    `query:"page"`
+	PageSize    int    `query:"pageSize"`
+}
+
+// ReportQueueItem is a report with what a reviewer needs to decide on it.
+// Latitude and Longitude are where the marker was, NewLatitude and NewLongitude where the reporter put it.
+type ReportQueueItem struct {
+	Latitude     float64    `json:"latitude" db:"Latitude"`
+	Longitude    float64    `json:"longitude" db:"Longitude"`
+	NewLatitude  float64    `json:"newLatitude" db:"NewLatitude"`
+	NewLongitude float64    `json:"newLongitude" db:"NewLongitude"`
+	Distance     float64    `json:"distance" db:"-"` // meters between the two
+	CreatedAt    time.Time  `json:"createdAt" db:"CreatedAt"`
+	DueAt        time.Time  `json:"dueAt" db:"-"`
+	AssignedAt   *time.Time `json:"assignedAt,omitempty" db:"AssignedAt"`
+	ReportID     int        `json:"reportId" db:"ReportID"`
+	MarkerID     int        `json:"markerId" db:"MarkerID"`
+	ReporterID   *int       `json:"reporterId,omitempty" db:"ReporterID"`
+	ReporterName string     `json:"reporterName,omitempty" db:"ReporterName"`
+	AssigneeID   *int       `json:"assigneeId,omitempty" db:"AssigneeID"`
+	AssigneeName string     `json:"assigneeName,omitempty" db:"AssigneeName"`
+	Description  string     `json:"description" db:"Description"`
+	Address      string     `json:"address" db:"Address"`
+	Status       string     `json:"status" db:"Status"`
+	Type         string     `json:"type" db:"-"`
+	Reason       string     `json:"reason,omitempty" db:"Reason"`
+	PhotoURLs    []string   `json:"photoUrls" db:"-"`
+	DoesExist    bool       `json:"doesExist" db:"DoesExist"`
+	Overdue      bool       `json:"overdue" db:"-"`
+
+	Evidence ReportEvidence `json:"evidence" db:"-"`
+}
+
+// ReportQueueSummary counts the pending reports for the queue header and the daily email
+type ReportQueueSummary struct {
+	Pending    int `json:"pending" db:"Pending"`
+	Overdue    int `json:"overdue" db:"Overdue"`
+	Unassigned int `json:"unassigned" db:"Unassigned"`
+}
+
+type ReportQueue struct {
+	Reports     []ReportQueueItem  `json:"reports"`
+	Summary     ReportQueueSummary `json:"summary"`
+	Total       int                `json:"total"`
+	CurrentPage int                `json:"currentPage"`
+	TotalPages  int                `json:"totalPages"`
+}
+
+// ReportAssignRequest assigns the reports to a reviewer, the caller when AssigneeID is missing and nobody when it's 0
+type ReportAssignRequest struct {
+	ReportIDs  []int `json:"reportIds"`
+	AssigneeID *int  `json:"assigneeId"`
+}
+
+// ReportBulkRequest approves or denies the reports at once, the reporters see the reason
+type ReportBulkRequest struct {
+	Action    string `json:"action"` // approve or deny
+	ReportIDs []int  `json:"reportIds"`
+	Reason    string `json:"reason"`
+}
+
+type ReportBulkResult struct {
+	Succeeded []int          `json:"succeeded"`
+	Failed    map[int]string `json:"failed,omitempty"` // report ID to why it failed
+}
+
+// ReporterReputation is how a reporter's past reports were judged.
+// Approved leaves out automatic approvals so trusted reporters can't keep themselves trusted.
+type ReporterReputation struct {
+	UserID         int        `json:"userId" db:"-"`
+	Approved       int        `json:"approved" db:"Approved"`
+	Denied         int        `json:"denied" db:"Denied"`
+	Pending        int        `json:"pending" db:"Pending"`
+	RecentApproved int        `json:"recentApproved" db:"RecentApproved"` // within the throttle window
+	RecentDenied   int        `json:"recentDenied" db:"RecentDenied"`
+	ReportsToday   int        `json:"reportsToday" db:"ReportsToday"` // in the last 24 hours
+	Contribution   int        `json:"contribution" db:"-"`
+	Score          float64    `json:"score" db:"-"` // smoothed approval rate, 0 to 1
+	Trusted        bool       `json:"trusted" db:"-"`
+	Throttled      bool       `json:"throttled" db:"-"`
+	ExemptUntil    *time.Time `json:"exemptUntil,omitempty" db:"-"`
+}
+
+// ReportAutoDecision is an audit entry for a report approved, or a reporter throttled, without a reviewer
+type ReportAutoDecision struct {
+	DecisionID int             `json:"decisionId" db:"DecisionID"`
+	Decision   string          `json:"decision" db:"Decision"` // auto_approved or throttled
+	ReportID   *int            `json:"reportId,omitempty" db:"ReportID"`
+	MarkerID   int             `json:"markerId" db:"MarkerID"`
+	UserID     int             `json:"userId" db:"UserID"`
+	Username   string          `json:"username" db:"Username"`
+	Reputation json.RawMessage `json:"reputation" db:"Reputation"` // ReporterReputation at the time of the decision
+	CreatedAt  time.Time       `json:"createdAt" db:"CreatedAt"`
+	RevertedBy *int            `json:"revertedBy,omitempty" db:"RevertedBy"`
+	RevertedAt *time.Time      `json:"revertedAt,omitempty" db:"RevertedAt"`
+}
+
+type ReportAutoDecisionList struct {
+	Decisions   []ReportAutoDecision `json:"decisions"`
+	Total       int                  `json:"total"`
+	CurrentPage int                  `json:"currentPage"`
+	TotalPages  int                  `json:"totalPages"`
+}
+
+// ReportPhotoEvidence is what a report photo's EXIF says about where and when it was taken.
+// Flags are no_gps, no_time, stale, mismatch (near but not at the proposed location) and far.
+type ReportPhotoEvidence struct {
+	PhotoURL  string     `json:"photoUrl"`
+	Latitude  *float64   `json:"latitude,omitempty"`
+	Longitude *float64   `json:"longitude,omitempty"`
+	TakenAt   *time.Time `json:"takenAt,omitempty"`
+	Distance  *float64   `json:"distance,omitempty"` // meters from the proposed location
+	Flags     []string   `json:"flags"`
+}
+
+// ReportEvidence sums up the report photos, verified when one was taken at the proposed location recently
+type ReportEvidence struct {
+	Status string                `json:"status"` // verified, flagged or missing
+	Photos []ReportPhotoEvidence `json:"photos"`
+}
+
+// ReportVoteRequest is a user's vote on a pending report
+type ReportVoteRequest struct {
+	Vote string `json:"vote"` // up or down
+}
+
+// ReportVoteTally is the weighted count of the votes on a report
+type ReportVoteTally struct {
+	ReportID int     `json:"reportId" db:"-"`
+	Up       float64 `json:"up" db:"Up"`
+	Down     float64 `json:"down" db:"Down"`
+	Voters   int     `json:"voters" db:"Voters"`
+	Quorum   float64 `json:"quorum" db:"-"`
+	MyVote   string  `json:"myVote,omitempty" db:"-"`
+	Status   string  `json:"status" db:"-"` // the report's, APPROVED or DENIED once the vote settled it
+}
@@ -1,5 +1,7 @@
 package dto
 
+import "fmt"
+
 // ElasticsearchResponse represents the entire JSON response structure
 type ElasticsearchResponse struct {
 	Hits     HitsData `json:"hits"`
@@ -43,7 +45,11 @@ type ZincMarker struct {
 	Timestamp string `json:"@timestamp,omitempty"`
 	Address   string `json:"address"`
 	Highlight string `json:"highlight,omitempty"`
-	MarkerID  int    `json:"markerId"`
+	// MatchedField is set when the hit came from text written about the marker
+	// (description, comments, captions) instead of its address, Highlight then holds the snippet
+	MatchedField string `json:"matchedField,omitempty"`
+	MarkerID     int    `json:"markerId"`
+	State        string `json:"state,omitempty"`
 }
 
 // FuzzSearch represents the structure of the search
@@ -66,12 +72,61 @@ type MarkerSearchResponse struct {
 }
 
 type MarkerIndexData struct {
-	MarkerID          int    `json:"markerId"`
-	Province          string `json:"province"`
-	City              string `json:"city"`
-	Address           string `json:"address"` // such as Korean: 경기도 부천시 소사구 경인로29번길 32, 우성아파트
-	FullAddress       string `json:"fullAddress"`
-	InitialConsonants string `json:"initialConsonants"` // 초성
+	MarkerID          int       `json:"markerId"`
+	Province          string    `json:"province"`
+	City              string    `json:"city"`
+	Address           string    `json:"address"` // such as Korean: 경기도 부천시 소사구 경인로29번길 32, 우성아파트
+	FullAddress       string    `json:"fullAddress"`
+	InitialConsonants string    `json:"initialConsonants"` // 초성
+	Aliases           string    `json:"aliases,omitempty"` // landmark names such as 한강공원, space separated
+	Coordinates       *GeoPoint `json:"coordinates,omitempty"`
+
+	// user written text, searched with lower weights than the address
+	Description string `json:"description,omitempty"`
+	Comments    string `json:"comments,omitempty"` // non-deleted comments, newline separated
+	Captions    string `json:"captions,omitempty"` // active story captions, newline separated
+
+	State string `json:"state"` // removed markers are dropped from the index instead
+}
+
+// GeoPoint is indexed as a bleve geopoint field
+type GeoPoint struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// GeoFilter limits or boosts a search to a map area, either a bounding box or a center with radius.
+type GeoFilter struct {
+	MinLat float64
+	MinLng float64
+	MaxLat float64
+	MaxLng float64
+
+	Lat    float64
+	Lng    float64
+	Radius float64 // meters
+
+	Restrict bool // true: only markers inside the area ("search this area"), false: rank them first
+}
+
+func (g *GeoFilter) HasBounds() bool {
+	return g != nil && g.MinLat < g.MaxLat && g.MinLng < g.MaxLng
+}
+
+func (g *GeoFilter) HasRadius() bool {
+	return g != nil && g.Radius > 0 && (g.Lat != 0 || g.Lng != 0)
+}
+
+// CacheKey rounds the area so small map drags share cached results
+func (g *GeoFilter) CacheKey() string {
+	switch {
+	case g.HasBounds():
+		return fmt.Sprintf("bbox:%.3f,%.3f,%.3f,%.3f:%t", g.MinLat, g.MinLng, g.MaxLat, g.MaxLng, g.Restrict)
+	case g.HasRadius():
+		return fmt.Sprintf("radius:%.3f,%.3f,%.0f:%t", g.Lat, g.Lng, g.Radius, g.Restrict)
+	default:
+		return ""
+	}
 }
 
 type KoreaStation struct {
@@ -79,3 +134,52 @@ type KoreaStation struct {
 	Latitude  float64
 	Longitude float64
 }
+
+type SearchClickRequest struct {
+	Term     string `json:"term"`
+	MarkerID int    `json:"markerId"`
+	Position int    `json:"position"` // 1-based position in the result list
+}
+
+type SearchQueryStat struct {
+	Query  string `json:"query"`
+	Count  int64  `json:"count"`
+	Clicks int64  `json:"clicks,omitempty"`
+}
+
+type SearchPositionStat struct {
+	Position    int     `json:"position"`
+	Impressions int64   `json:"impressions"`
+	Clicks      int64   `json:"clicks"`
+	CTR         float64 `json:"ctr"`
+}
+
+type SearchAnalyticsReport struct {
+	From                 string               `json:"from"`
+	To                   string               `json:"to"`
+	TotalSearches        int64                `json:"totalSearches"`
+	ZeroResultSearches   int64                `json:"zeroResultSearches"`
+	TotalClicks          int64                `json:"totalClicks"`
+	AutoCompleteSearches int64                `json:"autoCompleteSearches"`
+	AvgTookMs            float64              `json:"avgTookMs"`
+	TopQueries           []SearchQueryStat    `json:"topQueries"`
+	ZeroResultQueries    []SearchQueryStat    `json:"zeroResultQueries"`
+	PositionCTR          []SearchPositionStat `json:"positionCtr"`
+}
+
+type SearchSynonym struct {
+	SynonymID int    `json:"synonymId" db:"SynonymID"`
+	Term      string `json:"term" db:"Term"`
+	Synonym   string `json:"synonym" db:"Synonym"`
+}
+
+type MarkerAlias struct {
+	AliasID  int    `json:"aliasId" db:"AliasID"`
+	MarkerID int    `json:"markerId" db:"MarkerID"`
+	Alias    string `json:"alias" db:"Alias"`
+}
+
+type SearchDictionaryResponse struct {
+	Synonyms []SearchSynonym `json:"synonyms"`
+	Aliases  []MarkerAlias   `json:"aliases"`
+}
@@ -41,6 +41,7 @@ type AdminFacadeService struct {
 	ChatService    *service.ChatService
 	MarkerFacility *service.MarkerFacilityService
 	RedisService   *service.RedisService
+	ReportService  *service.ReportService
 
 	HTTPClient *http.Client
 
@@ -55,6 +56,7 @@ type AdminFacadeParams struct {
 	ChatService    *service.ChatService
 	MarkerFacility *service.MarkerFacilityService
 	RedisService   *service.RedisService
+	ReportService  *service.ReportService
 
 	HTTPClient *http.Client
 	Logger     *zap.Logger
@@ -69,6 +71,7 @@ func NewAdminFacadeService(
 		ChatService:    p.ChatService,
 		MarkerFacility: p.MarkerFacility,
 		RedisService:   p.RedisService,
+		ReportService:  p.ReportService,
 		HTTPClient:     p.HTTPClient,
 		Logger:         p.Logger,
 	}
@@ -90,10 +93,99 @@ func (afs *AdminFacadeService) DeleteDataFromS3(dataURL string) error {
 	return afs.S3Service.DeleteDataFromS3(dataURL)
 }
 
+func (afs *AdminFacadeService) GetReportQueue(filter dto.ReportQueueFilter, reviewerID int) (dto.ReportQueue, error) {
+	return afs.ReportService.GetReportQueue(filter, reviewerID, time.Now())
+}
+
+func (afs *AdminFacadeService) AssignReports(reportIDs []int, assigneeID int) (int64, error) {
+	return afs.ReportService.AssignReports(reportIDs, assigneeID)
+}
+
+func (afs *AdminFacadeService) DecideReports(req dto.ReportBulkRequest, reviewerID int) (dto.ReportBulkResult, error) {
+	return afs.ReportService.DecideReports(req, reviewerID)
+}
+
+func (afs *AdminFacadeService) ListAutoDecisions(decision string, page, pageSize int) (dto.ReportAutoDecisionList, error) {
+	return afs.ReportService.ListAutoDecisions(decision, page, pageSize)
+}
+
+func (afs *AdminFacadeService) RevertAutoDecision(decisionID, adminID int) error {
+	return afs.ReportService.RevertAutoDecision(decisionID, adminID, time.Now())
+}
+
+func (afs *AdminFacadeService) GetReporterReputation(userID int) (dto.ReporterReputation, error) {
+	return afs.ReportService.Reputation.GetReputation(userID, time.Now())
+}
+
+func (afs *AdminFacadeService) RestoreMarker(markerID, adminID int) (dto.MarkerState, error) {
+	return afs.ReportService.States.Restore(markerID, adminID)
+}
+
 func (afs *AdminFacadeService) BanUser(markerID, userID string, duration time.Duration) error {
 	return afs.ChatService.BanUser(markerID, userID, duration)
 }
 
+// BanChatUser bans for 1 minute up to 30 days, 5 minutes when no duration is given
+func (afs *AdminFacadeService) BanChatUser(req dto.ChatBanRequest, adminID int) (dto.ChatBan, error) {
+	duration := time.Duration(req.DurationInMinutes) * time.Minute
+	if duration < time.Minute {
+		duration = 5 * time.Minute
+	} else if duration > 30*24*time.Hour {
+		duration = 30 * 24 * time.Hour
+	}
+
+	return afs.ChatService.Ban(dto.ChatBan{
+		MarkerID: req.MarkerID,
+		UserID:   req.UserID,
+		Reason:   strings.TrimSpace(req.Reason),
+		Global:   req.Global,
+		BannedBy: adminID,
+	}, duration)
+}
+
+func (afs *AdminFacadeService) UnbanChatUser(markerID, userID string, adminID int) error {
+	return afs.ChatService.Unban(markerID, userID, adminID)
+}
+
+func (afs *AdminFacadeService) ListChatBans() ([]dto.ChatBan, error) {
+	return afs.ChatService.ListBans()
+}
+
+func (afs *AdminFacadeService) ListChatBanAudit(page, pageSize int) ([]dto.ChatBanAudit, error) {
+	return afs.ChatService.GetBanAudit(page, pageSize)
+}
+
+func (afs *AdminFacadeService) ListChatReports(page, pageSize int) ([]dto.ChatReport, error) {
+	return afs.ChatService.GetChatReports(page, pageSize)
+}
+
+func (afs *AdminFacadeService) SetChatSlowMode(markerID string, seconds int) error {
+	return afs.ChatService.SetSlowMode(markerID, seconds)
+}
+
+// ShadowMuteChatUser mutes for 1 minute up to 30 days, a day when no duration is given
+func (afs *AdminFacadeService) ShadowMuteChatUser(userID string, durationInMinutes int) error {
+	duration := time.Duration(durationInMinutes) * time.Minute
+	if duration < time.Minute {
+		duration = 24 * time.Hour
+	} else if duration > 30*24*time.Hour {
+		duration = 30 * 24 * time.Hour
+	}
+	return afs.ChatService.ShadowMute(userID, duration)
+}
+
+func (afs *AdminFacadeService) UnmuteChatUser(userID string) error {
+	return afs.ChatService.Unmute(userID)
+}
+
+func (afs *AdminFacadeService) SetChatRetention(markerID, days int) error {
+	return afs.ChatService.Archive.SetRetention(markerID, days)
+}
+
+func (afs *AdminFacadeService) SearchChatArchive(markerID int, keyword string, page, pageSize int) ([]dto.BroadcastMessage, error) {
+	return afs.ChatService.Archive.Search(markerID, keyword, page, pageSize)
+}
+
 func (afs *AdminFacadeService) FetchLatestMarkers(thresholdDate time.Time) ([]service.DataItem, error) {
 	return afs.MarkerFacility.FetchLatestMarkers(thresholdDate)
 }
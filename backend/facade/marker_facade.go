@@ -28,8 +28,11 @@ type MarkerFacadeService struct {
 	RankService     *service.MarkerRankService
 	FacilityService *service.MarkerFacilityService
 	StoryService    *service.StoryService
+	MeetupService   *service.MeetupService
 	RedisService    *service.RedisService
 	ReportService   *service.ReportService
+	VoteService     *service.ReportVoteService
+	StateService    *service.MarkerStateService
 
 	UserService *service.UserService
 
@@ -51,7 +54,10 @@ type MarkerFacadeParams struct {
 	FacilityService *service.MarkerFacilityService
 	RedisService    *service.RedisService
 	ReportService   *service.ReportService
+	VoteService     *service.ReportVoteService
+	StateService    *service.MarkerStateService
 	StoryService    *service.StoryService
+	MeetupService   *service.MeetupService
 
 	UserService *service.UserService
 
@@ -75,8 +81,11 @@ func NewMarkerFacadeService(
 		FacilityService: p.FacilityService,
 		RedisService:    p.RedisService,
 		ReportService:   p.ReportService,
+		VoteService:     p.VoteService,
+		StateService:    p.StateService,
 		UserService:     p.UserService,
 		StoryService:    p.StoryService,
+		MeetupService:   p.MeetupService,
 		ChatUtil:        p.ChatUtil,
 		BadWordUtil:     p.BadWordUtil,
 		MapUtil:         p.MapUtil,
@@ -101,6 +110,14 @@ func (mfs *MarkerFacadeService) GetAllMarkersProto() ([]*protos.Marker, error) {
 	return mfs.ManageService.GetAllMarkersProto()
 }
 
+func (mfs *MarkerFacadeService) GetAllMarkersByState(states []string) ([]dto.MarkerSimple, error) {
+	return mfs.ManageService.GetAllMarkersByState(states)
+}
+
+func (mfs *MarkerFacadeService) GetMarkerStateHistory(markerID int) ([]dto.MarkerStateChange, error) {
+	return mfs.StateService.GetHistory(markerID)
+}
+
 func (mfs *MarkerFacadeService) GetNew10Pictures() ([]dto.MarkerNewPicture, error) {
 	return mfs.ManageService.GetNewTop10Pictures()
 }
@@ -150,6 +167,10 @@ func (mfs *MarkerFacadeService) UploadMarkerPhotoToS3(markerID int, files []*mul
 	return mfs.ManageService.UploadMarkerPhotoToS3(markerID, files)
 }
 
+func (mfs *MarkerFacadeService) ConfirmMarker(markerID, userID int) (dto.MarkerState, error) {
+	return mfs.StateService.Confirm(markerID, userID)
+}
+
 func (mfs *MarkerFacadeService) SetMarkerFacilities(markerID int, facilities []dto.FacilityQuantity) error {
 	return mfs.FacilityService.SetMarkerFacilities(markerID, facilities)
 }
@@ -2,6 +2,7 @@ package facade
 
 import (
 	"mime/multipart"
+	"time"
 
 	"github.com/Alfex4936/chulbong-kr/dto"
 )
@@ -34,3 +35,11 @@ func (mfs *MarkerFacadeService) DenyReport(reportID, userID int) error {
 func (mfs *MarkerFacadeService) DeleteReport(reportID, userID, markerID int) error {
 	return mfs.ReportService.DeleteReport(reportID, userID, markerID)
 }
+
+func (mfs *MarkerFacadeService) VoteReport(reportID, userID int, req dto.ReportVoteRequest) (dto.ReportVoteTally, error) {
+	return mfs.VoteService.CastVote(reportID, userID, req, time.Now())
+}
+
+func (mfs *MarkerFacadeService) GetReportVotes(reportID, userID int) (dto.ReportVoteTally, error) {
+	return mfs.VoteService.GetTally(reportID, userID)
+}
@@ -3,6 +3,7 @@ package handler
 import (
 	"bytes"
 	"context"
+	"errors"
 	"image"
 	"image/gif"
 	"image/jpeg"
@@ -10,8 +11,8 @@ import (
 	"mime/multipart"
 	"net/http"
 	"path/filepath"
-	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/Alfex4936/chulbong-kr/dto"
@@ -74,11 +75,29 @@ func RegisterAdminRoutes(api fiber.Router, handler *AdminHandler, authMiddleware
 		adminGroup.Get("/unique-visitors/:date", handler.HandleListVisitors)
 		adminGroup.Get("/s3-list", handler.HandleListS3)
 		adminGroup.Get("/reports-ui", handler.HandleReportAdminPage)
+		adminGroup.Get("/reports/queue", handler.HandleGetReportQueue)
+		adminGroup.Post("/reports/assign", handler.HandleAssignReports)
+		adminGroup.Post("/reports/bulk", handler.HandleDecideReports)
+		adminGroup.Get("/reports/auto-decisions", handler.HandleListAutoDecisions)
+		adminGroup.Post("/reports/auto-decisions/:decisionID/revert", handler.HandleRevertAutoDecision)
+		adminGroup.Get("/reports/reputation/:userID", handler.HandleGetReporterReputation)
+		adminGroup.Post("/markers/:markerID/restore", handler.HandleRestoreMarker)
 
 		adminGroup.Post("/notices", handler.HandleCreateNotice)
 		adminGroup.Delete("/notices/:noticeID", handler.HandleDeleteNotice)
 
 		adminGroup.Delete("/photo", handler.HandleDeletePhoto)
+
+		adminGroup.Get("/chat/bans", handler.HandleListChatBans)
+		adminGroup.Get("/chat/bans/audit", handler.HandleListChatBanAudit)
+		adminGroup.Post("/chat/bans", handler.HandleCreateChatBan)
+		adminGroup.Delete("/chat/bans/:userID", handler.HandleDeleteChatBan)
+		adminGroup.Get("/chat/reports", handler.HandleListChatReports)
+		adminGroup.Put("/chat/slowmode/:markerID", handler.HandleSetChatSlowMode)
+		adminGroup.Post("/chat/mutes", handler.HandleCreateChatMute)
+		adminGroup.Delete("/chat/mutes/:userID", handler.HandleDeleteChatMute)
+		adminGroup.Put("/chat/retention/:markerID", handler.HandleSetChatRetention)
+		adminGroup.Get("/chat/archive/search", handler.HandleSearchChatArchive)
 	}
 }
 
@@ -129,14 +148,11 @@ func (h *AdminHandler) HandleBanUser(c *fiber.Ctx) error {
 
 	// assert duration is sent in the request body as JSON
 	var requestBody struct {
-		DurationInMinutes int `json:"duration"`
+		DurationInMinutes int    `json:"duration"`
+		Reason            string `json:"reason"`
 	}
 	if err := c.BodyParser(&requestBody); err != nil {
-		requestBody = struct {
-			DurationInMinutes int `json:"duration"`
-		}{
-			DurationInMinutes: 5, // default 5 minutes banned
-		}
+		requestBody.DurationInMinutes = 5 // default 5 minutes banned
 		// return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 		// 	"error": "Invalid request format",
 		// })
@@ -151,8 +167,12 @@ func (h *AdminHandler) HandleBanUser(c *fiber.Ctx) error {
 	// Convert duration to time.Duration
 	duration := time.Duration(requestBody.DurationInMinutes) * time.Minute
 
-	// Call the BanUser method on the manager instance
-	err := h.AdminFacade.BanUser(markerID, userID, duration)
+	_, err := h.AdminFacade.BanChatUser(dto.ChatBanRequest{
+		MarkerID:          markerID,
+		UserID:            userID,
+		Reason:            requestBody.Reason,
+		DurationInMinutes: requestBody.DurationInMinutes,
+	}, c.Locals("userID").(int))
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to ban user",
@@ -166,6 +186,142 @@ func (h *AdminHandler) HandleBanUser(c *fiber.Ctx) error {
 	})
 }
 
+func (h *AdminHandler) HandleListChatBans(c *fiber.Ctx) error {
+	bans, err := h.AdminFacade.ListChatBans()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to list bans"})
+	}
+	return c.JSON(bans)
+}
+
+func (h *AdminHandler) HandleCreateChatBan(c *fiber.Ctx) error {
+	var req dto.ChatBanRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request format"})
+	}
+	if req.UserID == "" || (!req.Global && req.MarkerID == "") {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "userId and markerId (or global) are required"})
+	}
+
+	ban, err := h.AdminFacade.BanChatUser(req, c.Locals("userID").(int))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to ban user"})
+	}
+	return c.Status(fiber.StatusCreated).JSON(ban)
+}
+
+// HandleDeleteChatBan lifts a room ban with ?markerID=, the global ban without it
+func (h *AdminHandler) HandleDeleteChatBan(c *fiber.Ctx) error {
+	userID := c.Params("userID")
+	markerID := c.Query("markerID")
+
+	err := h.AdminFacade.UnbanChatUser(markerID, userID, c.Locals("userID").(int))
+	if errors.Is(err, service.ErrChatBanNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to unban user"})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *AdminHandler) HandleListChatBanAudit(c *fiber.Ctx) error {
+	page := c.QueryInt("page", 1)
+	if page < 1 {
+		page = 1
+	}
+
+	audits, err := h.AdminFacade.ListChatBanAudit(page, 50)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load ban audit"})
+	}
+	return c.JSON(audits)
+}
+
+func (h *AdminHandler) HandleListChatReports(c *fiber.Ctx) error {
+	page := c.QueryInt("page", 1)
+	if page < 1 {
+		page = 1
+	}
+
+	reports, err := h.AdminFacade.ListChatReports(page, 50)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load chat reports"})
+	}
+	return c.JSON(reports)
+}
+
+func (h *AdminHandler) HandleSetChatSlowMode(c *fiber.Ctx) error {
+	var req dto.ChatSlowModeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request format"})
+	}
+
+	if err := h.AdminFacade.SetChatSlowMode(c.Params("markerID"), req.Seconds); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to set slow mode"})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// HandleCreateChatMute shadow-mutes a user, their messages are only shown to themselves
+func (h *AdminHandler) HandleCreateChatMute(c *fiber.Ctx) error {
+	var req dto.ChatMuteRequest
+	if err := c.BodyParser(&req); err != nil || req.UserID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request format"})
+	}
+
+	if err := h.AdminFacade.ShadowMuteChatUser(req.UserID, req.DurationInMinutes); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to mute user"})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *AdminHandler) HandleDeleteChatMute(c *fiber.Ctx) error {
+	if err := h.AdminFacade.UnmuteChatUser(c.Params("userID")); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to unmute user"})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *AdminHandler) HandleSetChatRetention(c *fiber.Ctx) error {
+	markerID, err := c.ParamsInt("markerID")
+	if err != nil || markerID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid marker ID"})
+	}
+
+	var req dto.ChatRetentionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request format"})
+	}
+
+	if err := h.AdminFacade.SetChatRetention(markerID, req.Days); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to set chat retention"})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// HandleSearchChatArchive finds archived messages by keyword, ?markerID= narrows it to a room
+func (h *AdminHandler) HandleSearchChatArchive(c *fiber.Ctx) error {
+	keyword := strings.TrimSpace(c.Query("q"))
+	if keyword == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "q is required"})
+	}
+
+	page := c.QueryInt("page", 1)
+	if page < 1 {
+		page = 1
+	}
+
+	messages, err := h.AdminFacade.SearchChatArchive(c.QueryInt("markerID"), keyword, page, 50)
+	if errors.Is(err, service.ErrChatArchiveDisabled) {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to search chat archive"})
+	}
+	return c.JSON(messages)
+}
+
 func (h *AdminHandler) HandleListUpdatedMarkers(c *fiber.Ctx) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
@@ -263,6 +419,7 @@ func (h *AdminHandler) HandleListVisitors(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"date": date, "unique_visitors": count})
 }
 
+// HandleReportAdminPage renders the review queue, the filters are the same query parameters as /admin/reports/queue
 func (h *AdminHandler) HandleReportAdminPage(c *fiber.Ctx) error {
 	// Get the userID from context
 	userID, ok := c.Locals("userID").(int)
@@ -270,59 +427,134 @@ func (h *AdminHandler) HandleReportAdminPage(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
 	}
 
-	// Fetch the reports data
-	reportsData, err := h.UserFacadeService.GetAllReportsForMyMarkersByUser(userID)
+	var filter dto.ReportQueueFilter
+	if err := c.QueryParser(&filter); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString("Invalid filter")
+	}
+
+	queue, err := h.AdminFacade.GetReportQueue(filter, userID)
 	if err != nil {
+		if errors.Is(err, service.ErrInvalidReportQueue) {
+			return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+		}
 		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
 	}
 
-	// Initialize slices for each status
-	type ReportItem struct {
-		MarkerID int
-		Address  string
-		Report   dto.ReportWithPhotos
+	return c.Render("report_admin", fiber.Map{
+		"queue":  queue,
+		"filter": filter,
+		"sla":    service.ReportReviewSLA.Hours(),
+	})
+}
+
+// HandleGetReportQueue lists the reports to review, oldest first
+func (h *AdminHandler) HandleGetReportQueue(c *fiber.Ctx) error {
+	var filter dto.ReportQueueFilter
+	if err := c.QueryParser(&filter); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid filter"})
 	}
 
-	var pendingReports, deniedReports, approvedReports []ReportItem
+	queue, err := h.AdminFacade.GetReportQueue(filter, c.Locals("userID").(int))
+	if err != nil {
+		return reportQueueError(c, err)
+	}
+	return c.JSON(queue)
+}
 
-	// Iterate over markers and their reports
-	for _, marker := range reportsData.Markers {
-		markerID := marker.MarkerID
-		address := marker.Address
-		for _, report := range marker.Reports {
-			item := ReportItem{
-				MarkerID: markerID,
-				Address:  address,
-				Report:   report,
-			}
-			switch report.Status {
-			case "PENDING":
-				pendingReports = append(pendingReports, item)
-			case "DENIED":
-				deniedReports = append(deniedReports, item)
-			case "APPROVED":
-				approvedReports = append(approvedReports, item)
-			}
-		}
+func (h *AdminHandler) HandleAssignReports(c *fiber.Ctx) error {
+	var req dto.ReportAssignRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request format"})
 	}
 
-	// Sort the reports by CreatedAt in descending order within each status group
-	sort.SliceStable(pendingReports, func(i, j int) bool {
-		return pendingReports[i].Report.CreatedAt.After(pendingReports[j].Report.CreatedAt)
-	})
-	sort.SliceStable(deniedReports, func(i, j int) bool {
-		return deniedReports[i].Report.CreatedAt.After(deniedReports[j].Report.CreatedAt)
-	})
-	sort.SliceStable(approvedReports, func(i, j int) bool {
-		return approvedReports[i].Report.CreatedAt.After(approvedReports[j].Report.CreatedAt)
-	})
+	assigneeID := c.Locals("userID").(int)
+	if req.AssigneeID != nil {
+		assigneeID = *req.AssigneeID
+	}
 
-	// Render the template with the grouped reports
-	return c.Render("report_admin", fiber.Map{
-		"pending_reports":  pendingReports,
-		"denied_reports":   deniedReports,
-		"approved_reports": approvedReports,
-	})
+	assigned, err := h.AdminFacade.AssignReports(req.ReportIDs, assigneeID)
+	if err != nil {
+		return reportQueueError(c, err)
+	}
+	return c.JSON(fiber.Map{"updated": assigned})
+}
+
+// HandleDecideReports approves or denies several reports with one reason
+func (h *AdminHandler) HandleDecideReports(c *fiber.Ctx) error {
+	var req dto.ReportBulkRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request format"})
+	}
+
+	result, err := h.AdminFacade.DecideReports(req, c.Locals("userID").(int))
+	if err != nil {
+		return reportQueueError(c, err)
+	}
+	if len(result.Succeeded) > 0 {
+		h.AdminFacade.ResetMarkerCache()
+	}
+	return c.JSON(result)
+}
+
+// HandleListAutoDecisions lists the reports approved and the reporters throttled without a reviewer
+func (h *AdminHandler) HandleListAutoDecisions(c *fiber.Ctx) error {
+	list, err := h.AdminFacade.ListAutoDecisions(c.Query("decision"), c.QueryInt("page", 1), c.QueryInt("pageSize", 20))
+	if err != nil {
+		return reportQueueError(c, err)
+	}
+	return c.JSON(list)
+}
+
+// HandleRevertAutoDecision puts an auto-approved report back in the queue or lifts a throttle
+func (h *AdminHandler) HandleRevertAutoDecision(c *fiber.Ctx) error {
+	decisionID, err := c.ParamsInt("decisionID")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid decision ID"})
+	}
+
+	if err := h.AdminFacade.RevertAutoDecision(decisionID, c.Locals("userID").(int)); err != nil {
+		return reportQueueError(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *AdminHandler) HandleGetReporterReputation(c *fiber.Ctx) error {
+	userID, err := c.ParamsInt("userID")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	reputation, err := h.AdminFacade.GetReporterReputation(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to get reputation"})
+	}
+	return c.JSON(reputation)
+}
+
+// HandleRestoreMarker brings back a marker whose removal was approved by mistake
+func (h *AdminHandler) HandleRestoreMarker(c *fiber.Ctx) error {
+	markerID, err := c.ParamsInt("markerID")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid marker ID"})
+	}
+
+	state, err := h.AdminFacade.RestoreMarker(markerID, c.Locals("userID").(int))
+	if err != nil {
+		return markerStateError(c, err)
+	}
+	return c.JSON(state)
+}
+
+func reportQueueError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidReportQueue):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrAutoDecisionNotFound), errors.Is(err, service.ErrReportNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrAutoDecisionReverted):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to process reports"})
 }
 
 func (h *AdminHandler) HandleEncodeBlurImage(c *fiber.Ctx) error {
@@ -3,8 +3,12 @@ package handler
 import (
 	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"strconv"
 
 	"github.com/Alfex4936/chulbong-kr/dto"
+	"github.com/Alfex4936/chulbong-kr/middleware"
 	"github.com/Alfex4936/chulbong-kr/service"
 	"github.com/Alfex4936/chulbong-kr/util"
 	sonic "github.com/bytedance/sonic"
@@ -18,41 +22,51 @@ import (
 )
 
 type ChatHandler struct {
-	ChatService *service.ChatService
+	ChatService           *service.ChatService
+	ChatAttachmentService *service.ChatAttachmentService
 
 	ChatUtil    *util.ChatUtil
 	BadWordUtil *util.BadWordUtil
 }
 
 // NewChatHandler creates a new ChatHandler with dependencies injected
-func NewChatHandler(chat *service.ChatService, cutil *util.ChatUtil, butil *util.BadWordUtil,
+func NewChatHandler(chat *service.ChatService, attachment *service.ChatAttachmentService, cutil *util.ChatUtil, butil *util.BadWordUtil,
 ) *ChatHandler {
 	return &ChatHandler{
-		ChatService: chat,
-		ChatUtil:    cutil,
-		BadWordUtil: butil,
+		ChatService:           chat,
+		ChatAttachmentService: attachment,
+		ChatUtil:              cutil,
+		BadWordUtil:           butil,
 	}
 }
 
 // RegisterChatRoutes sets up the routes for chat handling within the application.
-func RegisterChatRoutes(api fiber.Router, websocketConfig websocket.Config, handler *ChatHandler) {
-	api.Get("/ws/:markerID", func(c *fiber.Ctx) error {
-		// TODO: update on adding ban feature on admin API in frontend
-		// Extract markerID from the parameter
-		// markerID := c.Params("markerID")
-		// reqID := c.Query("request-id")
-
-		// Use GetBanDetails to check if the user is banned and get the remaining ban time
-		// banned, remainingTime, err := handler.ChatService.GetBanDetails(markerID, reqID)
-		// if err != nil {
-		// 	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Internal server error"})
-		// }
-		// if banned {
-		// 	return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-		// 		"error":         "User is banned",
-		// 		"remainingTime": remainingTime.Seconds(), // Respond with remaining time in seconds
-		// 	})
-		// }
+func RegisterChatRoutes(api fiber.Router, websocketConfig websocket.Config, handler *ChatHandler, authMiddleware *middleware.AuthMiddleware) {
+	api.Get("/chat/:markerID/history", handler.HandleChatHistory)
+	api.Get("/chat/:markerID/presence", handler.HandleChatPresence)
+	api.Post("/chat/:markerID/attachments", handler.HandleChatAttachmentUpload)
+
+	// logged-in users are listed with their account in the presence
+	api.Get("/ws/:markerID", authMiddleware.VerifySoft, func(c *fiber.Ctx) error {
+		markerID := c.Params("markerID")
+		reqID := c.Query("request-id")
+
+		ok, err := handler.ChatService.IsChatRoom(markerID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Internal server error"})
+		}
+		if !ok {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "wrong marker id"})
+		}
+
+		// banned users are still upgraded so the client gets a close frame it can show
+		accountID, _ := c.Locals("userID").(int)
+		ban, err := handler.ChatService.GetActiveBan(markerID, reqID, accountID, c.IP())
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Internal server error"})
+		}
+		c.Locals("chatBan", ban)
+		c.Locals("chatIP", c.IP())
 
 		// Proceed with WebSocket upgrade if not banned
 		if websocket.IsWebSocketUpgrade(c) {
@@ -63,14 +77,25 @@ func RegisterChatRoutes(api fiber.Router, websocketConfig websocket.Config, hand
 		// Extract markerID from the parameter again if necessary
 		markerID := c.Params("markerID")
 		reqID := c.Query("request-id")
+		lastUID := c.Query("last-uid") // set when reconnecting, missed messages are replayed
+
+		if ban, ok := c.Locals("chatBan").(*dto.ChatBan); ok && ban != nil {
+			c.WriteMessage(websocket.CloseMessage, service.BanCloseMessage(ban))
+			c.Close()
+			return
+		}
+
+		accountID, _ := c.Locals("userID").(int)
+		accountName, _ := c.Locals("username").(string)
+		remoteIP, _ := c.Locals("chatIP").(string)
 
 		// Now, the connection is already upgraded to WebSocket, and passed the ban check.
-		handler.HandleChatRoom(c, markerID, reqID)
+		handler.HandleChatRoom(c, markerID, reqID, lastUID, accountID, accountName, remoteIP)
 	}, websocketConfig))
 }
 
 // HandleChatRoomHandler manages chat rooms and messaging
-func (h *ChatHandler) HandleChatRoom(c *websocket.Conn, markerID, reqID string) {
+func (h *ChatHandler) HandleChatRoom(c *websocket.Conn, markerID, reqID, lastUID string, accountID int, accountName, remoteIP string) {
 	// clientID := c.Locals("userID").(int)
 	// clientNickname := c.Locals("username").(string)
 	if markerID == "" || strings.Contains(markerID, "&") {
@@ -97,8 +122,7 @@ func (h *ChatHandler) HandleChatRoom(c *websocket.Conn, markerID, reqID string)
 		c.Close()
 		return
 	}
-
-	// services.AddConnectionRoomToRedis(markerID, clientID, clientNickname) // saves to redis, "room:%s:connections"
+	conn.Identify(accountID, remoteIP)
 
 	defer func() {
 		// Get the nickname before removing the connection
@@ -106,12 +130,13 @@ func (h *ChatHandler) HandleChatRoom(c *websocket.Conn, markerID, reqID string)
 
 		// Remove the client from the room
 		h.ChatService.RemoveWsFromRoom(markerID, clientID)
+		h.ChatService.RemoveConnectionFromRedis(markerID, clientID)
 
 		if err == nil {
 			// Broadcast leave message after removing the connection
-			h.ChatService.BroadcastMessageToRoom(markerID, nickname+" 님이 퇴장하셨습니다.", nickname, clientID)
+			h.ChatService.BroadcastPresence(markerID, clientID, nickname, dto.ChatPresenceLeave)
 			// Broadcast updated user count
-			h.ChatService.BroadcastUserCountToRoomByLocal(markerID)
+			h.ChatService.BroadcastUserCountToRoom(markerID)
 		}
 	}()
 
@@ -123,7 +148,7 @@ func (h *ChatHandler) HandleChatRoom(c *websocket.Conn, markerID, reqID string)
 	// After saving the connection and broadcasting the join message
 	// Retrieve recent messages
 	ctx := context.Background()
-	messages, err := h.ChatService.GetRecentMessages(ctx, markerID)
+	messages, err := h.ChatService.GetMessagesAfter(ctx, markerID, lastUID)
 	if err != nil {
 		// Handle error
 	} else {
@@ -143,11 +168,12 @@ func (h *ChatHandler) HandleChatRoom(c *websocket.Conn, markerID, reqID string)
 		}
 	}
 
+	// saves to redis, "room:%s:connections", so every instance can list who is here
+	h.ChatService.JoinPresence(markerID, conn, accountID, accountName)
+
 	// Broadcast join message
-	// broadcasts directly by app memory objects
-	// services.PublishMessageToAMQP(context.Background(), markerID, clientNickname+" 님이 입장하셨습니다.", clientNickname, clientID)
-	h.ChatService.BroadcastMessageToRoom(markerID, clientNickname+" 님이 입장하셨습니다.", clientNickname, clientID)
-	h.ChatService.BroadcastUserCountToRoomByLocal(markerID) // sends how many users in the room
+	h.ChatService.BroadcastPresence(markerID, clientID, clientNickname, dto.ChatPresenceJoin)
+	h.ChatService.BroadcastUserCountToRoom(markerID) // sends how many users in the room
 
 	for {
 		if err := c.SetReadDeadline(time.Now().Add(time.Second * 60)); err != nil {
@@ -173,39 +199,227 @@ func (h *ChatHandler) HandleChatRoom(c *websocket.Conn, markerID, reqID string)
 			continue
 		}
 
-		// Then, replace bad words with asterisks in the message string
-		cleanMessage, err := h.BadWordUtil.ReplaceBadWordsInBytes(message)
-		if len(cleanMessage) == 0 && err != nil {
-			// log.Printf("Error replacing bad words: %v", err)
-			continue
+		// bans set while connected, possibly on another instance
+		if ban, err := h.ChatService.GetActiveBan(markerID, clientID, conn.AccountID, conn.RemoteIP); err == nil && ban != nil {
+			h.ChatService.KickBanned(markerID, clientID, ban)
+			break
 		}
 
-		// log.Printf("❤️ received message: %v", cleanMessage)
-
-		// Publish the valid message to the RabbitMQ queue for this chat room
-		// services.PublishMessageToAMQP(context.Background(), markerID, cleanMessage, clientNickname, clientID)
+		frame, ok := parseChatFrame(message)
+		if !ok {
+			// plain text frames from older clients
+			frame = dto.ChatClientFrame{Kind: dto.ChatKindChat, Message: util.BytesToString(message)}
+		}
 
 		// Broadcast received message
 		h.ChatService.UpdateLastPing(markerID, clientID)
 
-		// Create the broadcast message
-		broadcastMsg := dto.BroadcastMessage{
-			UID:          xid.New().String(),
-			Message:      util.BytesToString(cleanMessage),
-			UserID:       clientID,
-			UserNickname: clientNickname,
-			RoomID:       markerID,
-			Timestamp:    time.Now().UnixMilli(),
+		if frame.Kind != dto.ChatKindTyping {
+			if err := h.ChatService.AllowFrame(markerID, conn); err != nil {
+				h.ChatService.Ack(markerID, clientID, frame.UID, err.Error())
+				continue
+			}
 		}
 
-		// Save the message to Redis
-		if err := h.ChatService.SaveMessageToRedis(ctx, broadcastMsg); err != nil {
-			// Handle error
+		switch frame.Kind {
+		case dto.ChatKindChat:
+			h.handleChatFrame(ctx, conn, markerID, clientNickname, frame)
+		case dto.ChatKindTyping:
+			h.ChatService.Typing(markerID, conn)
+		case dto.ChatKindEdit:
+			text, ok := h.cleanText(frame.Message)
+			if !ok {
+				h.ChatService.Ack(markerID, clientID, frame.TargetUID, service.ErrInvalidChatFrame.Error())
+				continue
+			}
+			_, err := h.ChatService.EditMessage(ctx, markerID, conn, frame.TargetUID, text)
+			h.ack(markerID, clientID, frame.TargetUID, err)
+		case dto.ChatKindDelete:
+			_, err := h.ChatService.DeleteMessage(ctx, markerID, conn, frame.TargetUID)
+			h.ack(markerID, clientID, frame.TargetUID, err)
+		case dto.ChatKindReaction:
+			_, err := h.ChatService.ReactToMessage(ctx, markerID, clientID, clientNickname, frame.TargetUID, frame.Reaction)
+			h.ack(markerID, clientID, frame.TargetUID, err)
+		case dto.ChatKindReport:
+			err := h.ChatService.ReportMessage(ctx, markerID, conn, frame.TargetUID, frame.Message)
+			h.ack(markerID, clientID, frame.TargetUID, err)
+		default:
+			h.ChatService.Ack(markerID, clientID, frame.UID, service.ErrInvalidChatFrame.Error())
 		}
+	}
+}
 
-		// Broadcast the message
-		if err := h.ChatService.BroadcastMessageToRoomByDTO(broadcastMsg); err != nil {
-			break
+// HandleChatHistory pages back through a room's messages, ?before= takes the nextBefore of the previous page
+func (h *ChatHandler) HandleChatHistory(c *fiber.Ctx) error {
+	markerID, err := c.ParamsInt("markerID")
+	if err != nil || markerID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid marker ID"})
+	}
+
+	limit := c.QueryInt("limit", 50)
+	if limit < 1 || limit > 100 {
+		limit = 50
+	}
+
+	history, err := h.ChatService.GetChatHistory(c.Context(), markerID, c.Query("before"), limit)
+	if errors.Is(err, service.ErrChatMessageNotFound) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Unknown before cursor"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load chat history"})
+	}
+	return c.JSON(history)
+}
+
+// HandleChatPresence lists who is in the room on every instance
+func (h *ChatHandler) HandleChatPresence(c *fiber.Ctx) error {
+	markerID, err := c.ParamsInt("markerID")
+	if err != nil || markerID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid marker ID"})
+	}
+
+	users, err := h.ChatService.GetPresence(c.Context(), strconv.Itoa(markerID))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load presence"})
+	}
+	return c.JSON(fiber.Map{"users": users, "count": len(users)})
+}
+
+// HandleChatAttachmentUpload uploads a photo, ?request-id= is the one of the chat connection.
+// The photo is posted by sending the returned attachmentId in a chat frame.
+func (h *ChatHandler) HandleChatAttachmentUpload(c *fiber.Ctx) error {
+	markerID, err := c.ParamsInt("markerID")
+	if err != nil || markerID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid marker ID"})
+	}
+	reqID := c.Query("request-id")
+	if reqID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "request-id is required"})
+	}
+
+	file, err := c.FormFile("image")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "image is required"})
+	}
+
+	upload, err := h.ChatAttachmentService.Upload(c.Context(), strconv.Itoa(markerID), reqID, file)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrChatImageTooLarge):
+			return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, service.ErrChatNotImage):
+			return c.Status(fiber.StatusUnsupportedMediaType).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, service.ErrChatNotInRoom):
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, service.ErrChatRateLimited):
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"error": err.Error()})
+		default:
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to upload image"})
+		}
+	}
+	return c.Status(fiber.StatusCreated).JSON(upload)
+}
+
+// handleChatFrame moderates and broadcasts a chat message, a resent uid is only acked again
+func (h *ChatHandler) handleChatFrame(ctx context.Context, conn *service.ChulbongConn, markerID, clientNickname string, frame dto.ChatClientFrame) {
+	clientID := conn.UserID
+
+	uid := frame.UID
+	if _, err := xid.FromString(uid); err != nil {
+		uid = xid.New().String()
+	} else if !h.ChatService.ClaimMessageUID(uid) {
+		h.ChatService.Ack(markerID, clientID, uid, "")
+		return
+	}
+
+	text, ok := h.cleanText(frame.Message)
+	if !ok && frame.AttachmentID == "" && frame.Location == nil {
+		return
+	}
+
+	// photos and pins are moderated like text, repeats are told apart by the photo or the spot
+	moderated := text
+	var location *dto.ChatLocation
+	switch {
+	case frame.AttachmentID != "":
+		moderated += "\x00" + frame.AttachmentID
+	case frame.Location != nil:
+		var err error
+		location, err = h.ChatAttachmentService.CheckLocation(*frame.Location)
+		if err != nil {
+			h.ChatService.Ack(markerID, clientID, uid, err.Error())
+			return
+		}
+		location.Label, _ = h.cleanText(location.Label)
+		moderated += fmt.Sprintf("\x00%.5f,%.5f", location.Latitude, location.Longitude)
+	}
+
+	muted, err := h.ChatService.ModerateChat(ctx, markerID, conn, moderated)
+	if err != nil {
+		h.ChatService.Ack(markerID, clientID, uid, err.Error())
+		return
+	}
+
+	var attachment *dto.ChatAttachment
+	if frame.AttachmentID != "" {
+		attachment, err = h.ChatAttachmentService.Claim(ctx, markerID, clientID, frame.AttachmentID)
+		if err != nil {
+			h.ChatService.Ack(markerID, clientID, uid, err.Error())
+			return
 		}
 	}
+
+	// Create the broadcast message
+	broadcastMsg := service.NewChatEvent(dto.ChatKindChat, markerID, clientID, clientNickname, service.ChatMessageText(text, attachment, location))
+	broadcastMsg.UID = uid
+	broadcastMsg.Attachment = attachment
+	broadcastMsg.Location = location
+
+	if muted {
+		// shadow-muted, looks sent to the sender and nobody else sees it
+		h.ChatService.SendToClient(markerID, clientID, broadcastMsg)
+		h.ChatService.Ack(markerID, clientID, uid, "")
+		return
+	}
+
+	// Save to Redis and broadcast the message
+	if err := h.ChatService.SendUserChatMessage(ctx, conn, broadcastMsg); err != nil {
+		h.ChatService.Ack(markerID, clientID, uid, err.Error())
+		return
+	}
+	h.ChatService.Ack(markerID, clientID, uid, "")
+}
+
+// cleanText trims the text and replaces bad words with asterisks
+func (h *ChatHandler) cleanText(text string) (string, bool) {
+	trimmed := bytes.TrimSpace([]byte(text))
+	if len(trimmed) == 0 {
+		return "", false
+	}
+
+	cleanMessage, err := h.BadWordUtil.ReplaceBadWordsInBytes(trimmed)
+	if len(cleanMessage) == 0 && err != nil {
+		return "", false
+	}
+	return util.BytesToString(cleanMessage), true
+}
+
+func (h *ChatHandler) ack(markerID, clientID, targetUID string, err error) {
+	if err != nil {
+		h.ChatService.Ack(markerID, clientID, targetUID, err.Error())
+		return
+	}
+	h.ChatService.Ack(markerID, clientID, targetUID, "")
+}
+
+// parseChatFrame reads a typed frame, anything else is treated as plain text
+func parseChatFrame(message []byte) (dto.ChatClientFrame, bool) {
+	var frame dto.ChatClientFrame
+	if len(message) == 0 || message[0] != '{' {
+		return frame, false
+	}
+	if err := sonic.Unmarshal(message, &frame); err != nil || frame.Kind == "" {
+		return frame, false
+	}
+	return frame, true
 }
@@ -0,0 +1,572 @@
+//go:build loadtest
+
+package handler
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// fakeRedis speaks enough RESP3 for the chat path so the load test measures this server and not a Redis on the network.
+// Keys are typed by whichever of str, hash, set or zset is set, expiry is checked when a key is read.
+type fakeRedis struct {
+	ln       net.Listener
+	mu       sync.Mutex
+	data     map[string]*fakeRedisValue
+	commands atomic.Int64
+}
+
+type fakeRedisValue struct {
+	str      *string
+	hash     map[string]string
+	set      map[string]struct{}
+	zset     map[string]float64
+	expireAt time.Time
+}
+
+var errFakeRedisWrongType = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+
+func newFakeRedis() (*fakeRedis, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	r := &fakeRedis{ln: ln, data: make(map[string]*fakeRedisValue)}
+	go r.serve()
+	return r, nil
+}
+
+func (r *fakeRedis) Addr() string { return r.ln.Addr().String() }
+
+func (r *fakeRedis) Close() error { return r.ln.Close() }
+
+func (r *fakeRedis) serve() {
+	for {
+		conn, err := r.ln.Accept()
+		if err != nil {
+			return
+		}
+		go r.handle(conn)
+	}
+}
+
+func (r *fakeRedis) handle(conn net.Conn) {
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+	bw := bufio.NewWriter(conn)
+
+	for {
+		args, err := readRESPCommand(br)
+		if err != nil {
+			return
+		}
+		r.commands.Add(1)
+		r.exec(bw, args)
+		// rueidis pipelines, flush once the pipelined commands are answered
+		if br.Buffered() == 0 {
+			if err := bw.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func readRESPCommand(br *bufio.Reader) ([]string, error) {
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[0] != '*' {
+		return nil, fmt.Errorf("unexpected %q", line)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		if line[0] != '$' {
+			return nil, fmt.Errorf("unexpected %q", line)
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(br, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+// lookup returns a live key, expired ones are deleted. The caller holds mu.
+func (r *fakeRedis) lookup(key string) *fakeRedisValue {
+	v, ok := r.data[key]
+	if !ok {
+		return nil
+	}
+	if !v.expireAt.IsZero() && time.Now().After(v.expireAt) {
+		delete(r.data, key)
+		return nil
+	}
+	return v
+}
+
+func (r *fakeRedis) exec(w *bufio.Writer, args []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cmd := strings.ToUpper(args[0])
+	args = args[1:]
+	switch cmd {
+	case "HELLO":
+		fmt.Fprint(w, "%3\r\n")
+		writeBulk(w, "server")
+		writeBulk(w, "redis")
+		writeBulk(w, "version")
+		writeBulk(w, "7.2.0")
+		writeBulk(w, "proto")
+		writeInt(w, 3)
+	case "PING":
+		fmt.Fprint(w, "+PONG\r\n")
+	case "CLIENT", "SELECT":
+		fmt.Fprint(w, "+OK\r\n")
+
+	case "GET":
+		v := r.lookup(args[0])
+		if v == nil || v.str == nil {
+			writeNull(w)
+			return
+		}
+		writeBulk(w, *v.str)
+	case "GETDEL":
+		v := r.lookup(args[0])
+		if v == nil || v.str == nil {
+			writeNull(w)
+			return
+		}
+		delete(r.data, args[0])
+		writeBulk(w, *v.str)
+	case "MGET":
+		fmt.Fprintf(w, "*%d\r\n", len(args))
+		for _, key := range args {
+			if v := r.lookup(key); v != nil && v.str != nil {
+				writeBulk(w, *v.str)
+			} else {
+				writeNull(w)
+			}
+		}
+	case "SET":
+		r.set(w, args)
+	case "INCR":
+		v := r.lookup(args[0])
+		n := int64(0)
+		if v != nil && v.str != nil {
+			n, _ = strconv.ParseInt(*v.str, 10, 64)
+		}
+		n++
+		s := strconv.FormatInt(n, 10)
+		if v == nil {
+			r.data[args[0]] = &fakeRedisValue{str: &s}
+		} else {
+			v.str = &s
+		}
+		writeInt(w, n)
+	case "DEL":
+		deleted := 0
+		for _, key := range args {
+			if r.lookup(key) != nil {
+				delete(r.data, key)
+				deleted++
+			}
+		}
+		writeInt(w, int64(deleted))
+	case "EXISTS":
+		found := 0
+		for _, key := range args {
+			if r.lookup(key) != nil {
+				found++
+			}
+		}
+		writeInt(w, int64(found))
+	case "EXPIRE", "PEXPIRE":
+		v := r.lookup(args[0])
+		if v == nil || (len(args) > 2 && strings.EqualFold(args[2], "NX") && !v.expireAt.IsZero()) {
+			writeInt(w, 0)
+			return
+		}
+		n, _ := strconv.ParseInt(args[1], 10, 64)
+		unit := time.Second
+		if cmd == "PEXPIRE" {
+			unit = time.Millisecond
+		}
+		v.expireAt = time.Now().Add(time.Duration(n) * unit)
+		writeInt(w, 1)
+	case "PTTL", "TTL":
+		v := r.lookup(args[0])
+		switch {
+		case v == nil:
+			writeInt(w, -2)
+		case v.expireAt.IsZero():
+			writeInt(w, -1)
+		case cmd == "PTTL":
+			writeInt(w, time.Until(v.expireAt).Milliseconds())
+		default:
+			writeInt(w, int64(time.Until(v.expireAt).Seconds()))
+		}
+
+	case "HSET":
+		v, err := r.hash(args[0], true)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		added := 0
+		for i := 1; i+1 < len(args); i += 2 {
+			if _, ok := v.hash[args[i]]; !ok {
+				added++
+			}
+			v.hash[args[i]] = args[i+1]
+		}
+		writeInt(w, int64(added))
+	case "HGET":
+		v, _ := r.hash(args[0], false)
+		if v == nil {
+			writeNull(w)
+			return
+		}
+		value, ok := v.hash[args[1]]
+		if !ok {
+			writeNull(w)
+			return
+		}
+		writeBulk(w, value)
+	case "HDEL":
+		v, _ := r.hash(args[0], false)
+		deleted := 0
+		if v != nil {
+			for _, field := range args[1:] {
+				if _, ok := v.hash[field]; ok {
+					delete(v.hash, field)
+					deleted++
+				}
+			}
+			if len(v.hash) == 0 {
+				delete(r.data, args[0])
+			}
+		}
+		writeInt(w, int64(deleted))
+	case "HEXISTS":
+		v, _ := r.hash(args[0], false)
+		if v == nil {
+			writeInt(w, 0)
+			return
+		}
+		_, ok := v.hash[args[1]]
+		writeInt(w, boolInt(ok))
+	case "HLEN":
+		v, _ := r.hash(args[0], false)
+		if v == nil {
+			writeInt(w, 0)
+			return
+		}
+		writeInt(w, int64(len(v.hash)))
+	case "HGETALL":
+		v, _ := r.hash(args[0], false)
+		if v == nil {
+			fmt.Fprint(w, "%0\r\n")
+			return
+		}
+		fmt.Fprintf(w, "%%%d\r\n", len(v.hash))
+		for field, value := range v.hash {
+			writeBulk(w, field)
+			writeBulk(w, value)
+		}
+
+	case "SADD":
+		v := r.lookup(args[0])
+		if v == nil {
+			v = &fakeRedisValue{set: make(map[string]struct{})}
+			r.data[args[0]] = v
+		}
+		added := 0
+		for _, member := range args[1:] {
+			if _, ok := v.set[member]; !ok {
+				v.set[member] = struct{}{}
+				added++
+			}
+		}
+		writeInt(w, int64(added))
+	case "SREM":
+		v := r.lookup(args[0])
+		removed := 0
+		if v != nil && v.set != nil {
+			for _, member := range args[1:] {
+				if _, ok := v.set[member]; ok {
+					delete(v.set, member)
+					removed++
+				}
+			}
+		}
+		writeInt(w, int64(removed))
+	case "SMEMBERS":
+		v := r.lookup(args[0])
+		if v == nil || v.set == nil {
+			fmt.Fprint(w, "~0\r\n")
+			return
+		}
+		fmt.Fprintf(w, "~%d\r\n", len(v.set))
+		for member := range v.set {
+			writeBulk(w, member)
+		}
+
+	case "ZADD":
+		v := r.lookup(args[0])
+		if v == nil {
+			v = &fakeRedisValue{zset: make(map[string]float64)}
+			r.data[args[0]] = v
+		}
+		added := 0
+		for i := 1; i+1 < len(args); i += 2 {
+			score, _ := strconv.ParseFloat(args[i], 64)
+			if _, ok := v.zset[args[i+1]]; !ok {
+				added++
+			}
+			v.zset[args[i+1]] = score
+		}
+		writeInt(w, int64(added))
+	case "ZCARD":
+		v := r.lookup(args[0])
+		if v == nil {
+			writeInt(w, 0)
+			return
+		}
+		writeInt(w, int64(len(v.zset)))
+	case "ZREM":
+		v := r.lookup(args[0])
+		removed := 0
+		if v != nil {
+			for _, member := range args[1:] {
+				if _, ok := v.zset[member]; ok {
+					delete(v.zset, member)
+					removed++
+				}
+			}
+		}
+		writeInt(w, int64(removed))
+	case "ZRANGEBYSCORE", "ZREVRANGEBYSCORE", "ZREMRANGEBYSCORE":
+		r.zrangeByScore(w, cmd, args)
+	case "ZRANGE", "ZREMRANGEBYRANK":
+		members := r.sortedMembers(args[0])
+		start, _ := strconv.Atoi(args[1])
+		stop, _ := strconv.Atoi(args[2])
+		if start < 0 {
+			start = max(0, len(members)+start)
+		}
+		if stop < 0 {
+			stop = len(members) + stop
+		}
+		stop = min(stop, len(members)-1)
+		if start > stop {
+			members = nil
+		} else {
+			members = members[start : stop+1]
+		}
+		if cmd == "ZRANGE" {
+			writeArray(w, members)
+			return
+		}
+		if v := r.lookup(args[0]); v != nil {
+			for _, member := range members {
+				delete(v.zset, member)
+			}
+		}
+		writeInt(w, int64(len(members)))
+
+	case "SCAN":
+		fmt.Fprint(w, "*2\r\n")
+		writeBulk(w, "0")
+		keys := make([]string, 0, len(r.data))
+		for key := range r.data {
+			keys = append(keys, key)
+		}
+		writeArray(w, keys)
+	case "PUBLISH":
+		writeInt(w, 0)
+	case "GEOADD":
+		writeInt(w, 0)
+	default:
+		writeError(w, fmt.Errorf("ERR unknown command '%s'", cmd))
+	}
+}
+
+func (r *fakeRedis) set(w *bufio.Writer, args []string) {
+	key, value := args[0], args[1]
+	v := r.lookup(key)
+
+	var expireAt time.Time
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			if v != nil {
+				writeNull(w)
+				return
+			}
+		case "XX":
+			if v == nil {
+				writeNull(w)
+				return
+			}
+		case "EX", "PX":
+			n, _ := strconv.ParseInt(args[i+1], 10, 64)
+			unit := time.Second
+			if strings.EqualFold(args[i], "PX") {
+				unit = time.Millisecond
+			}
+			expireAt = time.Now().Add(time.Duration(n) * unit)
+			i++
+		}
+	}
+	r.data[key] = &fakeRedisValue{str: &value, expireAt: expireAt}
+	fmt.Fprint(w, "+OK\r\n")
+}
+
+func (r *fakeRedis) hash(key string, create bool) (*fakeRedisValue, error) {
+	v := r.lookup(key)
+	if v == nil {
+		if !create {
+			return nil, nil
+		}
+		v = &fakeRedisValue{hash: make(map[string]string)}
+		r.data[key] = v
+	}
+	if v.hash == nil {
+		return nil, errFakeRedisWrongType
+	}
+	return v, nil
+}
+
+// sortedMembers lists a sorted set by score then member like Redis does
+func (r *fakeRedis) sortedMembers(key string) []string {
+	v := r.lookup(key)
+	if v == nil {
+		return nil
+	}
+	members := make([]string, 0, len(v.zset))
+	for member := range v.zset {
+		members = append(members, member)
+	}
+	slices.SortFunc(members, func(a, b string) int {
+		if v.zset[a] != v.zset[b] {
+			if v.zset[a] < v.zset[b] {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a, b)
+	})
+	return members
+}
+
+func (r *fakeRedis) zrangeByScore(w *bufio.Writer, cmd string, args []string) {
+	lo, hi := args[1], args[2]
+	if cmd == "ZREVRANGEBYSCORE" {
+		lo, hi = hi, lo
+	}
+	low, lowExclusive := parseScoreBound(lo)
+	high, highExclusive := parseScoreBound(hi)
+
+	v := r.lookup(args[0])
+	var members []string
+	for _, member := range r.sortedMembers(args[0]) {
+		score := v.zset[member]
+		if score < low || (lowExclusive && score == low) || score > high || (highExclusive && score == high) {
+			continue
+		}
+		members = append(members, member)
+	}
+
+	switch cmd {
+	case "ZREMRANGEBYSCORE":
+		for _, member := range members {
+			delete(v.zset, member)
+		}
+		writeInt(w, int64(len(members)))
+		return
+	case "ZREVRANGEBYSCORE":
+		slices.Reverse(members)
+	}
+
+	// LIMIT offset count
+	for i := 3; i+2 < len(args); i++ {
+		if strings.EqualFold(args[i], "LIMIT") {
+			offset, _ := strconv.Atoi(args[i+1])
+			count, _ := strconv.Atoi(args[i+2])
+			offset = min(offset, len(members))
+			members = members[offset:]
+			if count >= 0 && count < len(members) {
+				members = members[:count]
+			}
+		}
+	}
+	writeArray(w, members)
+}
+
+func parseScoreBound(s string) (float64, bool) {
+	switch s {
+	case "-inf":
+		return math.Inf(-1), false
+	case "+inf", "inf":
+		return math.Inf(1), false
+	}
+	exclusive := strings.HasPrefix(s, "(")
+	f, _ := strconv.ParseFloat(strings.TrimPrefix(s, "("), 64)
+	return f, exclusive
+}
+
+func writeBulk(w *bufio.Writer, s string) {
+	fmt.Fprintf(w, "$%d\r\n%s\r\n", len(s), s)
+}
+
+func writeInt(w *bufio.Writer, n int64) {
+	fmt.Fprintf(w, ":%d\r\n", n)
+}
+
+func writeNull(w *bufio.Writer) {
+	fmt.Fprint(w, "_\r\n")
+}
+
+func writeError(w *bufio.Writer, err error) {
+	fmt.Fprintf(w, "-%s\r\n", err)
+}
+
+func writeArray(w *bufio.Writer, items []string) {
+	fmt.Fprintf(w, "*%d\r\n", len(items))
+	for _, item := range items {
+		writeBulk(w, item)
+	}
+}
+
+func boolInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,385 @@
+//go:build loadtest
+
+package handler
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Alfex4936/chulbong-kr/config"
+	"github.com/Alfex4936/chulbong-kr/dto"
+	"github.com/Alfex4936/chulbong-kr/middleware"
+	"github.com/Alfex4936/chulbong-kr/service"
+	"github.com/Alfex4936/chulbong-kr/util"
+	sonic "github.com/bytedance/sonic"
+	fastws "github.com/fasthttp/websocket"
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/rueidis"
+	"github.com/rs/xid"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+)
+
+// Run with
+//
+//	go test -tags loadtest -run TestChatLoad -timeout 30m ./handler/ -args -load.clients=5000 -load.duration=10m
+//
+// Every client sends in turn so the rate is spread over all of them, keep it under one message per second
+// per client or the flood limit rejects frames (they're reported, not counted as dropped).
+var (
+	loadClients     = flag.Int("load.clients", 2000, "websocket clients")
+	loadRooms       = flag.Int("load.rooms", 20, "rooms the clients are spread over")
+	loadRate        = flag.Float64("load.rate", 200, "chat messages per second over all clients")
+	loadDuration    = flag.Duration("load.duration", 30*time.Second, "how long messages are sent, soak with minutes")
+	loadCheckEvery  = flag.Duration("load.check-every", 5*time.Second, "how often connections are checked and memory sampled")
+	loadMaxDropRate = flag.Float64("load.max-drop", 0.001, "fraction of deliveries that can be lost before the test fails")
+)
+
+const (
+	loadMessagePrefix = "load|"
+	loadLeakSlack     = 50 // goroutines of the server and the Redis client that may still be winding down
+)
+
+type loadClient struct {
+	id   string
+	room string
+	conn *fastws.Conn
+	mu   sync.Mutex // one writer at a time, the sender and the pinger share the connection
+
+	latencies []time.Duration // only the read loop touches it until it returns
+	done      chan struct{}
+}
+
+type loadStats struct {
+	sent      atomic.Int64
+	accepted  atomic.Int64 // acked without error
+	rejected  atomic.Int64 // flood limit, moderation
+	delivered atomic.Int64
+	expected  atomic.Int64 // accepted messages times the clients in the room
+	sendErrs  atomic.Int64
+}
+
+type loadSample struct {
+	at         time.Duration
+	goroutines int
+	heap       uint64
+}
+
+func TestChatLoad(t *testing.T) {
+	logger := zap.NewNop()
+
+	redis, err := newFakeRedis()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+
+	client, err := rueidis.NewClient(rueidis.ClientOption{InitAddress: []string{redis.Addr()}, DisableCache: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	redisService := &service.RedisService{Core: &service.RedisClient{Client: client}}
+
+	lifecycle := fxtest.NewLifecycle(t)
+	manager := service.NewRoomConnectionManager(lifecycle)
+	archive := service.NewChatArchiveService(lifecycle, nil, &config.ChatConfig{}, logger)
+	chat := service.NewChatService(lifecycle, newFakeMarkerDB(), redisService, manager, service.NewInProcessChatBroker(), archive, logger)
+	attachment := service.NewChatAttachmentService(redisService, nil, chat, nil, logger)
+	chatHandler := NewChatHandler(chat, attachment, util.NewChatUtil(http.DefaultClient), util.NewBadWordUtil())
+	lifecycle.RequireStart()
+	defer lifecycle.RequireStop()
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	RegisterChatRoutes(app, websocket.Config{HandshakeTimeout: 5 * time.Second}, chatHandler,
+		&middleware.AuthMiddleware{Config: &config.AppConfig{LoginTokenCookie: "token"}})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go app.Listener(ln)
+	defer app.Shutdown()
+
+	baseline := sampleRuntime(0)
+
+	// connect
+	var stats loadStats
+	clients := make([]*loadClient, *loadClients)
+	roomSize := make(map[string]int64) // read by every read loop, filled before they start
+	for i := range clients {
+		clients[i] = &loadClient{id: xid.New().String(), room: strconv.Itoa(i%*loadRooms + 1), done: make(chan struct{})}
+		roomSize[clients[i].room]++
+	}
+
+	connectStart := time.Now()
+	{
+		sem := make(chan struct{}, 64)
+		var wg sync.WaitGroup
+		var failed atomic.Int64
+		for _, c := range clients {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func() {
+				defer wg.Done()
+				defer func() { <-sem }()
+
+				url := fmt.Sprintf("ws://%s/ws/%s?request-id=%s", ln.Addr(), c.room, c.id)
+				conn, _, err := fastws.DefaultDialer.Dial(url, nil)
+				if err != nil {
+					failed.Add(1)
+					close(c.done)
+					return
+				}
+				c.conn = conn
+				go c.readLoop(&stats, roomSize)
+			}()
+		}
+		wg.Wait()
+		if n := failed.Load(); n > 0 {
+			t.Fatalf("%d of %d clients failed to connect", n, len(clients))
+		}
+	}
+	connectTime := time.Since(connectStart)
+
+	// every client has to be in the room before messages count as expected
+	waitFor(t, 30*time.Second, func() bool {
+		n, _ := chat.GetUserCountInRoomByLocal("1")
+		return int64(n) == roomSize["1"]
+	})
+	connected := sampleRuntime(time.Since(connectStart))
+
+	// send
+	ctx, cancel := context.WithTimeout(context.Background(), *loadDuration)
+	defer cancel()
+
+	samples := []loadSample{baseline, connected}
+	var samplesMu sync.Mutex
+	go func() {
+		ticker := time.NewTicker(*loadCheckEvery)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				manager.CheckConnections()
+				samplesMu.Lock()
+				samples = append(samples, sampleRuntime(time.Since(connectStart)))
+				samplesMu.Unlock()
+			}
+		}
+	}()
+
+	go func() {
+		ticker := time.NewTicker(20 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				for _, c := range clients {
+					c.write([]byte(`{"type":"ping"}`))
+				}
+			}
+		}
+	}()
+
+	sendStart := time.Now()
+	sendMessages(ctx, clients, &stats)
+	sendTime := time.Since(sendStart)
+
+	// drain, stop once nothing arrived for a second
+	last := stats.delivered.Load()
+	for deadline := time.Now().Add(15 * time.Second); time.Now().Before(deadline); {
+		time.Sleep(time.Second)
+		now := stats.delivered.Load()
+		if now == last {
+			break
+		}
+		last = now
+	}
+	samplesMu.Lock()
+	samples = append(samples, sampleRuntime(time.Since(connectStart)))
+	samplesMu.Unlock()
+
+	// disconnect, every connection's goroutines should be gone
+	for _, c := range clients {
+		c.conn.Close()
+	}
+	for _, c := range clients {
+		<-c.done
+	}
+	waitFor(t, 30*time.Second, func() bool {
+		n, _ := chat.GetUserCountInRoomByLocal("1")
+		return n == 0
+	})
+	// idle fasthttp workers are let go after 10 seconds
+	var closed loadSample
+	for deadline := time.Now().Add(30 * time.Second); time.Now().Before(deadline); time.Sleep(time.Second) {
+		closed = sampleRuntime(time.Since(connectStart))
+		if closed.goroutines-baseline.goroutines <= loadLeakSlack {
+			break
+		}
+	}
+
+	var latencies []time.Duration
+	for _, c := range clients {
+		latencies = append(latencies, c.latencies...)
+	}
+	slices.Sort(latencies)
+
+	expected, delivered := stats.expected.Load(), stats.delivered.Load()
+	dropped := max(0, expected-delivered)
+	dropRate := 0.0
+	if expected > 0 {
+		dropRate = float64(dropped) / float64(expected)
+	}
+
+	var report strings.Builder
+	fmt.Fprintf(&report, "clients %d in %d rooms, connected in %s\n", len(clients), len(roomSize), connectTime.Round(time.Millisecond))
+	fmt.Fprintf(&report, "sent %d over %s (%.1f/s), accepted %d, rejected %d, unacked %d, write errors %d\n",
+		stats.sent.Load(), sendTime.Round(time.Millisecond), float64(stats.sent.Load())/sendTime.Seconds(),
+		stats.accepted.Load(), stats.rejected.Load(), stats.sent.Load()-stats.accepted.Load()-stats.rejected.Load(), stats.sendErrs.Load())
+	fmt.Fprintf(&report, "deliveries expected %d, delivered %d, dropped %d (%.4f%%)\n", expected, delivered, dropped, dropRate*100)
+	fmt.Fprintf(&report, "latency p50 %s p90 %s p99 %s p99.9 %s max %s\n",
+		percentile(latencies, 0.50), percentile(latencies, 0.90), percentile(latencies, 0.99), percentile(latencies, 0.999), percentile(latencies, 1))
+	fmt.Fprintf(&report, "redis commands %d\n", redis.commands.Load())
+	fmt.Fprintf(&report, "%10s %10s %10s\n", "at", "goroutines", "heap MiB")
+	for _, s := range append(samples, closed) {
+		fmt.Fprintf(&report, "%10s %10d %10.1f\n", s.at.Round(time.Second), s.goroutines, float64(s.heap)/(1<<20))
+	}
+	t.Log("\n" + report.String())
+
+	if dropRate > *loadMaxDropRate {
+		t.Errorf("dropped %.4f%% of deliveries, more than %.4f%%", dropRate*100, *loadMaxDropRate*100)
+	}
+	if leaked := closed.goroutines - baseline.goroutines; leaked > loadLeakSlack {
+		t.Errorf("%d goroutines left after every client disconnected", leaked)
+	}
+}
+
+// sendMessages spreads rate messages per second over the clients in turn until ctx is done
+func sendMessages(ctx context.Context, clients []*loadClient, stats *loadStats) {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	start := time.Now()
+	var sent int64
+	next := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			due := int64(now.Sub(start).Seconds() * *loadRate)
+			for ; sent < due; sent++ {
+				c := clients[next]
+				next = (next + 1) % len(clients)
+
+				frame, _ := sonic.Marshal(dto.ChatClientFrame{
+					Version: dto.ChatProtocolVersion,
+					Kind:    dto.ChatKindChat,
+					UID:     xid.New().String(),
+					Message: loadMessagePrefix + strconv.FormatInt(time.Now().UnixNano(), 10) + "|" + strconv.FormatInt(sent, 10),
+				})
+				stats.sent.Add(1)
+				go func() {
+					if err := c.write(frame); err != nil {
+						stats.sendErrs.Add(1)
+					}
+				}()
+			}
+		}
+	}
+}
+
+func (c *loadClient) write(payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return c.conn.WriteMessage(fastws.TextMessage, payload)
+}
+
+func (c *loadClient) readLoop(stats *loadStats, roomSize map[string]int64) {
+	defer close(c.done)
+	for {
+		_, payload, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		received := time.Now()
+
+		var event dto.BroadcastMessage
+		if err := sonic.Unmarshal(payload, &event); err != nil {
+			continue
+		}
+		switch event.Kind {
+		case dto.ChatKindAck:
+			if event.Error != "" {
+				stats.rejected.Add(1)
+				continue
+			}
+			stats.accepted.Add(1)
+			stats.expected.Add(roomSize[c.room])
+		case dto.ChatKindChat:
+			sentAt, ok := parseLoadMessage(event.Message)
+			if !ok {
+				continue // replayed from before the run
+			}
+			stats.delivered.Add(1)
+			c.latencies = append(c.latencies, received.Sub(sentAt))
+		}
+	}
+}
+
+func parseLoadMessage(message string) (time.Time, bool) {
+	rest, ok := strings.CutPrefix(message, loadMessagePrefix)
+	if !ok {
+		return time.Time{}, false
+	}
+	nanos, _, _ := strings.Cut(rest, "|")
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, n), true
+}
+
+func sampleRuntime(at time.Duration) loadSample {
+	runtime.GC()
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return loadSample{at: at, goroutines: runtime.NumGoroutine(), heap: m.HeapAlloc}
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(float64(len(sorted)-1) * p)
+	return sorted[i].Round(time.Microsecond)
+}
+
+func waitFor(t *testing.T, timeout time.Duration, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(timeout); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatalf("timed out after %s", timeout)
+}
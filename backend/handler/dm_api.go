@@ -0,0 +1,239 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/Alfex4936/chulbong-kr/dto"
+	"github.com/Alfex4936/chulbong-kr/middleware"
+	"github.com/Alfex4936/chulbong-kr/service"
+	"github.com/Alfex4936/chulbong-kr/util"
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/xid"
+)
+
+type DirectMessageHandler struct {
+	DirectMessageService *service.DirectMessageService
+
+	BadWordUtil *util.BadWordUtil
+}
+
+// NewDirectMessageHandler creates a new DirectMessageHandler with dependencies injected
+func NewDirectMessageHandler(dm *service.DirectMessageService, butil *util.BadWordUtil,
+) *DirectMessageHandler {
+	return &DirectMessageHandler{
+		DirectMessageService: dm,
+		BadWordUtil:          butil,
+	}
+}
+
+// RegisterDirectMessageRoutes sets up the routes for direct messages, the websocket lives outside /api/v1 like the chat one.
+func RegisterDirectMessageRoutes(app *fiber.App, api fiber.Router, websocketConfig websocket.Config, handler *DirectMessageHandler, authMiddleware *middleware.AuthMiddleware) {
+	app.Get("/ws/dm", authMiddleware.Verify, func(c *fiber.Ctx) error {
+		if websocket.IsWebSocketUpgrade(c) {
+			return c.Next()
+		}
+		return fiber.ErrUpgradeRequired
+	}, websocket.New(func(c *websocket.Conn) {
+		userID, ok := c.Locals("userID").(int)
+		if !ok {
+			c.WriteJSON(dto.SimpleErrorResponse{Error: "wrong user id"})
+			c.Close()
+			return
+		}
+		username, _ := c.Locals("username").(string)
+		handler.HandleDirectSocket(c, userID, username)
+	}, websocketConfig))
+
+	dmGroup := api.Group("/dm")
+	{
+		dmGroup.Use(authMiddleware.Verify)
+		dmGroup.Get("/conversations", handler.HandleGetConversations)
+		dmGroup.Get("/conversations/:conversationID/messages", handler.HandleGetMessages)
+		dmGroup.Post("/conversations/:conversationID/read", handler.HandleMarkRead)
+		dmGroup.Get("/unread", handler.HandleUnreadCount)
+		dmGroup.Get("/blocks", handler.HandleGetBlocks)
+		dmGroup.Post("/blocks/:userID", handler.HandleBlock)
+		dmGroup.Delete("/blocks/:userID", handler.HandleUnblock)
+		dmGroup.Post("/:userID", handler.HandleSendDirectMessage)
+	}
+}
+
+// HandleDirectSocket only pushes events to the user, messages are sent over REST
+func (h *DirectMessageHandler) HandleDirectSocket(c *websocket.Conn, userID int, username string) {
+	connID := xid.New().String() // one user can be connected from several devices
+
+	conn, err := h.DirectMessageService.Connect(userID, connID, username, c)
+	if err != nil || conn == nil {
+		c.WriteJSON(dto.SimpleErrorResponse{Error: "Failed to save connection"})
+		c.Close()
+		return
+	}
+	defer h.DirectMessageService.Disconnect(userID, connID)
+
+	for {
+		if err := c.SetReadDeadline(time.Now().Add(time.Second * 60)); err != nil {
+			break
+		}
+		_, message, err := c.ReadMessage()
+		if err != nil {
+			break
+		}
+
+		if bytes.Equal(message, []byte(`{"type":"ping"}`)) {
+			h.DirectMessageService.Ping(userID, connID)
+		}
+	}
+}
+
+func (h *DirectMessageHandler) HandleSendDirectMessage(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
+	recipientID, err := strconv.Atoi(c.Params("userID"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	var req dto.DirectMessageRequest
+	if err := util.JsonBodyParser(c, &req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	body, err := h.BadWordUtil.ReplaceBadWordsInBytes(bytes.TrimSpace([]byte(req.Body)))
+	if len(body) == 0 && err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": service.ErrInvalidDirectMessage.Error()})
+	}
+
+	message, err := h.DirectMessageService.Send(userID, recipientID, string(body))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidDirectMessage), errors.Is(err, service.ErrDirectToSelf):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, service.ErrUserNotFound):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+		case errors.Is(err, service.ErrDirectBlocked):
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+		default:
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to send message"})
+		}
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(message)
+}
+
+func (h *DirectMessageHandler) HandleGetConversations(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
+
+	page := c.QueryInt("page", 1)
+	if page < 1 {
+		page = 1
+	}
+	pageSize := c.QueryInt("pageSize", 20)
+	if pageSize < 1 || pageSize > 50 {
+		pageSize = 20
+	}
+
+	conversations, err := h.DirectMessageService.Conversations(userID, page, pageSize)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load conversations"})
+	}
+	return c.JSON(conversations)
+}
+
+// HandleGetMessages pages back through a conversation, ?before= takes the oldest messageId of the previous page
+func (h *DirectMessageHandler) HandleGetMessages(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
+	conversationID, err := strconv.ParseInt(c.Params("conversationID"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid conversation ID"})
+	}
+
+	before, _ := strconv.ParseInt(c.Query("before"), 10, 64)
+	limit := c.QueryInt("limit", 50)
+	if limit < 1 || limit > 100 {
+		limit = 50
+	}
+
+	messages, err := h.DirectMessageService.Messages(userID, conversationID, before, limit)
+	if errors.Is(err, service.ErrConversationNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Conversation not found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load messages"})
+	}
+	return c.JSON(messages)
+}
+
+func (h *DirectMessageHandler) HandleMarkRead(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
+	conversationID, err := strconv.ParseInt(c.Params("conversationID"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid conversation ID"})
+	}
+
+	var req dto.DirectReadRequest
+	if err := util.JsonBodyParser(c, &req); err != nil || req.MessageID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	err = h.DirectMessageService.MarkRead(userID, conversationID, req.MessageID)
+	if errors.Is(err, service.ErrConversationNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Conversation not found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to mark conversation as read"})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *DirectMessageHandler) HandleUnreadCount(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
+
+	count, err := h.DirectMessageService.UnreadCount(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to count unread messages"})
+	}
+	return c.JSON(fiber.Map{"unread": count})
+}
+
+func (h *DirectMessageHandler) HandleGetBlocks(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
+
+	blocks, err := h.DirectMessageService.Blocks(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load blocked users"})
+	}
+	return c.JSON(blocks)
+}
+
+func (h *DirectMessageHandler) HandleBlock(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
+	blockedID, err := strconv.Atoi(c.Params("userID"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	err = h.DirectMessageService.Block(userID, blockedID)
+	if errors.Is(err, service.ErrDirectToSelf) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to block user"})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *DirectMessageHandler) HandleUnblock(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
+	blockedID, err := strconv.Atoi(c.Params("userID"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	if err := h.DirectMessageService.Unblock(userID, blockedID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to unblock user"})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
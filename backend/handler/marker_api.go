@@ -60,6 +60,7 @@ func RegisterMarkerRoutes(api fiber.Router, handler *MarkerHandler, authMiddlewa
 
 	api.Get("/markers/:markerId/details", authMiddleware.VerifySoft, handler.HandleGetMarker)
 	api.Get("/markers/:markerID/facilities", handler.HandleGetFacilities)
+	api.Get("/markers/:markerID/states", handler.HandleGetMarkerStateHistory)
 	api.Get("/markers/close", handler.HandleFindCloseMarkers)
 	api.Get("/markers/ranking", handler.HandleGetMarkerRanking)
 	api.Get("/markers/unique-ranking", handler.HandleGetUniqueVisitorCount)
@@ -101,6 +102,10 @@ func RegisterMarkerRoutes(api fiber.Router, handler *MarkerHandler, authMiddlewa
 	api.Get("/markers/stories", handler.HandleGetAllStories)
 	api.Get("/markers/:markerID/stories", handler.HandleGetStories)
 
+	api.Get("/markers/:markerID/meetups", authMiddleware.VerifySoft, handler.HandleGetMeetups)
+	api.Get("/markers/meetups/:meetupID", authMiddleware.VerifySoft, handler.HandleGetMeetup)
+	api.Get("/markers/meetups/:meetupID/calendar.ics", handler.HandleMeetupICS)
+
 	markerGroup := api.Group("/markers")
 	{
 		markerGroup.Use(authMiddleware.Verify)
@@ -115,6 +120,7 @@ func RegisterMarkerRoutes(api fiber.Router, handler *MarkerHandler, authMiddlewa
 		markerGroup.Post("/facilities", handler.HandleSetMarkerFacilities)
 		markerGroup.Post("/:markerID/dislike", handler.HandleLeaveDislike)
 		markerGroup.Post("/:markerID/favorites", handler.HandleAddFavorite)
+		markerGroup.Post("/:markerID/confirm", handler.HandleConfirmMarker)
 
 		markerGroup.Put("/:markerID", handler.HandleUpdateMarker)
 
@@ -128,15 +134,39 @@ func RegisterMarkerRoutes(api fiber.Router, handler *MarkerHandler, authMiddlewa
 		markerGroup.Post("/stories/:storyID/reactions", handler.HandleAddReaction)
 		markerGroup.Delete("/stories/:storyID/reactions", handler.HandleRemoveReaction)
 		markerGroup.Post("/stories/:storyID/report", handler.HandleReportStory)
+
+		// Meetup routes
+		markerGroup.Post("/:markerID/meetups", handler.HandleCreateMeetup)
+		markerGroup.Post("/meetups/:meetupID/rsvp", handler.HandleRSVPMeetup)
+		markerGroup.Delete("/meetups/:meetupID/rsvp", handler.HandleCancelRSVP)
+		markerGroup.Delete("/meetups/:meetupID", handler.HandleCancelMeetup)
 	}
 }
 
 func (h *MarkerHandler) HandleGetAllMarkersProto(c *fiber.Ctx) error {
+	states, err := service.ParseMarkerStates(c.Query("state"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
 	markers, err := h.MarkerFacadeService.GetAllMarkersProto()
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 
+	if len(states) > 0 {
+		filtered := make([]*protos.Marker, 0, len(markers))
+		for _, marker := range markers {
+			for _, state := range states {
+				if marker.GetState() == state {
+					filtered = append(filtered, marker)
+					break
+				}
+			}
+		}
+		markers = filtered
+	}
+
 	markerList := &protos.MarkerList{
 		Markers: markers,
 	}
@@ -167,6 +197,19 @@ func (h *MarkerHandler) HandleGetAllMarkersLocal(c *fiber.Ctx) error {
 	// }
 	c.Set("Content-type", "application/json")
 
+	// Filtered lists skip the cache which only holds the full list
+	states, err := service.ParseMarkerStates(c.Query("state"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if len(states) > 0 {
+		markers, err := h.MarkerFacadeService.GetAllMarkersByState(states)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to get markers"})
+		}
+		return c.JSON(markers)
+	}
+
 	// Attempt to fetch cached data first
 	cached, _ := h.CacheService.GetAllMarkers() // from Redis, on error will proceed to fetch from DB
 	if len(cached) > 0 {
@@ -197,6 +240,23 @@ func (h *MarkerHandler) HandleGetAllMarkersLocal(c *fiber.Ctx) error {
 }
 
 func (h *MarkerHandler) HandleGetAllMarkersLocalMsgp(c *fiber.Ctx) error {
+	states, err := service.ParseMarkerStates(c.Query("state"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if len(states) > 0 {
+		markers, err := h.MarkerFacadeService.GetAllMarkersByState(states)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to get markers"})
+		}
+		markersBin, err := dto.MarkerSimpleSlice(markers).MarshalMsg(nil)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to encode markers"})
+		}
+		c.Set("Content-type", "application/json")
+		return c.Send(markersBin)
+	}
+
 	cached := h.MarkerFacadeService.GetMarkerCache()
 	c.Set("Content-type", "application/json")
 
@@ -276,9 +336,14 @@ func (h *MarkerHandler) HandleGetMarker(c *fiber.Ctx) error {
 		}
 	}
 
+	meetups, err := h.MarkerFacadeService.MeetupService.GetUpcomingMeetups(markerID, userID)
+	if err != nil {
+		meetups = []dto.Meetup{} // the marker is still worth showing
+	}
+
 	go h.MarkerFacadeService.BufferClickEvent(markerID)
 	// go h.MarkerFacadeService.SaveUniqueVisitor(c.Params("markerId"), c)
-	return c.JSON(marker)
+	return c.JSON(dto.MarkerDetails{MarkerWithPhotos: marker, Meetups: meetups})
 }
 
 // ADMIN
@@ -584,6 +649,48 @@ func (h *MarkerHandler) HandleRemoveFavorite(c *fiber.Ctx) error {
 	return c.SendStatus(fiber.StatusNoContent) // 204 No Content is appropriate for a DELETE success with no response body
 }
 
+// HandleConfirmMarker records that the user found the marker in place, it verifies a marker someone else created
+func (h *MarkerHandler) HandleConfirmMarker(c *fiber.Ctx) error {
+	markerID, err := strconv.Atoi(c.Params("markerID"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid marker ID"})
+	}
+
+	state, err := h.MarkerFacadeService.ConfirmMarker(markerID, c.Locals("userID").(int))
+	if err != nil {
+		return markerStateError(c, err)
+	}
+	return c.JSON(state)
+}
+
+func (h *MarkerHandler) HandleGetMarkerStateHistory(c *fiber.Ctx) error {
+	markerID, err := strconv.Atoi(c.Params("markerID"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid marker ID"})
+	}
+
+	history, err := h.MarkerFacadeService.GetMarkerStateHistory(markerID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to get marker states"})
+	}
+	return c.JSON(history)
+}
+
+func markerStateError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, service.ErrMarkerOwnConfirm):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrMarkerNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrMarkerNotRemoved):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrMarkerRemoved):
+		return c.Status(fiber.StatusGone).JSON(fiber.Map{"error": err.Error()})
+	default:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update marker state"})
+	}
+}
+
 // GetFacilitiesHandler handles requests to get facilities by marker ID.
 func (h *MarkerHandler) HandleGetFacilities(c *fiber.Ctx) error {
 	markerID, err := strconv.Atoi(c.Params("markerID"))
@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Alfex4936/chulbong-kr/dto"
+	"github.com/Alfex4936/chulbong-kr/service"
+	"github.com/Alfex4936/chulbong-kr/util"
+	"github.com/gofiber/fiber/v2"
+)
+
+func (h *MarkerHandler) HandleGetMeetups(c *fiber.Ctx) error {
+	markerID, err := strconv.Atoi(c.Params("markerID"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid marker ID"})
+	}
+	userID, _ := c.Locals("userID").(int)
+
+	meetups, err := h.MarkerFacadeService.MeetupService.GetUpcomingMeetups(markerID, userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load meetups"})
+	}
+	return c.JSON(meetups)
+}
+
+func (h *MarkerHandler) HandleGetMeetup(c *fiber.Ctx) error {
+	meetupID, err := strconv.ParseInt(c.Params("meetupID"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid meetup ID"})
+	}
+	userID, _ := c.Locals("userID").(int)
+
+	meetup, err := h.MarkerFacadeService.MeetupService.GetMeetup(meetupID, userID)
+	if err != nil {
+		return meetupError(c, err, "Failed to load meetup")
+	}
+	return c.JSON(meetup)
+}
+
+// HandleMeetupICS lets users add a meetup to their calendar
+func (h *MarkerHandler) HandleMeetupICS(c *fiber.Ctx) error {
+	meetupID, err := strconv.ParseInt(c.Params("meetupID"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid meetup ID"})
+	}
+
+	meetup, err := h.MarkerFacadeService.MeetupService.GetMeetup(meetupID, 0)
+	if err != nil {
+		return meetupError(c, err, "Failed to load meetup")
+	}
+
+	c.Set(fiber.HeaderContentType, "text/calendar; charset=utf-8")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="meetup-%d.ics"`, meetupID))
+	return c.Send(service.MeetupICS(meetup, time.Now()))
+}
+
+func (h *MarkerHandler) HandleCreateMeetup(c *fiber.Ctx) error {
+	markerID, err := strconv.Atoi(c.Params("markerID"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid marker ID"})
+	}
+	userID := c.Locals("userID").(int)
+
+	var req dto.MeetupRequest
+	if err := util.JsonBodyParser(c, &req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	req.Title, _ = h.MarkerFacadeService.BadWordUtil.ReplaceBadWords(req.Title)
+	req.Description, _ = h.MarkerFacadeService.BadWordUtil.ReplaceBadWords(req.Description)
+
+	meetup, err := h.MarkerFacadeService.MeetupService.CreateMeetup(markerID, userID, req)
+	if err != nil {
+		if errors.Is(err, service.ErrMarkerNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Marker not found"})
+		}
+		return meetupError(c, err, "Failed to create meetup")
+	}
+	return c.Status(fiber.StatusCreated).JSON(meetup)
+}
+
+func (h *MarkerHandler) HandleRSVPMeetup(c *fiber.Ctx) error {
+	meetupID, err := strconv.ParseInt(c.Params("meetupID"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid meetup ID"})
+	}
+	userID := c.Locals("userID").(int)
+
+	meetup, err := h.MarkerFacadeService.MeetupService.RSVP(meetupID, userID)
+	if err != nil {
+		return meetupError(c, err, "Failed to RSVP")
+	}
+	return c.JSON(meetup)
+}
+
+func (h *MarkerHandler) HandleCancelRSVP(c *fiber.Ctx) error {
+	meetupID, err := strconv.ParseInt(c.Params("meetupID"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid meetup ID"})
+	}
+	userID := c.Locals("userID").(int)
+
+	meetup, err := h.MarkerFacadeService.MeetupService.CancelRSVP(meetupID, userID)
+	if err != nil {
+		return meetupError(c, err, "Failed to cancel RSVP")
+	}
+	return c.JSON(meetup)
+}
+
+func (h *MarkerHandler) HandleCancelMeetup(c *fiber.Ctx) error {
+	meetupID, err := strconv.ParseInt(c.Params("meetupID"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid meetup ID"})
+	}
+	userID := c.Locals("userID").(int)
+	userRole, _ := c.Locals("role").(string)
+
+	if err := h.MarkerFacadeService.MeetupService.CancelMeetup(meetupID, userID, userRole); err != nil {
+		if errors.Is(err, service.ErrUnauthorized) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "You are not authorized to cancel this meetup"})
+		}
+		return meetupError(c, err, "Failed to cancel meetup")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func meetupError(c *fiber.Ctx, err error, fallback string) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidMeetup):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrMeetupNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Meetup not found"})
+	case errors.Is(err, service.ErrMeetupFull), errors.Is(err, service.ErrMeetupClosed),
+		errors.Is(err, service.ErrMeetupCreatorRSVP):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrMeetupLimit):
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"error": err.Error()})
+	default:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fallback})
+	}
+}
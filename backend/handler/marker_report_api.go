@@ -25,6 +25,9 @@ func RegisterReportRoutes(api fiber.Router, handler *MarkerHandler, authMiddlewa
 		reportGroup.Post("/approve/:reportID", authMiddleware.Verify, handler.HandleApproveReport)
 		reportGroup.Post("/deny/:reportID", authMiddleware.Verify, handler.HandleDenyReport)
 
+		reportGroup.Get("/:reportID/votes", authMiddleware.VerifySoft, handler.HandleGetReportVotes)
+		reportGroup.Post("/:reportID/votes", authMiddleware.Verify, handler.HandleVoteReport)
+
 		reportGroup.Delete("", authMiddleware.Verify, handler.HandleDeleteReport)
 
 	}
@@ -148,6 +151,14 @@ func (h *MarkerHandler) HandleCreateReport(c *fiber.Ctx) error {
 		var response dto.SimpleErrorResponse
 
 		switch {
+		case errors.Is(err, service.ErrReportThrottled):
+			status = fiber.StatusTooManyRequests
+			response = dto.SimpleErrorResponse{Error: err.Error()}
+
+		case errors.Is(err, service.ErrReportEvidenceRequired):
+			status = fiber.StatusUnprocessableEntity
+			response = dto.SimpleErrorResponse{Error: err.Error()}
+
 		case errors.Is(err, service.ErrNoPhotos):
 			status = fiber.StatusConflict
 			response = dto.SimpleErrorResponse{Error: "upload at least one photo"}
@@ -181,12 +192,62 @@ func (h *MarkerHandler) HandleApproveReport(c *fiber.Ctx) error {
 	userID, _ := c.Locals("userID").(int)
 
 	if err := h.MarkerFacadeService.ApproveReport(reportID, userID); err != nil {
+		if errors.Is(err, service.ErrReportNotPending) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Unable to approve report"})
 	}
 
 	return c.SendStatus(fiber.StatusOK)
 }
 
+// HandleVoteReport votes a pending report up or down, the report is settled once enough users agree
+func (h *MarkerHandler) HandleVoteReport(c *fiber.Ctx) error {
+	reportID, err := strconv.Atoi(c.Params("reportID"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid report ID"})
+	}
+
+	var req dto.ReportVoteRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request format"})
+	}
+
+	tally, err := h.MarkerFacadeService.VoteReport(reportID, c.Locals("userID").(int), req)
+	if err != nil {
+		return reportVoteError(c, err)
+	}
+	return c.JSON(tally)
+}
+
+func (h *MarkerHandler) HandleGetReportVotes(c *fiber.Ctx) error {
+	reportID, err := strconv.Atoi(c.Params("reportID"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid report ID"})
+	}
+
+	userID, _ := c.Locals("userID").(int) // userID will be 0 if not logged in
+	tally, err := h.MarkerFacadeService.GetReportVotes(reportID, userID)
+	if err != nil {
+		return reportVoteError(c, err)
+	}
+	return c.JSON(tally)
+}
+
+func reportVoteError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidReportVote), errors.Is(err, service.ErrReportOwnVote):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrReportVoteNotAllowed):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrReportNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrReportNotPending):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Unable to vote on report"})
+}
+
 // HandleDenyReport updates the status of a report to 'DENIED'
 func (h *MarkerHandler) HandleDenyReport(c *fiber.Ctx) error {
 	reportID, err := strconv.Atoi(c.Params("reportID"))
@@ -196,6 +257,9 @@ func (h *MarkerHandler) HandleDenyReport(c *fiber.Ctx) error {
 	userID, _ := c.Locals("userID").(int)
 
 	if err := h.MarkerFacadeService.DenyReport(reportID, userID); err != nil {
+		if errors.Is(err, service.ErrReportNotPending) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Unable to deny report"})
 	}
 
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"errors"
 	"log"
 	"strconv"
 
@@ -15,14 +16,17 @@ import (
 )
 
 type NotificationHandler struct {
-	NotiService *service.NotificationService
+	NotiService    *service.NotificationService
+	WebPushService *service.WebPushService
 }
 
 // NewNotificationHandler creates a new NotificationHandler with dependencies injected
 func NewNotificationHandler(notification *service.NotificationService,
+	webPush *service.WebPushService,
 ) *NotificationHandler {
 	return &NotificationHandler{
-		NotiService: notification,
+		NotiService:    notification,
+		WebPushService: webPush,
 	}
 }
 
@@ -39,9 +43,9 @@ func RegisterNotificationRoutes(api fiber.Router, websocketConfig websocket.Conf
 		if id, ok := c.Locals("userID").(int); ok {
 			// Convert integer userID to string if it exists and is valid
 			userID = strconv.Itoa(id)
-		} else {
-			// anonymous users
-			userID = c.Query("request-id")
+		} else if reqID := c.Query("request-id"); reqID != "" {
+			// anonymous users only get broadcasts
+			userID = service.AnonymousNotificationID(reqID)
 		}
 
 		if userID == "" {
@@ -54,6 +58,33 @@ func RegisterNotificationRoutes(api fiber.Router, websocketConfig websocket.Conf
 	}, websocketConfig))
 
 	api.Post("/notification", authMiddleware.CheckAdmin, handler.PostNotificationHandler)
+	api.Get("/notification/preferences", authMiddleware.Verify, handler.HandleGetNotificationPreferences)
+	api.Put("/notification/preferences", authMiddleware.Verify, handler.HandleSetNotificationPreferences)
+
+	inbox := api.Group("/notification/inbox", authMiddleware.Verify)
+	{
+		inbox.Get("/", handler.HandleGetInbox)
+		inbox.Get("/unread-count", handler.HandleGetUnreadCount)
+		inbox.Post("/read-all", handler.HandleMarkAllRead)
+		inbox.Post("/bulk", handler.HandleBulkNotifications)
+		inbox.Post("/:notificationID/read", handler.handleNotificationAction(service.NotificationActionRead))
+		inbox.Post("/:notificationID/archive", handler.handleNotificationAction(service.NotificationActionArchive))
+		inbox.Delete("/:notificationID/archive", handler.handleNotificationAction(service.NotificationActionUnarchive))
+		inbox.Delete("/:notificationID", handler.handleNotificationAction(service.NotificationActionDelete))
+	}
+
+	broadcasts := api.Group("/notification/broadcasts", authMiddleware.CheckAdmin)
+	{
+		broadcasts.Get("/", handler.HandleListBroadcasts)
+		broadcasts.Post("/", handler.HandleCreateBroadcast)
+		broadcasts.Post("/audience", handler.HandleCountBroadcastAudience)
+		broadcasts.Get("/:broadcastID", handler.HandleGetBroadcast)
+		broadcasts.Delete("/:broadcastID", handler.HandleCancelBroadcast)
+	}
+
+	api.Get("/notification/push/key", handler.HandleGetPushKey)
+	api.Post("/notification/push/subscriptions", authMiddleware.Verify, handler.HandleSubscribePush)
+	api.Delete("/notification/push/subscriptions", authMiddleware.Verify, handler.HandleUnsubscribePush)
 }
 
 // PostNotificationHandler handles POST requests to send notifications
@@ -74,9 +105,180 @@ func (h *NotificationHandler) PostNotificationHandler(c *fiber.Ctx) error {
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Notification posted successfully"})
 }
 
+// HandleGetNotificationPreferences lists the user's channels for each notification type, quiet hours and email mode
+func (h *NotificationHandler) HandleGetNotificationPreferences(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
+
+	settings, err := h.NotiService.GetNotificationSettings(userID)
+	if err != nil {
+		log.Printf("Error fetching notification preferences: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to get notification preferences"})
+	}
+	return c.JSON(settings)
+}
+
+// HandleSetNotificationPreferences saves the user's notification settings
+func (h *NotificationHandler) HandleSetNotificationPreferences(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
+
+	var settings notification.NotificationSettings
+	if err := c.BodyParser(&settings); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Bad request"})
+	}
+
+	if err := h.NotiService.SetNotificationSettings(userID, settings); err != nil {
+		if errors.Is(err, service.ErrInvalidNotificationType) || errors.Is(err, service.ErrInvalidNotificationSettings) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		log.Printf("Error saving notification preferences: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save notification preferences"})
+	}
+
+	settings, err := h.NotiService.GetNotificationSettings(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to get notification preferences"})
+	}
+	return c.JSON(settings)
+}
+
+// HandleGetInbox pages through the user's notifications, ?box= is inbox (default), unread or archived
+func (h *NotificationHandler) HandleGetInbox(c *fiber.Ctx) error {
+	userID := strconv.Itoa(c.Locals("userID").(int))
+
+	page := c.QueryInt("page", 1)
+	if page < 1 {
+		page = 1
+	}
+	pageSize := c.QueryInt("pageSize", 20)
+	if pageSize < 1 || pageSize > 50 {
+		pageSize = 20
+	}
+
+	inbox, err := h.NotiService.GetInbox(userID, c.Query("box"), page, pageSize)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidNotificationAction) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		log.Printf("Error fetching notification inbox: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to get notifications"})
+	}
+	return c.JSON(inbox)
+}
+
+func (h *NotificationHandler) HandleGetUnreadCount(c *fiber.Ctx) error {
+	userID := strconv.Itoa(c.Locals("userID").(int))
+
+	count, err := h.NotiService.UnreadCount(userID)
+	if err != nil {
+		log.Printf("Error counting unread notifications: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to count notifications"})
+	}
+	return c.JSON(fiber.Map{"unreadCount": count})
+}
+
+func (h *NotificationHandler) HandleMarkAllRead(c *fiber.Ctx) error {
+	userID := strconv.Itoa(c.Locals("userID").(int))
+
+	updated, err := h.NotiService.MarkAllRead(userID)
+	if err != nil {
+		log.Printf("Error marking notifications read: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to mark notifications read"})
+	}
+	return c.JSON(fiber.Map{"updated": updated})
+}
+
+// HandleBulkNotifications reads, archives, unarchives or deletes up to 100 notifications at once
+func (h *NotificationHandler) HandleBulkNotifications(c *fiber.Ctx) error {
+	userID := strconv.Itoa(c.Locals("userID").(int))
+
+	var req notification.NotificationBulkRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Bad request"})
+	}
+
+	updated, err := h.NotiService.UpdateNotifications(userID, req.Action, req.IDs)
+	if err != nil && !errors.Is(err, service.ErrNotificationNotFound) {
+		return notificationActionError(c, err)
+	}
+	return c.JSON(fiber.Map{"updated": updated})
+}
+
+// handleNotificationAction applies the action to the notification in the path
+func (h *NotificationHandler) handleNotificationAction(action string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := strconv.Itoa(c.Locals("userID").(int))
+		notificationID, err := strconv.ParseInt(c.Params("notificationID"), 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid notification ID"})
+		}
+
+		if _, err := h.NotiService.UpdateNotifications(userID, action, []int64{notificationID}); err != nil {
+			return notificationActionError(c, err)
+		}
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+func notificationActionError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, service.ErrNotificationNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidNotificationAction):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	log.Printf("Error updating notifications: %v", err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update notifications"})
+}
+
+// HandleGetPushKey returns the VAPID public key browsers subscribe with
+func (h *NotificationHandler) HandleGetPushKey(c *fiber.Ctx) error {
+	if !h.WebPushService.Enabled() {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": service.ErrWebPushDisabled.Error()})
+	}
+	return c.JSON(fiber.Map{"publicKey": h.WebPushService.PublicKey()})
+}
+
+// HandleSubscribePush saves the PushSubscription of the user's browser
+func (h *NotificationHandler) HandleSubscribePush(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
+
+	var sub notification.PushSubscription
+	if err := c.BodyParser(&sub); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Bad request"})
+	}
+
+	if err := h.WebPushService.Subscribe(userID, sub); err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidPushSubscription):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, service.ErrWebPushDisabled):
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": err.Error()})
+		}
+		log.Printf("Error saving push subscription: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save push subscription"})
+	}
+	return c.SendStatus(fiber.StatusCreated)
+}
+
+// HandleUnsubscribePush removes a browser's subscription, the body only needs the endpoint
+func (h *NotificationHandler) HandleUnsubscribePush(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
+
+	var sub notification.PushSubscription
+	if err := c.BodyParser(&sub); err != nil || sub.Endpoint == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "endpoint is required"})
+	}
+
+	if err := h.WebPushService.Unsubscribe(userID, sub.Endpoint); err != nil {
+		log.Printf("Error deleting push subscription: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete push subscription"})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
 // user id can be anonymous too. it should check auth and if authenticated, use cookie value as userID
 func (h *NotificationHandler) WsNotificationHandler(c *websocket.Conn, userID string) {
-	// Fetch unviewed notifications at the start of the WebSocket connection
+	// Fetch the notifications sent while the user was away at the start of the WebSocket connection
 	unviewedNotifications, err := h.NotiService.GetNotifications(userID)
 	if err != nil {
 		log.Printf("Error fetching unviewed notifications: %v", err)
@@ -93,8 +295,8 @@ func (h *NotificationHandler) WsNotificationHandler(c *websocket.Conn, userID st
 			continue
 		}
 
-		// Mark notifications as viewed based on their type
-		h.NotiService.MarkNotificationAsViewed(notification.NotificationId, notification.NotificationType, userID)
+		// delivered isn't read, it stays unread in the inbox
+		h.NotiService.MarkNotificationDelivered(notification.NotificationId, userID)
 	}
 
 	// Subscribe to Redis on a per-connection basis
@@ -105,7 +307,7 @@ func (h *NotificationHandler) WsNotificationHandler(c *websocket.Conn, userID st
 		} else {
 			var notification notification.NotificationRedis
 			sonic.Unmarshal([]byte(msg.Message), &notification)
-			h.NotiService.MarkNotificationAsViewed(notification.NotificationId, notification.NotificationType, userID)
+			h.NotiService.MarkNotificationDelivered(notification.NotificationId, userID)
 		}
 	})
 
@@ -141,3 +343,88 @@ func (h *NotificationHandler) WsNotificationHandler(c *websocket.Conn, userID st
 	// 	}
 	// }
 }
+
+func (h *NotificationHandler) HandleListBroadcasts(c *fiber.Ctx) error {
+	page := c.QueryInt("page", 1)
+	if page < 1 {
+		page = 1
+	}
+	pageSize := c.QueryInt("pageSize", 20)
+	if pageSize < 1 || pageSize > 50 {
+		pageSize = 20
+	}
+
+	list, err := h.NotiService.ListBroadcasts(page, pageSize)
+	if err != nil {
+		log.Printf("Error fetching broadcasts: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to get broadcasts"})
+	}
+	return c.JSON(list)
+}
+
+func (h *NotificationHandler) HandleCreateBroadcast(c *fiber.Ctx) error {
+	adminID := c.Locals("userID").(int)
+
+	var req notification.BroadcastRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Bad request"})
+	}
+
+	broadcast, err := h.NotiService.CreateBroadcast(adminID, req)
+	if err != nil {
+		return broadcastError(c, err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(broadcast)
+}
+
+// HandleCountBroadcastAudience previews how many users an audience reaches
+func (h *NotificationHandler) HandleCountBroadcastAudience(c *fiber.Ctx) error {
+	var audience notification.BroadcastAudience
+	if err := c.BodyParser(&audience); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Bad request"})
+	}
+
+	count, err := h.NotiService.CountBroadcastAudience(audience)
+	if err != nil {
+		return broadcastError(c, err)
+	}
+	return c.JSON(fiber.Map{"audience": count})
+}
+
+func (h *NotificationHandler) HandleGetBroadcast(c *fiber.Ctx) error {
+	broadcastID, err := strconv.ParseInt(c.Params("broadcastID"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid broadcast ID"})
+	}
+
+	broadcast, err := h.NotiService.GetBroadcast(broadcastID)
+	if err != nil {
+		return broadcastError(c, err)
+	}
+	return c.JSON(broadcast)
+}
+
+func (h *NotificationHandler) HandleCancelBroadcast(c *fiber.Ctx) error {
+	broadcastID, err := strconv.ParseInt(c.Params("broadcastID"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid broadcast ID"})
+	}
+
+	if err := h.NotiService.CancelBroadcast(broadcastID); err != nil {
+		return broadcastError(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func broadcastError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidBroadcast):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrBroadcastNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrBroadcastAlreadySent):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	}
+	log.Printf("Error handling broadcast: %v", err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to handle broadcast"})
+}
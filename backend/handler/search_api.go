@@ -1,38 +1,74 @@
 package handler
 
 import (
+	"errors"
 	"strings"
+	"time"
 
 	"github.com/Alfex4936/chulbong-kr/dto"
+	"github.com/Alfex4936/chulbong-kr/middleware"
 	"github.com/Alfex4936/chulbong-kr/service"
+	"github.com/Alfex4936/chulbong-kr/util"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
+)
+
+const (
+	defaultSearchRadius = 2000.0  // meters
+	maxSearchRadius     = 50000.0 // meters
 )
 
 type SearchHandler struct {
-	SearchService      *service.ZincSearchService
-	BleveSearchService *service.BleveSearchService
+	MarkerSearcher         service.MarkerSearcher // bleve or zincsearch, chosen by SEARCH_BACKEND
+	SearchAnalyticsService *service.SearchAnalyticsService
+	SearchSynonymService   *service.SearchSynonymService
+	ChatUtil               *util.ChatUtil
 }
 
 // NewSearchHandler creates a new SearchHandler with dependencies injected
 func NewSearchHandler(
-	zinc *service.ZincSearchService,
-	bleve *service.BleveSearchService,
+	searcher service.MarkerSearcher,
+	analytics *service.SearchAnalyticsService,
+	synonym *service.SearchSynonymService,
+	cutil *util.ChatUtil,
 ) *SearchHandler {
 	return &SearchHandler{
-		SearchService:      zinc,
-		BleveSearchService: bleve,
+		MarkerSearcher:         searcher,
+		SearchAnalyticsService: analytics,
+		SearchSynonymService:   synonym,
+		ChatUtil:               cutil,
 	}
 }
 
 // RegisterSearchRoutes sets up the routes for search handling within the application.
-func RegisterSearchRoutes(api fiber.Router, handler *SearchHandler) {
+func RegisterSearchRoutes(api fiber.Router, handler *SearchHandler, authMiddleware *middleware.AuthMiddleware) {
 	searchGroup := api.Group("/search")
 	{
-		searchGroup.Get("/marker", handler.HandleBleveSearchMarkerAddress)
+		searchGroup.Get("/marker", handler.HandleSearchMarkerAddress)
 		searchGroup.Get("/autocomplete", handler.HandleAutoComplete)
 		searchGroup.Get("/station", handler.HandleGeoSearchByStation)
-		// searchGroup.Get("/marker-zinc", handler.HandleSearchMarkerAddress)
+		// anyone can report clicks, keep a single client from skewing the CTR
+		searchGroup.Post("/click", limiter.New(limiter.Config{
+			KeyGenerator: func(c *fiber.Ctx) string {
+				return handler.ChatUtil.GetUserIP(c)
+			},
+			Max:               20,
+			Expiration:        1 * time.Minute,
+			LimiterMiddleware: limiter.SlidingWindow{},
+			LimitReached: func(c *fiber.Ctx) error {
+				c.Set(fiber.HeaderContentType, fiber.MIMETextPlainCharsetUTF8)
+				c.Status(429).SendString("Too many requests, please try again later.")
+				return nil
+			},
+		}), handler.HandleSearchClick)
+		searchGroup.Get("/analytics", authMiddleware.CheckAdmin, handler.HandleSearchAnalyticsReport)
+
+		searchGroup.Get("/dictionary", authMiddleware.CheckAdmin, handler.HandleGetSearchDictionary)
+		searchGroup.Post("/synonyms", authMiddleware.CheckAdmin, handler.HandleAddSynonym)
+		searchGroup.Delete("/synonyms/:synonymID", authMiddleware.CheckAdmin, handler.HandleRemoveSynonym)
+		searchGroup.Post("/aliases", authMiddleware.CheckAdmin, handler.HandleAddMarkerAlias)
+		searchGroup.Delete("/aliases/:aliasID", authMiddleware.CheckAdmin, handler.HandleRemoveMarkerAlias)
 		// searchGroup.Post("/marker", handler.HandleInsertMarkerAddressTest)
 		// searchGroup.Delete("", handler.HandleDeleteMarkerAddressTest)
 	}
@@ -48,39 +84,46 @@ func (h *SearchHandler) HandleSearchMarkerAddress(c *fiber.Ctx) error {
 		})
 	}
 
-	// Call the service function
-	response, err := h.SearchService.SearchMarkerAddress(term)
+	// Optional map area: ?minLat=&minLng=&maxLat=&maxLng= or ?lat=&lng=&radius= (meters), &restrict=true
+	area, err := parseSearchArea(c)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": err.Error(),
 		})
 	}
 
-	return c.Status(fiber.StatusOK).JSON(response)
-}
-
-// Handler for searching marker addresses (using bleve)
-func (h *SearchHandler) HandleBleveSearchMarkerAddress(c *fiber.Ctx) error {
-	term := c.Query("term")
-	term = strings.TrimSpace(term)
-	if term == "" {
+	// Optional ?state=verified,unverified
+	states, err := service.ParseMarkerStates(c.Query("state"))
+	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "search term is required",
+			"error": err.Error(),
 		})
 	}
 
 	// Call the service function
-	response, err := h.BleveSearchService.SearchMarkerAddress(term)
+	var response dto.MarkerSearchResponse
+	if areaSearcher, ok := h.MarkerSearcher.(service.AreaMarkerSearcher); ok && area != nil {
+		response, err = areaSearcher.SearchMarkerAddressInArea(term, area, states...)
+	} else if area != nil && area.Restrict {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{
+			"error": "area search is not supported by the current search backend",
+		})
+	} else {
+		response, err = h.MarkerSearcher.SearchMarkerAddress(term, states...)
+	}
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": err.Error(),
 		})
 	}
 
+	// fiber reuses the query buffer once the handler returns
+	go h.SearchAnalyticsService.RecordQuery(service.SearchSourceMarker, strings.Clone(term), len(response.Markers), time.Duration(response.Took)*time.Millisecond)
+
 	return c.Status(fiber.StatusOK).JSON(response)
 }
 
-// Handler for autocomplete marker addresses (using bleve)
+// Handler for autocomplete marker addresses
 func (h *SearchHandler) HandleAutoComplete(c *fiber.Ctx) error {
 	term := c.Query("term")
 	term = strings.TrimSpace(term)
@@ -91,16 +134,119 @@ func (h *SearchHandler) HandleAutoComplete(c *fiber.Ctx) error {
 	}
 
 	// Call the service function
-	response, err := h.BleveSearchService.AutoComplete(term)
+	start := time.Now()
+	response, err := h.MarkerSearcher.AutoComplete(term)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": err.Error(),
 		})
 	}
 
+	go h.SearchAnalyticsService.RecordQuery(service.SearchSourceAutoComplete, strings.Clone(term), len(response), time.Since(start))
+
 	return c.Status(fiber.StatusOK).JSON(response)
 }
 
+// HandleSearchClick records which marker was picked from the search results
+func (h *SearchHandler) HandleSearchClick(c *fiber.Ctx) error {
+	var req dto.SearchClickRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+	}
+
+	if err := h.SearchAnalyticsService.RecordClick(req.Term, req.MarkerID, req.Position); err != nil {
+		if err == service.ErrInvalidSearchClick {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to record click"})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// HandleSearchAnalyticsReport returns top queries, zero-result queries and CTR by position (admin only)
+func (h *SearchHandler) HandleSearchAnalyticsReport(c *fiber.Ctx) error {
+	days := c.QueryInt("days", 7)
+	limit := c.QueryInt("limit", 20)
+
+	report, err := h.SearchAnalyticsService.GetReport(days, limit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to build search report"})
+	}
+
+	return c.JSON(report)
+}
+
+// HandleGetSearchDictionary lists all synonyms and marker aliases (admin only)
+func (h *SearchHandler) HandleGetSearchDictionary(c *fiber.Ctx) error {
+	response, err := h.SearchSynonymService.GetDictionary()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to fetch dictionary"})
+	}
+	return c.JSON(response)
+}
+
+func (h *SearchHandler) HandleAddSynonym(c *fiber.Ctx) error {
+	var req dto.SearchSynonym
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+	}
+
+	if err := h.SearchSynonymService.AddSynonym(req.Term, req.Synonym); err != nil {
+		if err == service.ErrInvalidSynonym {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to add synonym"})
+	}
+
+	return c.SendStatus(fiber.StatusCreated)
+}
+
+func (h *SearchHandler) HandleRemoveSynonym(c *fiber.Ctx) error {
+	synonymID, err := c.ParamsInt("synonymID")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid synonym ID"})
+	}
+
+	if err := h.SearchSynonymService.RemoveSynonym(synonymID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to remove synonym"})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *SearchHandler) HandleAddMarkerAlias(c *fiber.Ctx) error {
+	var req dto.MarkerAlias
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+	}
+
+	if err := h.SearchSynonymService.AddMarkerAlias(req.MarkerID, req.Alias); err != nil {
+		switch err {
+		case service.ErrInvalidSynonym:
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "alias is required"})
+		case service.ErrMarkerNotFound:
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to add alias"})
+	}
+
+	return c.SendStatus(fiber.StatusCreated)
+}
+
+func (h *SearchHandler) HandleRemoveMarkerAlias(c *fiber.Ctx) error {
+	aliasID, err := c.ParamsInt("aliasID")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid alias ID"})
+	}
+
+	if err := h.SearchSynonymService.RemoveMarkerAlias(aliasID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to remove alias"})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
 func (h *SearchHandler) HandleGeoSearchByStation(c *fiber.Ctx) error {
 	term := c.Query("term")
 	term = strings.TrimSpace(term)
@@ -114,8 +260,15 @@ func (h *SearchHandler) HandleGeoSearchByStation(c *fiber.Ctx) error {
 		term = term + "역"
 	}
 
+	states, err := service.ParseMarkerStates(c.Query("state"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
 	// Call the service function
-	response, err := h.BleveSearchService.SearchMarkersNearLocation(term)
+	response, err := h.MarkerSearcher.SearchMarkersNearLocation(term, states...)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": err.Error(),
@@ -128,7 +281,7 @@ func (h *SearchHandler) HandleGeoSearchByStation(c *fiber.Ctx) error {
 // Handler for searching marker addresses
 func (h *SearchHandler) HandleInsertMarkerAddressTest(c *fiber.Ctx) error {
 	// Call the service function
-	err := h.SearchService.InsertMarkerIndex(dto.MarkerIndexData{MarkerID: 9999, Address: "test address"})
+	err := h.MarkerSearcher.InsertMarkerIndex(dto.MarkerIndexData{MarkerID: 9999, Address: "test address"})
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": err.Error(),
@@ -138,16 +291,15 @@ func (h *SearchHandler) HandleInsertMarkerAddressTest(c *fiber.Ctx) error {
 	return c.Status(fiber.StatusOK).SendString("success")
 }
 func (h *SearchHandler) HandleDeleteMarkerAddressTest(c *fiber.Ctx) error {
-	markerID := c.Query("markerId")
-	markerID = strings.TrimSpace(markerID)
-	if markerID == "" {
+	markerID := c.QueryInt("markerId")
+	if markerID <= 0 {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "search term is required",
+			"error": "markerId is required",
 		})
 	}
 
 	// Call the service function
-	err := h.SearchService.DeleteMarkerIndex(markerID)
+	err := h.MarkerSearcher.DeleteMarkerIndex(markerID)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": err.Error(),
@@ -156,3 +308,37 @@ func (h *SearchHandler) HandleDeleteMarkerAddressTest(c *fiber.Ctx) error {
 
 	return c.Status(fiber.StatusOK).SendString("success")
 }
+
+// parseSearchArea reads an optional bounding box or center+radius from the query string
+func parseSearchArea(c *fiber.Ctx) (*dto.GeoFilter, error) {
+	hasBounds := c.Query("minLat") != "" || c.Query("minLng") != "" || c.Query("maxLat") != "" || c.Query("maxLng") != ""
+	hasCenter := c.Query("lat") != "" || c.Query("lng") != ""
+	if !hasBounds && !hasCenter {
+		return nil, nil
+	}
+
+	area := &dto.GeoFilter{Restrict: c.QueryBool("restrict")}
+
+	if hasBounds {
+		area.MinLat = c.QueryFloat("minLat")
+		area.MinLng = c.QueryFloat("minLng")
+		area.MaxLat = c.QueryFloat("maxLat")
+		area.MaxLng = c.QueryFloat("maxLng")
+		if !area.HasBounds() || !validLatLng(area.MinLat, area.MinLng) || !validLatLng(area.MaxLat, area.MaxLng) {
+			return nil, errors.New("invalid bounding box")
+		}
+		return area, nil
+	}
+
+	area.Lat = c.QueryFloat("lat")
+	area.Lng = c.QueryFloat("lng")
+	area.Radius = c.QueryFloat("radius", defaultSearchRadius)
+	if !validLatLng(area.Lat, area.Lng) || area.Radius <= 0 || area.Radius > maxSearchRadius {
+		return nil, errors.New("invalid center or radius")
+	}
+	return area, nil
+}
+
+func validLatLng(lat, lng float64) bool {
+	return lat >= -90 && lat <= 90 && lng >= -180 && lng <= 180
+}
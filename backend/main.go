@@ -181,6 +181,7 @@ func NewFiberApp(
 	commentHandler *handler.CommentHandler,
 	notificatinHandler *handler.NotificationHandler,
 	kakaobotHandler *handler.KakaoBotHandler,
+	dmHandler *handler.DirectMessageHandler,
 	authMiddleware *middleware.AuthMiddleware,
 	zapMiddleware *middleware.LogMiddleware,
 	prometheusRegistry prometheus.Registerer,
@@ -290,13 +291,14 @@ func NewFiberApp(
 	handler.RegisterMarkerRoutes(api, markerHandler, authMiddleware)
 	handler.RegisterReportRoutes(api, markerHandler, authMiddleware)
 	handler.RegisterUserRoutes(api, userHandler, authMiddleware)
-	handler.RegisterSearchRoutes(api, searchHandler)
+	handler.RegisterSearchRoutes(api, searchHandler, authMiddleware)
 	handler.RegisterAdminRoutes(api, adminHandler, authMiddleware)
 	handler.RegisterAuthRoutes(api, authHandler, authMiddleware)
-	handler.RegisterChatRoutes(app, wsConfig, chatHandler) // not /api/v1/
+	handler.RegisterChatRoutes(app, wsConfig, chatHandler, authMiddleware) // not /api/v1/
 	handler.RegisterCommentRoutes(api, commentHandler, authMiddleware)
 	handler.RegisterNotificationRoutes(app, wsConfig, notificatinHandler, authMiddleware) // not /api/v1/
 	handler.RegisterKakaoBotRoutes(api, kakaobotHandler, authMiddleware)
+	handler.RegisterDirectMessageRoutes(app, api, wsConfig, dmHandler, authMiddleware) // ws is not /api/v1/
 
 	return app
 }
@@ -591,11 +593,14 @@ func main() {
 			registerHooks,
 			util.RegisterBadWordUtilLifecycle,
 			service.RegisterSchedulerLifecycle,
+			service.RegisterNotificationDispatcher,
+			service.RegisterNotificationLifecycle,
 			util.RegisterPdfInitLifecycle,
 			service.RegisterMarkerLifecycle,
 			service.RegisterMarkerLocationLifecycle,
 			service.RegisterAuthLifecycle,
 			service.RegisteBleveLifecycle,
+			service.RegisterSearchSynonymLifecycle,
 			service.RegisterTokenServiceLifecycle,
 		), // func(diGraph fx.DotGraph) {
 		// logger.Debug("➡️", diGraph)
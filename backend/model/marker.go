@@ -12,6 +12,7 @@ type Marker struct {
 	UserID      *int      `json:"userId" db:"UserID"`
 	Description string    `json:"description" db:"Description"`
 	Address     *string   `json:"address" db:"Address"`
+	State       string    `json:"state" db:"State"`
 }
 
 // MarkerWithPhoto includes information about the marker and its associated photo.
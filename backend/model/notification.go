@@ -16,5 +16,5 @@ type Notification struct {
 	Message          string          `json:"message" db:"Message"`
 	CreatedAt        time.Time       `json:"-" db:"CreatedAt"`
 	UpdatedAt        time.Time       `json:"-" db:"UpdatedAt"`
-	Viewed           bool            `json:"-" db:"Viewed"`
+	Viewed           bool            `json:"-" db:"Viewed"` // superseded by NotificationStates, always false
 }
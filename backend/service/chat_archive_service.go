@@ -0,0 +1,303 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Alfex4936/chulbong-kr/config"
+	"github.com/Alfex4936/chulbong-kr/dto"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+const (
+	chatArchiveQueueLen      = 4096
+	chatArchiveBatchSize     = 100
+	chatArchiveFlushInterval = 2 * time.Second
+	maxChatRetentionDays     = 3650
+
+	upsertChatArchivePrefix = "INSERT INTO ChatArchive (MarkerID, UID, UserID, UserNickname, Message, Payload, SentAt) VALUES "
+	upsertChatArchiveSuffix = " ON DUPLICATE KEY UPDATE Message = VALUES(Message), Payload = VALUES(Payload)"
+
+	getChatArchiveSentAtQuery = "SELECT SentAt FROM ChatArchive WHERE UID = ?"
+
+	getChatArchiveBeforeQuery = `
+SELECT Payload
+FROM ChatArchive
+WHERE MarkerID = ? AND (SentAt < ? OR (SentAt = ? AND UID < ?))
+ORDER BY SentAt DESC, UID DESC
+LIMIT ?`
+
+	searchChatArchiveQuery = `
+SELECT Payload
+FROM ChatArchive
+WHERE Message LIKE ? AND (? = 0 OR MarkerID = ?)
+ORDER BY SentAt DESC, UID DESC
+LIMIT ? OFFSET ?`
+
+	upsertChatRetentionQuery = `
+INSERT INTO ChatRoomRetention (MarkerID, RetentionDays, UpdatedAt)
+VALUES (?, ?, NOW())
+ON DUPLICATE KEY UPDATE RetentionDays = VALUES(RetentionDays), UpdatedAt = NOW()`
+
+	deleteChatRetentionQuery = "DELETE FROM ChatRoomRetention WHERE MarkerID = ?"
+
+	pruneChatArchiveQuery = `
+DELETE a FROM ChatArchive a
+LEFT JOIN ChatRoomRetention r ON r.MarkerID = a.MarkerID
+WHERE a.SentAt < ? - COALESCE(r.RetentionDays, ?) * 86400000`
+)
+
+// ChatArchiveService keeps chat messages in MySQL after Redis forgets them.
+// Messages are written in batches, edits and deletes overwrite the archived copy.
+type ChatArchiveService struct {
+	DB         *sqlx.DB
+	ChatConfig *config.ChatConfig
+	Logger     *zap.Logger
+
+	queue chan dto.BroadcastMessage
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+func NewChatArchiveService(lifecycle fx.Lifecycle, db *sqlx.DB, chatConfig *config.ChatConfig, logger *zap.Logger) *ChatArchiveService {
+	service := &ChatArchiveService{
+		DB:         db,
+		ChatConfig: chatConfig,
+		Logger:     logger,
+	}
+	if !chatConfig.Archive {
+		return service
+	}
+
+	service.queue = make(chan dto.BroadcastMessage, chatArchiveQueueLen)
+	service.stop = make(chan struct{})
+	service.done = make(chan struct{})
+
+	lifecycle.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			go service.run()
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			close(service.stop)
+			select {
+			case <-service.done:
+			case <-ctx.Done():
+			}
+			return nil
+		},
+	})
+
+	return service
+}
+
+// Enabled is false when CHAT_ARCHIVE isn't set, the service is then a no-op
+func (s *ChatArchiveService) Enabled() bool {
+	return s != nil && s.queue != nil
+}
+
+// Enqueue archives a message or the new state of an archived one
+func (s *ChatArchiveService) Enqueue(msg dto.BroadcastMessage) {
+	if !s.Enabled() {
+		return
+	}
+	select {
+	case s.queue <- msg:
+	default:
+		s.Logger.Warn("Chat archive queue is full, message not archived", zap.String("uid", msg.UID))
+	}
+}
+
+func (s *ChatArchiveService) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(chatArchiveFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]dto.BroadcastMessage, 0, chatArchiveBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := s.write(batch); err != nil {
+			s.Logger.Error("Failed to archive chat messages", zap.Int("count", len(batch)), zap.Error(err))
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case msg := <-s.queue:
+			batch = append(batch, msg)
+			if len(batch) >= chatArchiveBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-s.stop:
+			for {
+				select {
+				case msg := <-s.queue:
+					batch = append(batch, msg)
+					if len(batch) >= chatArchiveBatchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// write upserts a batch, rows of the same uid are applied in order so the last state wins
+func (s *ChatArchiveService) write(batch []dto.BroadcastMessage) error {
+	var query strings.Builder
+	query.WriteString(upsertChatArchivePrefix)
+
+	args := make([]any, 0, len(batch)*7)
+	for i, msg := range batch {
+		payload, err := encodeArchivedMessage(msg)
+		if err != nil {
+			return err
+		}
+
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		query.WriteString("(?, ?, ?, ?, ?, ?, ?)")
+		args = append(args, msg.RoomID, msg.UID, msg.UserID, msg.UserNickname, msg.Message, payload, msg.Timestamp)
+	}
+	query.WriteString(upsertChatArchiveSuffix)
+
+	_, err := s.DB.Exec(query.String(), args...)
+	return err
+}
+
+// History returns up to limit messages older than before (a message uid or unix ms), oldest first
+func (s *ChatArchiveService) History(markerID int, before string, limit int) (dto.ChatHistoryResponse, error) {
+	sentAt, uid := int64(math.MaxInt64), ""
+	if before != "" {
+		if ms, err := strconv.ParseInt(before, 10, 64); err == nil {
+			sentAt = ms
+		} else {
+			err := s.DB.Get(&sentAt, getChatArchiveSentAtQuery, before)
+			if errors.Is(err, sql.ErrNoRows) {
+				return dto.ChatHistoryResponse{}, ErrChatMessageNotFound
+			}
+			if err != nil {
+				return dto.ChatHistoryResponse{}, err
+			}
+			uid = before
+		}
+	}
+
+	var payloads [][]byte
+	if err := s.DB.Select(&payloads, getChatArchiveBeforeQuery, markerID, sentAt, sentAt, uid, limit+1); err != nil {
+		return dto.ChatHistoryResponse{}, fmt.Errorf("error fetching chat history: %w", err)
+	}
+
+	messages, err := decodeArchivedMessages(payloads)
+	if err != nil {
+		return dto.ChatHistoryResponse{}, err
+	}
+	return newChatHistoryResponse(messages, limit), nil
+}
+
+// Search finds archived messages containing keyword, in one room or everywhere when markerID is 0
+func (s *ChatArchiveService) Search(markerID int, keyword string, page, pageSize int) ([]dto.BroadcastMessage, error) {
+	if !s.Enabled() {
+		return nil, ErrChatArchiveDisabled
+	}
+
+	pattern := "%" + escapeLike(keyword) + "%"
+	offset := (page - 1) * pageSize
+
+	var payloads [][]byte
+	if err := s.DB.Select(&payloads, searchChatArchiveQuery, pattern, markerID, markerID, pageSize, offset); err != nil {
+		return nil, fmt.Errorf("error searching chat archive: %w", err)
+	}
+	return decodeArchivedMessages(payloads)
+}
+
+// SetRetention sets how long a room's chat is kept, 0 or less goes back to the default
+func (s *ChatArchiveService) SetRetention(markerID, days int) error {
+	if days <= 0 {
+		_, err := s.DB.Exec(deleteChatRetentionQuery, markerID)
+		return err
+	}
+
+	_, err := s.DB.Exec(upsertChatRetentionQuery, markerID, min(days, maxChatRetentionDays))
+	return err
+}
+
+// Prune deletes archived messages older than their room's retention
+func (s *ChatArchiveService) Prune(now time.Time) (int64, error) {
+	if !s.Enabled() {
+		return 0, nil
+	}
+
+	result, err := s.DB.Exec(pruneChatArchiveQuery, now.UnixMilli(), s.ChatConfig.ArchiveRetentionDays)
+	if err != nil {
+		return 0, fmt.Errorf("error pruning chat archive: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// newChatHistoryResponse takes newest first rows (one more than limit if there are more) and returns them oldest first
+func newChatHistoryResponse(messages []dto.BroadcastMessage, limit int) dto.ChatHistoryResponse {
+	response := dto.ChatHistoryResponse{Messages: messages}
+	if len(messages) > limit {
+		response.Messages = messages[:limit]
+		response.HasMore = true
+	}
+
+	for i, j := 0, len(response.Messages)-1; i < j; i, j = i+1, j-1 {
+		response.Messages[i], response.Messages[j] = response.Messages[j], response.Messages[i]
+	}
+
+	if response.HasMore {
+		response.NextBefore = response.Messages[0].UID
+	}
+	if response.Messages == nil {
+		response.Messages = []dto.BroadcastMessage{}
+	}
+	return response
+}
+
+func encodeArchivedMessage(msg dto.BroadcastMessage) ([]byte, error) {
+	data, err := encodeStoredMessage(msg)
+	if err != nil {
+		return nil, err
+	}
+	return compress(data)
+}
+
+func decodeArchivedMessages(payloads [][]byte) ([]dto.BroadcastMessage, error) {
+	messages := make([]dto.BroadcastMessage, 0, len(payloads))
+	for _, payload := range payloads {
+		data, err := decompress(payload)
+		if err != nil {
+			return nil, err
+		}
+		msg, err := decodeStoredMessage(data)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	return messages, nil
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
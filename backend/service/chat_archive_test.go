@@ -0,0 +1,42 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/Alfex4936/chulbong-kr/dto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchivedMessageRoundTrip(t *testing.T) {
+	original := NewChatEvent(dto.ChatKindChat, "42", "req-1", "철봉왕", "한강공원 철봉 새로 생겼어요")
+	original.Reactions = map[string]int{"👍": 3}
+
+	payload, err := encodeArchivedMessage(original)
+	require.NoError(t, err)
+
+	messages, err := decodeArchivedMessages([][]byte{payload})
+	require.NoError(t, err)
+	assert.Equal(t, []dto.BroadcastMessage{original}, messages)
+}
+
+func TestNewChatHistoryResponse(t *testing.T) {
+	// rows come newest first with one extra when there are more
+	rows := []dto.BroadcastMessage{{UID: "d"}, {UID: "c"}, {UID: "b"}, {UID: "a"}}
+
+	page := newChatHistoryResponse(rows, 3)
+	assert.Equal(t, []dto.BroadcastMessage{{UID: "b"}, {UID: "c"}, {UID: "d"}}, page.Messages)
+	assert.True(t, page.HasMore)
+	assert.Equal(t, "b", page.NextBefore)
+
+	last := newChatHistoryResponse([]dto.BroadcastMessage{{UID: "a"}}, 3)
+	assert.False(t, last.HasMore)
+	assert.Empty(t, last.NextBefore)
+
+	assert.NotNil(t, newChatHistoryResponse(nil, 3).Messages)
+}
+
+func TestEscapeLike(t *testing.T) {
+	assert.Equal(t, `100\%`, escapeLike("100%"))
+	assert.Equal(t, `a\_b\\c`, escapeLike(`a_b\c`))
+}
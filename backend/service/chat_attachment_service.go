@@ -0,0 +1,208 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"mime/multipart"
+	"strings"
+	"time"
+
+	"github.com/Alfex4936/chulbong-kr/dto"
+	"github.com/Alfex4936/chulbong-kr/util"
+	sonic "github.com/bytedance/sonic"
+	"github.com/disintegration/imaging"
+	"github.com/redis/rueidis"
+	"github.com/rs/xid"
+	"go.uber.org/zap"
+)
+
+const (
+	maxChatImageSize      = 10 << 20
+	chatAttachmentTTL     = time.Hour // an upload that isn't posted by then is forgotten
+	chatUploadsPerMinute  = 5
+	maxChatLocationLabel  = 50
+	chatBlurhashMaxLength = 64 // the image is shrunk to this before encoding, blurhash doesn't need more
+)
+
+// ChatAttachmentService handles photos and location pins posted in marker chat.
+// Photos are uploaded first and posted with the id the upload returns, so the chat frame stays small.
+type ChatAttachmentService struct {
+	Redis       *RedisService
+	S3Service   *S3Service
+	ChatService *ChatService
+	MapUtil     *util.MapUtil
+	Logger      *zap.Logger
+}
+
+// chatAttachmentClaim is kept in Redis between the upload and the chat frame that posts it
+type chatAttachmentClaim struct {
+	MarkerID   string             `json:"markerId"`
+	UserID     string             `json:"userId"`
+	Attachment dto.ChatAttachment `json:"attachment"`
+}
+
+func NewChatAttachmentService(redis *RedisService, s3 *S3Service, chat *ChatService, mapUtil *util.MapUtil, logger *zap.Logger) *ChatAttachmentService {
+	return &ChatAttachmentService{
+		Redis:       redis,
+		S3Service:   s3,
+		ChatService: chat,
+		MapUtil:     mapUtil,
+		Logger:      logger,
+	}
+}
+
+func chatAttachmentKey(id string) string {
+	return fmt.Sprintf("chat:attachment:%s", id)
+}
+
+// Upload stores a photo with its thumbnail and blurhash, only users connected to the room can upload
+func (s *ChatAttachmentService) Upload(ctx context.Context, markerID, userID string, file *multipart.FileHeader) (dto.ChatAttachmentUpload, error) {
+	if file.Size > maxChatImageSize {
+		return dto.ChatAttachmentUpload{}, ErrChatImageTooLarge
+	}
+	if !isImage(filepathExtLower(file.Filename)) {
+		return dto.ChatAttachmentUpload{}, ErrChatNotImage
+	}
+
+	connected, err := s.ChatService.CheckDuplicateConnection(markerID, userID)
+	if err != nil {
+		return dto.ChatAttachmentUpload{}, err
+	}
+	if !connected {
+		return dto.ChatAttachmentUpload{}, ErrChatNotInRoom
+	}
+	var accountID int
+	var ip string
+	if conn := s.ChatService.findConnection(markerID, userID); conn != nil {
+		accountID, ip = conn.AccountID, conn.RemoteIP
+	}
+	ban, err := s.ChatService.GetActiveBan(markerID, userID, accountID, ip)
+	if err != nil {
+		return dto.ChatAttachmentUpload{}, err
+	}
+	if ban != nil {
+		return dto.ChatAttachmentUpload{}, ErrChatNotInRoom
+	}
+
+	if err := s.countUpload(ctx, userID); err != nil {
+		return dto.ChatAttachmentUpload{}, err
+	}
+
+	attachment, err := describeImage(file)
+	if err != nil {
+		return dto.ChatAttachmentUpload{}, ErrChatNotImage
+	}
+
+	attachment.URL, attachment.ThumbnailURL, err = s.S3Service.UploadFileToS3WithContext(ctx, "chat/"+markerID, file, true)
+	if err != nil {
+		return dto.ChatAttachmentUpload{}, err
+	}
+
+	upload := dto.ChatAttachmentUpload{AttachmentID: xid.New().String(), Attachment: attachment}
+	claim, err := sonic.Marshal(chatAttachmentClaim{MarkerID: markerID, UserID: userID, Attachment: attachment})
+	if err != nil {
+		return dto.ChatAttachmentUpload{}, err
+	}
+
+	client := s.Redis.Core.Client
+	err = client.Do(ctx, client.B().Set().Key(chatAttachmentKey(upload.AttachmentID)).Value(rueidis.BinaryString(claim)).Ex(chatAttachmentTTL).Build()).Error()
+	if err != nil {
+		return dto.ChatAttachmentUpload{}, err
+	}
+	return upload, nil
+}
+
+// Claim takes an uploaded photo for a chat message, an upload can be posted once by its uploader in its room
+func (s *ChatAttachmentService) Claim(ctx context.Context, markerID, userID, attachmentID string) (*dto.ChatAttachment, error) {
+	client := s.Redis.Core.Client
+	value, err := client.Do(ctx, client.B().Getdel().Key(chatAttachmentKey(attachmentID)).Build()).AsBytes()
+	if rueidis.IsRedisNil(err) {
+		return nil, ErrChatAttachmentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var claim chatAttachmentClaim
+	if err := sonic.Unmarshal(value, &claim); err != nil {
+		return nil, err
+	}
+	if claim.MarkerID != markerID || claim.UserID != userID {
+		return nil, ErrChatAttachmentNotFound
+	}
+	return &claim.Attachment, nil
+}
+
+// CheckLocation validates a pin, it must be in South Korea like markers are
+func (s *ChatAttachmentService) CheckLocation(location dto.ChatLocation) (*dto.ChatLocation, error) {
+	if math.IsNaN(location.Latitude) || math.IsNaN(location.Longitude) ||
+		math.Abs(location.Latitude) > 90 || math.Abs(location.Longitude) > 180 {
+		return nil, ErrChatLocationInvalid
+	}
+	if !s.MapUtil.IsInSouthKoreaPrecisely(location.Latitude, location.Longitude) {
+		return nil, ErrChatLocationInvalid
+	}
+
+	location.Label = strings.TrimSpace(location.Label)
+	if r := []rune(location.Label); len(r) > maxChatLocationLabel {
+		location.Label = string(r[:maxChatLocationLabel])
+	}
+	return &location, nil
+}
+
+// countUpload limits how many photos a user uploads per minute
+func (s *ChatAttachmentService) countUpload(ctx context.Context, userID string) error {
+	key := fmt.Sprintf("chat:uploads:%s", userID)
+	client := s.Redis.Core.Client
+	resps := client.DoMulti(ctx,
+		client.B().Incr().Key(key).Build(),
+		client.B().Expire().Key(key).Seconds(60).Nx().Build(),
+	)
+	count, err := resps[0].AsInt64()
+	if err != nil {
+		return err
+	}
+	if count > chatUploadsPerMinute {
+		return ErrChatRateLimited
+	}
+	return nil
+}
+
+// describeImage decodes the photo for its size and blurhash, it also rejects files that only look like images
+func describeImage(file *multipart.FileHeader) (dto.ChatAttachment, error) {
+	f, err := file.Open()
+	if err != nil {
+		return dto.ChatAttachment{}, err
+	}
+	defer f.Close()
+
+	img, err := imaging.Decode(f, imaging.AutoOrientation(true))
+	if err != nil {
+		return dto.ChatAttachment{}, err
+	}
+
+	bounds := img.Bounds()
+	small := imaging.Fit(img, chatBlurhashMaxLength, chatBlurhashMaxLength, imaging.Box)
+	return dto.ChatAttachment{
+		Blurhash: util.EncodeBlurHashImage(small, 4, 3),
+		Width:    bounds.Dx(),
+		Height:   bounds.Dy(),
+	}, nil
+}
+
+// ChatMessageText is the text of a chat message with a photo or pin,
+// the caption or what clients without photo and pin support show
+func ChatMessageText(caption string, attachment *dto.ChatAttachment, location *dto.ChatLocation) string {
+	switch {
+	case caption != "":
+		return caption
+	case attachment != nil:
+		return "[사진]"
+	case location != nil && location.Label != "":
+		return "[위치] " + location.Label
+	case location != nil:
+		return "[위치]"
+	}
+	return ""
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"mime/multipart"
+	"testing"
+
+	"github.com/Alfex4936/chulbong-kr/dto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestFileHeader(t *testing.T, filename string, content []byte) *multipart.FileHeader {
+	t.Helper()
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	part, err := w.CreateFormFile("image", filename)
+	require.NoError(t, err)
+	_, err = part.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	form, err := multipart.NewReader(&body, w.Boundary()).ReadForm(1 << 20)
+	require.NoError(t, err)
+	return form.File["image"][0]
+}
+
+func TestChatAttachment(t *testing.T) {
+	t.Run("DescribeImage", func(t *testing.T) {
+		img := image.NewRGBA(image.Rect(0, 0, 320, 240))
+		for x := 0; x < 320; x++ {
+			for y := 0; y < 240; y++ {
+				img.Set(x, y, color.RGBA{uint8(x), uint8(y), 128, 255})
+			}
+		}
+		var buf bytes.Buffer
+		require.NoError(t, png.Encode(&buf, img))
+
+		attachment, err := describeImage(newTestFileHeader(t, "bar.png", buf.Bytes()))
+		require.NoError(t, err)
+		assert.Equal(t, 320, attachment.Width)
+		assert.Equal(t, 240, attachment.Height)
+		assert.NotEmpty(t, attachment.Blurhash)
+
+		_, err = describeImage(newTestFileHeader(t, "fake.png", []byte("not an image")))
+		assert.Error(t, err)
+	})
+
+	t.Run("MessageText", func(t *testing.T) {
+		photo := &dto.ChatAttachment{URL: "https://bucket.s3.amazonaws.com/chat/1/a.png"}
+		pin := &dto.ChatLocation{Latitude: 37.5665, Longitude: 126.978, Label: "정문"}
+
+		assert.Equal(t, "여기 비었어요", ChatMessageText("여기 비었어요", photo, nil))
+		assert.Equal(t, "[사진]", ChatMessageText("", photo, nil))
+		assert.Equal(t, "[위치] 정문", ChatMessageText("", nil, pin))
+		assert.Equal(t, "[위치]", ChatMessageText("", nil, &dto.ChatLocation{}))
+	})
+}
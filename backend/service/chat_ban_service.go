@@ -0,0 +1,359 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Alfex4936/chulbong-kr/dto"
+	sonic "github.com/bytedance/sonic"
+	"github.com/gofiber/contrib/websocket"
+	"github.com/puzpuzpuz/xsync/v3"
+	"github.com/redis/rueidis"
+	"go.uber.org/zap"
+)
+
+const (
+	ChatBanCloseCode = 4003 // private close code, clients shouldn't reconnect on it
+
+	chatBanIndexKey      = "chat:bans" // member is the ban key, score its expiry in unix ms
+	maxBanReasonLength   = 200
+	maxCloseReasonLength = 123 // control frames are 125 bytes, 2 go to the close code
+
+	insertChatBanAuditQuery = `
+INSERT INTO ChatBanAudits (Action, MarkerID, UserID, Reason, DurationSeconds, AdminUserID, CreatedAt)
+VALUES (?, ?, ?, ?, ?, ?, NOW())`
+
+	getChatBanAuditQuery = `
+SELECT AuditID, Action, MarkerID, UserID, Reason, DurationSeconds, AdminUserID, CreatedAt
+FROM ChatBanAudits
+ORDER BY CreatedAt DESC, AuditID DESC
+LIMIT ? OFFSET ?`
+)
+
+func roomBanKey(markerID, userID string) string {
+	return fmt.Sprintf("ban_%s_%s", markerID, userID)
+}
+
+func globalBanKey(userID string) string {
+	return fmt.Sprintf("chat:ban:global:%s", userID)
+}
+
+// chatBanSubjects are what a ban is stored under. The request-id is chosen by the client,
+// so the account, or the address of an anonymous user, is banned with it.
+func chatBanSubjects(userID string, accountID int, ip string) []string {
+	subjects := []string{userID}
+	switch {
+	case accountID > 0:
+		subjects = append(subjects, "account:"+strconv.Itoa(accountID))
+	case ip != "":
+		subjects = append(subjects, "ip:"+ip)
+	}
+	return subjects
+}
+
+func chatBanKeys(markerID string, global bool, subjects []string) []string {
+	keys := make([]string, len(subjects))
+	for i, subject := range subjects {
+		if global {
+			keys[i] = globalBanKey(subject)
+		} else {
+			keys[i] = roomBanKey(markerID, subject)
+		}
+	}
+	return keys
+}
+
+// bannedBy tells whether the ban covers the connection
+func (c *ChulbongConn) bannedBy(ban *dto.ChatBan) bool {
+	switch {
+	case c.UserID == ban.UserID:
+		return true
+	case ban.AccountID > 0:
+		return c.AccountID == ban.AccountID
+	default:
+		return ban.IP != "" && c.AccountID == 0 && c.RemoteIP == ban.IP
+	}
+}
+
+// BanUser bans a user from a room without a reason, kept for the old admin route
+func (s *ChatService) BanUser(markerID, userID string, duration time.Duration) error {
+	_, err := s.Ban(dto.ChatBan{MarkerID: markerID, UserID: userID}, duration)
+	return err
+}
+
+// Ban stores the ban, writes the audit log and kicks the user out of the room (or every room) on this instance.
+// Other instances catch the ban on the user's next message.
+func (s *ChatService) Ban(ban dto.ChatBan, duration time.Duration) (dto.ChatBan, error) {
+	if r := []rune(ban.Reason); len(r) > maxBanReasonLength {
+		ban.Reason = string(r[:maxBanReasonLength])
+	}
+	if ban.Global {
+		ban.MarkerID = ""
+	}
+
+	now := time.Now()
+	ban.BannedAt = now
+	ban.ExpiresAt = now.Add(duration)
+	ban.RemainingSeconds = int64(duration.Seconds())
+
+	// admins ban by request-id, the account or address comes from the user's connection
+	if ban.AccountID == 0 && ban.IP == "" {
+		if conn := s.findConnection(ban.MarkerID, ban.UserID); conn != nil {
+			ban.AccountID, ban.IP = conn.AccountID, conn.RemoteIP
+		}
+	}
+	if ban.AccountID > 0 {
+		ban.IP = ""
+	}
+	keys := chatBanKeys(ban.MarkerID, ban.Global, chatBanSubjects(ban.UserID, ban.AccountID, ban.IP))
+
+	value, err := sonic.MarshalString(ban)
+	if err != nil {
+		return dto.ChatBan{}, err
+	}
+
+	ctx := context.Background()
+	client := s.Redis.Core.Client
+	cmds := make(rueidis.Commands, 0, len(keys)+1)
+	for _, key := range keys {
+		cmds = append(cmds, client.B().Set().Key(key).Value(value).Ex(duration).Build())
+	}
+	// only the request-id key is listed, the others are removed with it
+	cmds = append(cmds, client.B().Zadd().Key(chatBanIndexKey).ScoreMember().ScoreMember(float64(ban.ExpiresAt.UnixMilli()), keys[0]).Build())
+	for _, resp := range client.DoMulti(ctx, cmds...) {
+		if err := resp.Error(); err != nil {
+			return dto.ChatBan{}, err
+		}
+	}
+
+	s.auditBan("ban", ban.MarkerID, ban.UserID, ban.Reason, ban.RemainingSeconds, ban.BannedBy)
+
+	type kick struct{ markerID, clientID string }
+	var kicks []kick
+	s.WebSocketManager.rooms.Range(func(markerID string, roomConns *xsync.MapOf[string, *ChulbongConn]) bool {
+		if !ban.Global && markerID != ban.MarkerID {
+			return true
+		}
+		roomConns.Range(func(clientID string, conn *ChulbongConn) bool {
+			if conn.bannedBy(&ban) {
+				kicks = append(kicks, kick{markerID, clientID})
+			}
+			return true
+		})
+		return true
+	})
+	for _, k := range kicks {
+		s.KickBanned(k.markerID, k.clientID, &ban)
+	}
+	return ban, nil
+}
+
+// findConnection is the user's connection on this instance, in the room or in any room when markerID is empty
+func (s *ChatService) findConnection(markerID, clientID string) *ChulbongConn {
+	var found *ChulbongConn
+	s.WebSocketManager.rooms.Range(func(roomID string, roomConns *xsync.MapOf[string, *ChulbongConn]) bool {
+		if markerID != "" && roomID != markerID {
+			return true
+		}
+		found, _ = roomConns.Load(clientID)
+		return found == nil
+	})
+	return found
+}
+
+// Unban lifts a room ban, or the global ban when markerID is empty, along with the account or address it covers
+func (s *ChatService) Unban(markerID, userID string, adminID int) error {
+	global := markerID == ""
+	key := chatBanKeys(markerID, global, []string{userID})[0]
+
+	ctx := context.Background()
+	client := s.Redis.Core.Client
+	value, err := client.Do(ctx, client.B().Get().Key(key).Build()).ToString()
+	if rueidis.IsRedisNil(err) {
+		return ErrChatBanNotFound
+	}
+	if err != nil {
+		return err
+	}
+	ban := parseBan(value, markerID, userID, global)
+	keys := chatBanKeys(markerID, global, chatBanSubjects(userID, ban.AccountID, ban.IP))
+
+	if err := client.Do(ctx, client.B().Del().Key(keys...).Build()).Error(); err != nil {
+		return err
+	}
+	if err := client.Do(ctx, client.B().Zrem().Key(chatBanIndexKey).Member(key).Build()).Error(); err != nil {
+		return err
+	}
+
+	s.auditBan("unban", markerID, userID, "", 0, adminID)
+	return nil
+}
+
+// GetActiveBan returns the ban that keeps the user out of the room, global bans first, nil if there is none.
+// The account, or the address of an anonymous user, is checked along with the request-id.
+func (s *ChatService) GetActiveBan(markerID, userID string, accountID int, ip string) (*dto.ChatBan, error) {
+	ctx := context.Background()
+	client := s.Redis.Core.Client
+
+	subjects := chatBanSubjects(userID, accountID, ip)
+	var cmds rueidis.Commands
+	var globals []bool
+	for _, global := range []bool{true, false} {
+		for _, key := range chatBanKeys(markerID, global, subjects) {
+			cmds = append(cmds, client.B().Get().Key(key).Build(), client.B().Pttl().Key(key).Build())
+			globals = append(globals, global)
+		}
+	}
+	resps := client.DoMulti(ctx, cmds...)
+
+	for i, global := range globals {
+		value, err := resps[i*2].ToString()
+		if rueidis.IsRedisNil(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		ttl, err := resps[i*2+1].AsInt64()
+		if err != nil {
+			return nil, err
+		}
+
+		ban := parseBan(value, markerID, userID, global)
+		if ttl > 0 {
+			ban.RemainingSeconds = (ttl + 999) / 1000
+			ban.ExpiresAt = time.Now().Add(time.Duration(ttl) * time.Millisecond)
+		}
+		return &ban, nil
+	}
+	return nil, nil
+}
+
+// GetBanDetails reports whether the user is banned from the room and for how long
+func (s *ChatService) GetBanDetails(markerID, userID string) (bool, time.Duration, error) {
+	ban, err := s.GetActiveBan(markerID, userID, 0, "")
+	if err != nil || ban == nil {
+		return false, 0, err
+	}
+	return true, time.Duration(ban.RemainingSeconds) * time.Second, nil
+}
+
+// ListBans returns every active ban, expired entries are pruned from the index on the way
+func (s *ChatService) ListBans() ([]dto.ChatBan, error) {
+	ctx := context.Background()
+	client := s.Redis.Core.Client
+
+	now := fmt.Sprintf("%d", time.Now().UnixMilli())
+	if err := client.Do(ctx, client.B().Zremrangebyscore().Key(chatBanIndexKey).Min("-inf").Max(now).Build()).Error(); err != nil {
+		return nil, err
+	}
+
+	entries, err := client.Do(ctx, client.B().Zrange().Key(chatBanIndexKey).Min("0").Max("-1").Withscores().Build()).AsZScores()
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return []dto.ChatBan{}, nil
+	}
+
+	keys := make([]string, len(entries))
+	for i, entry := range entries {
+		keys[i] = entry.Member
+	}
+	values, err := client.Do(ctx, client.B().Mget().Key(keys...).Build()).ToArray()
+	if err != nil {
+		return nil, err
+	}
+
+	bans := make([]dto.ChatBan, 0, len(values))
+	for i, v := range values {
+		value, err := v.ToString()
+		if err != nil {
+			continue // unbanned or expired between the calls
+		}
+
+		var ban dto.ChatBan
+		if err := sonic.UnmarshalString(value, &ban); err != nil {
+			continue
+		}
+		ban.ExpiresAt = time.UnixMilli(int64(entries[i].Score))
+		ban.RemainingSeconds = int64(time.Until(ban.ExpiresAt).Seconds())
+		bans = append(bans, ban)
+	}
+	return bans, nil
+}
+
+// GetBanAudit returns the ban and unban history, newest first
+func (s *ChatService) GetBanAudit(page, pageSize int) ([]dto.ChatBanAudit, error) {
+	offset := (page - 1) * pageSize
+
+	audits := make([]dto.ChatBanAudit, 0, pageSize)
+	if err := s.DB.Select(&audits, getChatBanAuditQuery, pageSize, offset); err != nil {
+		return nil, fmt.Errorf("error fetching chat ban audit: %w", err)
+	}
+	return audits, nil
+}
+
+// KickBanned closes the user's connection with a close frame that says why and for how long
+func (s *ChatService) KickBanned(markerID, clientID string, ban *dto.ChatBan) {
+	roomConns, ok := s.WebSocketManager.rooms.Load(markerID)
+	if !ok {
+		return
+	}
+	conn, ok := roomConns.Load(clientID)
+	if !ok {
+		return
+	}
+
+	frame := BanCloseMessage(ban)
+	conn.closeFrame.Store(&frame)
+	// writePump sends the frame and closes the socket
+	if _, err := s.RemoveWsFromRoom(markerID, clientID); err != nil {
+		return // the connection was closed meanwhile
+	}
+
+	s.RemoveConnectionFromRedis(markerID, clientID)
+	s.BroadcastPresence(markerID, clientID, conn.Nickname, dto.ChatPresenceLeave)
+	s.BroadcastUserCountToRoomByLocal(markerID)
+}
+
+// BanCloseMessage builds the close frame of a banned user, the reason is cut to fit in a control frame
+func BanCloseMessage(ban *dto.ChatBan) []byte {
+	reason := ban.Reason
+	for {
+		payload, _ := sonic.MarshalString(dto.ChatBanClose{
+			Error:            "banned",
+			Reason:           reason,
+			Global:           ban.Global,
+			RemainingSeconds: ban.RemainingSeconds,
+		})
+		if len(payload) <= maxCloseReasonLength || reason == "" {
+			return websocket.FormatCloseMessage(ChatBanCloseCode, payload)
+		}
+		_, size := utf8.DecodeLastRuneInString(reason)
+		reason = reason[:len(reason)-size]
+	}
+}
+
+// parseBan reads a stored ban, bans set before reasons existed only hold "banned"
+func parseBan(value, markerID, userID string, global bool) dto.ChatBan {
+	var ban dto.ChatBan
+	if err := sonic.UnmarshalString(value, &ban); err != nil || ban.UserID == "" {
+		ban = dto.ChatBan{UserID: userID, MarkerID: markerID}
+	}
+	ban.Global = global
+	if global {
+		ban.MarkerID = ""
+	}
+	return ban
+}
+
+func (s *ChatService) auditBan(action, markerID, userID, reason string, durationSeconds int64, adminID int) {
+	if _, err := s.DB.Exec(insertChatBanAuditQuery, action, markerID, userID, reason, durationSeconds, adminID); err != nil {
+		// the ban itself is in place, don't fail it over the log
+		s.Logger.Error("Failed to write chat ban audit", zap.String("action", action), zap.String("userID", userID), zap.Error(err))
+	}
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/Alfex4936/chulbong-kr/dto"
+	sonic "github.com/bytedance/sonic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBanCloseMessage(t *testing.T) {
+	decode := func(t *testing.T, frame []byte) (int, dto.ChatBanClose) {
+		require.GreaterOrEqual(t, len(frame), 2)
+		require.LessOrEqual(t, len(frame), 125)
+
+		var payload dto.ChatBanClose
+		require.NoError(t, sonic.Unmarshal(frame[2:], &payload))
+		return int(binary.BigEndian.Uint16(frame[:2])), payload
+	}
+
+	t.Run("Reason", func(t *testing.T) {
+		code, payload := decode(t, BanCloseMessage(&dto.ChatBan{Reason: "도배", RemainingSeconds: 300}))
+		assert.Equal(t, ChatBanCloseCode, code)
+		assert.Equal(t, "banned", payload.Error)
+		assert.Equal(t, "도배", payload.Reason)
+		assert.EqualValues(t, 300, payload.RemainingSeconds)
+	})
+
+	t.Run("LongReason", func(t *testing.T) {
+		reason := strings.Repeat("욕설", 100)
+		_, payload := decode(t, BanCloseMessage(&dto.ChatBan{Reason: reason, Global: true, RemainingSeconds: 86400}))
+		assert.True(t, payload.Global)
+		assert.NotEmpty(t, payload.Reason)
+		assert.True(t, strings.HasPrefix(reason, payload.Reason), "cut on a rune boundary")
+	})
+}
+
+func TestParseBan(t *testing.T) {
+	// bans set before reasons existed
+	ban := parseBan("banned", "42", "req-1", false)
+	assert.Equal(t, dto.ChatBan{MarkerID: "42", UserID: "req-1"}, ban)
+
+	value, _ := sonic.MarshalString(dto.ChatBan{MarkerID: "42", UserID: "req-1", Reason: "spam"})
+	ban = parseBan(value, "7", "req-1", true)
+	assert.True(t, ban.Global)
+	assert.Empty(t, ban.MarkerID)
+	assert.Equal(t, "spam", ban.Reason)
+}
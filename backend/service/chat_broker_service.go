@@ -0,0 +1,260 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Alfex4936/chulbong-kr/config"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/redis/rueidis"
+	"go.uber.org/zap"
+)
+
+const (
+	chatExchange       = "chat_exchange"
+	chatRoutingPrefix  = "chat.room."
+	chatBrokerQueueLen = 1024
+)
+
+var ErrChatBrokerClosed = errors.New("chat broker is closed")
+
+// ChatBroker fans chat events out to every node, each node then delivers them to its own connections.
+// Subscribers get the events of every room, their own included, in the order a node published them.
+type ChatBroker interface {
+	Publish(ctx context.Context, roomID string, payload []byte) error
+	Subscribe(handler func(roomID string, payload []byte)) error
+	Close() error
+}
+
+// NewChatBroker picks the broker from CHAT_BROKER
+func NewChatBroker(chatConfig *config.ChatConfig, redis *RedisService, logger *zap.Logger) (ChatBroker, error) {
+	switch chatConfig.Broker {
+	case config.ChatBrokerLocal:
+		return NewInProcessChatBroker(), nil
+	case config.ChatBrokerRedis:
+		return NewRedisChatBroker(redis, logger), nil
+	case config.ChatBrokerAMQP:
+		return NewAMQPChatBroker(chatConfig.AMQPURL, logger)
+	default:
+		return nil, fmt.Errorf("unknown chat broker: %q", chatConfig.Broker)
+	}
+}
+
+// InProcessChatBroker connects ChatServices living in the same process, a single node or tests
+type InProcessChatBroker struct {
+	mu          sync.RWMutex
+	subscribers []chan chatBrokerMessage
+	closed      bool
+	wg          sync.WaitGroup
+}
+
+type chatBrokerMessage struct {
+	roomID  string
+	payload []byte
+}
+
+func NewInProcessChatBroker() *InProcessChatBroker {
+	return &InProcessChatBroker{}
+}
+
+// Publish blocks while a subscriber's queue is full so nothing is dropped or reordered
+func (b *InProcessChatBroker) Publish(ctx context.Context, roomID string, payload []byte) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.closed {
+		return ErrChatBrokerClosed
+	}
+
+	msg := chatBrokerMessage{roomID: roomID, payload: append([]byte(nil), payload...)}
+	for _, queue := range b.subscribers {
+		select {
+		case queue <- msg:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (b *InProcessChatBroker) Subscribe(handler func(roomID string, payload []byte)) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return ErrChatBrokerClosed
+	}
+
+	queue := make(chan chatBrokerMessage, chatBrokerQueueLen)
+	b.subscribers = append(b.subscribers, queue)
+
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		for msg := range queue {
+			handler(msg.roomID, msg.payload)
+		}
+	}()
+	return nil
+}
+
+// Close stops accepting events and waits until the queued ones are handled
+func (b *InProcessChatBroker) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	for _, queue := range b.subscribers {
+		close(queue)
+	}
+	b.mu.Unlock()
+
+	b.wg.Wait()
+	return nil
+}
+
+// RedisChatBroker uses pub/sub, one pattern subscription per node covers every room
+type RedisChatBroker struct {
+	Redis  *RedisService
+	Logger *zap.Logger
+
+	cancel context.CancelFunc
+}
+
+func NewRedisChatBroker(redis *RedisService, logger *zap.Logger) *RedisChatBroker {
+	return &RedisChatBroker{
+		Redis:  redis,
+		Logger: logger,
+	}
+}
+
+func chatChannel(roomID string) string {
+	return fmt.Sprintf("room:%s:messages", roomID)
+}
+
+func (b *RedisChatBroker) Publish(ctx context.Context, roomID string, payload []byte) error {
+	client := b.Redis.Core.Client
+	return client.Do(ctx, client.B().Publish().Channel(chatChannel(roomID)).Message(rueidis.BinaryString(payload)).Build()).Error()
+}
+
+func (b *RedisChatBroker) Subscribe(handler func(roomID string, payload []byte)) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	b.cancel = cancel
+
+	go func() {
+		for {
+			client := b.Redis.Core.Client
+			err := client.Receive(ctx, client.B().Psubscribe().Pattern(chatChannel("*")).Build(), func(m rueidis.PubSubMessage) {
+				roomID := strings.TrimSuffix(strings.TrimPrefix(m.Channel, "room:"), ":messages")
+				handler(roomID, []byte(m.Message))
+			})
+			if ctx.Err() != nil {
+				return
+			}
+
+			// events published while resubscribing are lost, clients catch up with last-uid
+			b.Logger.Warn("Chat subscription dropped, resubscribing", zap.Error(err))
+			time.Sleep(time.Second)
+		}
+	}()
+	return nil
+}
+
+func (b *RedisChatBroker) Close() error {
+	if b.cancel != nil {
+		b.cancel()
+	}
+	return nil
+}
+
+// AMQPChatBroker publishes to a topic exchange, every node reads from its own exclusive queue
+type AMQPChatBroker struct {
+	Conn   *amqp.Connection
+	Logger *zap.Logger
+
+	mu        sync.Mutex // amqp channels aren't safe for concurrent publishing
+	publishCh *amqp.Channel
+}
+
+func NewAMQPChatBroker(url string, logger *zap.Logger) (*AMQPChatBroker, error) {
+	conn, err := amqp.Dial(url)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to amqp: %w", err)
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error opening amqp channel: %w", err)
+	}
+
+	if err := ch.ExchangeDeclare(chatExchange, "topic", true, false, false, false, nil); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error declaring chat exchange: %w", err)
+	}
+
+	return &AMQPChatBroker{
+		Conn:      conn,
+		Logger:    logger,
+		publishCh: ch,
+	}, nil
+}
+
+func (b *AMQPChatBroker) Publish(ctx context.Context, roomID string, payload []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.publishCh.PublishWithContext(ctx, chatExchange, chatRoutingPrefix+roomID, false, false, amqp.Publishing{
+		ContentType: "application/json",
+		Body:        payload,
+	})
+}
+
+func (b *AMQPChatBroker) Subscribe(handler func(roomID string, payload []byte)) error {
+	ch, err := b.Conn.Channel()
+	if err != nil {
+		return fmt.Errorf("error opening amqp channel: %w", err)
+	}
+
+	q, err := ch.QueueDeclare(
+		"",    // server named
+		false, // durable
+		true,  // delete when unused
+		true,  // exclusive, goes away with the node
+		false, // no-wait
+		amqp.Table{
+			"x-message-ttl": 30000, // a lagging node shouldn't deliver stale chat
+			"x-max-length":  10000,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("error declaring chat queue: %w", err)
+	}
+
+	if err := ch.QueueBind(q.Name, chatRoutingPrefix+"#", chatExchange, false, nil); err != nil {
+		return fmt.Errorf("error binding chat queue: %w", err)
+	}
+
+	msgs, err := ch.Consume(q.Name, "", true, true, false, false, nil)
+	if err != nil {
+		return fmt.Errorf("error consuming chat queue: %w", err)
+	}
+
+	go func() {
+		for d := range msgs {
+			handler(strings.TrimPrefix(d.RoutingKey, chatRoutingPrefix), d.Body)
+		}
+		b.Logger.Info("Chat queue consumer stopped")
+	}()
+	return nil
+}
+
+func (b *AMQPChatBroker) Close() error {
+	return b.Conn.Close()
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Alfex4936/chulbong-kr/dto"
+	sonic "github.com/bytedance/sonic"
+	"github.com/puzpuzpuz/xsync/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func newTestChatNode(t *testing.T, broker ChatBroker) *ChatService {
+	node := &ChatService{
+		WebSocketManager: newRoomConnectionManager(),
+		Broker:           broker,
+		Logger:           zap.NewNop(),
+	}
+	require.NoError(t, broker.Subscribe(node.ProcessMessageFromSubscription))
+	return node
+}
+
+func joinTestRoom(node *ChatService, roomID, clientID string) *ChulbongConn {
+	conn := &ChulbongConn{UserID: clientID, Send: make(chan []byte, 512)}
+	roomConns, _ := node.WebSocketManager.rooms.LoadOrCompute(roomID, func() *xsync.MapOf[string, *ChulbongConn] {
+		return xsync.NewMapOf[string, *ChulbongConn]()
+	})
+	roomConns.Store(clientID, conn)
+	return conn
+}
+
+func receiveEvents(t *testing.T, conn *ChulbongConn, n int) []dto.BroadcastMessage {
+	t.Helper()
+
+	events := make([]dto.BroadcastMessage, 0, n)
+	for len(events) < n {
+		select {
+		case payload := <-conn.Send:
+			var event dto.BroadcastMessage
+			require.NoError(t, sonic.Unmarshal(payload, &event))
+			events = append(events, event)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%s got %d of %d events", conn.UserID, len(events), n)
+		}
+	}
+	return events
+}
+
+func TestChatMultiNode(t *testing.T) {
+	const count = 200
+
+	t.Run("Delivery", func(t *testing.T) {
+		broker := NewInProcessChatBroker()
+		defer broker.Close()
+
+		nodeA, nodeB := newTestChatNode(t, broker), newTestChatNode(t, broker)
+		a1 := joinTestRoom(nodeA, "1", "a1")
+		b1 := joinTestRoom(nodeB, "1", "b1")
+		b2 := joinTestRoom(nodeB, "2", "b2")
+
+		sent := make([]dto.BroadcastMessage, count)
+		for i := range sent {
+			sent[i] = NewChatEvent(dto.ChatKindChat, "1", "a1", "철봉왕", strconv.Itoa(i))
+			require.NoError(t, nodeA.BroadcastMessageToRoomByDTO(sent[i]))
+		}
+
+		for _, conn := range []*ChulbongConn{a1, b1} {
+			events := receiveEvents(t, conn, count)
+			for i, event := range events {
+				assert.Equal(t, sent[i].UID, event.UID, "%s event %d out of order", conn.UserID, i)
+			}
+		}
+
+		// a redelivered event is dropped, the next one is new
+		require.NoError(t, broker.Publish(context.Background(), "1", changePayloadToByte(sent[0])))
+		last := NewChatEvent(dto.ChatKindChat, "1", "b1", "턱걸이", "last")
+		require.NoError(t, nodeB.BroadcastMessageToRoomByDTO(last))
+
+		assert.Equal(t, last.UID, receiveEvents(t, a1, 1)[0].UID)
+		assert.Equal(t, last.UID, receiveEvents(t, b1, 1)[0].UID)
+		assert.Empty(t, b2.Send, "other rooms get nothing")
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		broker := NewInProcessChatBroker()
+		defer broker.Close()
+
+		nodes := []*ChatService{newTestChatNode(t, broker), newTestChatNode(t, broker)}
+		conns := []*ChulbongConn{joinTestRoom(nodes[0], "1", "a1"), joinTestRoom(nodes[1], "1", "b1")}
+
+		var wg sync.WaitGroup
+		for n, node := range nodes {
+			wg.Add(1)
+			go func(n int, node *ChatService) {
+				defer wg.Done()
+				for i := 0; i < count; i++ {
+					node.BroadcastMessageToRoomByDTO(NewChatEvent(dto.ChatKindChat, "1", conns[n].UserID, "", strconv.Itoa(i)))
+				}
+			}(n, node)
+		}
+		wg.Wait()
+
+		for _, conn := range conns {
+			next := map[string]int{} // per sender, messages count up from 0
+			seen := map[string]struct{}{}
+			for _, event := range receiveEvents(t, conn, 2*count) {
+				_, dup := seen[event.UID]
+				require.False(t, dup, "%s got %s twice", conn.UserID, event.UID)
+				seen[event.UID] = struct{}{}
+
+				assert.Equal(t, strconv.Itoa(next[event.UserID]), event.Message, "%s: %s out of order", conn.UserID, event.UserID)
+				next[event.UserID]++
+			}
+			assert.Empty(t, conn.Send)
+		}
+	})
+}
@@ -14,20 +14,12 @@ import (
 	"github.com/Alfex4936/chulbong-kr/dto"
 	"github.com/Alfex4936/chulbong-kr/util"
 	"github.com/puzpuzpuz/xsync/v3"
-	"github.com/rs/xid"
-	"github.com/vmihailenco/msgpack/v5"
 
 	sonic "github.com/bytedance/sonic"
 	"github.com/gofiber/contrib/websocket"
 	"github.com/redis/rueidis"
 )
 
-// LAVINMQ: Ensure only one subscription per room
-// if _, exists := ActiveSubscriptions.Load(key); !exists {
-// 	go SubscribeAndBroadcastFromAMQP(markerID)
-// 	ActiveSubscriptions.Store(key, struct{}{}) // marker_%s
-// }
-
 const (
 	MAX_MESSAGE_RETAIN = 10 * 24 // days*hours
 )
@@ -70,39 +62,24 @@ func (s *ChatService) SaveConnection(markerID, clientID, clientNickname string,
 
 // REDIS
 // To see which users are in a room easily (in case distributed servers)
-func (s *ChatService) AddConnectionRoomToRedis(markerID, userID, username string) error {
+func (s *ChatService) AddConnectionRoomToRedis(connInfo dto.ConnectionInfo) error {
 	ctx := context.Background()
-	key := fmt.Sprintf("room:%s:connections", markerID)
-	connID := xid.New().String() // unique identifier for the connection
-
-	connInfo := dto.ConnectionInfo{
-		UserID:   userID,
-		RoomID:   markerID,
-		Username: username,
-		ConnID:   connID,
-	}
+	key := fmt.Sprintf("room:%s:connections", connInfo.RoomID)
 
 	jsonConnInfo, err := sonic.Marshal(connInfo)
 	if err != nil {
 		return err
 	}
 
-	// Use HSET to set the field value
-	setCmd := s.Redis.Core.Client.B().Hset().
-		Key(key).
-		FieldValue().
-		FieldValue(userID, rueidis.BinaryString(jsonConnInfo)).
-		Build()
-
-	// Execute the HSET command
-	if err := s.Redis.Core.Client.Do(ctx, setCmd).Error(); err != nil {
-		return err
-	}
-
-	// Set expiration on the whole hash key
-	expireCmd := s.Redis.Core.Client.B().Expire().Key(key).Seconds(int64(time.Hour / time.Second)).Build()
-	if err := s.Redis.Core.Client.Do(ctx, expireCmd).Error(); err != nil {
-		return err
+	// HSET and refresh the expiration on the whole hash key
+	client := s.Redis.Core.Client
+	for _, resp := range client.DoMulti(ctx,
+		client.B().Hset().Key(key).FieldValue().FieldValue(connInfo.UserID, rueidis.BinaryString(jsonConnInfo)).Build(),
+		client.B().Expire().Key(key).Seconds(int64(time.Hour/time.Second)).Build(),
+	) {
+		if err := resp.Error(); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -167,9 +144,8 @@ func (s *ChatService) GetRecentMessages(ctx context.Context, roomID string) ([]d
 			return nil, err
 		}
 
-		var msg dto.BroadcastMessage
 		// Decode the message
-		err = msgpack.Unmarshal(msgData, &msg)
+		msg, err := decodeStoredMessage(msgData)
 		if err != nil {
 			return nil, err
 		}
@@ -225,18 +201,12 @@ func (s *ChatService) SaveMessageToRedis(ctx context.Context, message dto.Broadc
 	// }
 
 	// WAY: msgpack
-	// Create a buffer
-	var buf bytes.Buffer
-
-	// Create an encoder and set it to use array encoding
-	enc := msgpack.NewEncoder(&buf)
-	enc.UseArrayEncodedStructs(true)
-
 	// Serialize the message using MessagePack
-	if err := enc.Encode(message); err != nil {
+	normalizeEvent(&message)
+	msgPackData, err := encodeStoredMessage(message)
+	if err != nil {
 		return err
 	}
-	msgPackData := buf.Bytes()
 
 	// WAY: compress
 	// Compress the message
@@ -310,12 +280,12 @@ func (s *ChatService) RemoveConnectionFromRedis(markerID, xRequestID string) {
 // RemoveConnection removes a WebSocket connection associated with a id
 func (s *ChatService) RemoveWsFromRoom(markerID, clientID string) (string, error) {
 	if roomConns, ok := s.WebSocketManager.rooms.Load(markerID); ok {
-		if conn, ok := roomConns.Load(clientID); ok {
+		if conn, ok := roomConns.LoadAndDelete(clientID); ok {
 			clientNickname := conn.Nickname
-			close(conn.Send)
-			close(conn.InActiveChan)
-			conn.Socket.Close()
-			roomConns.Delete(clientID)
+			conn.shutdown()
+			if conn.closeFrame.Load() == nil {
+				conn.Socket.Close() // otherwise writePump closes it after the frame
+			}
 
 			// s.Logger.Info("Connection closed", zap.String("markerID", markerID), zap.String("clientID", clientID))
 
@@ -331,11 +301,9 @@ func (s *ChatService) RemoveWsFromRoom(markerID, clientID string) (string, error
 // KickUserFromRoom closes the connection for a user in a specified room.
 func (s *ChatService) KickUserFromRoom(markerID, clientID string) error {
 	if roomConns, ok := s.WebSocketManager.rooms.Load(markerID); ok {
-		if conn, ok := roomConns.Load(clientID); ok {
-			close(conn.Send)
-			close(conn.InActiveChan)
+		if conn, ok := roomConns.LoadAndDelete(clientID); ok {
+			conn.shutdown()
 			conn.Socket.Close()
-			roomConns.Delete(clientID)
 
 			if roomConns.Size() == 0 {
 				s.WebSocketManager.rooms.Delete(markerID)
@@ -393,54 +361,25 @@ func (s *ChatService) GetAllRedisConnectionsFromRoom(markerID string) ([]dto.Con
 	return connections, nil
 }
 
-func (s *ChatService) BanUser(markerID, userID string, duration time.Duration) error {
-	// First, kick the user from the room.
-	err := s.KickUserFromRoom(markerID, userID)
-	if err != nil {
-		log.Printf("Error kicking user %s from room %s: %v", userID, markerID, err)
-	}
-
-	// Then, set the ban in Redis.
-	banKey := fmt.Sprintf("ban_%s_%s", markerID, userID)
-	ctx := context.Background()
-
-	// Use Set to set the ban in Redis
-	cmd := s.Redis.Core.Client.B().Set().Key(banKey).Value("banned").Nx().Ex(duration).Build()
-	return s.Redis.Core.Client.Do(ctx, cmd).Error()
-}
-
-func (s *ChatService) GetBanDetails(markerID, userID string) (bool, time.Duration, error) {
-	banKey := "ban_" + markerID + "_" + userID
-	ctx := context.Background()
-
-	// Use PTTL to get the remaining TTL in milliseconds
-	cmd := s.Redis.Core.Client.B().Pttl().Key(banKey).Build()
-	ttl, err := s.Redis.Core.Client.Do(ctx, cmd).AsInt64()
-	if err != nil {
-		return false, 0, err
-	}
-
-	if ttl == -2 {
-		// Key does not exist
-		return false, 0, nil
-	}
-
-	banned := true
-	var remainingTime time.Duration
-	if ttl == -1 {
-		// Key exists but no expiration is set (banned indefinitely)
-		remainingTime = 0
-	} else {
-		remainingTime = time.Duration(ttl) * time.Millisecond
+// writeCloseFrame sends the close frame of a kick with a reason (bans) and closes the socket,
+// nobody else closes it then
+func (conn *ChulbongConn) writeCloseFrame() bool {
+	frame := conn.closeFrame.Load()
+	if frame == nil {
+		return false
 	}
-
-	return banned, remainingTime, nil
+	conn.Socket.WriteMessage(websocket.CloseMessage, *frame)
+	conn.Socket.Close()
+	return true
 }
 
 func (conn *ChulbongConn) writePump() {
 	for {
 		select {
 		case <-conn.InActiveChan:
+			if conn.writeCloseFrame() {
+				return
+			}
 			// conn.Socket.WriteJSON(fiber.Map{"error": "inactive connection"})
 			// time.Sleep(500 * time.Millisecond)
 			conn.Socket.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "inactive"))
@@ -448,6 +387,9 @@ func (conn *ChulbongConn) writePump() {
 			return
 		case message, ok := <-conn.Send:
 			if !ok {
+				if conn.writeCloseFrame() {
+					return
+				}
 				conn.Socket.WriteMessage(websocket.CloseMessage, []byte{})
 				return
 			}
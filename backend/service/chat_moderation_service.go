@@ -0,0 +1,316 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Alfex4936/chulbong-kr/dto"
+	"github.com/redis/rueidis"
+	"go.uber.org/zap"
+)
+
+const (
+	chatBurst           = 5.0 // frames a connection can send at once
+	chatRefillPerSecond = 1.0
+	chatMaxRepeats      = 2 // the third identical message in a row is dropped
+	chatRepeatWindow    = 30 * time.Second
+	maxSlowModeSeconds  = 300
+	maxReportReasonLen  = 200
+
+	// a message is a strike once this many distinct accounts or addresses reported it
+	chatReportEscalation = 3
+
+	// every flood, repeat or widely reported message is a strike, strikes are forgotten an hour after the last one
+	chatStrikeWindow        = time.Hour
+	chatStrikeMuteThreshold = 3
+	chatStrikeBanThreshold  = 6
+	chatAutoMuteDuration    = 15 * time.Minute
+	chatAutoBanDuration     = 30 * time.Minute
+
+	insertChatReportQuery = `
+INSERT INTO ChatReports (MarkerID, MessageUID, ReporterID, ReportedUserID, Message, Reason, CreatedAt)
+VALUES (?, ?, ?, ?, ?, ?, NOW())`
+
+	getChatReportsQuery = `
+SELECT ReportID, MarkerID, MessageUID, ReporterID, ReportedUserID, Message, Reason, CreatedAt
+FROM ChatReports
+ORDER BY CreatedAt DESC, ReportID DESC
+LIMIT ? OFFSET ?`
+)
+
+// chatFloodState is the per connection part of moderation, only the connection's read loop touches it
+type chatFloodState struct {
+	tokens     float64
+	refilledAt time.Time
+	limited    bool
+
+	lastText   string
+	lastSentAt time.Time
+	repeats    int
+}
+
+// take refills the token bucket and spends one token.
+// first is true for the first rejected frame of a burst so a flood is only counted once.
+func (f *chatFloodState) take(now time.Time) (ok, first bool) {
+	if f.refilledAt.IsZero() {
+		f.tokens = chatBurst
+	} else {
+		f.tokens = min(chatBurst, f.tokens+now.Sub(f.refilledAt).Seconds()*chatRefillPerSecond)
+	}
+	f.refilledAt = now
+
+	if f.tokens < 1 {
+		first = !f.limited
+		f.limited = true
+		return false, first
+	}
+	f.tokens--
+	f.limited = false
+	return true, false
+}
+
+// repeated counts the same text sent in a row, case and spacing don't make a message different
+func (f *chatFloodState) repeated(text string, now time.Time) bool {
+	normalized := strings.Join(strings.Fields(strings.ToLower(text)), " ")
+	if normalized == f.lastText && now.Sub(f.lastSentAt) < chatRepeatWindow {
+		f.repeats++
+	} else {
+		f.lastText = normalized
+		f.repeats = 1
+	}
+	f.lastSentAt = now
+	return f.repeats > chatMaxRepeats
+}
+
+func slowModeKey(markerID string) string {
+	return fmt.Sprintf("chat:room:%s:slowmode", markerID)
+}
+
+func shadowMuteKey(subject string) string {
+	return fmt.Sprintf("chat:shadowmute:%s", subject)
+}
+
+// chatSubject is who moderation counts against, the account or the address of an anonymous user,
+// so a new request-id doesn't start over. It's the request-id only when neither is known.
+func chatSubject(userID string, accountID int, ip string) string {
+	subjects := chatBanSubjects(userID, accountID, ip)
+	return subjects[len(subjects)-1]
+}
+
+func (c *ChulbongConn) moderationSubject() string {
+	return chatSubject(c.UserID, c.AccountID, c.RemoteIP)
+}
+
+// AllowFrame applies the connection's rate limit to any frame but typing
+func (s *ChatService) AllowFrame(markerID string, conn *ChulbongConn) error {
+	ok, first := conn.flood.take(time.Now())
+	if ok {
+		return nil
+	}
+	if first {
+		s.strike(markerID, conn.UserID, conn.AccountID, conn.RemoteIP, "flooding")
+	}
+	return ErrChatRateLimited
+}
+
+// ModerateChat runs a chat message through repeat detection and slow mode.
+// muted is true when the sender is shadow-muted, the message then only goes back to them.
+func (s *ChatService) ModerateChat(ctx context.Context, markerID string, conn *ChulbongConn, text string) (muted bool, err error) {
+	if conn.flood.repeated(text, time.Now()) {
+		s.strike(markerID, conn.UserID, conn.AccountID, conn.RemoteIP, "repeated messages")
+		return false, ErrChatRepeated
+	}
+
+	var muteKeys []string
+	for _, subject := range chatBanSubjects(conn.UserID, conn.AccountID, conn.RemoteIP) {
+		muteKeys = append(muteKeys, shadowMuteKey(subject))
+	}
+
+	client := s.Redis.Core.Client
+	resps := client.DoMulti(ctx,
+		client.B().Exists().Key(muteKeys...).Build(),
+		client.B().Get().Key(slowModeKey(markerID)).Build(),
+	)
+
+	// moderation state is best effort, Redis hiccups shouldn't silence every room
+	if n, err := resps[0].AsInt64(); err == nil {
+		muted = n > 0
+	} else {
+		s.Logger.Warn("Failed to check shadow mute", zap.String("userID", conn.UserID), zap.Error(err))
+	}
+
+	seconds, err := resps[1].AsInt64()
+	if err != nil || seconds <= 0 {
+		return muted, nil
+	}
+
+	key := fmt.Sprintf("chat:room:%s:slow:%s", markerID, conn.moderationSubject())
+	err = client.Do(ctx, client.B().Set().Key(key).Value("1").Nx().ExSeconds(seconds).Build()).Error()
+	if rueidis.IsRedisNil(err) {
+		return muted, ErrChatSlowMode
+	}
+	return muted, nil
+}
+
+// SetSlowMode sets the seconds a user has to wait between messages in a room, 0 turns it off
+func (s *ChatService) SetSlowMode(markerID string, seconds int) error {
+	ctx := context.Background()
+	client := s.Redis.Core.Client
+
+	if seconds <= 0 {
+		return client.Do(ctx, client.B().Del().Key(slowModeKey(markerID)).Build()).Error()
+	}
+	seconds = min(seconds, maxSlowModeSeconds)
+	return client.Do(ctx, client.B().Set().Key(slowModeKey(markerID)).Value(strconv.Itoa(seconds)).Build()).Error()
+}
+
+// ShadowMute keeps the user's messages to themselves in every room.
+// Admins mute by request-id, the account or address comes from the user's connection like a ban.
+func (s *ChatService) ShadowMute(userID string, duration time.Duration) error {
+	var accountID int
+	var ip string
+	if conn := s.findConnection("", userID); conn != nil {
+		accountID, ip = conn.AccountID, conn.RemoteIP
+	}
+	return s.shadowMute(userID, accountID, ip, duration)
+}
+
+// shadowMute stores the mute under every subject, each holding the account or address so Unmute finds it
+func (s *ChatService) shadowMute(userID string, accountID int, ip string, duration time.Duration) error {
+	subject := chatSubject(userID, accountID, ip)
+
+	client := s.Redis.Core.Client
+	var cmds rueidis.Commands
+	for _, key := range chatBanSubjects(userID, accountID, ip) {
+		cmds = append(cmds, client.B().Set().Key(shadowMuteKey(key)).Value(subject).Ex(duration).Build())
+	}
+	for _, resp := range client.DoMulti(context.Background(), cmds...) {
+		if err := resp.Error(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Unmute lifts the mute of the request-id along with the account or address it covers
+func (s *ChatService) Unmute(userID string) error {
+	ctx := context.Background()
+	client := s.Redis.Core.Client
+
+	keys := []string{shadowMuteKey(userID)}
+	// mutes set before they held the subject hold "1"
+	subject, err := client.Do(ctx, client.B().Get().Key(keys[0]).Build()).ToString()
+	if err == nil && strings.Contains(subject, ":") {
+		keys = append(keys, shadowMuteKey(subject))
+	}
+	return client.Do(ctx, client.B().Del().Key(keys...).Build()).Error()
+}
+
+// authorIdentity is the account or address behind a message's author. Their connection knows both,
+// once they are gone from this instance only the account the message was stored with is left.
+func (s *ChatService) authorIdentity(ctx context.Context, markerID, userID, uid string) (int, string) {
+	if conn := s.findConnection(markerID, userID); conn != nil {
+		return conn.AccountID, conn.RemoteIP
+	}
+
+	client := s.Redis.Core.Client
+	author, err := client.Do(ctx, client.B().Get().Key(chatAuthorKey(uid)).Build()).ToString()
+	if err != nil {
+		return 0, ""
+	}
+	if id, ok := strings.CutPrefix(author, "account:"); ok {
+		accountID, _ := strconv.Atoi(id)
+		return accountID, ""
+	}
+	return 0, ""
+}
+
+// ReportMessage records a report on a stored message, each reporter counts once per message.
+// The author gets a strike when enough distinct reporters agree, not for every report.
+func (s *ChatService) ReportMessage(ctx context.Context, markerID string, conn *ChulbongConn, uid, reason string) error {
+	msg, _, err := s.findStoredMessage(ctx, markerID, uid)
+	if err != nil {
+		return err
+	}
+	if msg.Deleted || msg.Kind != dto.ChatKindChat {
+		return ErrChatMessageNotFound
+	}
+	if msg.UserID == conn.UserID {
+		return ErrChatSelfReport
+	}
+
+	if r := []rune(strings.TrimSpace(reason)); len(r) > maxReportReasonLen {
+		reason = string(r[:maxReportReasonLen])
+	}
+
+	key := fmt.Sprintf("chat:reports:%s", uid)
+	client := s.Redis.Core.Client
+	resps := client.DoMulti(ctx,
+		client.B().Sadd().Key(key).Member(conn.moderationSubject()).Build(),
+		client.B().Scard().Key(key).Build(),
+		client.B().Expire().Key(key).Seconds(MAX_MESSAGE_RETAIN*3600).Build(),
+	)
+	added, err := resps[0].AsInt64()
+	if err != nil {
+		return err
+	}
+	if added == 0 {
+		return nil // already reported by this user
+	}
+
+	if _, err := s.DB.Exec(insertChatReportQuery, markerID, uid, conn.UserID, msg.UserID, msg.Message, reason); err != nil {
+		return fmt.Errorf("error inserting chat report: %w", err)
+	}
+
+	// only the reporter that reaches the threshold escalates, later ones just add to the admin list
+	if reporters, err := resps[1].AsInt64(); err == nil && reporters == chatReportEscalation {
+		accountID, ip := s.authorIdentity(ctx, markerID, msg.UserID, uid)
+		s.strike(markerID, msg.UserID, accountID, ip, "reported by users")
+	}
+	return nil
+}
+
+// GetChatReports returns reported messages, newest first
+func (s *ChatService) GetChatReports(page, pageSize int) ([]dto.ChatReport, error) {
+	offset := (page - 1) * pageSize
+
+	reports := make([]dto.ChatReport, 0, pageSize)
+	if err := s.DB.Select(&reports, getChatReportsQuery, pageSize, offset); err != nil {
+		return nil, fmt.Errorf("error fetching chat reports: %w", err)
+	}
+	return reports, nil
+}
+
+// strike counts a violation against the account or address and escalates,
+// first to a shadow-mute and then to a ban from the room
+func (s *ChatService) strike(markerID, userID string, accountID int, ip, reason string) {
+	ctx := context.Background()
+	key := fmt.Sprintf("chat:strikes:%s:%s", markerID, chatSubject(userID, accountID, ip))
+
+	client := s.Redis.Core.Client
+	resps := client.DoMulti(ctx,
+		client.B().Incr().Key(key).Build(),
+		client.B().Expire().Key(key).Seconds(int64(chatStrikeWindow.Seconds())).Build(),
+	)
+	strikes, err := resps[0].AsInt64()
+	if err != nil {
+		s.Logger.Warn("Failed to count chat strike", zap.String("userID", userID), zap.Error(err))
+		return
+	}
+
+	switch {
+	case strikes >= chatStrikeBanThreshold:
+		client.Do(ctx, client.B().Del().Key(key).Build())
+		ban := dto.ChatBan{MarkerID: markerID, UserID: userID, AccountID: accountID, IP: ip, Reason: "자동 차단: " + reason}
+		if _, err := s.Ban(ban, chatAutoBanDuration); err != nil {
+			s.Logger.Error("Failed to auto ban chat user", zap.String("userID", userID), zap.Error(err))
+		}
+	case strikes == chatStrikeMuteThreshold:
+		if err := s.shadowMute(userID, accountID, ip, chatAutoMuteDuration); err != nil {
+			s.Logger.Error("Failed to auto mute chat user", zap.String("userID", userID), zap.Error(err))
+		}
+	}
+}
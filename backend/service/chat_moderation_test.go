@@ -0,0 +1,48 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChatFloodStateTake(t *testing.T) {
+	var f chatFloodState
+	now := time.Now()
+
+	for i := 0; i < int(chatBurst); i++ {
+		ok, _ := f.take(now)
+		assert.True(t, ok, "burst %d", i)
+	}
+
+	ok, first := f.take(now)
+	assert.False(t, ok)
+	assert.True(t, first)
+
+	// the flood is only reported once
+	ok, first = f.take(now)
+	assert.False(t, ok)
+	assert.False(t, first)
+
+	ok, _ = f.take(now.Add(time.Second))
+	assert.True(t, ok, "refilled after a second")
+}
+
+func TestChatFloodStateRepeated(t *testing.T) {
+	var f chatFloodState
+	now := time.Now()
+
+	assert.False(t, f.repeated("철봉 어디?", now))
+	assert.False(t, f.repeated("철봉  어디?", now))
+	assert.True(t, f.repeated("철봉 어디?", now), "third time in a row")
+
+	assert.False(t, f.repeated("다른 말", now))
+	assert.False(t, f.repeated("다른 말", now.Add(chatRepeatWindow+time.Second)), "window passed")
+}
+
+func TestChatSubject(t *testing.T) {
+	assert.Equal(t, "account:7", chatSubject("req-1", 7, "10.0.0.1"))
+	assert.Equal(t, "ip:10.0.0.1", chatSubject("req-1", 0, "10.0.0.1"))
+	assert.Equal(t, "req-1", chatSubject("req-1", 0, ""), "nothing but the request-id is known")
+}
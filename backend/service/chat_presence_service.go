@@ -0,0 +1,203 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Alfex4936/chulbong-kr/dto"
+	sonic "github.com/bytedance/sonic"
+	"github.com/puzpuzpuz/xsync/v3"
+	"github.com/redis/rueidis"
+	"github.com/rs/xid"
+	"go.uber.org/zap"
+)
+
+const (
+	chatIdleAfter          = 2 * time.Minute
+	chatPresenceRefresh    = 30 * time.Second
+	chatPresenceStaleAfter = 3 * chatPresenceRefresh // the node holding the connection is gone
+	chatTypingDebounce     = 3 * time.Second
+)
+
+// chatPresenceState is what this node last wrote about a connection, nil until the user joined
+type chatPresenceState struct {
+	info dto.ConnectionInfo
+	idle bool
+}
+
+// JoinPresence lists the connection in the room's presence, accountID is 0 for anonymous users.
+// If Redis fails the next refresh adds it.
+func (s *ChatService) JoinPresence(markerID string, conn *ChulbongConn, accountID int, accountName string) {
+	now := time.Now().UnixMilli()
+	state := &chatPresenceState{info: dto.ConnectionInfo{
+		UserID:      conn.UserID,
+		RoomID:      markerID,
+		Username:    conn.Nickname,
+		ConnID:      xid.New().String(),
+		AccountID:   accountID,
+		AccountName: accountName,
+		JoinedAt:    now,
+		LastSeen:    now,
+		RefreshedAt: now,
+	}}
+	conn.presence.Store(state)
+
+	if err := s.AddConnectionRoomToRedis(state.info); err != nil {
+		s.Logger.Warn("Failed to save presence", zap.String("markerID", markerID), zap.Error(err))
+	}
+}
+
+// Typing broadcasts a typing event unless the connection already did in the last few seconds
+func (s *ChatService) Typing(markerID string, conn *ChulbongConn) {
+	now := time.Now()
+	if now.Sub(conn.typingAt) < chatTypingDebounce {
+		return
+	}
+	conn.typingAt = now
+	s.BroadcastTyping(markerID, conn.UserID, conn.Nickname)
+}
+
+// GetPresence lists who is in the room on every node, entries of nodes that stopped refreshing are dropped
+func (s *ChatService) GetPresence(ctx context.Context, markerID string) ([]dto.ChatPresenceUser, error) {
+	key := fmt.Sprintf("room:%s:connections", markerID)
+	client := s.Redis.Core.Client
+
+	result, err := client.Do(ctx, client.B().Hgetall().Key(key).Build()).AsStrMap()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	users := make([]dto.ChatPresenceUser, 0, len(result))
+	var stale []string
+	for field, value := range result {
+		var info dto.ConnectionInfo
+		if err := sonic.UnmarshalString(value, &info); err != nil || info.RefreshedAt == 0 {
+			stale = append(stale, field) // written before presence existed
+			continue
+		}
+		if now.Sub(time.UnixMilli(info.RefreshedAt)) > chatPresenceStaleAfter {
+			stale = append(stale, field)
+			continue
+		}
+		users = append(users, newChatPresenceUser(info, now))
+	}
+
+	if len(stale) > 0 {
+		if err := client.Do(ctx, client.B().Hdel().Key(key).Field(stale...).Build()).Error(); err != nil {
+			s.Logger.Warn("Failed to prune stale presence", zap.String("markerID", markerID), zap.Error(err))
+		}
+	}
+
+	slices.SortFunc(users, func(a, b dto.ChatPresenceUser) int {
+		return cmp.Or(cmp.Compare(a.JoinedAt, b.JoinedAt), strings.Compare(a.UserID, b.UserID))
+	})
+	return users, nil
+}
+
+// GetPresenceCount is the number of users in the room on every node, the local count if Redis fails
+func (s *ChatService) GetPresenceCount(ctx context.Context, markerID string) int {
+	count, err := s.GetUserCountInRoom(ctx, markerID)
+	if err != nil || count == 0 {
+		local, _ := s.GetUserCountInRoomByLocal(markerID)
+		return local
+	}
+	return int(count)
+}
+
+// RefreshPresence rewrites the presence of this node's connections so other nodes know they're still here,
+// users whose idle status changed since the last refresh are announced to the room
+func (s *ChatService) RefreshPresence(ctx context.Context) {
+	now := time.Now()
+	client := s.Redis.Core.Client
+
+	s.WebSocketManager.rooms.Range(func(markerID string, roomConns *xsync.MapOf[string, *ChulbongConn]) bool {
+		if strings.HasPrefix(markerID, directRoomPrefix) {
+			return true
+		}
+
+		key := fmt.Sprintf("room:%s:connections", markerID)
+		cmds := make(rueidis.Commands, 0, roomConns.Size()+1)
+		var changed []*chatPresenceState
+
+		roomConns.Range(func(_ string, conn *ChulbongConn) bool {
+			old := conn.presence.Load()
+			if old == nil {
+				return true
+			}
+
+			next := &chatPresenceState{info: old.info}
+			next.info.LastSeen = conn.GetLastSeen().UnixMilli()
+			next.info.RefreshedAt = now.UnixMilli()
+			next.idle = now.Sub(conn.GetLastSeen()) >= chatIdleAfter
+			if !conn.presence.CompareAndSwap(old, next) {
+				return true // left or rejoined meanwhile
+			}
+			if next.idle != old.idle {
+				changed = append(changed, next)
+			}
+
+			value, err := sonic.Marshal(next.info)
+			if err != nil {
+				return true
+			}
+			cmds = append(cmds, client.B().Hset().Key(key).FieldValue().FieldValue(next.info.UserID, rueidis.BinaryString(value)).Build())
+			return true
+		})
+
+		if len(cmds) > 0 {
+			cmds = append(cmds, client.B().Expire().Key(key).Seconds(int64(time.Hour/time.Second)).Build())
+			for _, resp := range client.DoMulti(ctx, cmds...) {
+				if err := resp.Error(); err != nil {
+					s.Logger.Warn("Failed to refresh presence", zap.String("markerID", markerID), zap.Error(err))
+					break
+				}
+			}
+		}
+
+		for _, state := range changed {
+			presence := dto.ChatPresenceActive
+			if state.idle {
+				presence = dto.ChatPresenceIdle
+			}
+			event := NewChatEvent(dto.ChatKindPresence, markerID, state.info.UserID, state.info.Username, "")
+			event.Presence = presence
+			s.BroadcastMessageToRoomByDTO(event)
+		}
+		return true
+	})
+}
+
+func (s *ChatService) runPresenceRefresher(ctx context.Context) {
+	ticker := time.NewTicker(chatPresenceRefresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.RefreshPresence(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func newChatPresenceUser(info dto.ConnectionInfo, now time.Time) dto.ChatPresenceUser {
+	status := dto.ChatPresenceActive
+	if now.Sub(time.UnixMilli(info.LastSeen)) >= chatIdleAfter {
+		status = dto.ChatPresenceIdle
+	}
+	return dto.ChatPresenceUser{
+		UserID:      info.UserID,
+		Nickname:    info.Username,
+		AccountID:   info.AccountID,
+		AccountName: info.AccountName,
+		Status:      status,
+		JoinedAt:    info.JoinedAt,
+		LastSeen:    info.LastSeen,
+	}
+}
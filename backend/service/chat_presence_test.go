@@ -0,0 +1,49 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Alfex4936/chulbong-kr/dto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChatPresence(t *testing.T) {
+	t.Run("Status", func(t *testing.T) {
+		now := time.Now()
+		info := dto.ConnectionInfo{UserID: "a1", Username: "철봉왕", AccountID: 7, JoinedAt: now.Add(-time.Hour).UnixMilli()}
+
+		info.LastSeen = now.Add(-time.Minute).UnixMilli()
+		user := newChatPresenceUser(info, now)
+		assert.Equal(t, dto.ChatPresenceActive, user.Status)
+		assert.Equal(t, 7, user.AccountID)
+		assert.Equal(t, "철봉왕", user.Nickname)
+
+		info.LastSeen = now.Add(-chatIdleAfter).UnixMilli()
+		assert.Equal(t, dto.ChatPresenceIdle, newChatPresenceUser(info, now).Status)
+	})
+
+	t.Run("TypingDebounce", func(t *testing.T) {
+		broker := NewInProcessChatBroker()
+		defer broker.Close()
+
+		nodeA, nodeB := newTestChatNode(t, broker), newTestChatNode(t, broker)
+		a1 := joinTestRoom(nodeA, "1", "a1")
+		b1 := joinTestRoom(nodeB, "1", "b1")
+
+		nodeA.Typing("1", a1)
+		nodeA.Typing("1", a1)
+		events := receiveEvents(t, b1, 1)
+		assert.Equal(t, dto.ChatKindTyping, events[0].Kind)
+		assert.Equal(t, "a1", events[0].UserID)
+
+		a1.typingAt = time.Now().Add(-chatTypingDebounce)
+		nodeA.Typing("1", a1)
+		receiveEvents(t, b1, 1)
+
+		require.NoError(t, broker.Close())
+		assert.Empty(t, b1.Send, "typing within the debounce is dropped")
+		assert.Empty(t, a1.Send, "the typing user isn't told")
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/Alfex4936/chulbong-kr/dto"
@@ -11,8 +12,13 @@ import (
 	sonic "github.com/bytedance/sonic"
 )
 
-// ProcessMessageFromSubscription processes a message from a Redis subscription
-func (s *ChatService) ProcessMessageFromSubscription(msg []byte) {
+// ProcessMessageFromSubscription delivers an event published by any node to the room's connections on this node
+func (s *ChatService) ProcessMessageFromSubscription(roomID string, msg []byte) {
+	if strings.HasPrefix(roomID, directRoomPrefix) {
+		s.processDirectFromSubscription(roomID, msg)
+		return
+	}
+
 	var broadcastMsg dto.BroadcastMessage
 	err := sonic.Unmarshal(msg, &broadcastMsg)
 	if err != nil {
@@ -26,11 +32,26 @@ func (s *ChatService) ProcessMessageFromSubscription(msg []byte) {
 
 	s.WebSocketManager.markAsProcessed(broadcastMsg.UID) // Mark the message as processed locally
 
-	// then broadcast
-	if err := s.BroadcastMessageToRoom(broadcastMsg.RoomID, broadcastMsg.Message, broadcastMsg.UserNickname, broadcastMsg.UserID); err != nil {
-		log.Printf("Error broadcasting message: %v", err)
+	// then deliver as is, so the kind and uid survive the hop
+	broadcastMsg.RoomID = roomID
+	s.deliverToRoom(broadcastMsg)
+}
+
+// processDirectFromSubscription delivers direct message events as they are, only the uid is read
+func (s *ChatService) processDirectFromSubscription(roomID string, msg []byte) {
+	var event struct {
+		UID string `json:"uid"`
+	}
+	if err := sonic.Unmarshal(msg, &event); err != nil {
+		log.Printf("Error unmarshalling direct event: %v", err)
+		return
+	}
+
+	if s.WebSocketManager.hasProcessed(event.UID) {
 		return
 	}
+	s.WebSocketManager.markAsProcessed(event.UID)
+	s.deliverRawToRoom(roomID, msg)
 }
 
 // Clean every hour
@@ -0,0 +1,475 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Alfex4936/chulbong-kr/dto"
+	"github.com/redis/rueidis"
+	"github.com/rs/xid"
+	"github.com/vmihailenco/msgpack/v5"
+	"go.uber.org/zap"
+)
+
+const (
+	chatReplayLimit   = 200         // at most this many missed messages are replayed on resume
+	chatUIDWindow     = time.Minute // a message's timestamp is taken right after its xid is generated
+	maxReactionLength = 16
+)
+
+// legacyBroadcastMessage is how messages were stored before the typed envelope (6 field msgpack array)
+type legacyBroadcastMessage struct {
+	Timestamp    int64
+	UID          string
+	Message      string
+	UserID       string
+	UserNickname string
+	RoomID       string
+}
+
+// envelopeV1BroadcastMessage is the typed envelope before attachments and locations
+type envelopeV1BroadcastMessage struct {
+	Timestamp    int64
+	UID          string
+	Message      string
+	UserID       string
+	UserNickname string
+	RoomID       string
+	Version      int
+	Kind         string
+	TargetUID    string
+	Reaction     string
+	Reactions    map[string]int
+	EditedAt     int64
+	Deleted      bool
+	Presence     string
+	UserCount    int
+	Error        string
+}
+
+// NewChatEvent creates an envelope with a fresh uid
+func NewChatEvent(kind, roomID, userID, nickname, message string) dto.BroadcastMessage {
+	return dto.BroadcastMessage{
+		Version:      dto.ChatProtocolVersion,
+		Kind:         kind,
+		UID:          xid.New().String(),
+		Message:      message,
+		UserID:       userID,
+		UserNickname: nickname,
+		RoomID:       roomID,
+		Timestamp:    time.Now().UnixMilli(),
+	}
+}
+
+// normalizeEvent fills in the version and kind for messages built before the typed protocol
+func normalizeEvent(msg *dto.BroadcastMessage) {
+	if msg.Version == 0 {
+		msg.Version = dto.ChatProtocolVersion
+	}
+	if msg.Kind == "" {
+		msg.Kind = dto.ChatKindChat
+	}
+}
+
+// ClaimMessageUID returns false if the uid was already handled by this instance
+func (s *ChatService) ClaimMessageUID(uid string) bool {
+	if s.WebSocketManager.hasProcessed(uid) {
+		return false
+	}
+	s.WebSocketManager.markAsProcessed(uid)
+	return true
+}
+
+// SendChatMessage stores a chat message for replay and broadcasts it to the room
+func (s *ChatService) SendChatMessage(ctx context.Context, msg dto.BroadcastMessage) error {
+	normalizeEvent(&msg)
+	s.WebSocketManager.markAsProcessed(msg.UID) // skip it when it comes back from pub/sub
+
+	if err := s.SaveMessageToRedis(ctx, msg); err != nil {
+		// still deliver it live, it just won't be replayed
+		s.Logger.Warn("Failed to save chat message", zap.String("roomID", msg.RoomID), zap.Error(err))
+	}
+	s.Archive.Enqueue(msg)
+	return s.BroadcastMessageToRoomByDTO(msg)
+}
+
+// SendUserChatMessage sends a message a user wrote, remembering the connection's author key for edits and deletes
+func (s *ChatService) SendUserChatMessage(ctx context.Context, conn *ChulbongConn, msg dto.BroadcastMessage) error {
+	client := s.Redis.Core.Client
+	err := client.Do(ctx, client.B().Set().Key(chatAuthorKey(msg.UID)).Value(conn.authorKey).ExSeconds(MAX_MESSAGE_RETAIN*3600).Build()).Error()
+	if err != nil {
+		return err
+	}
+	return s.SendChatMessage(ctx, msg)
+}
+
+func chatAuthorKey(uid string) string {
+	return fmt.Sprintf("chat:author:%s", uid)
+}
+
+// checkAuthor returns ErrChatNotAuthor unless the connection wrote the message,
+// the UserID in a message is public so it can't tell
+func (s *ChatService) checkAuthor(ctx context.Context, conn *ChulbongConn, uid string) error {
+	client := s.Redis.Core.Client
+	author, err := client.Do(ctx, client.B().Get().Key(chatAuthorKey(uid)).Build()).ToString()
+	if rueidis.IsRedisNil(err) {
+		return ErrChatNotAuthor
+	}
+	if err != nil {
+		return err
+	}
+	if conn.authorKey == "" || author != conn.authorKey {
+		return ErrChatNotAuthor
+	}
+	return nil
+}
+
+// SendToClient sends an event to a single connection in the room (acks)
+func (s *ChatService) SendToClient(roomID, clientID string, msg dto.BroadcastMessage) {
+	roomConns, ok := s.WebSocketManager.rooms.Load(roomID)
+	if !ok {
+		return
+	}
+	conn, ok := roomConns.Load(clientID)
+	if !ok {
+		return
+	}
+
+	normalizeEvent(&msg)
+	select {
+	case conn.Send <- changePayloadToByte(msg):
+	default:
+	}
+}
+
+// Ack confirms a client frame, errMsg is empty when it was accepted
+func (s *ChatService) Ack(roomID, clientID, targetUID, errMsg string) {
+	ack := NewChatEvent(dto.ChatKindAck, roomID, clientID, "", "")
+	ack.TargetUID = targetUID
+	ack.Error = errMsg
+	s.SendToClient(roomID, clientID, ack)
+}
+
+// BroadcastTyping tells everyone but the typing user
+func (s *ChatService) BroadcastTyping(roomID, clientID, nickname string) {
+	roomConns, ok := s.WebSocketManager.rooms.Load(roomID)
+	if !ok {
+		return
+	}
+
+	event := NewChatEvent(dto.ChatKindTyping, roomID, clientID, nickname, "")
+	payload := changePayloadToByte(event)
+	roomConns.Range(func(id string, conn *ChulbongConn) bool {
+		if id == clientID {
+			return true
+		}
+		select {
+		case conn.Send <- payload:
+		default:
+		}
+		return true
+	})
+
+	// the typing user is only connected here, other nodes send it to everyone
+	s.publish(event)
+}
+
+// BroadcastPresence sends join/leave events, the message keeps the text older clients show
+func (s *ChatService) BroadcastPresence(roomID, clientID, nickname, presence string) {
+	var message string
+	switch presence {
+	case dto.ChatPresenceJoin:
+		message = nickname + " 님이 입장하셨습니다."
+	case dto.ChatPresenceLeave:
+		message = nickname + " 님이 퇴장하셨습니다."
+	}
+
+	event := NewChatEvent(dto.ChatKindPresence, roomID, clientID, nickname, message)
+	event.Presence = presence
+	event.UserCount = s.GetPresenceCount(context.Background(), roomID)
+	s.BroadcastMessageToRoomByDTO(event)
+}
+
+// EditMessage changes the text of a stored message, only its author can
+func (s *ChatService) EditMessage(ctx context.Context, roomID string, conn *ChulbongConn, uid, text string) (dto.BroadcastMessage, error) {
+	if err := s.checkAuthor(ctx, conn, uid); err != nil {
+		return dto.BroadcastMessage{}, err
+	}
+	updated, err := s.updateStoredMessage(ctx, roomID, uid, func(msg *dto.BroadcastMessage) error {
+		if msg.Deleted {
+			return ErrChatMessageNotFound
+		}
+		msg.Message = text
+		msg.EditedAt = time.Now().UnixMilli()
+		return nil
+	})
+	if err != nil {
+		return dto.BroadcastMessage{}, err
+	}
+
+	event := NewChatEvent(dto.ChatKindEdit, roomID, conn.UserID, updated.UserNickname, updated.Message)
+	event.TargetUID = uid
+	event.EditedAt = updated.EditedAt
+	return event, s.BroadcastMessageToRoomByDTO(event)
+}
+
+// DeleteMessage blanks a stored message so it replays as deleted
+func (s *ChatService) DeleteMessage(ctx context.Context, roomID string, conn *ChulbongConn, uid string) (dto.BroadcastMessage, error) {
+	if err := s.checkAuthor(ctx, conn, uid); err != nil {
+		return dto.BroadcastMessage{}, err
+	}
+	updated, err := s.updateStoredMessage(ctx, roomID, uid, func(msg *dto.BroadcastMessage) error {
+		msg.Message = ""
+		msg.Deleted = true
+		msg.Reactions = nil
+		return nil
+	})
+	if err != nil {
+		return dto.BroadcastMessage{}, err
+	}
+
+	event := NewChatEvent(dto.ChatKindDelete, roomID, conn.UserID, updated.UserNickname, "")
+	event.TargetUID = uid
+	return event, s.BroadcastMessageToRoomByDTO(event)
+}
+
+// ReactToMessage counts a reaction on a stored message and broadcasts the new totals
+func (s *ChatService) ReactToMessage(ctx context.Context, roomID, userID, nickname, uid, reaction string) (dto.BroadcastMessage, error) {
+	reaction = strings.TrimSpace(reaction)
+	if reaction == "" || len(reaction) > maxReactionLength {
+		return dto.BroadcastMessage{}, ErrInvalidChatFrame
+	}
+
+	updated, err := s.updateStoredMessage(ctx, roomID, uid, func(msg *dto.BroadcastMessage) error {
+		if msg.Deleted {
+			return ErrChatMessageNotFound
+		}
+		if msg.Reactions == nil {
+			msg.Reactions = make(map[string]int, 1)
+		}
+		msg.Reactions[reaction]++
+		return nil
+	})
+	if err != nil {
+		return dto.BroadcastMessage{}, err
+	}
+
+	event := NewChatEvent(dto.ChatKindReaction, roomID, userID, nickname, "")
+	event.TargetUID = uid
+	event.Reaction = reaction
+	event.Reactions = updated.Reactions
+	return event, s.BroadcastMessageToRoomByDTO(event)
+}
+
+// GetMessagesAfter returns what a reconnecting client missed since lastUID.
+// Unknown or empty uids fall back to the recent history.
+func (s *ChatService) GetMessagesAfter(ctx context.Context, roomID, lastUID string) ([]dto.BroadcastMessage, error) {
+	id, err := xid.FromString(lastUID)
+	if err != nil {
+		return s.GetRecentMessages(ctx, roomID)
+	}
+
+	key := fmt.Sprintf("chat:room:%s:messages", roomID)
+	min := strconv.FormatInt(id.Time().UnixMilli(), 10)
+
+	cmd := s.Redis.Core.Client.B().Zrangebyscore().Key(key).Min(min).Max("+inf").Build()
+	redisResult, err := s.Redis.Core.Client.Do(ctx, cmd).ToArray()
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]dto.BroadcastMessage, 0, len(redisResult))
+	for _, msgRedisMessage := range redisResult {
+		msgData, err := msgRedisMessage.AsBytes()
+		if err != nil {
+			return nil, err
+		}
+		msg, err := decodeStoredMessage(msgData)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+
+	return messagesAfter(messages, lastUID), nil
+}
+
+// GetChatHistory pages back through a room's messages, from the archive when there is one
+func (s *ChatService) GetChatHistory(ctx context.Context, markerID int, before string, limit int) (dto.ChatHistoryResponse, error) {
+	if s.Archive.Enabled() {
+		return s.Archive.History(markerID, before, limit)
+	}
+
+	roomID := strconv.Itoa(markerID)
+	max := "+inf"
+	if before != "" {
+		if ms, err := strconv.ParseInt(before, 10, 64); err == nil {
+			max = "(" + strconv.FormatInt(ms, 10)
+		} else {
+			_, entry, err := s.findStoredMessage(ctx, roomID, before)
+			if err != nil {
+				return dto.ChatHistoryResponse{}, err
+			}
+			max = "(" + strconv.FormatFloat(entry.Score, 'f', -1, 64)
+		}
+	}
+
+	key := fmt.Sprintf("chat:room:%s:messages", roomID)
+	client := s.Redis.Core.Client
+	cmd := client.B().Zrevrangebyscore().Key(key).Max(max).Min("-inf").Limit(0, int64(limit+1)).Build()
+	redisResult, err := client.Do(ctx, cmd).ToArray()
+	if err != nil {
+		return dto.ChatHistoryResponse{}, err
+	}
+
+	messages := make([]dto.BroadcastMessage, 0, len(redisResult))
+	for _, msgRedisMessage := range redisResult {
+		msgData, err := msgRedisMessage.AsBytes()
+		if err != nil {
+			return dto.ChatHistoryResponse{}, err
+		}
+		msg, err := decodeStoredMessage(msgData)
+		if err != nil {
+			return dto.ChatHistoryResponse{}, err
+		}
+		messages = append(messages, msg)
+	}
+	return newChatHistoryResponse(messages, limit), nil
+}
+
+// messagesAfter drops everything up to and including lastUID, messages are in score order
+func messagesAfter(messages []dto.BroadcastMessage, lastUID string) []dto.BroadcastMessage {
+	for i, msg := range messages {
+		if msg.UID == lastUID {
+			messages = messages[i+1:]
+			break
+		}
+	}
+	if len(messages) > chatReplayLimit {
+		messages = messages[len(messages)-chatReplayLimit:]
+	}
+	return messages
+}
+
+// updateStoredMessage finds a message by uid and swaps the zset member for the updated one.
+// Concurrent updates of the same message are last write wins.
+func (s *ChatService) updateStoredMessage(ctx context.Context, roomID, uid string, update func(*dto.BroadcastMessage) error) (dto.BroadcastMessage, error) {
+	msg, entry, err := s.findStoredMessage(ctx, roomID, uid)
+	if err != nil {
+		return dto.BroadcastMessage{}, err
+	}
+
+	if err := update(&msg); err != nil {
+		return dto.BroadcastMessage{}, err
+	}
+
+	updated, err := encodeStoredMessage(msg)
+	if err != nil {
+		return dto.BroadcastMessage{}, err
+	}
+
+	key := fmt.Sprintf("chat:room:%s:messages", roomID)
+	client := s.Redis.Core.Client
+	for _, resp := range client.DoMulti(ctx,
+		client.B().Zrem().Key(key).Member(entry.Member).Build(),
+		client.B().Zadd().Key(key).ScoreMember().ScoreMember(entry.Score, rueidis.BinaryString(updated)).Build(),
+	) {
+		if err := resp.Error(); err != nil {
+			return dto.BroadcastMessage{}, err
+		}
+	}
+	s.Archive.Enqueue(msg)
+	return msg, nil
+}
+
+// findStoredMessage looks a message up by uid, its xid tells roughly where it is in the zset
+func (s *ChatService) findStoredMessage(ctx context.Context, roomID, uid string) (dto.BroadcastMessage, rueidis.ZScore, error) {
+	id, err := xid.FromString(uid)
+	if err != nil {
+		return dto.BroadcastMessage{}, rueidis.ZScore{}, ErrChatMessageNotFound
+	}
+
+	key := fmt.Sprintf("chat:room:%s:messages", roomID)
+	from := id.Time().UnixMilli()
+	min := strconv.FormatInt(from, 10)
+	max := strconv.FormatInt(from+chatUIDWindow.Milliseconds(), 10)
+
+	client := s.Redis.Core.Client
+	entries, err := client.Do(ctx, client.B().Zrangebyscore().Key(key).Min(min).Max(max).Withscores().Build()).AsZScores()
+	if err != nil {
+		return dto.BroadcastMessage{}, rueidis.ZScore{}, err
+	}
+
+	for _, entry := range entries {
+		msg, err := decodeStoredMessage([]byte(entry.Member))
+		if err != nil || msg.UID != uid {
+			continue
+		}
+		return msg, entry, nil
+	}
+
+	return dto.BroadcastMessage{}, rueidis.ZScore{}, ErrChatMessageNotFound
+}
+
+func encodeStoredMessage(message dto.BroadcastMessage) ([]byte, error) {
+	var buf bytes.Buffer
+
+	// Create an encoder and set it to use array encoding
+	enc := msgpack.NewEncoder(&buf)
+	enc.UseArrayEncodedStructs(true)
+
+	if err := enc.Encode(message); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeStoredMessage reads the typed envelope and every older layout of it
+func decodeStoredMessage(data []byte) (dto.BroadcastMessage, error) {
+	var msg dto.BroadcastMessage
+	if err := msgpack.Unmarshal(data, &msg); err == nil {
+		return msg, nil
+	}
+
+	var v1 envelopeV1BroadcastMessage
+	if err := msgpack.Unmarshal(data, &v1); err == nil {
+		return dto.BroadcastMessage{
+			Timestamp:    v1.Timestamp,
+			UID:          v1.UID,
+			Message:      v1.Message,
+			UserID:       v1.UserID,
+			UserNickname: v1.UserNickname,
+			RoomID:       v1.RoomID,
+			Version:      v1.Version,
+			Kind:         v1.Kind,
+			TargetUID:    v1.TargetUID,
+			Reaction:     v1.Reaction,
+			Reactions:    v1.Reactions,
+			EditedAt:     v1.EditedAt,
+			Deleted:      v1.Deleted,
+			Presence:     v1.Presence,
+			UserCount:    v1.UserCount,
+			Error:        v1.Error,
+		}, nil
+	}
+
+	var legacy legacyBroadcastMessage
+	if err := msgpack.Unmarshal(data, &legacy); err != nil {
+		return msg, err
+	}
+
+	msg = dto.BroadcastMessage{
+		Timestamp:    legacy.Timestamp,
+		UID:          legacy.UID,
+		Message:      legacy.Message,
+		UserID:       legacy.UserID,
+		UserNickname: legacy.UserNickname,
+		RoomID:       legacy.RoomID,
+	}
+	normalizeEvent(&msg)
+	return msg, nil
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Alfex4936/chulbong-kr/dto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestDecodeStoredMessage(t *testing.T) {
+	t.Run("Legacy", func(t *testing.T) {
+		var buf bytes.Buffer
+		enc := msgpack.NewEncoder(&buf)
+		enc.UseArrayEncodedStructs(true)
+		require.NoError(t, enc.Encode(legacyBroadcastMessage{
+			Timestamp:    1700000000000,
+			UID:          "cs0l5a1v0o4c73e2d3kg",
+			Message:      "안녕하세요",
+			UserID:       "req-1",
+			UserNickname: "철봉왕",
+			RoomID:       "42",
+		}))
+
+		msg, err := decodeStoredMessage(buf.Bytes())
+		require.NoError(t, err)
+		assert.Equal(t, "안녕하세요", msg.Message)
+		assert.Equal(t, "42", msg.RoomID)
+		assert.Equal(t, dto.ChatKindChat, msg.Kind)
+		assert.Equal(t, dto.ChatProtocolVersion, msg.Version)
+	})
+
+	t.Run("EnvelopeV1", func(t *testing.T) {
+		var buf bytes.Buffer
+		enc := msgpack.NewEncoder(&buf)
+		enc.UseArrayEncodedStructs(true)
+		require.NoError(t, enc.Encode(envelopeV1BroadcastMessage{
+			Timestamp: 1700000000000,
+			UID:       "cs0l5a1v0o4c73e2d3kg",
+			Message:   "안녕하세요",
+			RoomID:    "42",
+			Version:   dto.ChatProtocolVersion,
+			Kind:      dto.ChatKindChat,
+			Reactions: map[string]int{"👍": 2},
+			EditedAt:  1700000000001,
+		}))
+
+		msg, err := decodeStoredMessage(buf.Bytes())
+		require.NoError(t, err)
+		assert.Equal(t, "안녕하세요", msg.Message)
+		assert.Equal(t, map[string]int{"👍": 2}, msg.Reactions)
+		assert.Equal(t, int64(1700000000001), msg.EditedAt)
+		assert.Nil(t, msg.Attachment)
+	})
+
+	t.Run("Envelope", func(t *testing.T) {
+		original := NewChatEvent(dto.ChatKindChat, "42", "req-1", "철봉왕", "턱걸이 하실 분")
+		original.Reactions = map[string]int{"👍": 2}
+		original.EditedAt = 1700000000001
+		original.Attachment = &dto.ChatAttachment{URL: "https://bucket.s3.amazonaws.com/chat/42/a.jpg", Blurhash: "LKO2?U%2Tw=w", Width: 640, Height: 480}
+		original.Location = &dto.ChatLocation{Latitude: 37.5665, Longitude: 126.978, Label: "정문"}
+
+		data, err := encodeStoredMessage(original)
+		require.NoError(t, err)
+
+		msg, err := decodeStoredMessage(data)
+		require.NoError(t, err)
+		assert.Equal(t, original, msg)
+	})
+}
+
+func TestMessagesAfter(t *testing.T) {
+	messages := []dto.BroadcastMessage{{UID: "a"}, {UID: "b"}, {UID: "c"}}
+
+	assert.Equal(t, []dto.BroadcastMessage{{UID: "c"}}, messagesAfter(messages, "b"))
+	assert.Empty(t, messagesAfter(messages, "c"))
+	// the last seen message may have been trimmed already, send the whole window
+	assert.Len(t, messagesAfter(messages, "z"), 3)
+
+	many := make([]dto.BroadcastMessage, chatReplayLimit+10)
+	assert.Len(t, messagesAfter(many, "z"), chatReplayLimit)
+}
@@ -13,14 +13,13 @@ import (
 
 	"github.com/Alfex4936/chulbong-kr/dto"
 	"github.com/jmoiron/sqlx"
-	"github.com/rs/xid"
 	"go.uber.org/fx"
 	"go.uber.org/zap"
 
 	"github.com/gofiber/contrib/websocket"
 	csmap "github.com/mhmtszr/concurrent-swiss-map"
 	"github.com/puzpuzpuz/xsync/v3"
-	"github.com/redis/rueidis"
+	"github.com/rs/xid"
 	"github.com/zeebo/xxh3"
 
 	sonic "github.com/bytedance/sonic"
@@ -51,25 +50,32 @@ type ChatService struct {
 	DB               *sqlx.DB
 	Redis            *RedisService
 	WebSocketManager *RoomConnectionManager
+	Broker           ChatBroker
+	Archive          *ChatArchiveService
 
 	Logger *zap.Logger
 }
 
-func NewChatService(lifecycle fx.Lifecycle, db *sqlx.DB, redis *RedisService, manager *RoomConnectionManager, l *zap.Logger) *ChatService {
+func NewChatService(lifecycle fx.Lifecycle, db *sqlx.DB, redis *RedisService, manager *RoomConnectionManager, broker ChatBroker, archive *ChatArchiveService, l *zap.Logger) *ChatService {
 	service := &ChatService{
 		DB:               db,
 		Redis:            redis,
 		WebSocketManager: manager,
+		Broker:           broker,
+		Archive:          archive,
 		Logger:           l,
 	}
 
+	presenceCtx, stopPresence := context.WithCancel(context.Background())
 	lifecycle.Append(fx.Hook{
 		OnStart: func(context.Context) error {
 			go service.processRetryQueue(retryCtx)
-			return nil
+			go service.runPresenceRefresher(presenceCtx)
+			return service.Broker.Subscribe(service.ProcessMessageFromSubscription)
 		},
 		OnStop: func(context.Context) error {
-			return nil
+			stopPresence()
+			return service.Broker.Close()
 		},
 	})
 
@@ -83,6 +89,28 @@ type ChulbongConn struct {
 	Socket       *websocket.Conn
 	Send         chan []byte
 	InActiveChan chan struct{}
+
+	// who is behind the request-id, set once when the socket joins and never broadcast
+	AccountID int // 0 for anonymous users
+	RemoteIP  string
+	authorKey string
+
+	closeFrame atomic.Pointer[[]byte] // written instead of the default close frame on shutdown
+	closeOnce  sync.Once
+	flood      chatFloodState
+	presence   atomic.Pointer[chatPresenceState]
+	typingAt   time.Time // only the read loop touches it
+}
+
+func newRoomConnectionManager() *RoomConnectionManager {
+	return &RoomConnectionManager{
+		rooms: xsync.NewMapOf[string, *xsync.MapOf[string, *ChulbongConn]](),
+		// no custom hasher, the swiss maps inside rehash with their own one when they grow
+		// and entries stored with a custom hash can't be found anymore
+		processedMessages: csmap.Create(
+			csmap.WithShardCount[string, struct{}](64),
+		),
+	}
 }
 
 type RoomConnectionManager struct {
@@ -98,21 +126,12 @@ func CustomXXH3Hasher(s string) uintptr {
 
 // NewRoomConnectionManager initializes a ConnectionManager with a new haxmap instance
 func NewRoomConnectionManager(lifecycle fx.Lifecycle) *RoomConnectionManager {
-	hasher := func(key string) uint64 {
-		return xxh3.HashString(key)
-	}
-
-	manager := &RoomConnectionManager{
-		rooms: xsync.NewMapOf[string, *xsync.MapOf[string, *ChulbongConn]](),
-		processedMessages: csmap.Create(
-			csmap.WithShardCount[string, struct{}](64),
-			csmap.WithCustomHasher[string, struct{}](hasher),
-		),
-	}
+	manager := newRoomConnectionManager()
 
 	lifecycle.Append(fx.Hook{
 		OnStart: func(context.Context) error {
 			go manager.StartConnectionChecker()
+			manager.StartCleanUpProcessedMsg()
 			return nil
 		},
 		OnStop: func(context.Context) error {
@@ -130,11 +149,9 @@ func (s *ChatService) BroadcastUserCountToRoom(roomID string) {
 		return
 	}
 
-	// LAVINMQ:
 	if userCount > 0 {
 		message := fmt.Sprintf("%s (%d명 접속 중)", roomID, userCount)
-		// PublishMessageToAMQP(context.Background(), roomID, message, "chulbong-kr", "")
-		s.BroadcastMessageToRoom(roomID, message, "chulbong-kr", "")
+		s.broadcastUserCount(roomID, message, int(userCount))
 	}
 }
 
@@ -145,35 +162,20 @@ func (s *ChatService) BroadcastUserCountToRoomByLocal(roomID string) {
 		return
 	}
 
-	// LAVINMQ:
 	if userCount > 0 {
 		message := roomID + " (" + strconv.Itoa(userCount) + "명 접속 중)"
-		// PublishMessageToAMQP(context.Background(), roomID, message, "chulbong-kr", "")
 
 		// Broadcast the user count message
-		s.BroadcastRawMessageToRoom(roomID, message)
+		s.broadcastUserCount(roomID, message, userCount)
 	}
 }
 
-// TODO: LAVINMQ
-// BroadcastMessageToRoom sends a WebSocket message to all users in a specific room LAVINMQ:
-func (s *ChatService) BroadcastMessageToRoom2(roomID string, msgJSON []byte) {
-	// key := fmt.Sprintf("marker_%s", roomID)
-
-	// // markAsProcessed(broadcastMsg.UID)
-
-	// // Retrieve the slice of connections for the given roomID from the manager's connections map
-	// if conns, ok := s.WebSocketManager.connections.Load(key); ok {
-	// 	// Iterate over the connections and send the message
-	// 	for _, conn := range conns {
-	// 		select {
-	// 		case conn.Send <- msgJSON:
-	// 			// Message enqueued to be sent by writePump goroutine
-	// 		default:
-	// 			// Handle full send channel, e.g., by logging or closing the connection
-	// 		}
-	// 	}
-	// }
+// broadcastUserCount sends a presence event, message is the text older clients show
+func (s *ChatService) broadcastUserCount(roomID, message string, userCount int) {
+	event := NewChatEvent(dto.ChatKindPresence, roomID, "", "chulbong-kr", message)
+	event.Presence = dto.ChatPresenceCount
+	event.UserCount = userCount
+	s.deliverToRoom(event) // counts are per node
 }
 
 // BroadcastMessageToRoom sends a WebSocket message to all users in a specific room
@@ -197,38 +199,51 @@ func (s *ChatService) BroadcastMessageToRoom(markerID, message, senderNickname,
 	return nil
 }
 
-// BroadcastMessageToRoom sends a WebSocket message to all users in a specific room
+// BroadcastMessageToRoomByDTO sends an event to everyone in the room, on this node and the others
 func (s *ChatService) BroadcastMessageToRoomByDTO(broadcastMsg dto.BroadcastMessage) error {
-	roomConns, ok := s.WebSocketManager.rooms.Load(broadcastMsg.RoomID)
+	s.deliverToRoom(broadcastMsg)
+	return s.publish(broadcastMsg)
+}
+
+// publish hands an event to the other nodes, it's marked processed so this node skips it when it comes back
+func (s *ChatService) publish(broadcastMsg dto.BroadcastMessage) error {
+	s.WebSocketManager.markAsProcessed(broadcastMsg.UID)
+	return s.Broker.Publish(context.Background(), broadcastMsg.RoomID, changePayloadToByte(broadcastMsg))
+}
+
+// SendRawToRoom is BroadcastMessageToRoomByDTO for payloads that aren't chat envelopes (direct messages)
+func (s *ChatService) SendRawToRoom(roomID, uid string, payload []byte) error {
+	s.deliverRawToRoom(roomID, payload)
+	s.WebSocketManager.markAsProcessed(uid)
+	return s.Broker.Publish(context.Background(), roomID, payload)
+}
+
+func (s *ChatService) deliverRawToRoom(roomID string, payload []byte) {
+	roomConns, ok := s.WebSocketManager.rooms.Load(roomID)
 	if !ok {
-		return nil // No connections in room
+		return
 	}
-
-	payload := changePayloadToByte(broadcastMsg)
-	roomConns.Range(func(clientID string, conn *ChulbongConn) bool {
+	roomConns.Range(func(_ string, conn *ChulbongConn) bool {
 		select {
 		case conn.Send <- payload:
-			// Message enqueued to be sent by writePump goroutine
 		default:
-			// Handle full send channel if necessary
 		}
 		return true
 	})
-	return nil
 }
 
-func (s *ChatService) BroadcastRawMessageToRoom(markerID, message string) {
-	roomConns, ok := s.WebSocketManager.rooms.Load(markerID)
+// deliverToRoom sends an event to the connections of the room on this node
+func (s *ChatService) deliverToRoom(broadcastMsg dto.BroadcastMessage) {
+	roomConns, ok := s.WebSocketManager.rooms.Load(broadcastMsg.RoomID)
 	if !ok {
 		return // No connections in room
 	}
 
-	payload := createMessagePayload(markerID, message, "chulbong-kr", "")
+	payload := changePayloadToByte(broadcastMsg)
 	roomConns.Range(func(clientID string, conn *ChulbongConn) bool {
 		select {
 		case conn.Send <- payload:
 			// Message enqueued to be sent by writePump goroutine
-			// s.Logger.Info("Broadcast user count to room", zap.String("roomID", markerID), zap.String("clientID", clientID))
 		default:
 			// Handle full send channel if necessary
 		}
@@ -236,16 +251,13 @@ func (s *ChatService) BroadcastRawMessageToRoom(markerID, message string) {
 	})
 }
 
+func (s *ChatService) BroadcastRawMessageToRoom(markerID, message string) {
+	s.BroadcastMessageToRoomByDTO(NewChatEvent(dto.ChatKindSystem, markerID, "", "chulbong-kr", message))
+}
+
 // BroadcastMessage sends a WebSocket message to all users in all rooms
 func (s *ChatService) BroadcastMessage(message []byte, userID, roomID, userNickname string) {
-	broadcastMsg := dto.BroadcastMessage{
-		UID:          xid.New().String(),
-		Message:      string(message),
-		UserID:       userID,
-		UserNickname: userNickname,
-		RoomID:       roomID,
-		Timestamp:    time.Now().UnixMilli(),
-	}
+	broadcastMsg := NewChatEvent(dto.ChatKindSystem, roomID, userID, userNickname, string(message))
 	// Serialize the message struct to JSON
 	msgJSON, err := sonic.ConfigFastest.Marshal(broadcastMsg)
 	if err != nil {
@@ -279,44 +291,48 @@ func (c *ChulbongConn) UpdateLastSeen() {
 	atomic.StoreInt64(&c.LastSeen, time.Now().UnixNano())
 }
 
-// Atomic read of the LastSeen timestamp.
-func (c *ChulbongConn) GetLastSeen() time.Time {
-	return time.Unix(0, atomic.LoadInt64(&c.LastSeen))
+// Identify records the account and address behind the connection. Messages are owned by the account,
+// or by this connection alone for anonymous users, since the request-id is public.
+func (c *ChulbongConn) Identify(accountID int, remoteIP string) {
+	c.AccountID, c.RemoteIP = accountID, remoteIP
+	if accountID > 0 {
+		c.authorKey = "account:" + strconv.Itoa(accountID)
+	} else {
+		c.authorKey = "conn:" + xid.New().String()
+	}
 }
 
-// SubscribeToChatUpdate to subscribe to messages
-func (s *ChatService) SubscribeToChatUpdate(markerID string) {
-	key := fmt.Sprintf("room:%s:messages", markerID)
-
-	// Using a dedicated connection for subscription
-	dedicatedClient, cancel := s.Redis.Core.Client.Dedicate()
-	defer cancel() // Ensure resources are cleaned up properly
-
-	// Set up pub/sub hooks
-	wait := dedicatedClient.SetPubSubHooks(rueidis.PubSubHooks{
-		OnMessage: func(m rueidis.PubSubMessage) {
-			// Handle incoming messages
-			fmt.Printf("Received message: %s\n", m.Message)
-		},
+// shutdown stops the writePump, it's safe to call from every removal path
+func (c *ChulbongConn) shutdown() {
+	c.closeOnce.Do(func() {
+		close(c.Send)
+		close(c.InActiveChan)
 	})
+}
 
-	// Subscribe to the channel
-	dedicatedClient.Do(context.Background(), dedicatedClient.B().Subscribe().Channel(key).Build())
-
-	// Use the wait channel to handle disconnection
-	err := <-wait // will receive a value if the client disconnects
-	if err != nil {
-		fmt.Printf("Disconnected due to: %v\n", err)
-	}
+// Atomic read of the LastSeen timestamp.
+func (c *ChulbongConn) GetLastSeen() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&c.LastSeen))
 }
 
-// PublishChatToRoom publishes a chat message to a specific room
-func (s *ChatService) PublishChatToRoom(markerID string, message []byte) error {
-	key := fmt.Sprintf("room:%s:messages", markerID)
+// IsChatRoom tells whether clients may join the room, a marker that exists or a region.
+// Other rooms in the connection manager, like the dm: ones, can't be joined from the public chat.
+func (s *ChatService) IsChatRoom(roomID string) (bool, error) {
+	for _, region := range regions {
+		if roomID == region.Code {
+			return true, nil
+		}
+	}
 
-	// Publish the serialized message to the Redis pub/sub system
-	err := s.Redis.Core.Client.Do(context.Background(), s.Redis.Core.Client.B().Publish().Channel(key).Message(rueidis.BinaryString(message)).Build()).Error()
-	return err
+	markerID, err := strconv.Atoi(roomID)
+	if err != nil || markerID <= 0 {
+		return false, nil
+	}
+	var exists bool
+	if err := s.DB.Get(&exists, markerCheckQuery, markerID); err != nil {
+		return false, fmt.Errorf("error checking marker %d: %w", markerID, err)
+	}
+	return exists, nil
 }
 
 func (s *ChatService) GetNickname(markerID, clientID string) (string, error) {
@@ -329,6 +345,8 @@ func (s *ChatService) GetNickname(markerID, clientID string) (string, error) {
 }
 
 func changePayloadToByte(broadcastMsg dto.BroadcastMessage) []byte {
+	normalizeEvent(&broadcastMsg)
+
 	buf := jsonBufferPool.Get().(*bytes.Buffer)
 	defer func() {
 		buf.Reset()
@@ -355,14 +373,7 @@ func createMessagePayload(markerID, message, senderNickname, senderUserID string
 		jsonBufferPool.Put(buf)
 	}()
 
-	broadcastMsg := dto.BroadcastMessage{
-		UID:          xid.New().String(),
-		Message:      message,
-		UserID:       senderUserID,
-		UserNickname: senderNickname,
-		RoomID:       markerID,
-		Timestamp:    time.Now().UnixMilli(),
-	}
+	broadcastMsg := NewChatEvent(dto.ChatKindChat, markerID, senderUserID, senderNickname, message)
 
 	encoder := sonic.ConfigFastest.NewEncoder(buf)
 	if err := encoder.Encode(broadcastMsg); err != nil {
@@ -34,6 +34,8 @@ ORDER BY
     C.PostedAt DESC
 LIMIT ? OFFSET ?`
 
+	getCommentMarkerIDQuery = "SELECT MarkerID FROM Comments WHERE CommentID = ?"
+
 	countCommentQuery = `
 SELECT COUNT(*)
 FROM Comments C
@@ -41,12 +43,16 @@ WHERE C.MarkerID = ? AND C.DeletedAt IS NULL`
 )
 
 type MarkerCommentService struct {
-	DB *sqlx.DB
+	DB                 *sqlx.DB
+	SearchIndexService *SearchIndexService
+	EventBus           *EventBus
 }
 
-func NewMarkerCommentService(db *sqlx.DB) *MarkerCommentService {
+func NewMarkerCommentService(db *sqlx.DB, searchIndex *SearchIndexService, bus *EventBus) *MarkerCommentService {
 	return &MarkerCommentService{
-		DB: db,
+		DB:                 db,
+		SearchIndexService: searchIndex,
+		EventBus:           bus,
 	}
 }
 
@@ -101,6 +107,16 @@ func (s *MarkerCommentService) CreateComment(markerID, userID int, userName, com
 		go util.SendSlackNewComment(markerID, userID, userName, commentText)
 	}
 
+	s.SearchIndexService.SyncMarkerAsync(markerID)
+	s.EventBus.Publish(DomainEvent{
+		Name:      EventMarkerCommented,
+		ActorID:   userID,
+		ActorName: userName,
+		MarkerID:  markerID,
+		CommentID: comment.CommentID,
+		Text:      commentText,
+	})
+
 	return &comment, nil
 }
 
@@ -121,6 +137,8 @@ func (s *MarkerCommentService) UpdateComment(commentID int, userID int, newComme
 		return fmt.Errorf("comment not found or not owned by user")
 	}
 
+	s.syncCommentMarker(commentID)
+
 	return nil
 }
 
@@ -140,6 +158,8 @@ func (s *MarkerCommentService) RemoveComment(commentID, userID int) error {
 		return fmt.Errorf("comment not found or already deleted")
 	}
 
+	s.syncCommentMarker(commentID)
+
 	return nil
 }
 
@@ -197,3 +217,12 @@ func (s *MarkerCommentService) CreateCommentTx(tx *sqlx.Tx, markerID, userID int
 
 	return &comment, nil
 }
+
+// syncCommentMarker updates the search index of the marker a comment belongs to
+func (s *MarkerCommentService) syncCommentMarker(commentID int) {
+	var markerID int
+	if err := s.DB.Get(&markerID, getCommentMarkerIDQuery, commentID); err != nil {
+		return
+	}
+	s.SearchIndexService.SyncMarkerAsync(markerID)
+}
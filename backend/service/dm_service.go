@@ -0,0 +1,380 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Alfex4936/chulbong-kr/dto"
+	"github.com/Alfex4936/chulbong-kr/dto/notification"
+	sonic "github.com/bytedance/sonic"
+	"github.com/gofiber/contrib/websocket"
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/xid"
+	"go.uber.org/zap"
+)
+
+const (
+	directRoomPrefix      = "dm:" // a user's connections are kept as a room named dm:<userID>
+	maxDirectMessageLen   = 1000
+	directOnlineTTL       = 10 * time.Minute // refreshed by pings, covers nodes that died without cleaning up
+	directNotificationLen = 50
+
+	getDirectUsernameQuery = "SELECT Username FROM Users WHERE UserID = ?"
+
+	isBlockedEitherWayQuery = `
+SELECT EXISTS(
+    SELECT 1 FROM UserBlocks
+    WHERE (BlockerID = ? AND BlockedID = ?) OR (BlockerID = ? AND BlockedID = ?)
+)`
+
+	upsertDirectConversationQuery = `
+INSERT INTO DirectConversations (UserA, UserB, LastReadA, LastReadB, LastMessageAt, CreatedAt)
+VALUES (?, ?, 0, 0, NOW(), NOW())
+ON DUPLICATE KEY UPDATE LastMessageAt = NOW(), ConversationID = LAST_INSERT_ID(ConversationID)`
+
+	insertDirectMessageQuery = "INSERT INTO DirectMessages (ConversationID, SenderID, Body, CreatedAt) VALUES (?, ?, ?, NOW())"
+
+	getDirectMessageQuery = "SELECT MessageID, ConversationID, SenderID, Body, CreatedAt FROM DirectMessages WHERE MessageID = ?"
+
+	getDirectParticipantsQuery = "SELECT UserA, UserB FROM DirectConversations WHERE ConversationID = ?"
+
+	markDirectReadQuery = `
+UPDATE DirectConversations
+SET LastReadA = IF(UserA = ?, GREATEST(LastReadA, ?), LastReadA),
+    LastReadB = IF(UserB = ?, GREATEST(LastReadB, ?), LastReadB)
+WHERE ConversationID = ?`
+
+	getDirectConversationsQuery = `
+SELECT c.ConversationID,
+       u.UserID AS OtherUserID,
+       u.Username AS OtherUsername,
+       COALESCE((SELECT m.Body FROM DirectMessages m
+                 WHERE m.ConversationID = c.ConversationID
+                 ORDER BY m.MessageID DESC LIMIT 1), '') AS LastMessage,
+       c.LastMessageAt,
+       (SELECT COUNT(*) FROM DirectMessages m
+        WHERE m.ConversationID = c.ConversationID AND m.SenderID <> ?
+          AND m.MessageID > IF(c.UserA = ?, c.LastReadA, c.LastReadB)) AS UnreadCount
+FROM DirectConversations c
+JOIN Users u ON u.UserID = IF(c.UserA = ?, c.UserB, c.UserA)
+WHERE c.UserA = ? OR c.UserB = ?
+ORDER BY c.LastMessageAt DESC
+LIMIT ? OFFSET ?`
+
+	getDirectUnreadQuery = `
+SELECT COUNT(*)
+FROM DirectMessages m
+JOIN DirectConversations c ON c.ConversationID = m.ConversationID
+WHERE (c.UserA = ? OR c.UserB = ?) AND m.SenderID <> ?
+  AND m.MessageID > IF(c.UserA = ?, c.LastReadA, c.LastReadB)`
+
+	getDirectMessagesQuery = `
+SELECT MessageID, ConversationID, SenderID, Body, CreatedAt
+FROM DirectMessages
+WHERE ConversationID = ? AND MessageID < ?
+ORDER BY MessageID DESC
+LIMIT ?`
+
+	insertUserBlockQuery = "INSERT IGNORE INTO UserBlocks (BlockerID, BlockedID, CreatedAt) VALUES (?, ?, NOW())"
+	deleteUserBlockQuery = "DELETE FROM UserBlocks WHERE BlockerID = ? AND BlockedID = ?"
+	getUserBlocksQuery   = `
+SELECT b.BlockedID AS UserID, u.Username, b.CreatedAt
+FROM UserBlocks b
+JOIN Users u ON u.UserID = b.BlockedID
+WHERE b.BlockerID = ?
+ORDER BY b.CreatedAt DESC`
+)
+
+// DirectMessageService handles 1:1 conversations between registered users.
+// Live delivery reuses the chat connection manager and broker, every user is a room of their own.
+type DirectMessageService struct {
+	DB                  *sqlx.DB
+	Redis               *RedisService
+	ChatService         *ChatService
+	NotificationService *NotificationService
+	Logger              *zap.Logger
+}
+
+func NewDirectMessageService(db *sqlx.DB, redis *RedisService, chat *ChatService, notification *NotificationService, logger *zap.Logger) *DirectMessageService {
+	return &DirectMessageService{
+		DB:                  db,
+		Redis:               redis,
+		ChatService:         chat,
+		NotificationService: notification,
+		Logger:              logger,
+	}
+}
+
+func DirectRoomID(userID int) string {
+	return directRoomPrefix + strconv.Itoa(userID)
+}
+
+func directOnlineKey(userID int) string {
+	return fmt.Sprintf("dm:online:%d", userID)
+}
+
+// Connect registers a websocket of the user, a user can be connected from several devices
+func (s *DirectMessageService) Connect(userID int, connID, username string, c *websocket.Conn) (*ChulbongConn, error) {
+	conn, saved, err := s.ChatService.SaveConnection(DirectRoomID(userID), connID, username, c)
+	if !saved {
+		return nil, err
+	}
+	s.touchOnline(userID, connID)
+	return conn, nil
+}
+
+// Disconnect drops the websocket, the user is offline once every device is gone
+func (s *DirectMessageService) Disconnect(userID int, connID string) {
+	s.ChatService.RemoveWsFromRoom(DirectRoomID(userID), connID)
+
+	client := s.Redis.Core.Client
+	client.Do(context.Background(), client.B().Hdel().Key(directOnlineKey(userID)).Field(connID).Build())
+}
+
+// Ping keeps the user online
+func (s *DirectMessageService) Ping(userID int, connID string) {
+	s.ChatService.UpdateLastPing(DirectRoomID(userID), connID)
+	s.touchOnline(userID, connID)
+}
+
+func (s *DirectMessageService) touchOnline(userID int, connID string) {
+	key := directOnlineKey(userID)
+	client := s.Redis.Core.Client
+	client.DoMulti(context.Background(),
+		client.B().Hset().Key(key).FieldValue().FieldValue(connID, strconv.FormatInt(time.Now().Unix(), 10)).Build(),
+		client.B().Expire().Key(key).Seconds(int64(directOnlineTTL.Seconds())).Build(),
+	)
+}
+
+// IsOnline checks every node, not only this one
+func (s *DirectMessageService) IsOnline(userID int) (bool, error) {
+	client := s.Redis.Core.Client
+	n, err := client.Do(context.Background(), client.B().Hlen().Key(directOnlineKey(userID)).Build()).AsInt64()
+	return n > 0, err
+}
+
+// Send stores a message, pushes it to both users' devices and notifies the recipient when they're offline
+func (s *DirectMessageService) Send(senderID, recipientID int, body string) (dto.DirectMessage, error) {
+	body = strings.TrimSpace(body)
+	if body == "" || utf8.RuneCountInString(body) > maxDirectMessageLen {
+		return dto.DirectMessage{}, ErrInvalidDirectMessage
+	}
+	if senderID == recipientID {
+		return dto.DirectMessage{}, ErrDirectToSelf
+	}
+
+	var recipientName string
+	if err := s.DB.Get(&recipientName, getDirectUsernameQuery, recipientID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return dto.DirectMessage{}, ErrUserNotFound
+		}
+		return dto.DirectMessage{}, err
+	}
+
+	blocked, err := s.isBlockedEitherWay(senderID, recipientID)
+	if err != nil {
+		return dto.DirectMessage{}, err
+	}
+	if blocked {
+		return dto.DirectMessage{}, ErrDirectBlocked
+	}
+
+	var senderName string
+	if err := s.DB.Get(&senderName, getDirectUsernameQuery, senderID); err != nil {
+		return dto.DirectMessage{}, err
+	}
+
+	message, err := s.store(senderID, recipientID, body)
+	if err != nil {
+		return dto.DirectMessage{}, err
+	}
+	message.SenderName = senderName
+
+	event := dto.DirectEvent{Version: dto.ChatProtocolVersion, Kind: dto.DirectKindMessage, Message: &message}
+	s.push(recipientID, event)
+	s.push(senderID, event) // the sender's other devices
+
+	online, err := s.IsOnline(recipientID)
+	if err != nil {
+		s.Logger.Warn("Failed to check if user is online", zap.Int("userID", recipientID), zap.Error(err))
+	}
+	if !online {
+		s.notify(recipientID, message)
+	}
+
+	return message, nil
+}
+
+// store writes the message and marks it read for the sender
+func (s *DirectMessageService) store(senderID, recipientID int, body string) (dto.DirectMessage, error) {
+	userA, userB := min(senderID, recipientID), max(senderID, recipientID)
+
+	tx, err := s.DB.Beginx()
+	if err != nil {
+		return dto.DirectMessage{}, ErrBeginTransaction
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(upsertDirectConversationQuery, userA, userB)
+	if err != nil {
+		return dto.DirectMessage{}, fmt.Errorf("error upserting conversation: %w", err)
+	}
+	conversationID, err := result.LastInsertId()
+	if err != nil {
+		return dto.DirectMessage{}, ErrLastInsertID
+	}
+
+	result, err = tx.Exec(insertDirectMessageQuery, conversationID, senderID, body)
+	if err != nil {
+		return dto.DirectMessage{}, fmt.Errorf("error inserting direct message: %w", err)
+	}
+	messageID, err := result.LastInsertId()
+	if err != nil {
+		return dto.DirectMessage{}, ErrLastInsertID
+	}
+
+	if _, err := tx.Exec(markDirectReadQuery, senderID, messageID, senderID, messageID, conversationID); err != nil {
+		return dto.DirectMessage{}, fmt.Errorf("error marking conversation read: %w", err)
+	}
+
+	var message dto.DirectMessage
+	if err := tx.Get(&message, getDirectMessageQuery, messageID); err != nil {
+		return dto.DirectMessage{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return dto.DirectMessage{}, ErrCommitTransaction
+	}
+	return message, nil
+}
+
+func (s *DirectMessageService) push(userID int, event dto.DirectEvent) {
+	event.UID = xid.New().String()
+	payload, err := sonic.Marshal(event)
+	if err != nil {
+		return
+	}
+	if err := s.ChatService.SendRawToRoom(DirectRoomID(userID), event.UID, payload); err != nil {
+		s.Logger.Warn("Failed to publish direct event", zap.Int("userID", userID), zap.Error(err))
+	}
+}
+
+func (s *DirectMessageService) notify(recipientID int, message dto.DirectMessage) {
+	preview := message.Body
+	if r := []rune(preview); len(r) > directNotificationLen {
+		preview = string(r[:directNotificationLen]) + "…"
+	}
+
+	metadata := notification.NotificationDirectMessageMetadata{
+		ConversationID: message.ConversationID,
+		MessageID:      message.MessageID,
+		SenderID:       message.SenderID,
+	}
+
+	title := message.SenderName + " 님의 메시지"
+	if err := s.NotificationService.NotifyUser(recipientID, NotificationDirectMessage, title, preview, metadata); err != nil {
+		s.Logger.Error("Failed to post direct message notification", zap.Int("userID", recipientID), zap.Error(err))
+	}
+}
+
+// Conversations is the user's inbox, most recent first
+func (s *DirectMessageService) Conversations(userID, page, pageSize int) ([]dto.DirectConversation, error) {
+	offset := (page - 1) * pageSize
+
+	conversations := make([]dto.DirectConversation, 0, pageSize)
+	err := s.DB.Select(&conversations, getDirectConversationsQuery,
+		userID, userID, userID, userID, userID, pageSize, offset)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching conversations: %w", err)
+	}
+	return conversations, nil
+}
+
+// UnreadCount is the number of unread messages over every conversation
+func (s *DirectMessageService) UnreadCount(userID int) (int, error) {
+	var count int
+	err := s.DB.Get(&count, getDirectUnreadQuery, userID, userID, userID, userID)
+	return count, err
+}
+
+// Messages pages back through a conversation, newest first. beforeID 0 starts from the latest.
+func (s *DirectMessageService) Messages(userID int, conversationID, beforeID int64, limit int) ([]dto.DirectMessage, error) {
+	if err := s.checkParticipant(userID, conversationID); err != nil {
+		return nil, err
+	}
+	if beforeID <= 0 {
+		beforeID = math.MaxInt64
+	}
+
+	messages := make([]dto.DirectMessage, 0, limit)
+	if err := s.DB.Select(&messages, getDirectMessagesQuery, conversationID, beforeID, limit); err != nil {
+		return nil, fmt.Errorf("error fetching direct messages: %w", err)
+	}
+	return messages, nil
+}
+
+// MarkRead moves the user's read marker forward and tells their other devices
+func (s *DirectMessageService) MarkRead(userID int, conversationID, messageID int64) error {
+	if err := s.checkParticipant(userID, conversationID); err != nil {
+		return err
+	}
+
+	if _, err := s.DB.Exec(markDirectReadQuery, userID, messageID, userID, messageID, conversationID); err != nil {
+		return fmt.Errorf("error marking conversation read: %w", err)
+	}
+
+	s.push(userID, dto.DirectEvent{
+		Version:        dto.ChatProtocolVersion,
+		Kind:           dto.DirectKindRead,
+		ConversationID: conversationID,
+		LastReadID:     messageID,
+	})
+	return nil
+}
+
+func (s *DirectMessageService) checkParticipant(userID int, conversationID int64) error {
+	var participants struct {
+		UserA int `db:"UserA"`
+		UserB int `db:"UserB"`
+	}
+	err := s.DB.Get(&participants, getDirectParticipantsQuery, conversationID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && participants.UserA != userID && participants.UserB != userID) {
+		return ErrConversationNotFound // don't tell strangers it exists
+	}
+	return err
+}
+
+// Block stops DMs both ways, existing conversations stay readable
+func (s *DirectMessageService) Block(userID, blockedID int) error {
+	if userID == blockedID {
+		return ErrDirectToSelf
+	}
+	_, err := s.DB.Exec(insertUserBlockQuery, userID, blockedID)
+	return err
+}
+
+func (s *DirectMessageService) Unblock(userID, blockedID int) error {
+	_, err := s.DB.Exec(deleteUserBlockQuery, userID, blockedID)
+	return err
+}
+
+func (s *DirectMessageService) Blocks(userID int) ([]dto.BlockedUser, error) {
+	blocks := make([]dto.BlockedUser, 0)
+	if err := s.DB.Select(&blocks, getUserBlocksQuery, userID); err != nil {
+		return nil, fmt.Errorf("error fetching blocked users: %w", err)
+	}
+	return blocks, nil
+}
+
+func (s *DirectMessageService) isBlockedEitherWay(userA, userB int) (bool, error) {
+	var blocked bool
+	err := s.DB.Get(&blocked, isBlockedEitherWayQuery, userA, userB, userB, userA)
+	return blocked, err
+}
@@ -0,0 +1,41 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/Alfex4936/chulbong-kr/dto"
+	sonic "github.com/bytedance/sonic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirectEventMultiNode(t *testing.T) {
+	broker := NewInProcessChatBroker()
+	defer broker.Close()
+
+	nodeA, nodeB := newTestChatNode(t, broker), newTestChatNode(t, broker)
+	phone := joinTestRoom(nodeA, DirectRoomID(7), "phone")
+	laptop := joinTestRoom(nodeB, DirectRoomID(7), "laptop")
+	other := joinTestRoom(nodeB, DirectRoomID(8), "other")
+
+	event := dto.DirectEvent{
+		Version: dto.ChatProtocolVersion,
+		Kind:    dto.DirectKindMessage,
+		UID:     "dm-1",
+		Message: &dto.DirectMessage{MessageID: 1, ConversationID: 3, SenderID: 8, Body: "안녕"},
+	}
+	payload, err := sonic.Marshal(event)
+	require.NoError(t, err)
+	require.NoError(t, nodeA.SendRawToRoom(DirectRoomID(7), event.UID, payload))
+
+	for _, conn := range []*ChulbongConn{phone, laptop} {
+		var got dto.DirectEvent
+		require.NoError(t, sonic.Unmarshal(<-conn.Send, &got))
+		assert.Equal(t, event.UID, got.UID)
+		assert.Equal(t, "안녕", got.Message.Body)
+	}
+
+	require.NoError(t, broker.Close())
+	assert.Empty(t, phone.Send, "the sending node delivers once")
+	assert.Empty(t, other.Send)
+}
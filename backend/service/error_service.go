@@ -12,15 +12,78 @@ var (
 	ErrMaxCommentsReached = errors.New("user has reached the maximum number of comments")
 
 	// Report
-	ErrBeginTransaction   = errors.New("could not begin transaction")
-	ErrInsertReport       = errors.New("failed to insert report")
-	ErrLastInsertID       = errors.New("failed to get last insert ID")
-	ErrInsertReportPhoto  = errors.New("failed to insert report photo")
-	ErrCommitTransaction  = errors.New("could not commit transaction")
-	ErrMarkerDoesNotExist = errors.New("marker does not exist")
+	ErrBeginTransaction       = errors.New("could not begin transaction")
+	ErrInsertReport           = errors.New("failed to insert report")
+	ErrLastInsertID           = errors.New("failed to get last insert ID")
+	ErrInsertReportPhoto      = errors.New("failed to insert report photo")
+	ErrCommitTransaction      = errors.New("could not commit transaction")
+	ErrMarkerDoesNotExist     = errors.New("marker does not exist")
+	ErrReportNotFound         = errors.New("report not found")
+	ErrInvalidReportQueue     = errors.New("invalid report queue request")
+	ErrReportNotPending       = errors.New("report is already reviewed")
+	ErrReportThrottled        = errors.New("too many of your reports were denied, try again tomorrow")
+	ErrInvalidReportVote      = errors.New("vote up or down")
+	ErrReportOwnVote          = errors.New("cannot vote on your own report")
+	ErrReportVoteNotAllowed   = errors.New("only established contributors can vote")
+	ErrReportEvidenceRequired = errors.New("moving a marker this far needs a recent photo taken at the new location")
+	ErrAutoDecisionNotFound   = errors.New("automatic decision not found")
+	ErrAutoDecisionReverted   = errors.New("automatic decision is already reverted")
 
 	// Stories
 	ErrUnauthorized     = errors.New("unauthorized")
 	ErrStoryNotFound    = errors.New("story not found")
 	ErrAlreadyStoryPost = errors.New("you have already posted a story for this marker")
+
+	// Notifications
+	ErrInvalidNotificationType     = errors.New("unknown notification type")
+	ErrInvalidNotificationSettings = errors.New("invalid notification settings")
+	ErrInvalidPushSubscription     = errors.New("invalid push subscription")
+	ErrWebPushDisabled             = errors.New("web push is not configured")
+	ErrNotificationNotFound        = errors.New("notification not found")
+	ErrInvalidNotificationAction   = errors.New("invalid notification action")
+	ErrInvalidBroadcast            = errors.New("invalid broadcast")
+	ErrBroadcastNotFound           = errors.New("broadcast not found")
+	ErrBroadcastAlreadySent        = errors.New("broadcast is already sent")
+
+	// Meetups
+	ErrInvalidMeetup     = errors.New("invalid meetup")
+	ErrMeetupNotFound    = errors.New("meetup not found")
+	ErrMeetupLimit       = errors.New("you already have 3 upcoming meetups")
+	ErrMeetupFull        = errors.New("meetup is full")
+	ErrMeetupClosed      = errors.New("meetup is cancelled or already started")
+	ErrMeetupCreatorRSVP = errors.New("the creator can't leave, cancel the meetup instead")
+
+	// Marker states
+	ErrInvalidMarkerState = errors.New("state must be unverified, verified or missing")
+	ErrMarkerOwnConfirm   = errors.New("cannot confirm your own marker")
+	ErrMarkerRemoved      = errors.New("marker has been removed")
+	ErrMarkerNotRemoved   = errors.New("marker is not removed")
+
+	// Search
+	ErrInvalidSearchClick = errors.New("term, markerId and position are required")
+	ErrInvalidSynonym     = errors.New("term and synonym are required")
+
+	// Chat
+	ErrChatMessageNotFound = errors.New("chat message not found")
+	ErrChatNotAuthor       = errors.New("only the author can change this message")
+	ErrInvalidChatFrame    = errors.New("invalid chat frame")
+	ErrChatBanNotFound     = errors.New("chat ban not found")
+	ErrChatRateLimited     = errors.New("too many messages, slow down")
+	ErrChatRepeated        = errors.New("same message sent too many times")
+	ErrChatSlowMode        = errors.New("slow mode is on in this room")
+	ErrChatSelfReport      = errors.New("cannot report your own message")
+	ErrChatArchiveDisabled = errors.New("chat archive is disabled")
+
+	ErrChatImageTooLarge      = errors.New("image must be 10MB or smaller")
+	ErrChatNotImage           = errors.New("only images can be attached")
+	ErrChatNotInRoom          = errors.New("join the chat room before uploading")
+	ErrChatAttachmentNotFound = errors.New("attachment not found or already posted")
+	ErrChatLocationInvalid    = errors.New("location must be in South Korea")
+
+	// Direct messages
+	ErrUserNotFound         = errors.New("user not found")
+	ErrInvalidDirectMessage = errors.New("message must be between 1 and 1000 characters")
+	ErrDirectToSelf         = errors.New("cannot message or block yourself")
+	ErrDirectBlocked        = errors.New("this user can't receive your messages")
+	ErrConversationNotFound = errors.New("conversation not found")
 )
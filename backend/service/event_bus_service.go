@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+const eventBusQueueLen = 1024
+
+// Domain events published by the marker services
+const (
+	EventMarkerCommented = "marker.commented"
+	EventMarkerReported  = "marker.reported"
+	EventMarkerFavorited = "marker.favorited"
+	EventStoryReacted    = "story.reacted"
+	EventReportApproved  = "report.approved"
+	EventReportDenied    = "report.denied"
+	// the community vote on a report ended, Text is APPROVED or DENIED
+	EventReportVoteResolved = "report.vote_resolved"
+)
+
+// DomainEvent is something a user did, subscribers work out who cares about it.
+// Only the ids that make sense for the event are set.
+type DomainEvent struct {
+	Name      string
+	ActorID   int    // 0 for anonymous users
+	ActorName string // optional, looked up when empty
+	MarkerID  int
+	CommentID int
+	StoryID   int
+	ReportID  int
+	Text      string // comment text, reaction type
+	At        time.Time
+}
+
+// EventBus delivers domain events to in-process subscribers after the request that caused them.
+// Publishing never blocks, events are dropped and logged when a subscriber falls too far behind.
+type EventBus struct {
+	mu          sync.RWMutex
+	subscribers map[string][]chan DomainEvent
+	closed      bool
+	wg          sync.WaitGroup
+	Logger      *zap.Logger
+}
+
+func NewEventBus(lifecycle fx.Lifecycle, logger *zap.Logger) *EventBus {
+	bus := newEventBus(logger)
+	lifecycle.Append(fx.Hook{
+		OnStop: func(context.Context) error {
+			bus.Close()
+			return nil
+		},
+	})
+	return bus
+}
+
+func newEventBus(logger *zap.Logger) *EventBus {
+	return &EventBus{
+		subscribers: make(map[string][]chan DomainEvent),
+		Logger:      logger,
+	}
+}
+
+// Publish queues the event for its subscribers, a nil bus drops it
+func (b *EventBus) Publish(event DomainEvent) {
+	if b == nil {
+		return
+	}
+	if event.At.IsZero() {
+		event.At = time.Now()
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return
+	}
+	for _, queue := range b.subscribers[event.Name] {
+		select {
+		case queue <- event:
+		default:
+			b.Logger.Warn("Event bus queue is full, event dropped", zap.String("event", event.Name))
+		}
+	}
+}
+
+// Subscribe calls handler for every event with one of the names, one event at a time in publish order
+func (b *EventBus) Subscribe(handler func(DomainEvent), names ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+
+	queue := make(chan DomainEvent, eventBusQueueLen)
+	for _, name := range names {
+		b.subscribers[name] = append(b.subscribers[name], queue)
+	}
+
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		for event := range queue {
+			b.handle(handler, event)
+		}
+	}()
+}
+
+func (b *EventBus) handle(handler func(DomainEvent), event DomainEvent) {
+	defer func() {
+		if r := recover(); r != nil {
+			b.Logger.Error("Event handler panicked", zap.String("event", event.Name), zap.Any("panic", r))
+		}
+	}()
+	handler(event)
+}
+
+// Close stops accepting events and waits until the queued ones are handled
+func (b *EventBus) Close() {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return
+	}
+	b.closed = true
+
+	// a queue is listed once per event name it subscribed to
+	closed := make(map[chan DomainEvent]struct{})
+	for _, queues := range b.subscribers {
+		for _, queue := range queues {
+			if _, ok := closed[queue]; !ok {
+				close(queue)
+				closed[queue] = struct{}{}
+			}
+		}
+	}
+	b.mu.Unlock()
+
+	b.wg.Wait()
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Alfex4936/chulbong-kr/dto/notification"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestEventBus(t *testing.T) {
+	t.Run("DeliversInOrder", func(t *testing.T) {
+		bus := newEventBus(zap.NewNop())
+
+		var mu sync.Mutex
+		var got []string
+		bus.Subscribe(func(e DomainEvent) {
+			mu.Lock()
+			defer mu.Unlock()
+			got = append(got, e.Name)
+			assert.False(t, e.At.IsZero())
+		}, EventMarkerCommented, EventMarkerFavorited)
+
+		bus.Publish(DomainEvent{Name: EventMarkerCommented})
+		bus.Publish(DomainEvent{Name: EventStoryReacted}) // nobody listens
+		bus.Publish(DomainEvent{Name: EventMarkerFavorited})
+		bus.Publish(DomainEvent{Name: EventMarkerCommented})
+		bus.Close()
+
+		assert.Equal(t, []string{EventMarkerCommented, EventMarkerFavorited, EventMarkerCommented}, got)
+	})
+
+	t.Run("EverySubscriberGetsIt", func(t *testing.T) {
+		bus := newEventBus(zap.NewNop())
+
+		var mu sync.Mutex
+		count := 0
+		for range 3 {
+			bus.Subscribe(func(DomainEvent) {
+				mu.Lock()
+				count++
+				mu.Unlock()
+			}, EventReportApproved)
+		}
+		bus.Publish(DomainEvent{Name: EventReportApproved})
+		bus.Close()
+
+		assert.Equal(t, 3, count)
+	})
+
+	t.Run("SurvivesPanics", func(t *testing.T) {
+		bus := newEventBus(zap.NewNop())
+
+		handled := 0
+		bus.Subscribe(func(e DomainEvent) {
+			handled++
+			if e.MarkerID == 1 {
+				panic("boom")
+			}
+		}, EventMarkerReported)
+		bus.Publish(DomainEvent{Name: EventMarkerReported, MarkerID: 1})
+		bus.Publish(DomainEvent{Name: EventMarkerReported, MarkerID: 2})
+		bus.Close()
+
+		assert.Equal(t, 2, handled)
+	})
+
+	t.Run("ClosedAndNil", func(t *testing.T) {
+		bus := newEventBus(zap.NewNop())
+		bus.Close()
+		bus.Close()
+		bus.Subscribe(func(DomainEvent) { t.Error("subscribed after close") }, EventReportDenied)
+		bus.Publish(DomainEvent{Name: EventReportDenied})
+
+		var none *EventBus
+		assert.NotPanics(t, func() { none.Publish(DomainEvent{Name: EventReportDenied}) })
+	})
+}
+
+func TestBuildPersonalNotification(t *testing.T) {
+	t.Run("Comment", func(t *testing.T) {
+		text := strings.Repeat("좋아요", 30)
+		n := buildPersonalNotification(DomainEvent{
+			Name: EventMarkerCommented, ActorID: 2, ActorName: "철봉왕", MarkerID: 7, CommentID: 11, Text: text,
+		}, 5, "서울특별시 종로구")
+
+		assert.Equal(t, 5, n.UserID)
+		assert.Equal(t, NotificationComment, n.Type)
+		assert.Contains(t, n.Message, "철봉왕님이 서울특별시 종로구에")
+		assert.Contains(t, n.Message, previewText(text, notificationPreviewLen))
+		assert.NotContains(t, n.Message, text)
+		assert.Equal(t, notification.NotificationCommentMetadata{
+			MarkerID: 7, CommentID: 11, CommenterID: 2, Link: "/pullup/7",
+		}, n.Metadata)
+	})
+
+	t.Run("Report", func(t *testing.T) {
+		n := buildPersonalNotification(DomainEvent{Name: EventMarkerReported, ActorID: 0, MarkerID: 3, ReportID: 9}, 4, "")
+		assert.Equal(t, NotificationReport, n.Type)
+		assert.Contains(t, n.Message, "익명님이 회원님의 철봉")
+
+		for name, status := range map[string]string{EventReportApproved: "APPROVED", EventReportDenied: "DENIED"} {
+			n := buildPersonalNotification(DomainEvent{Name: name, ActorID: 1, MarkerID: 3, ReportID: 9}, 4, "")
+			assert.Equal(t, NotificationReportResult, n.Type)
+			require.IsType(t, notification.NotificationReportMetadata{}, n.Metadata)
+			assert.Equal(t, status, n.Metadata.(notification.NotificationReportMetadata).Status)
+		}
+	})
+
+	t.Run("StoryReaction", func(t *testing.T) {
+		n := buildPersonalNotification(DomainEvent{
+			Name: EventStoryReacted, ActorID: 2, ActorName: "a", MarkerID: 7, StoryID: 8, Text: "thumbsdown",
+		}, 5, "")
+		assert.Equal(t, NotificationStoryReaction, n.Type)
+		assert.Contains(t, n.Message, "👎")
+		assert.Equal(t, "/pullup/7?story=8", n.Metadata.(notification.NotificationStoryMetadata).Link)
+	})
+
+	t.Run("Unknown", func(t *testing.T) {
+		n := buildPersonalNotification(DomainEvent{Name: "marker.created", MarkerID: 7}, 5, "")
+		assert.Zero(t, n.UserID)
+	})
+
+	t.Run("Preview", func(t *testing.T) {
+		assert.Equal(t, "짧은 글", previewText("짧은 글", 5))
+		assert.Equal(t, "가나…", previewText("가나다", 2))
+	})
+}
@@ -15,21 +15,22 @@ const (
 	checkDislikeQuery  = "SELECT EXISTS(SELECT 1 FROM MarkerDislikes WHERE UserID = ? AND MarkerID = ?)"
 	checkFavQuery      = "SELECT EXISTS(SELECT 1 FROM Favorites WHERE UserID = ? AND MarkerID = ?)"
 	// access_type: ref, query_cost: 0.95
-	countFavQuery         = "SELECT COUNT(*) FROM Favorites WHERE UserID = ?"
-	insertFavQuery        = "INSERT INTO Favorites (UserID, MarkerID) VALUES (?, ?)"
-	checkMarkerOwnerQuery = "SELECT UserID FROM Markers WHERE MarkerID = ?"
-	deleteFavQuery        = "DELETE FROM Favorites WHERE UserID = ? AND MarkerID = ?"
+	countFavQuery  = "SELECT COUNT(*) FROM Favorites WHERE UserID = ?"
+	insertFavQuery = "INSERT INTO Favorites (UserID, MarkerID) VALUES (?, ?)"
+	deleteFavQuery = "DELETE FROM Favorites WHERE UserID = ? AND MarkerID = ?"
 
-	getMarkersAfterIDQuery = "SELECT ST_X(Location) AS Latitude, ST_Y(Location) AS Longitude, Address, MarkerID, COALESCE(U.Username, '알 수 없는 사용자') AS Username, M.UserID FROM Markers M LEFT JOIN Users U ON M.UserID = U.UserID WHERE MarkerID > ? ORDER BY MarkerID ASC"
+	getMarkersAfterIDQuery = "SELECT ST_X(Location) AS Latitude, ST_Y(Location) AS Longitude, Address, MarkerID, COALESCE(U.Username, '알 수 없는 사용자') AS Username, M.UserID FROM Markers M LEFT JOIN Users U ON M.UserID = U.UserID WHERE MarkerID > ? AND M.State <> 'removed' ORDER BY MarkerID ASC"
 )
 
 type MarkerInteractService struct {
-	DB *sqlx.DB
+	DB       *sqlx.DB
+	EventBus *EventBus
 }
 
-func NewMarkerInteractService(db *sqlx.DB) *MarkerInteractService {
+func NewMarkerInteractService(db *sqlx.DB, bus *EventBus) *MarkerInteractService {
 	return &MarkerInteractService{
-		DB: db,
+		DB:       db,
+		EventBus: bus,
 	}
 }
 
@@ -103,25 +104,8 @@ func (s *MarkerInteractService) AddFavorite(userID, markerID int) error {
 		return fmt.Errorf("failed to add favorite: %w", err)
 	}
 
-	// Retrieve the UserID (owner) of the marker
-	var ownerUserID int
-	err = s.DB.QueryRowx(checkMarkerOwnerQuery, markerID).Scan(&ownerUserID)
-	if err != nil {
-		return fmt.Errorf("failed to retrieve marker owner: %w", err)
-	}
-
-	// if ownerUserID != userID {
-	// 	userIDstr := strconv.Itoa(ownerUserID)
-	// 	updateMsg := fmt.Sprintf("누군가 %d 마커에 좋아요를 남겼습니다!", markerID)
-	// 	metadata := notification.NotificationLikeMetadata{
-	// 		MarkerID: markerID,
-	// 		UserId:   ownerUserID,
-	// 		LikerId:  userID,
-	// 	}
-
-	// 	rawMetadata, _ := json.Marshal(metadata)
-	// 	PostNotification(userIDstr, "Like", "sys", updateMsg, rawMetadata)
-	// }
+	// the marker owner is notified
+	s.EventBus.Publish(DomainEvent{Name: EventMarkerFavorited, ActorID: userID, MarkerID: markerID})
 
 	// TODO: update when frontend updates
 	// key := fmt.Sprintf("%d-%d", ownerUserID, markerID)
@@ -32,7 +32,7 @@ const (
 SELECT EXISTS (
     SELECT 1 
     FROM Markers
-    WHERE ST_Within(Location, ST_Buffer(ST_GeomFromText(?, 4326), ?))
+    WHERE ST_Within(Location, ST_Buffer(ST_GeomFromText(?, 4326), ?)) AND State <> 'removed'
 ) AS Nearby;
 `
 
@@ -51,7 +51,8 @@ SELECT MarkerID,
        ST_Y(Location) AS Longitude, 
        Description, 
        ST_Distance_Sphere(Location, ST_GeomFromText(?, 4326)) AS distance, 
-       Address
+       Address,
+       State
 FROM Markers
 WHERE MBRContains(
     ST_SRID(
@@ -66,6 +67,7 @@ WHERE MBRContains(
         4326), 
     Location)
   AND ST_Distance_Sphere(Location, ST_GeomFromText(?, 4326)) <= ?
+  AND State <> 'removed'
 ORDER BY distance ASC`
 
 	findClosestMarkersWithThumbnailQuery = `
@@ -75,6 +77,7 @@ SELECT m.MarkerID,
        m.Description, 
        ST_Distance_Sphere(m.Location, ST_GeomFromText(?, 4326)) AS Distance, 
        m.Address,
+       m.State,
 	   COALESCE(p.ThumbnailURL, p.PhotoURL) AS Thumbnail
 FROM Markers m
 LEFT JOIN (
@@ -99,6 +102,7 @@ WHERE MBRContains(
         4326), 
     Location)
 AND ST_Distance_Sphere(Location, ST_GeomFromText(?, 4326)) <= ?
+AND m.State <> 'removed'
 GROUP BY m.MarkerID
 ORDER BY distance ASC
 LIMIT ? OFFSET ?`
@@ -35,9 +35,12 @@ const (
 SELECT 
 	MarkerID, 
 	ST_X(Location) AS Latitude,
-	ST_Y(Location) AS Longitude
+	ST_Y(Location) AS Longitude,
+	State
 FROM 
-	Markers;`
+	Markers
+WHERE 
+	State <> 'removed';`
 
 	getAllSimpleMarkersPhotoExistenceQuery = `
 SELECT 
@@ -47,11 +50,34 @@ SELECT
     CASE 
         WHEN COUNT(p.PhotoID) > 0 THEN TRUE 
         ELSE FALSE 
-    END AS HasPhoto
+    END AS HasPhoto,
+    m.State
 FROM 
     Markers m
 LEFT JOIN 
     Photos p ON m.MarkerID = p.MarkerID
+WHERE 
+    m.State <> 'removed'
+GROUP BY 
+    m.MarkerID;`
+
+	// same as above for the map's state filter, removed is never one of the states
+	getSimpleMarkersByStateQuery = `
+SELECT 
+    m.MarkerID, 
+    ST_X(m.Location) AS Latitude,
+    ST_Y(m.Location) AS Longitude,
+    CASE 
+        WHEN COUNT(p.PhotoID) > 0 THEN TRUE 
+        ELSE FALSE 
+    END AS HasPhoto,
+    m.State
+FROM 
+    Markers m
+LEFT JOIN 
+    Photos p ON m.MarkerID = p.MarkerID
+WHERE 
+    m.State IN (?)
 GROUP BY 
     m.MarkerID;`
 
@@ -61,9 +87,12 @@ SELECT
 	ST_X(Location) AS Latitude,
 	ST_Y(Location) AS Longitude,
 	Address,
-	UserID
+	UserID,
+	State
 FROM 
 	Markers
+WHERE 
+	State <> 'removed'
 ORDER BY 
 	CreatedAt DESC
 LIMIT ? OFFSET ?;`
@@ -80,6 +109,7 @@ SELECT
 	M.CreatedAt,
 	M.UpdatedAt,
 	M.Address,
+	M.State,
 	COALESCE(D.DislikeCount, 0) AS DislikeCount,
 	COALESCE(F.FavoriteCount, 0) AS FavoriteCount
 FROM Markers M
@@ -149,10 +179,10 @@ LIMIT ? OFFSET ?`
 	findCloseMarkersAdminQuery = `
 SELECT MarkerID, ST_X(Location) AS Latitude, ST_Y(Location) AS Longitude, Description, ST_Distance_Sphere(Location, ST_GeomFromText(?, 4326)) AS distance, Address
 FROM Markers
-WHERE ST_Distance_Sphere(Location, ST_GeomFromText(?, 4326)) <= ?
+WHERE ST_Distance_Sphere(Location, ST_GeomFromText(?, 4326)) <= ? AND State <> 'removed'
 ORDER BY distance ASC`
 
-	generateRSSQuery = "SELECT MarkerID, UpdatedAt, Address FROM Markers ORDER BY UpdatedAt DESC"
+	generateRSSQuery = "SELECT MarkerID, UpdatedAt, Address FROM Markers WHERE State <> 'removed' ORDER BY UpdatedAt DESC"
 
 	getNewTop10PicturesQuery      = "SELECT MarkerID, COALESCE(ThumbnailURL, PhotoURL) AS PhotoURL FROM Photos GROUP BY MarkerID, PhotoURL ORDER BY MAX(UploadedAt) DESC LIMIT 10"
 	getNewTop10PicturesExtraQuery = `
@@ -174,10 +204,10 @@ type MarkerManageService struct {
 
 	MarkerLocationService *MarkerLocationService
 	S3Service             *S3Service
-	// ZincSearchService     *ZincSearchService
-	BleveSearchService *BleveSearchService
-	RedisService       *RedisService
-	ChatService        *ChatService
+	MarkerSearcher        MarkerSearcher
+	SearchIndexService    *SearchIndexService
+	RedisService          *RedisService
+	ChatService           *ChatService
 
 	MapUtil           *util.MapUtil
 	BadWordUtil       *util.BadWordUtil
@@ -193,6 +223,7 @@ type MarkerManageService struct {
 	workerPool *workerpool.WorkerPool
 
 	CacheService *MarkerCacheService
+	StateService *MarkerStateService
 
 	GetMarkerStmt             *sqlx.Stmt
 	GetAllPhotosForMarkerStmt *sqlx.Stmt
@@ -206,15 +237,16 @@ type MarkerManageServiceParams struct {
 	DB                    *sqlx.DB
 	MarkerLocationService *MarkerLocationService
 	S3Service             *S3Service
-	// ZincSearchService     *ZincSearchService
-	BleveSearchService *BleveSearchService
-	RedisService       *RedisService
-	ChatService        *ChatService
-	MapUtil            *util.MapUtil
-	BadWordUtil        *util.BadWordUtil
-	LocalCacheStorage  *ristretto_store.RistrettoStore
-	Logger             *zap.Logger
-	CacheService       *MarkerCacheService
+	MarkerSearcher        MarkerSearcher
+	SearchIndexService    *SearchIndexService
+	RedisService          *RedisService
+	ChatService           *ChatService
+	MapUtil               *util.MapUtil
+	BadWordUtil           *util.BadWordUtil
+	LocalCacheStorage     *ristretto_store.RistrettoStore
+	Logger                *zap.Logger
+	CacheService          *MarkerCacheService
+	StateService          *MarkerStateService
 }
 
 // NewMarkerManageService creates a new instance of MarkerManageService.
@@ -231,13 +263,13 @@ func NewMarkerManageService(p MarkerManageServiceParams) *MarkerManageService {
 		DB:                    p.DB,
 		MarkerLocationService: p.MarkerLocationService,
 		S3Service:             p.S3Service,
-		// ZincSearchService:     p.ZincSearchService,
-		BleveSearchService: p.BleveSearchService,
-		RedisService:       p.RedisService,
-		ChatService:        p.ChatService,
-		MapUtil:            p.MapUtil,
-		BadWordUtil:        p.BadWordUtil,
-		Logger:             p.Logger,
+		MarkerSearcher:        p.MarkerSearcher,
+		SearchIndexService:    p.SearchIndexService,
+		RedisService:          p.RedisService,
+		ChatService:           p.ChatService,
+		MapUtil:               p.MapUtil,
+		BadWordUtil:           p.BadWordUtil,
+		Logger:                p.Logger,
 
 		byteCache:  byteCache,
 		workerPool: workerpool.New(30),
@@ -248,6 +280,7 @@ func NewMarkerManageService(p MarkerManageServiceParams) *MarkerManageService {
 		GenerateRSSQueryStmt:      generateRSSQueryStmt,
 
 		CacheService: p.CacheService,
+		StateService: p.StateService,
 	}
 }
 
@@ -551,6 +584,15 @@ func (s *MarkerManageService) CreateMarkerWithPhotos(ctx context.Context, marker
 		return nil, fmt.Errorf("encountered an error during file upload or DB operation: %v", err)
 	}
 
+	// A photo backs up a new marker, it starts verified
+	state := MarkerStateUnverified
+	if len(files) > 0 {
+		if state, _, err = transitionMarkerTx(tx, int(markerID), MarkerEventPhotoAdded, &userID, nil); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
 	// Commit the transaction after all operations succeed
 	if err := tx.Commit(); err != nil {
 		return nil, fmt.Errorf("could not commit transaction: %w", err)
@@ -617,7 +659,13 @@ func (s *MarkerManageService) CreateMarkerWithPhotos(ctx context.Context, marker
 			s.Logger.Error("Failed to update address", zap.Int64("markerID", markerID), zap.Error(err))
 		}
 
-		err = s.BleveSearchService.InsertMarkerIndex(dto.MarkerIndexData{MarkerID: int(markerID), Address: address})
+		err = s.MarkerSearcher.InsertMarkerIndex(dto.MarkerIndexData{
+			MarkerID:    int(markerID),
+			Address:     address,
+			Coordinates: &dto.GeoPoint{Lat: latitude, Lon: longitude},
+			Description: markerDto.Description,
+			State:       state,
+		})
 		if err != nil {
 			s.Logger.Error("Failed to index address", zap.Int64("markerID", markerID), zap.Error(err))
 		}
@@ -637,6 +685,8 @@ func (s *MarkerManageService) CreateMarkerWithPhotos(ctx context.Context, marker
 				UserID:       "1",
 				UserNickname: "k-pullup",
 				RoomID:       regionCode,
+				Version:      dto.ChatProtocolVersion,
+				Kind:         dto.ChatKindSystem,
 			}
 
 			// Call SaveMessageToRedis
@@ -706,7 +756,12 @@ func (s *MarkerManageService) FetchAllPhotoURLsFromDB() ([]string, error) {
 // UpdateMarker updates an existing marker's latitude, longitude, and description
 func (s *MarkerManageService) UpdateMarker(marker *model.Marker) error {
 	_, err := s.DB.Exec(updateMarkerQuery, marker.Latitude, marker.Longitude, marker.Description, marker.MarkerID)
-	return err
+	if err != nil {
+		return err
+	}
+
+	s.SearchIndexService.SyncMarkerAsync(marker.MarkerID)
+	return nil
 }
 
 func (s *MarkerManageService) UpdateMarkerDescriptionOnly(markerID int, description string) error {
@@ -718,6 +773,8 @@ func (s *MarkerManageService) UpdateMarkerDescriptionOnly(markerID int, descript
 		return fmt.Errorf("error updating a marker: %w", err)
 	}
 
+	s.SearchIndexService.SyncMarkerAsync(markerID)
+
 	return nil
 }
 
@@ -772,7 +829,7 @@ func (s *MarkerManageService) DeleteMarker(userID, markerID int, userRole string
 	}(photoURLs)
 
 	s.ClearCache()
-	s.BleveSearchService.DeleteMarkerIndex(markerID)
+	s.MarkerSearcher.DeleteMarkerIndex(markerID)
 
 	return nil
 }
@@ -812,14 +869,39 @@ func (s *MarkerManageService) UploadMarkerPhotoToS3(markerID int, files []*multi
 		return nil, err
 	}
 
+	var stateChanged bool
+	if len(picUrls) > 0 {
+		if _, stateChanged, err = transitionMarkerTx(tx, markerID, MarkerEventPhotoAdded, nil, nil); err != nil {
+			return nil, err
+		}
+	}
+
 	// If no errors, commit the transaction
 	if err := tx.Commit(); err != nil {
 		return nil, err
 	}
 
+	if stateChanged {
+		s.StateService.Changed(markerID)
+	}
+
 	return picUrls, nil
 }
 
+// GetAllMarkersByState lists the markers in any of the given states, it isn't cached like the full list
+func (s *MarkerManageService) GetAllMarkersByState(states []string) ([]dto.MarkerSimple, error) {
+	query, args, err := sqlx.In(getSimpleMarkersByStateQuery, states)
+	if err != nil {
+		return nil, fmt.Errorf("error building state filter: %w", err)
+	}
+
+	markers := make([]dto.MarkerSimple, 0)
+	if err := s.DB.Select(&markers, s.DB.Rebind(query), args...); err != nil {
+		return nil, fmt.Errorf("error fetching markers: %w", err)
+	}
+	return markers, nil
+}
+
 func (s *MarkerManageService) CheckNearbyMarkersInDB() ([]dto.MarkerGroup, error) {
 	markers, err := s.GetAllMarkers()
 	if err != nil {
@@ -0,0 +1,391 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Alfex4936/chulbong-kr/dto"
+	"github.com/Alfex4936/chulbong-kr/dto/notification"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+const (
+	maxMeetupTitleLength       = 50
+	maxMeetupDescriptionLength = 500
+	maxUpcomingMeetupsPerUser  = 3
+	minMeetupLeadTime          = 10 * time.Minute
+	maxMeetupLeadTime          = 60 * 24 * time.Hour
+	meetupReminderLeadTime     = time.Hour
+	defaultMeetupDuration      = 60
+
+	meetupColumns = `
+SELECT m.MeetupID, m.MarkerID, m.CreatorID, u.Username AS CreatorName, m.Title, m.Description,
+       m.StartsAt, m.DurationMinutes, m.Capacity, m.CancelledAt, m.CreatedAt,
+       (SELECT COUNT(*) FROM MeetupRSVPs r WHERE r.MeetupID = m.MeetupID) AS GoingCount,
+       EXISTS(SELECT 1 FROM MeetupRSVPs r WHERE r.MeetupID = m.MeetupID AND r.UserID = ?) AS Going,
+       mk.Address, mk.Latitude, mk.Longitude
+FROM Meetups m
+JOIN Users u ON u.UserID = m.CreatorID
+JOIN Markers mk ON mk.MarkerID = m.MarkerID`
+
+	getMeetupQuery = meetupColumns + `
+WHERE m.MeetupID = ?`
+
+	getUpcomingMeetupsQuery = meetupColumns + `
+WHERE m.MarkerID = ? AND m.CancelledAt IS NULL AND m.StartsAt + INTERVAL m.DurationMinutes MINUTE > ?
+ORDER BY m.StartsAt`
+
+	countUpcomingMeetupsQuery = "SELECT COUNT(*) FROM Meetups WHERE CreatorID = ? AND CancelledAt IS NULL AND StartsAt > ?"
+
+	insertMeetupQuery = `
+INSERT INTO Meetups (MarkerID, CreatorID, Title, Description, StartsAt, DurationMinutes, Capacity, CreatedAt)
+VALUES (?, ?, ?, ?, ?, ?, ?, NOW())`
+
+	lockMeetupQuery   = "SELECT Capacity, StartsAt, CancelledAt IS NOT NULL FROM Meetups WHERE MeetupID = ? FOR UPDATE"
+	countRSVPsQuery   = "SELECT COUNT(*) FROM MeetupRSVPs WHERE MeetupID = ?"
+	insertRSVPQuery   = "INSERT IGNORE INTO MeetupRSVPs (MeetupID, UserID, CreatedAt) VALUES (?, ?, NOW())"
+	deleteRSVPQuery   = "DELETE FROM MeetupRSVPs WHERE MeetupID = ? AND UserID = ?"
+	getAttendeesQuery = "SELECT UserID FROM MeetupRSVPs WHERE MeetupID = ?"
+
+	cancelMeetupQuery = "UPDATE Meetups SET CancelledAt = NOW() WHERE MeetupID = ? AND CancelledAt IS NULL"
+
+	getDueRemindersQuery = `
+SELECT MeetupID FROM Meetups
+WHERE CancelledAt IS NULL AND ReminderSentAt IS NULL AND StartsAt BETWEEN ? AND ?`
+
+	// only one instance wins the update, so reminders go out once
+	claimReminderQuery = "UPDATE Meetups SET ReminderSentAt = NOW() WHERE MeetupID = ? AND ReminderSentAt IS NULL"
+)
+
+// kst is how times are written in chat and notifications, users are in Korea
+var kst = time.FixedZone("KST", 9*60*60)
+
+// MeetupService schedules group workouts at markers.
+// Meetups are announced in the marker's chat room and attendees are reminded an hour before.
+type MeetupService struct {
+	DB                  *sqlx.DB
+	ChatService         *ChatService
+	NotificationService *NotificationService
+	Logger              *zap.Logger
+}
+
+func NewMeetupService(db *sqlx.DB, chat *ChatService, notification *NotificationService, logger *zap.Logger) *MeetupService {
+	return &MeetupService{
+		DB:                  db,
+		ChatService:         chat,
+		NotificationService: notification,
+		Logger:              logger,
+	}
+}
+
+// CreateMeetup schedules a meetup, the creator is the first attendee
+func (s *MeetupService) CreateMeetup(markerID, userID int, req dto.MeetupRequest) (*dto.Meetup, error) {
+	if err := validateMeetup(&req, time.Now()); err != nil {
+		return nil, err
+	}
+
+	var upcoming int
+	if err := s.DB.Get(&upcoming, countUpcomingMeetupsQuery, userID, time.Now()); err != nil {
+		return nil, err
+	}
+	if upcoming >= maxUpcomingMeetupsPerUser {
+		return nil, ErrMeetupLimit
+	}
+
+	tx, err := s.DB.Beginx()
+	if err != nil {
+		return nil, ErrBeginTransaction
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.Get(&exists, "SELECT EXISTS(SELECT 1 FROM Markers WHERE MarkerID = ?)", markerID); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrMarkerNotFound
+	}
+
+	result, err := tx.Exec(insertMeetupQuery, markerID, userID, req.Title, req.Description, req.StartsAt.UTC(), req.DurationMinutes, req.Capacity)
+	if err != nil {
+		return nil, fmt.Errorf("error inserting meetup: %w", err)
+	}
+	meetupID, err := result.LastInsertId()
+	if err != nil {
+		return nil, ErrLastInsertID
+	}
+	if _, err := tx.Exec(insertRSVPQuery, meetupID, userID); err != nil {
+		return nil, fmt.Errorf("error inserting rsvp: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, ErrCommitTransaction
+	}
+
+	meetup, err := s.GetMeetup(meetupID, userID)
+	if err != nil {
+		return nil, err
+	}
+	s.announce(meetup, fmt.Sprintf("📅 %s 님이 모임을 만들었어요: %s (%s, 최대 %d명)",
+		meetup.CreatorName, meetup.Title, formatMeetupTime(meetup.StartsAt), meetup.Capacity))
+	return meetup, nil
+}
+
+// GetMeetup returns a meetup, userID is 0 for anonymous users
+func (s *MeetupService) GetMeetup(meetupID int64, userID int) (*dto.Meetup, error) {
+	var meetup dto.Meetup
+	err := s.DB.Get(&meetup, getMeetupQuery, userID, meetupID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrMeetupNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &meetup, nil
+}
+
+// GetUpcomingMeetups lists the meetups of a marker that haven't ended yet
+func (s *MeetupService) GetUpcomingMeetups(markerID, userID int) ([]dto.Meetup, error) {
+	meetups := make([]dto.Meetup, 0)
+	if err := s.DB.Select(&meetups, getUpcomingMeetupsQuery, userID, markerID, time.Now()); err != nil {
+		return nil, fmt.Errorf("error fetching meetups: %w", err)
+	}
+	return meetups, nil
+}
+
+// RSVP adds the user to a meetup that has room left
+func (s *MeetupService) RSVP(meetupID int64, userID int) (*dto.Meetup, error) {
+	tx, err := s.DB.Beginx()
+	if err != nil {
+		return nil, ErrBeginTransaction
+	}
+	defer tx.Rollback()
+
+	var (
+		capacity  int
+		startsAt  time.Time
+		cancelled bool
+	)
+	err = tx.QueryRow(lockMeetupQuery, meetupID).Scan(&capacity, &startsAt, &cancelled)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrMeetupNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if cancelled || !startsAt.After(time.Now()) {
+		return nil, ErrMeetupClosed
+	}
+
+	var going int
+	if err := tx.Get(&going, countRSVPsQuery, meetupID); err != nil {
+		return nil, err
+	}
+	result, err := tx.Exec(insertRSVPQuery, meetupID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error inserting rsvp: %w", err)
+	}
+	if added, _ := result.RowsAffected(); added > 0 && going >= capacity {
+		return nil, ErrMeetupFull // rolled back
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, ErrCommitTransaction
+	}
+
+	return s.GetMeetup(meetupID, userID)
+}
+
+// CancelRSVP takes the user off a meetup, the creator cancels the meetup instead
+func (s *MeetupService) CancelRSVP(meetupID int64, userID int) (*dto.Meetup, error) {
+	meetup, err := s.GetMeetup(meetupID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if meetup.CreatorID == userID {
+		return nil, ErrMeetupCreatorRSVP
+	}
+
+	if _, err := s.DB.Exec(deleteRSVPQuery, meetupID, userID); err != nil {
+		return nil, fmt.Errorf("error deleting rsvp: %w", err)
+	}
+	return s.GetMeetup(meetupID, userID)
+}
+
+// CancelMeetup is for the creator or admins, attendees are notified
+func (s *MeetupService) CancelMeetup(meetupID int64, userID int, userRole string) error {
+	meetup, err := s.GetMeetup(meetupID, userID)
+	if err != nil {
+		return err
+	}
+	if meetup.CreatorID != userID && userRole != "admin" {
+		return ErrUnauthorized
+	}
+
+	result, err := s.DB.Exec(cancelMeetupQuery, meetupID)
+	if err != nil {
+		return fmt.Errorf("error cancelling meetup: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrMeetupClosed
+	}
+
+	s.announce(meetup, fmt.Sprintf("🚫 모임이 취소되었어요: %s (%s)", meetup.Title, formatMeetupTime(meetup.StartsAt)))
+	s.notifyAttendees(meetup, "모임 취소", fmt.Sprintf("%s 모임이 취소되었어요.", meetup.Title), meetup.CreatorID)
+	return nil
+}
+
+// SendReminders notifies the attendees of meetups starting within the hour
+func (s *MeetupService) SendReminders(now time.Time) (int, error) {
+	var meetupIDs []int64
+	if err := s.DB.Select(&meetupIDs, getDueRemindersQuery, now, now.Add(meetupReminderLeadTime)); err != nil {
+		return 0, fmt.Errorf("error fetching due reminders: %w", err)
+	}
+
+	sent := 0
+	for _, meetupID := range meetupIDs {
+		claimed, err := claimOnce(s.DB, claimReminderQuery, meetupID)
+		if err != nil {
+			return sent, err
+		}
+		if !claimed {
+			continue
+		}
+
+		meetup, err := s.GetMeetup(meetupID, 0)
+		if err != nil {
+			s.Logger.Error("Failed to load meetup for reminder", zap.Int64("meetupID", meetupID), zap.Error(err))
+			continue
+		}
+
+		s.announce(meetup, fmt.Sprintf("⏰ 곧 시작해요: %s (%s, %d명 참여)", meetup.Title, formatMeetupTime(meetup.StartsAt), meetup.GoingCount))
+		s.notifyAttendees(meetup, "모임 알림", fmt.Sprintf("%s 모임이 %s에 시작해요.", meetup.Title, formatMeetupTime(meetup.StartsAt)), 0)
+		sent++
+	}
+	return sent, nil
+}
+
+// announce posts a system message in the marker's chat room, it's kept with the room's messages
+func (s *MeetupService) announce(meetup *dto.Meetup, text string) {
+	event := NewChatEvent(dto.ChatKindSystem, strconv.Itoa(meetup.MarkerID), "", "chulbong-kr", text)
+	if err := s.ChatService.SendChatMessage(context.Background(), event); err != nil {
+		s.Logger.Warn("Failed to announce meetup in chat", zap.Int64("meetupID", meetup.MeetupID), zap.Error(err))
+	}
+}
+
+// notifyAttendees sends a personal notification to everyone going but skipUserID
+func (s *MeetupService) notifyAttendees(meetup *dto.Meetup, title, message string, skipUserID int) {
+	var attendees []int
+	if err := s.DB.Select(&attendees, getAttendeesQuery, meetup.MeetupID); err != nil {
+		s.Logger.Error("Failed to load meetup attendees", zap.Int64("meetupID", meetup.MeetupID), zap.Error(err))
+		return
+	}
+
+	metadata := notification.NotificationMeetupMetadata{
+		MeetupID: meetup.MeetupID,
+		MarkerID: meetup.MarkerID,
+		StartsAt: meetup.StartsAt.Format(time.RFC3339),
+	}
+	for _, userID := range attendees {
+		if userID == skipUserID {
+			continue
+		}
+		if err := s.NotificationService.NotifyUser(userID, NotificationMeetup, title, message, metadata); err != nil {
+			s.Logger.Error("Failed to post meetup notification", zap.Int("userID", userID), zap.Error(err))
+		}
+	}
+}
+
+// validateMeetup trims the request and fills in the default duration
+func validateMeetup(req *dto.MeetupRequest, now time.Time) error {
+	req.Title = strings.TrimSpace(req.Title)
+	req.Description = strings.TrimSpace(req.Description)
+	if req.DurationMinutes == 0 {
+		req.DurationMinutes = defaultMeetupDuration
+	}
+
+	switch {
+	case req.Title == "" || utf8.RuneCountInString(req.Title) > maxMeetupTitleLength:
+		return fmt.Errorf("%w: title must be between 1 and %d characters", ErrInvalidMeetup, maxMeetupTitleLength)
+	case utf8.RuneCountInString(req.Description) > maxMeetupDescriptionLength:
+		return fmt.Errorf("%w: description must be %d characters or fewer", ErrInvalidMeetup, maxMeetupDescriptionLength)
+	case req.StartsAt.Before(now.Add(minMeetupLeadTime)) || req.StartsAt.After(now.Add(maxMeetupLeadTime)):
+		return fmt.Errorf("%w: meetups start between 10 minutes and 60 days from now", ErrInvalidMeetup)
+	case req.DurationMinutes < 15 || req.DurationMinutes > 480:
+		return fmt.Errorf("%w: duration must be between 15 and 480 minutes", ErrInvalidMeetup)
+	case req.Capacity < 2 || req.Capacity > 100:
+		return fmt.Errorf("%w: capacity must be between 2 and 100", ErrInvalidMeetup)
+	}
+	return nil
+}
+
+func formatMeetupTime(t time.Time) string {
+	return t.In(kst).Format("1월 2일 15:04")
+}
+
+// MeetupICS renders a meetup as an iCalendar (RFC 5545) event
+func MeetupICS(meetup *dto.Meetup, now time.Time) []byte {
+	const stamp = "20060102T150405Z"
+
+	status := "CONFIRMED"
+	if meetup.CancelledAt != nil {
+		status = "CANCELLED"
+	}
+	location := fmt.Sprintf("https://k-pullup.com/pullup/%d", meetup.MarkerID)
+	if meetup.Address != nil && *meetup.Address != "" {
+		location = *meetup.Address
+	}
+
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//k-pullup//meetups//KO",
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+		"BEGIN:VEVENT",
+		fmt.Sprintf("UID:meetup-%d@k-pullup.com", meetup.MeetupID),
+		"DTSTAMP:" + now.UTC().Format(stamp),
+		"DTSTART:" + meetup.StartsAt.UTC().Format(stamp),
+		"DTEND:" + meetup.StartsAt.Add(time.Duration(meetup.DurationMinutes)*time.Minute).UTC().Format(stamp),
+		"SUMMARY:" + escapeICSText(meetup.Title),
+		"DESCRIPTION:" + escapeICSText(meetup.Description),
+		"LOCATION:" + escapeICSText(location),
+		fmt.Sprintf("GEO:%.6f;%.6f", meetup.Latitude, meetup.Longitude),
+		fmt.Sprintf("URL:https://k-pullup.com/pullup/%d", meetup.MarkerID),
+		"STATUS:" + status,
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}
+
+	var b strings.Builder
+	for _, line := range lines {
+		foldICSLine(&b, line)
+	}
+	return []byte(b.String())
+}
+
+func escapeICSText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`).Replace(s)
+}
+
+// foldICSLine writes a content line folded at 75 octets without splitting a UTF-8 character
+func foldICSLine(b *strings.Builder, line string) {
+	const limit = 75
+
+	width := 0
+	for _, r := range line {
+		size := utf8.RuneLen(r)
+		if width+size > limit {
+			b.WriteString("\r\n ")
+			width = 1 // the leading space counts
+		}
+		b.WriteRune(r)
+		width += size
+	}
+	b.WriteString("\r\n")
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Alfex4936/chulbong-kr/dto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMeetup(t *testing.T) {
+	now := time.Date(2024, 6, 1, 9, 0, 0, 0, time.UTC)
+
+	t.Run("Validate", func(t *testing.T) {
+		req := dto.MeetupRequest{Title: "  아침 턱걸이  ", StartsAt: now.Add(2 * time.Hour), Capacity: 5}
+		require.NoError(t, validateMeetup(&req, now))
+		assert.Equal(t, "아침 턱걸이", req.Title)
+		assert.Equal(t, defaultMeetupDuration, req.DurationMinutes)
+
+		invalid := []dto.MeetupRequest{
+			{Title: " ", StartsAt: now.Add(2 * time.Hour), Capacity: 5},
+			{Title: strings.Repeat("가", maxMeetupTitleLength+1), StartsAt: now.Add(2 * time.Hour), Capacity: 5},
+			{Title: "soon", StartsAt: now.Add(time.Minute), Capacity: 5},
+			{Title: "far", StartsAt: now.Add(90 * 24 * time.Hour), Capacity: 5},
+			{Title: "long", StartsAt: now.Add(2 * time.Hour), DurationMinutes: 600, Capacity: 5},
+			{Title: "alone", StartsAt: now.Add(2 * time.Hour), Capacity: 1},
+		}
+		for _, req := range invalid {
+			assert.ErrorIs(t, validateMeetup(&req, now), ErrInvalidMeetup, req.Title)
+		}
+	})
+
+	t.Run("ICS", func(t *testing.T) {
+		address := "서울특별시 종로구 세종대로 175"
+		meetup := &dto.Meetup{
+			MeetupID:        42,
+			MarkerID:        7,
+			Title:           "Pull-ups; then dips, maybe",
+			Description:     "bring chalk\n" + strings.Repeat("턱걸이", 20),
+			StartsAt:        time.Date(2024, 6, 2, 7, 30, 0, 0, kst),
+			DurationMinutes: 90,
+			Address:         &address,
+			Latitude:        37.5759,
+			Longitude:       126.9768,
+		}
+
+		ics := string(MeetupICS(meetup, now))
+		assert.True(t, strings.HasSuffix(ics, "END:VCALENDAR\r\n"))
+		assert.Contains(t, ics, "UID:meetup-42@k-pullup.com\r\n")
+		assert.Contains(t, ics, "DTSTART:20240601T223000Z\r\n")
+		assert.Contains(t, ics, "DTEND:20240602T000000Z\r\n")
+		assert.Contains(t, ics, `SUMMARY:Pull-ups\; then dips\, maybe`+"\r\n")
+		assert.Contains(t, ics, "GEO:37.575900;126.976800\r\n")
+		assert.Contains(t, ics, "STATUS:CONFIRMED\r\n")
+
+		for _, line := range strings.Split(strings.TrimSuffix(ics, "\r\n"), "\r\n") {
+			assert.LessOrEqual(t, len(line), 75, line)
+			assert.NotContains(t, line, "\n")
+		}
+		unfolded := strings.ReplaceAll(ics, "\r\n ", "")
+		assert.Contains(t, unfolded, `DESCRIPTION:bring chalk\n`+strings.Repeat("턱걸이", 20)+"\r\n")
+
+		cancelled := now
+		meetup.CancelledAt = &cancelled
+		assert.Contains(t, string(MeetupICS(meetup, now)), "STATUS:CANCELLED\r\n")
+	})
+}
@@ -0,0 +1,317 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Alfex4936/chulbong-kr/dto"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+// Lifecycle of a marker. New markers are unverified until another user confirms them or a photo backs them up,
+// a "does not exist" report makes them missing until it's decided and approving it removes them.
+// Removed markers keep their row as a tombstone but are left out of the map, the payloads and search.
+const (
+	MarkerStateUnverified = "unverified"
+	MarkerStateVerified   = "verified"
+	MarkerStateMissing    = "missing"
+	MarkerStateRemoved    = "removed"
+
+	MarkerEventConfirmed       = "confirmed" // by a user other than the creator
+	MarkerEventPhotoAdded      = "photo_added"
+	MarkerEventReportedMissing = "reported_missing"
+	MarkerEventMissingDenied   = "missing_denied" // the last pending "does not exist" report was denied
+	MarkerEventRemovalApproved = "removal_approved"
+	MarkerEventRestored        = "restored"
+)
+
+// markerTransitions maps each event to the states it moves a marker out of and where to,
+// a missing marker waits for its reports to be decided whatever else happens to it
+var markerTransitions = map[string]map[string]string{
+	MarkerEventConfirmed:  {MarkerStateUnverified: MarkerStateVerified},
+	MarkerEventPhotoAdded: {MarkerStateUnverified: MarkerStateVerified},
+	MarkerEventReportedMissing: {
+		MarkerStateUnverified: MarkerStateMissing,
+		MarkerStateVerified:   MarkerStateMissing,
+	},
+	MarkerEventMissingDenied: {MarkerStateMissing: MarkerStateUnverified}, // settleMissingMarkerTx puts back the state before the report
+	MarkerEventRemovalApproved: {
+		MarkerStateUnverified: MarkerStateRemoved,
+		MarkerStateVerified:   MarkerStateRemoved,
+		MarkerStateMissing:    MarkerStateRemoved,
+	},
+	MarkerEventRestored: {MarkerStateRemoved: MarkerStateVerified},
+}
+
+// listedMarkerStates are the states clients can filter by, removed markers are never listed
+var listedMarkerStates = []string{MarkerStateUnverified, MarkerStateVerified, MarkerStateMissing}
+
+// Markers.State is one of the states above, 'unverified' by default.
+// MarkerStateHistory(HistoryID, MarkerID, FromState, ToState, Event, ActorID, ReportID, CreatedAt) records every transition.
+// MarkerConfirmations(MarkerID, UserID, CreatedAt) keeps one confirmation per user.
+const (
+	getMarkerStateForUpdateQuery = "SELECT State FROM Markers WHERE MarkerID = ? FOR UPDATE"
+	updateMarkerStateQuery       = "UPDATE Markers SET State = ? WHERE MarkerID = ?"
+
+	insertMarkerStateHistoryQuery = `
+INSERT INTO MarkerStateHistory (MarkerID, FromState, ToState, Event, ActorID, ReportID, CreatedAt)
+VALUES (?, ?, ?, ?, ?, ?, NOW())`
+
+	getMarkerStateHistoryQuery = `
+SELECT HistoryID, FromState, ToState, Event, ActorID, ReportID, CreatedAt
+FROM MarkerStateHistory
+WHERE MarkerID = ?
+ORDER BY HistoryID DESC`
+
+	getMarkerOwnerStateQuery      = "SELECT COALESCE(UserID, 0) AS UserID, State FROM Markers WHERE MarkerID = ?"
+	insertMarkerConfirmationQuery = "INSERT IGNORE INTO MarkerConfirmations (MarkerID, UserID, CreatedAt) VALUES (?, ?, NOW())"
+	countMarkerConfirmationsQuery = "SELECT COUNT(*) FROM MarkerConfirmations WHERE MarkerID = ?"
+
+	getReportForStateQuery          = "SELECT MarkerID, DoesExist FROM Reports WHERE ReportID = ?"
+	countPendingMissingReportsQuery = "SELECT COUNT(*) FROM Reports WHERE MarkerID = ? AND DoesExist = FALSE AND Status = 'PENDING'"
+
+	getStateBeforeMissingQuery = `
+SELECT FromState
+FROM MarkerStateHistory
+WHERE MarkerID = ? AND Event = 'reported_missing'
+ORDER BY HistoryID DESC
+LIMIT 1`
+)
+
+// MarkerStateService moves markers through their lifecycle on behalf of users and admins
+type MarkerStateService struct {
+	DB                 *sqlx.DB
+	CacheService       *MarkerCacheService
+	SearchIndexService *SearchIndexService
+	Logger             *zap.Logger
+}
+
+func NewMarkerStateService(db *sqlx.DB, cache *MarkerCacheService, searchIndex *SearchIndexService, logger *zap.Logger) *MarkerStateService {
+	return &MarkerStateService{
+		DB:                 db,
+		CacheService:       cache,
+		SearchIndexService: searchIndex,
+		Logger:             logger,
+	}
+}
+
+// Confirm records that the user found the marker where it is, the first confirmation by someone other than its creator verifies it
+func (s *MarkerStateService) Confirm(markerID, userID int) (dto.MarkerState, error) {
+	result := dto.MarkerState{MarkerID: markerID}
+
+	var marker struct {
+		UserID int    `db:"UserID"`
+		State  string `db:"State"`
+	}
+	if err := s.DB.Get(&marker, getMarkerOwnerStateQuery, markerID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return result, ErrMarkerNotFound
+		}
+		return result, fmt.Errorf("error fetching marker %d: %w", markerID, err)
+	}
+	switch {
+	case marker.State == MarkerStateRemoved:
+		return result, ErrMarkerRemoved
+	case marker.UserID == userID:
+		return result, ErrMarkerOwnConfirm
+	}
+
+	tx, err := s.DB.Beginx()
+	if err != nil {
+		return result, fmt.Errorf("%w: %v", ErrBeginTransaction, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(insertMarkerConfirmationQuery, markerID, userID); err != nil {
+		return result, fmt.Errorf("error saving confirmation of marker %d: %w", markerID, err)
+	}
+	state, changed, err := transitionMarkerTx(tx, markerID, MarkerEventConfirmed, &userID, nil)
+	if err != nil {
+		return result, err
+	}
+	if err := tx.Get(&result.Confirmations, countMarkerConfirmationsQuery, markerID); err != nil {
+		return result, fmt.Errorf("error counting confirmations of marker %d: %w", markerID, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return result, fmt.Errorf("%w: %v", ErrCommitTransaction, err)
+	}
+
+	if changed {
+		s.Changed(markerID)
+	}
+	result.State = state
+	return result, nil
+}
+
+// Restore brings back a marker removed by mistake, it comes back verified since a report had looked at it
+func (s *MarkerStateService) Restore(markerID, adminID int) (dto.MarkerState, error) {
+	result := dto.MarkerState{MarkerID: markerID}
+
+	tx, err := s.DB.Beginx()
+	if err != nil {
+		return result, fmt.Errorf("%w: %v", ErrBeginTransaction, err)
+	}
+	defer tx.Rollback()
+
+	state, changed, err := transitionMarkerTx(tx, markerID, MarkerEventRestored, &adminID, nil)
+	if err != nil {
+		return result, err
+	}
+	if !changed {
+		return result, ErrMarkerNotRemoved
+	}
+	if err := tx.Get(&result.Confirmations, countMarkerConfirmationsQuery, markerID); err != nil {
+		return result, fmt.Errorf("error counting confirmations of marker %d: %w", markerID, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return result, fmt.Errorf("%w: %v", ErrCommitTransaction, err)
+	}
+
+	s.Changed(markerID)
+	result.State = state
+	return result, nil
+}
+
+// GetHistory lists the transitions of the marker, the latest first
+func (s *MarkerStateService) GetHistory(markerID int) ([]dto.MarkerStateChange, error) {
+	history := make([]dto.MarkerStateChange, 0)
+	if err := s.DB.Select(&history, getMarkerStateHistoryQuery, markerID); err != nil {
+		return nil, fmt.Errorf("error fetching state history of marker %d: %w", markerID, err)
+	}
+	return history, nil
+}
+
+// Changed refreshes the cached marker list and the search document once a transition is committed,
+// SyncMarker drops removed markers from the index
+func (s *MarkerStateService) Changed(markerID int) {
+	if err := s.CacheService.InvalidateFullMarkersCache(); err != nil {
+		s.Logger.Error("Failed to invalidate markers cache", zap.Int("markerID", markerID), zap.Error(err))
+	}
+	s.SearchIndexService.SyncMarkerAsync(markerID)
+}
+
+// ParseMarkerStates reads a comma separated state filter, empty means every listed state
+func ParseMarkerStates(raw string) ([]string, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	var states []string
+	for _, state := range strings.Split(raw, ",") {
+		state = strings.ToLower(strings.TrimSpace(state))
+		if !isListedMarkerState(state) {
+			return nil, ErrInvalidMarkerState
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+func isListedMarkerState(state string) bool {
+	for _, listed := range listedMarkerStates {
+		if state == listed {
+			return true
+		}
+	}
+	return false
+}
+
+// nextMarkerState is where the event moves a marker in the given state, ok is false when the event doesn't apply to it
+func nextMarkerState(state, event string) (next string, ok bool) {
+	next, ok = markerTransitions[event][state]
+	return next, ok
+}
+
+// transitionMarkerTx moves the marker along the event and records the step, events that don't apply leave it as it is.
+// It returns the state the marker ends up in and whether it changed.
+func transitionMarkerTx(tx *sqlx.Tx, markerID int, event string, actorID, reportID *int) (string, bool, error) {
+	var state string
+	if err := tx.Get(&state, getMarkerStateForUpdateQuery, markerID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", false, ErrMarkerNotFound
+		}
+		return "", false, fmt.Errorf("error fetching state of marker %d: %w", markerID, err)
+	}
+
+	next, ok := nextMarkerState(state, event)
+	if !ok {
+		return state, false, nil
+	}
+	if err := recordMarkerStateTx(tx, markerID, state, next, event, actorID, reportID); err != nil {
+		return state, false, err
+	}
+	return next, true, nil
+}
+
+// recordMarkerStateTx sets the state of a marker locked by the caller and keeps the step in its history
+func recordMarkerStateTx(tx *sqlx.Tx, markerID int, from, to, event string, actorID, reportID *int) error {
+	if _, err := tx.Exec(updateMarkerStateQuery, to, markerID); err != nil {
+		return fmt.Errorf("error updating state of marker %d: %w", markerID, err)
+	}
+	if _, err := tx.Exec(insertMarkerStateHistoryQuery, markerID, from, to, event, actorID, reportID); err != nil {
+		return fmt.Errorf("error recording state of marker %d: %w", markerID, err)
+	}
+	return nil
+}
+
+// reportMarkerTransitionTx moves the marker of a "does not exist" report along the event,
+// other reports leave the marker as it is. A denial waits until no such report on the marker is pending.
+func reportMarkerTransitionTx(tx *sqlx.Tx, reportID int, event string) (markerID int, changed bool, err error) {
+	var report struct {
+		MarkerID  int  `db:"MarkerID"`
+		DoesExist bool `db:"DoesExist"`
+	}
+	if err := tx.Get(&report, getReportForStateQuery, reportID); err != nil {
+		return 0, false, fmt.Errorf("error fetching report %d: %w", reportID, err)
+	}
+	if report.DoesExist {
+		return report.MarkerID, false, nil
+	}
+
+	if event == MarkerEventMissingDenied {
+		changed, err = settleMissingMarkerTx(tx, report.MarkerID, &reportID)
+		return report.MarkerID, changed, err
+	}
+	_, changed, err = transitionMarkerTx(tx, report.MarkerID, event, nil, &reportID)
+	return report.MarkerID, changed, err
+}
+
+// settleMissingMarkerTx puts a missing marker back in the state it had before it was reported
+// once no "does not exist" report on it is pending, a denied report doesn't verify a marker nobody confirmed
+func settleMissingMarkerTx(tx *sqlx.Tx, markerID int, reportID *int) (bool, error) {
+	var pending int
+	if err := tx.Get(&pending, countPendingMissingReportsQuery, markerID); err != nil {
+		return false, fmt.Errorf("error counting reports of marker %d: %w", markerID, err)
+	}
+	if pending > 0 {
+		return false, nil
+	}
+
+	var state string
+	if err := tx.Get(&state, getMarkerStateForUpdateQuery, markerID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, ErrMarkerNotFound
+		}
+		return false, fmt.Errorf("error fetching state of marker %d: %w", markerID, err)
+	}
+	next, ok := nextMarkerState(state, MarkerEventMissingDenied)
+	if !ok {
+		return false, nil
+	}
+
+	var before string
+	err := tx.Get(&before, getStateBeforeMissingQuery, markerID)
+	switch {
+	case err == nil && (before == MarkerStateUnverified || before == MarkerStateVerified):
+		next = before
+	case err != nil && !errors.Is(err, sql.ErrNoRows):
+		return false, fmt.Errorf("error fetching state history of marker %d: %w", markerID, err)
+	}
+
+	if err := recordMarkerStateTx(tx, markerID, state, next, MarkerEventMissingDenied, nil, reportID); err != nil {
+		return false, err
+	}
+	return true, nil
+}
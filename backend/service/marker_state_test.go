@@ -0,0 +1,56 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarkerState(t *testing.T) {
+	t.Run("Transitions", func(t *testing.T) {
+		for name, c := range map[string]struct {
+			state, event string
+			want         string
+			ok           bool
+		}{
+			"ConfirmedUnverified":   {MarkerStateUnverified, MarkerEventConfirmed, MarkerStateVerified, true},
+			"ConfirmedVerified":     {MarkerStateVerified, MarkerEventConfirmed, "", false},
+			"ConfirmedMissing":      {MarkerStateMissing, MarkerEventConfirmed, "", false},
+			"PhotoOnUnverified":     {MarkerStateUnverified, MarkerEventPhotoAdded, MarkerStateVerified, true},
+			"PhotoOnMissing":        {MarkerStateMissing, MarkerEventPhotoAdded, "", false},
+			"ReportedUnverified":    {MarkerStateUnverified, MarkerEventReportedMissing, MarkerStateMissing, true},
+			"ReportedVerified":      {MarkerStateVerified, MarkerEventReportedMissing, MarkerStateMissing, true},
+			"ReportedMissing":       {MarkerStateMissing, MarkerEventReportedMissing, "", false},
+			"MissingDenied":         {MarkerStateMissing, MarkerEventMissingDenied, MarkerStateUnverified, true},
+			"DeniedOnVerified":      {MarkerStateVerified, MarkerEventMissingDenied, "", false},
+			"RemovalOfMissing":      {MarkerStateMissing, MarkerEventRemovalApproved, MarkerStateRemoved, true},
+			"RemovalOfUnverified":   {MarkerStateUnverified, MarkerEventRemovalApproved, MarkerStateRemoved, true},
+			"RemovalOfRemoved":      {MarkerStateRemoved, MarkerEventRemovalApproved, "", false},
+			"RestoredRemoved":       {MarkerStateRemoved, MarkerEventRestored, MarkerStateVerified, true},
+			"RestoredVerified":      {MarkerStateVerified, MarkerEventRestored, "", false},
+			"RemovedStaysOnConfirm": {MarkerStateRemoved, MarkerEventConfirmed, "", false},
+			"UnknownEvent":          {MarkerStateUnverified, "moved", "", false},
+		} {
+			next, ok := nextMarkerState(c.state, c.event)
+			assert.Equal(t, c.ok, ok, name)
+			assert.Equal(t, c.want, next, name)
+		}
+	})
+
+	t.Run("ParseFilter", func(t *testing.T) {
+		states, err := ParseMarkerStates(" Verified, missing ")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{MarkerStateVerified, MarkerStateMissing}, states)
+
+		states, err = ParseMarkerStates("")
+		assert.NoError(t, err)
+		assert.Empty(t, states)
+
+		// removed markers are never listed
+		_, err = ParseMarkerStates("removed")
+		assert.ErrorIs(t, err, ErrInvalidMarkerState)
+
+		_, err = ParseMarkerStates("verified,gone")
+		assert.ErrorIs(t, err, ErrInvalidMarkerState)
+	})
+}
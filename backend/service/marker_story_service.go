@@ -78,24 +78,30 @@ ORDER BY s.CreatedAt DESC
 )
 
 type StoryService struct {
-	DB        *sqlx.DB
-	S3Service *S3Service
-	Redis     *RedisService
-	Logger    *zap.Logger
+	DB                 *sqlx.DB
+	S3Service          *S3Service
+	Redis              *RedisService
+	SearchIndexService *SearchIndexService
+	EventBus           *EventBus
+	Logger             *zap.Logger
 }
 
 func NewMarkerStoryService(
 	db *sqlx.DB,
 	s3 *S3Service,
 	redis *RedisService,
+	searchIndex *SearchIndexService,
+	bus *EventBus,
 	logger *zap.Logger,
 
 ) *StoryService {
 	return &StoryService{
-		DB:        db,
-		Redis:     redis,
-		S3Service: s3,
-		Logger:    logger,
+		DB:                 db,
+		Redis:              redis,
+		S3Service:          s3,
+		SearchIndexService: searchIndex,
+		EventBus:           bus,
+		Logger:             logger,
 	}
 }
 
@@ -156,6 +162,8 @@ func (s *StoryService) AddStory(markerID int, userID int, caption string, photo
 			_ = tx.Rollback()
 		} else if commitErr := tx.Commit(); commitErr != nil {
 			err = commitErr
+		} else {
+			s.SearchIndexService.SyncMarkerAsync(markerID) // caption becomes searchable
 		}
 	}()
 
@@ -323,6 +331,7 @@ func (s *StoryService) DeleteStory(markerID int, storyID int, userID int, userRo
 	// Invalidate cache
 	s.Redis.ResetAllCache(fmt.Sprintf("stories:%d:*", markerID))
 	s.Redis.ResetAllCache("stories:all:*")
+	s.SearchIndexService.SyncMarkerAsync(markerID)
 
 	return nil
 }
@@ -363,6 +372,7 @@ func (s *StoryService) AddReaction(storyID int, userID int, reactionType string)
 	// Invalidate cache for the marker's stories
 	s.Redis.ResetAllCache(fmt.Sprintf("stories:%d:*", markerID))
 
+	s.EventBus.Publish(DomainEvent{Name: EventStoryReacted, ActorID: userID, MarkerID: markerID, StoryID: storyID, Text: reactionType})
 	return nil
 }
 
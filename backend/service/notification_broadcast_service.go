@@ -0,0 +1,343 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Alfex4936/chulbong-kr/dto/notification"
+	sonic "github.com/bytedance/sonic"
+)
+
+// Broadcast audiences
+const (
+	BroadcastAudienceProvince = "province" // users who favorited a marker in the province
+	BroadcastAudienceDistrict = "district" // users who created a marker in the district
+	BroadcastAudienceActive   = "active"   // users who logged in, commented or added a marker lately
+	BroadcastAudienceMarker   = "marker"   // users who favorited the marker
+)
+
+// Broadcast statuses, a scheduled broadcast is claimed by one instance when it's due
+const (
+	BroadcastScheduled = "scheduled"
+	BroadcastSending   = "sending"
+	BroadcastSent      = "sent"
+	BroadcastCanceled  = "canceled"
+	BroadcastFailed    = "failed" // the audience couldn't be read, retrying won't change that
+)
+
+const (
+	maxBroadcastTitle      = 100
+	maxBroadcastMessage    = 1000
+	maxBroadcastActiveDays = 365
+	maxBroadcastSchedule   = 90 * 24 * time.Hour
+
+	// a broadcast still sending after this was left by an instance that died mid-send
+	broadcastSendTimeout = time.Hour
+)
+
+// Broadcasts(BroadcastID, Title, Message, Link, Audience, Status, ScheduledAt, ClaimedAt, SentAt, CreatedBy, CreatedAt) are the announcements,
+// BroadcastRecipients(BroadcastID, UserID, NotificationId) the notification each recipient got.
+// Delivery and opens are read from NotificationStates of those notifications.
+const (
+	insertBroadcastQuery = `
+INSERT INTO Broadcasts (Title, Message, Link, Audience, Status, ScheduledAt, CreatedBy, CreatedAt)
+VALUES (?, ?, ?, ?, 'scheduled', ?, ?, NOW())`
+
+	broadcastStatsSelect = `
+SELECT b.BroadcastID, b.Title, b.Message, COALESCE(b.Link, '') AS Link, b.Audience, b.Status, b.ScheduledAt, b.SentAt,
+	b.CreatedBy, b.CreatedAt,
+	COUNT(r.UserID) AS Recipients,
+	COUNT(COALESCE(s.DeliveredAt, s.ReadAt)) AS Delivered,
+	COUNT(s.ReadAt) AS Opened
+FROM Broadcasts b
+LEFT JOIN BroadcastRecipients r ON r.BroadcastID = b.BroadcastID
+LEFT JOIN NotificationStates s ON s.NotificationId = r.NotificationId AND s.UserID = CAST(r.UserID AS CHAR)`
+
+	getBroadcastQuery   = broadcastStatsSelect + " WHERE b.BroadcastID = ? GROUP BY b.BroadcastID"
+	getBroadcastsQuery  = broadcastStatsSelect + " GROUP BY b.BroadcastID ORDER BY b.ScheduledAt DESC LIMIT ? OFFSET ?"
+	countBroadcastQuery = "SELECT COUNT(*) FROM Broadcasts"
+
+	cancelBroadcastQuery    = "UPDATE Broadcasts SET Status = 'canceled' WHERE BroadcastID = ? AND Status = 'scheduled'"
+	getBroadcastStatusQuery = "SELECT Status FROM Broadcasts WHERE BroadcastID = ?"
+
+	getDueBroadcastsQuery = `
+SELECT BroadcastID, Title, Message, COALESCE(Link, '') AS Link, Audience
+FROM Broadcasts WHERE Status = 'scheduled' AND ScheduledAt <= ?
+ORDER BY ScheduledAt`
+
+	// only one instance wins the update, so a broadcast goes out once
+	claimBroadcastQuery    = "UPDATE Broadcasts SET Status = 'sending', ClaimedAt = ? WHERE BroadcastID = ? AND Status = 'scheduled'"
+	releaseBroadcastQuery  = "UPDATE Broadcasts SET Status = 'scheduled' WHERE BroadcastID = ? AND Status = 'sending'"
+	reclaimBroadcastsQuery = "UPDATE Broadcasts SET Status = 'scheduled' WHERE Status = 'sending' AND ClaimedAt < ?"
+	failBroadcastQuery     = "UPDATE Broadcasts SET Status = 'failed' WHERE BroadcastID = ?"
+	finishBroadcastQuery   = "UPDATE Broadcasts SET Status = 'sent', SentAt = NOW() WHERE BroadcastID = ?"
+	insertRecipientQuery   = "INSERT IGNORE INTO BroadcastRecipients (BroadcastID, UserID, NotificationId) VALUES (?, ?, ?)"
+	getRecipientIDsQuery   = "SELECT UserID FROM BroadcastRecipients WHERE BroadcastID = ? ORDER BY UserID"
+	countAudienceQueryWrap = "SELECT COUNT(*) FROM (%s) audience"
+
+	provinceAudienceQuery = `
+SELECT DISTINCT f.UserID FROM Favorites f
+JOIN Markers m ON m.MarkerID = f.MarkerID
+WHERE m.Address LIKE ?`
+
+	districtAudienceQuery = "SELECT DISTINCT UserID FROM Markers WHERE Address LIKE ? AND UserID IS NOT NULL"
+
+	// there's no last seen column, a login, a comment or a new marker counts as activity
+	activeAudienceQuery = `
+SELECT UserID FROM OpaqueTokens WHERE CreatedAt > NOW() - INTERVAL ? DAY
+UNION SELECT UserID FROM Comments WHERE PostedAt > NOW() - INTERVAL ? DAY
+UNION SELECT UserID FROM Markers WHERE CreatedAt > NOW() - INTERVAL ? DAY AND UserID IS NOT NULL`
+
+	markerAudienceQuery = "SELECT DISTINCT UserID FROM Favorites WHERE MarkerID = ?"
+)
+
+// CreateBroadcast validates the broadcast and schedules it, the scheduler sends it once it's due
+func (s *NotificationService) CreateBroadcast(adminID int, req notification.BroadcastRequest) (notification.Broadcast, error) {
+	now := time.Now()
+	if err := validateBroadcast(&req, now); err != nil {
+		return notification.Broadcast{}, err
+	}
+
+	audience, err := sonic.Marshal(req.Audience)
+	if err != nil {
+		return notification.Broadcast{}, err
+	}
+	scheduledAt := now
+	if req.ScheduledAt != nil {
+		scheduledAt = *req.ScheduledAt
+	}
+
+	result, err := s.DB.Exec(insertBroadcastQuery, req.Title, req.Message, req.Link, audience, scheduledAt, adminID)
+	if err != nil {
+		return notification.Broadcast{}, fmt.Errorf("error saving broadcast: %w", err)
+	}
+	broadcastID, err := result.LastInsertId()
+	if err != nil {
+		return notification.Broadcast{}, err
+	}
+	return s.GetBroadcast(broadcastID)
+}
+
+// CountBroadcastAudience tells how many users the audience reaches right now, before anything is sent
+func (s *NotificationService) CountBroadcastAudience(audience notification.BroadcastAudience) (int, error) {
+	if err := validateBroadcastAudience(&audience); err != nil {
+		return 0, err
+	}
+	query, args := broadcastAudienceQuery(audience)
+
+	var count int
+	if err := s.DB.Get(&count, fmt.Sprintf(countAudienceQueryWrap, query), args...); err != nil {
+		return 0, fmt.Errorf("error counting broadcast audience: %w", err)
+	}
+	return count, nil
+}
+
+func (s *NotificationService) GetBroadcast(broadcastID int64) (notification.Broadcast, error) {
+	var broadcast notification.Broadcast
+	if err := s.DB.Get(&broadcast, getBroadcastQuery, broadcastID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return broadcast, ErrBroadcastNotFound
+		}
+		return broadcast, fmt.Errorf("error fetching broadcast: %w", err)
+	}
+	return broadcast, nil
+}
+
+// ListBroadcasts lists a page of broadcasts with their counts, the latest scheduled first
+func (s *NotificationService) ListBroadcasts(page, pageSize int) (notification.BroadcastList, error) {
+	list := notification.BroadcastList{CurrentPage: page, Broadcasts: []notification.Broadcast{}}
+
+	var total int
+	if err := s.DB.Get(&total, countBroadcastQuery); err != nil {
+		return list, fmt.Errorf("error counting broadcasts: %w", err)
+	}
+	list.TotalPages = (total + pageSize - 1) / pageSize
+
+	offset := (page - 1) * pageSize
+	if err := s.DB.Select(&list.Broadcasts, getBroadcastsQuery, pageSize, offset); err != nil {
+		return list, fmt.Errorf("error fetching broadcasts: %w", err)
+	}
+	return list, nil
+}
+
+// CancelBroadcast stops a broadcast that hasn't gone out yet
+func (s *NotificationService) CancelBroadcast(broadcastID int64) error {
+	result, err := s.DB.Exec(cancelBroadcastQuery, broadcastID)
+	if err != nil {
+		return fmt.Errorf("error canceling broadcast: %w", err)
+	}
+	if canceled, _ := result.RowsAffected(); canceled > 0 {
+		return nil
+	}
+
+	var status string
+	if err := s.DB.Get(&status, getBroadcastStatusQuery, broadcastID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrBroadcastNotFound
+		}
+		return fmt.Errorf("error fetching broadcast: %w", err)
+	}
+	if status == BroadcastCanceled {
+		return nil
+	}
+	return ErrBroadcastAlreadySent
+}
+
+// SendDueBroadcasts sends the broadcasts scheduled before now and returns how many notifications went out
+func (s *NotificationService) SendDueBroadcasts(now time.Time) (int, error) {
+	var due []struct {
+		BroadcastID int64  `db:"BroadcastID"`
+		Title       string `db:"Title"`
+		Message     string `db:"Message"`
+		Link        string `db:"Link"`
+		Audience    []byte `db:"Audience"`
+	}
+	// broadcasts left sending by a dead instance go out again, without the recipients they already reached
+	if _, err := s.DB.Exec(reclaimBroadcastsQuery, now.Add(-broadcastSendTimeout)); err != nil {
+		return 0, fmt.Errorf("error reclaiming stale broadcasts: %w", err)
+	}
+	if err := s.DB.Select(&due, getDueBroadcastsQuery, now); err != nil {
+		return 0, fmt.Errorf("error fetching due broadcasts: %w", err)
+	}
+
+	notified := 0
+	for _, b := range due {
+		claimed, err := claimOnce(s.DB, claimBroadcastQuery, now, b.BroadcastID)
+		if err != nil {
+			return notified, fmt.Errorf("error claiming broadcast: %w", err)
+		}
+		if !claimed {
+			continue // another instance has it
+		}
+
+		var audience notification.BroadcastAudience
+		if err := sonic.Unmarshal(b.Audience, &audience); err != nil {
+			log.Printf("Error decoding audience of broadcast %d: %v", b.BroadcastID, err)
+			if _, err := s.DB.Exec(failBroadcastQuery, b.BroadcastID); err != nil {
+				log.Printf("Error failing broadcast %d: %v", b.BroadcastID, err)
+			}
+			continue
+		}
+		query, args := broadcastAudienceQuery(audience)
+		var userIDs, reached []int
+		err = s.DB.Select(&userIDs, query, args...)
+		if err == nil {
+			err = s.DB.Select(&reached, getRecipientIDsQuery, b.BroadcastID)
+		}
+		if err != nil {
+			// nobody was notified yet, hand it back so the next run retries instead of leaving it sending
+			if _, releaseErr := s.DB.Exec(releaseBroadcastQuery, b.BroadcastID); releaseErr != nil {
+				log.Printf("Error releasing broadcast %d: %v", b.BroadcastID, releaseErr)
+			}
+			return notified, fmt.Errorf("error fetching broadcast audience: %w", err)
+		}
+
+		metadata := notification.NotificationBroadcastMetadata{BroadcastID: b.BroadcastID, Link: b.Link}
+		for _, userID := range userIDs {
+			if _, ok := slices.BinarySearch(reached, userID); ok {
+				continue // reached before the broadcast was reclaimed
+			}
+			notificationId, err := s.notify(userID, NotificationAnnouncement, b.Title, b.Message, metadata)
+			if err != nil {
+				log.Printf("Error notifying user %d of broadcast %d: %v", userID, b.BroadcastID, err)
+			}
+			if notificationId == 0 {
+				continue // muted, or failed before it was stored
+			}
+			if _, err := s.DB.Exec(insertRecipientQuery, b.BroadcastID, userID, notificationId); err != nil {
+				log.Printf("Error saving recipient of broadcast %d: %v", b.BroadcastID, err)
+			}
+			notified++
+		}
+
+		if _, err := s.DB.Exec(finishBroadcastQuery, b.BroadcastID); err != nil {
+			return notified, fmt.Errorf("error finishing broadcast: %w", err)
+		}
+	}
+	return notified, nil
+}
+
+// validateBroadcast trims the request and rejects what can't be sent
+func validateBroadcast(req *notification.BroadcastRequest, now time.Time) error {
+	req.Title = strings.TrimSpace(req.Title)
+	req.Message = strings.TrimSpace(req.Message)
+	req.Link = strings.TrimSpace(req.Link)
+
+	if req.Title == "" || utf8.RuneCountInString(req.Title) > maxBroadcastTitle {
+		return fmt.Errorf("%w: title must be 1 to %d characters", ErrInvalidBroadcast, maxBroadcastTitle)
+	}
+	if req.Message == "" || utf8.RuneCountInString(req.Message) > maxBroadcastMessage {
+		return fmt.Errorf("%w: message must be 1 to %d characters", ErrInvalidBroadcast, maxBroadcastMessage)
+	}
+	// notificationLink only follows links on the site
+	if req.Link != "" && (!strings.HasPrefix(req.Link, "/") || strings.HasPrefix(req.Link, "//")) {
+		return fmt.Errorf("%w: link must be a path on the site", ErrInvalidBroadcast)
+	}
+	if req.ScheduledAt != nil {
+		if req.ScheduledAt.Before(now.Add(-time.Minute)) {
+			return fmt.Errorf("%w: scheduled time is in the past", ErrInvalidBroadcast)
+		}
+		if req.ScheduledAt.After(now.Add(maxBroadcastSchedule)) {
+			return fmt.Errorf("%w: can't schedule more than 90 days ahead", ErrInvalidBroadcast)
+		}
+	}
+	return validateBroadcastAudience(&req.Audience)
+}
+
+// validateBroadcastAudience standardizes the province and clears the fields the type doesn't use
+func validateBroadcastAudience(audience *notification.BroadcastAudience) error {
+	province := standardizeProvinceForDB(strings.TrimSpace(audience.Province))
+	district := strings.Join(strings.Fields(audience.District), " ")
+	knownProvince := slices.ContainsFunc(regions, func(r Region) bool { return r.Name == province })
+
+	switch audience.Type {
+	case BroadcastAudienceProvince:
+		if !knownProvince {
+			return fmt.Errorf("%w: unknown province %q", ErrInvalidBroadcast, audience.Province)
+		}
+		*audience = notification.BroadcastAudience{Type: audience.Type, Province: province}
+	case BroadcastAudienceDistrict:
+		if !knownProvince {
+			return fmt.Errorf("%w: unknown province %q", ErrInvalidBroadcast, audience.Province)
+		}
+		// it ends up in a LIKE pattern
+		if district == "" || strings.ContainsAny(district, `%_\`) {
+			return fmt.Errorf("%w: invalid district %q", ErrInvalidBroadcast, audience.District)
+		}
+		*audience = notification.BroadcastAudience{Type: audience.Type, Province: province, District: district}
+	case BroadcastAudienceActive:
+		if audience.Days < 1 || audience.Days > maxBroadcastActiveDays {
+			return fmt.Errorf("%w: days must be 1 to %d", ErrInvalidBroadcast, maxBroadcastActiveDays)
+		}
+		*audience = notification.BroadcastAudience{Type: audience.Type, Days: audience.Days}
+	case BroadcastAudienceMarker:
+		if audience.MarkerID <= 0 {
+			return fmt.Errorf("%w: invalid marker ID", ErrInvalidBroadcast)
+		}
+		*audience = notification.BroadcastAudience{Type: audience.Type, MarkerID: audience.MarkerID}
+	default:
+		return fmt.Errorf("%w: unknown audience %q", ErrInvalidBroadcast, audience.Type)
+	}
+	return nil
+}
+
+// broadcastAudienceQuery selects the user IDs of a validated audience.
+// Addresses are stored standardized, "서울특별시 종로구 ...", so regions match on the prefix.
+func broadcastAudienceQuery(audience notification.BroadcastAudience) (string, []any) {
+	switch audience.Type {
+	case BroadcastAudienceProvince:
+		return provinceAudienceQuery, []any{audience.Province + " %"}
+	case BroadcastAudienceDistrict:
+		return districtAudienceQuery, []any{audience.Province + " " + audience.District + " %"}
+	case BroadcastAudienceActive:
+		return activeAudienceQuery, []any{audience.Days, audience.Days, audience.Days}
+	default:
+		return markerAudienceQuery, []any{audience.MarkerID}
+	}
+}
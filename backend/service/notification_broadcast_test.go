@@ -0,0 +1,97 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Alfex4936/chulbong-kr/dto/notification"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBroadcast(t *testing.T) {
+	t.Run("Audiences", func(t *testing.T) {
+		audience := notification.BroadcastAudience{Type: BroadcastAudienceProvince, Province: " 서울 ", Days: 7}
+		require.NoError(t, validateBroadcastAudience(&audience))
+		assert.Equal(t, notification.BroadcastAudience{Type: BroadcastAudienceProvince, Province: "서울특별시"}, audience)
+		query, args := broadcastAudienceQuery(audience)
+		assert.Equal(t, provinceAudienceQuery, query)
+		assert.Equal(t, []any{"서울특별시 %"}, args)
+
+		audience = notification.BroadcastAudience{Type: BroadcastAudienceDistrict, Province: "경기", District: " 수원시  장안구 "}
+		require.NoError(t, validateBroadcastAudience(&audience))
+		_, args = broadcastAudienceQuery(audience)
+		assert.Equal(t, []any{"경기도 수원시 장안구 %"}, args)
+
+		audience = notification.BroadcastAudience{Type: BroadcastAudienceActive, Days: 30, MarkerID: 3}
+		require.NoError(t, validateBroadcastAudience(&audience))
+		assert.Zero(t, audience.MarkerID)
+		query, args = broadcastAudienceQuery(audience)
+		assert.Equal(t, activeAudienceQuery, query)
+		assert.Equal(t, []any{30, 30, 30}, args)
+
+		audience = notification.BroadcastAudience{Type: BroadcastAudienceMarker, MarkerID: 42}
+		require.NoError(t, validateBroadcastAudience(&audience))
+		query, args = broadcastAudienceQuery(audience)
+		assert.Equal(t, markerAudienceQuery, query)
+		assert.Equal(t, []any{42}, args)
+
+		for _, invalid := range []notification.BroadcastAudience{
+			{},
+			{Type: "everyone"},
+			{Type: BroadcastAudienceProvince, Province: "도쿄"},
+			{Type: BroadcastAudienceDistrict, Province: "서울"},
+			{Type: BroadcastAudienceDistrict, Province: "서울", District: "%"},
+			{Type: BroadcastAudienceActive},
+			{Type: BroadcastAudienceActive, Days: maxBroadcastActiveDays + 1},
+			{Type: BroadcastAudienceMarker},
+		} {
+			assert.ErrorIs(t, validateBroadcastAudience(&invalid), ErrInvalidBroadcast, invalid)
+		}
+	})
+
+	t.Run("Requests", func(t *testing.T) {
+		now := time.Now()
+		valid := func() notification.BroadcastRequest {
+			return notification.BroadcastRequest{
+				Title:    " 철봉 공원 폐쇄 ",
+				Message:  "공사로 이번 주 동안 이용할 수 없어요",
+				Link:     "/pullup/7",
+				Audience: notification.BroadcastAudience{Type: BroadcastAudienceMarker, MarkerID: 7},
+			}
+		}
+
+		req := valid()
+		require.NoError(t, validateBroadcast(&req, now))
+		assert.Equal(t, "철봉 공원 폐쇄", req.Title)
+
+		later := now.Add(24 * time.Hour)
+		req = valid()
+		req.ScheduledAt = &later
+		assert.NoError(t, validateBroadcast(&req, now))
+
+		past := now.Add(-time.Hour)
+		tooLate := now.Add(maxBroadcastSchedule + time.Hour)
+		invalid := []func(r *notification.BroadcastRequest){
+			func(r *notification.BroadcastRequest) { r.Title = "  " },
+			func(r *notification.BroadcastRequest) { r.Title = strings.Repeat("가", maxBroadcastTitle+1) },
+			func(r *notification.BroadcastRequest) { r.Message = "" },
+			func(r *notification.BroadcastRequest) { r.Link = "https://example.com" },
+			func(r *notification.BroadcastRequest) { r.Link = "//example.com" },
+			func(r *notification.BroadcastRequest) { r.ScheduledAt = &past },
+			func(r *notification.BroadcastRequest) { r.ScheduledAt = &tooLate },
+			func(r *notification.BroadcastRequest) { r.Audience = notification.BroadcastAudience{} },
+		}
+		for _, mutate := range invalid {
+			req := valid()
+			mutate(&req)
+			assert.ErrorIs(t, validateBroadcast(&req, now), ErrInvalidBroadcast)
+		}
+	})
+
+	t.Run("AnnouncementsArePersonal", func(t *testing.T) {
+		// each recipient gets their own row, so it goes to their channel and follows their preferences
+		assert.True(t, isPersonalNotification(NotificationAnnouncement))
+	})
+}
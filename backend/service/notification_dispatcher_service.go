@@ -0,0 +1,265 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Alfex4936/chulbong-kr/dto/notification"
+	"github.com/jmoiron/sqlx"
+	"github.com/redis/rueidis"
+	"go.uber.org/zap"
+)
+
+const (
+	notificationPreviewLen = 50
+	// favorites and reactions can be toggled, the same one only notifies once in a while
+	notificationDedupeTTL = time.Hour
+
+	getMarkerOwnerQuery = "SELECT UserID, COALESCE(Address, '') AS Address FROM Markers WHERE MarkerID = ?"
+)
+
+// NotificationDispatcher turns domain events into personal notifications for the users they concern
+type NotificationDispatcher struct {
+	DB                  *sqlx.DB
+	Redis               *RedisService
+	NotificationService *NotificationService
+	Logger              *zap.Logger
+}
+
+// personalNotification is what an event becomes, nobody is notified when UserID is 0
+type personalNotification struct {
+	UserID   int
+	Type     string
+	Title    string
+	Message  string
+	Metadata any
+}
+
+func NewNotificationDispatcher(db *sqlx.DB, redis *RedisService, notifications *NotificationService, logger *zap.Logger) *NotificationDispatcher {
+	return &NotificationDispatcher{
+		DB:                  db,
+		Redis:               redis,
+		NotificationService: notifications,
+		Logger:              logger,
+	}
+}
+
+func RegisterNotificationDispatcher(bus *EventBus, dispatcher *NotificationDispatcher) {
+	bus.Subscribe(dispatcher.Dispatch,
+		EventMarkerCommented,
+		EventMarkerReported,
+		EventMarkerFavorited,
+		EventStoryReacted,
+		EventReportApproved,
+		EventReportDenied,
+	)
+	bus.Subscribe(dispatcher.DispatchVoteResult, EventReportVoteResolved)
+}
+
+// Dispatch notifies the owner of what the event happened to, users aren't notified of their own actions
+func (d *NotificationDispatcher) Dispatch(event DomainEvent) {
+	n, err := d.resolve(event)
+	if err != nil {
+		d.Logger.Error("Failed to resolve notification", zap.String("event", event.Name), zap.Error(err))
+		return
+	}
+	if n.UserID == 0 || n.UserID == event.ActorID {
+		return
+	}
+
+	if event.Name == EventMarkerFavorited || event.Name == EventStoryReacted {
+		if first, err := d.firstInWindow(event); err == nil && !first {
+			return
+		}
+	}
+
+	if err := d.NotificationService.NotifyUser(n.UserID, n.Type, n.Title, n.Message, n.Metadata); err != nil {
+		d.Logger.Error("Failed to post notification", zap.String("event", event.Name), zap.Int("userID", n.UserID), zap.Error(err))
+	}
+}
+
+// DispatchVoteResult tells everyone who voted on a report how the vote settled it
+func (d *NotificationDispatcher) DispatchVoteResult(event DomainEvent) {
+	var voters []int
+	if err := d.DB.Select(&voters, getReportVotersQuery, event.ReportID); err != nil {
+		d.Logger.Error("Failed to fetch report voters", zap.Int("reportID", event.ReportID), zap.Error(err))
+		return
+	}
+
+	var marker struct {
+		UserID  *int   `db:"UserID"`
+		Address string `db:"Address"`
+	}
+	if err := d.DB.Get(&marker, getMarkerOwnerQuery, event.MarkerID); ignoreNoRows(err) != nil {
+		d.Logger.Error("Failed to fetch marker of report", zap.Int("markerID", event.MarkerID), zap.Error(err))
+		return
+	}
+
+	for _, voterID := range voters {
+		n := buildPersonalNotification(event, voterID, marker.Address)
+		if err := d.NotificationService.NotifyUser(n.UserID, n.Type, n.Title, n.Message, n.Metadata); err != nil {
+			d.Logger.Error("Failed to post notification", zap.String("event", event.Name), zap.Int("userID", voterID), zap.Error(err))
+		}
+	}
+}
+
+// resolve looks up who the event concerns and fills in the names the message needs
+func (d *NotificationDispatcher) resolve(event DomainEvent) (personalNotification, error) {
+	if event.ActorName == "" && event.ActorID != 0 {
+		if err := d.DB.Get(&event.ActorName, getUsernameByIdQuery, event.ActorID); err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return personalNotification{}, err
+		}
+	}
+
+	var recipientID int
+	switch event.Name {
+	case EventStoryReacted:
+		var story struct {
+			MarkerID int `db:"MarkerID"`
+			UserID   int `db:"UserID"`
+		}
+		if err := d.DB.Get(&story, selectUserIdFromStoriesQuery, event.StoryID); err != nil {
+			return personalNotification{}, ignoreNoRows(err)
+		}
+		event.MarkerID, recipientID = story.MarkerID, story.UserID
+
+	case EventReportApproved, EventReportDenied:
+		var report struct {
+			MarkerID int  `db:"MarkerID"`
+			UserID   *int `db:"UserID"`
+		}
+		if err := d.DB.Get(&report, getReportByMarkerUserIdsQuery, event.ReportID); err != nil {
+			return personalNotification{}, ignoreNoRows(err)
+		}
+		if report.UserID == nil {
+			return personalNotification{}, nil // anonymous report
+		}
+		event.MarkerID, recipientID = report.MarkerID, *report.UserID
+	}
+
+	var marker struct {
+		UserID  *int   `db:"UserID"`
+		Address string `db:"Address"`
+	}
+	if err := d.DB.Get(&marker, getMarkerOwnerQuery, event.MarkerID); err != nil {
+		return personalNotification{}, ignoreNoRows(err)
+	}
+	if recipientID == 0 && marker.UserID != nil {
+		recipientID = *marker.UserID
+	}
+
+	return buildPersonalNotification(event, recipientID, marker.Address), nil
+}
+
+// firstInWindow is false when the same actor did the same thing to the same target recently
+func (d *NotificationDispatcher) firstInWindow(event DomainEvent) (bool, error) {
+	key := fmt.Sprintf("notification:dedupe:%s:%d:%d:%d", event.Name, event.ActorID, event.MarkerID, event.StoryID)
+	client := d.Redis.Core.Client
+	err := client.Do(context.Background(), client.B().Set().Key(key).Value("1").Nx().Ex(notificationDedupeTTL).Build()).Error()
+	if err == nil {
+		return true, nil
+	}
+	if rueidis.IsRedisNil(err) {
+		return false, nil
+	}
+	return true, err
+}
+
+// buildPersonalNotification writes the notification of an event, address is the marker's
+func buildPersonalNotification(event DomainEvent, recipientID int, address string) personalNotification {
+	actor := event.ActorName
+	if actor == "" {
+		actor = "익명"
+	}
+	place := address
+	if place == "" {
+		place = "회원님의 철봉"
+	}
+	link := fmt.Sprintf("/pullup/%d", event.MarkerID)
+
+	n := personalNotification{UserID: recipientID}
+	switch event.Name {
+	case EventMarkerCommented:
+		n.Type, n.Title = NotificationComment, "새 댓글"
+		n.Message = fmt.Sprintf("%s님이 %s에 댓글을 남겼어요: %s", actor, place, previewText(event.Text, notificationPreviewLen))
+		n.Metadata = notification.NotificationCommentMetadata{
+			MarkerID: event.MarkerID, CommentID: event.CommentID, CommenterID: event.ActorID, Link: link,
+		}
+	case EventMarkerFavorited:
+		n.Type, n.Title = NotificationLike, "새 즐겨찾기"
+		n.Message = fmt.Sprintf("%s님이 %s을(를) 즐겨찾기에 추가했어요", actor, place)
+		n.Metadata = notification.NotificationLikeMetadata{
+			MarkerID: event.MarkerID, UserId: recipientID, LikerId: event.ActorID, Link: link,
+		}
+	case EventMarkerReported:
+		n.Type, n.Title = NotificationReport, "정보 수정 제안"
+		n.Message = fmt.Sprintf("%s님이 %s의 정보 수정을 제안했어요", actor, place)
+		n.Metadata = notification.NotificationReportMetadata{
+			MarkerID: event.MarkerID, ReportID: event.ReportID, Status: "PENDING", Link: link,
+		}
+	case EventReportApproved:
+		n.Type, n.Title = NotificationReportResult, "제안 승인"
+		n.Message = fmt.Sprintf("%s에 대한 정보 수정 제안이 승인되었어요. 감사합니다!", place) + reportReason(event.Text)
+		n.Metadata = notification.NotificationReportMetadata{
+			MarkerID: event.MarkerID, ReportID: event.ReportID, Status: "APPROVED", Reason: event.Text, Link: link,
+		}
+	case EventReportDenied:
+		n.Type, n.Title = NotificationReportResult, "제안 반려"
+		n.Message = fmt.Sprintf("%s에 대한 정보 수정 제안이 반려되었어요", place) + reportReason(event.Text)
+		n.Metadata = notification.NotificationReportMetadata{
+			MarkerID: event.MarkerID, ReportID: event.ReportID, Status: "DENIED", Reason: event.Text, Link: link,
+		}
+	case EventReportVoteResolved:
+		result := "승인"
+		if event.Text == "DENIED" {
+			result = "반려"
+		}
+		if address == "" {
+			place = "철봉"
+		}
+		n.Type, n.Title = NotificationReportVote, "투표 결과"
+		n.Message = fmt.Sprintf("투표하신 %s의 정보 수정 제안이 %s되었어요", place, result)
+		n.Metadata = notification.NotificationReportMetadata{
+			MarkerID: event.MarkerID, ReportID: event.ReportID, Status: event.Text, Link: link,
+		}
+	case EventStoryReacted:
+		reaction := "👍"
+		if event.Text == "thumbsdown" {
+			reaction = "👎"
+		}
+		n.Type, n.Title = NotificationStoryReaction, "스토리 반응"
+		n.Message = fmt.Sprintf("%s님이 회원님의 스토리에 %s 반응을 남겼어요", actor, reaction)
+		n.Metadata = notification.NotificationStoryMetadata{
+			MarkerID: event.MarkerID, StoryID: event.StoryID, ReactorID: event.ActorID, Reaction: event.Text,
+			Link: fmt.Sprintf("%s?story=%d", link, event.StoryID),
+		}
+	default:
+		n.UserID = 0
+	}
+	return n
+}
+
+func previewText(text string, limit int) string {
+	if r := []rune(text); len(r) > limit {
+		return string(r[:limit]) + "…"
+	}
+	return text
+}
+
+func ignoreNoRows(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil // deleted in the meantime, nobody to notify
+	}
+	return err
+}
+
+// reportReason is the reviewer's reason as the reporter reads it, nothing when none was given
+func reportReason(reason string) string {
+	if reason == "" {
+		return ""
+	}
+	return " (사유: " + previewText(reason, notificationPreviewLen) + ")"
+}
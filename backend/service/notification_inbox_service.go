@@ -0,0 +1,379 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Alfex4936/chulbong-kr/dto/notification"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// Inbox boxes and bulk actions
+const (
+	NotificationBoxInbox    = "inbox" // everything but the archived
+	NotificationBoxUnread   = "unread"
+	NotificationBoxArchived = "archived"
+
+	NotificationActionRead      = "read"
+	NotificationActionArchive   = "archive"
+	NotificationActionUnarchive = "unarchive"
+	NotificationActionDelete    = "delete"
+
+	maxNotificationBulk = 100
+
+	// how far back an anonymous socket catches up on broadcasts, it has no inbox to find older ones
+	anonymousBacklogWindow = 7 * 24 * time.Hour
+)
+
+// NotificationStates(UserID, NotificationId, DeliveredAt, ReadAt, ArchivedAt, DeletedAt) keeps what each user did with
+// each notification, for personal and broadcast ones alike. UserID is a string as anonymous sockets use their request id.
+// Delivered means the websocket sent it, read means the user opened it.
+const (
+	// the notifications a user can see: their own and the broadcasts, minus the types they muted in-app and the deleted ones
+	notificationInboxFrom = `
+FROM Notifications n
+LEFT JOIN NotificationStates s ON s.NotificationId = n.NotificationId AND s.UserID = ?
+WHERE (n.UserId = ? OR n.NotificationType IN ('NewMarker', 'System', 'Other'))
+AND n.NotificationType NOT IN (SELECT NotificationType FROM NotificationPreferences WHERE UserID = ? AND InApp = FALSE)
+AND s.DeletedAt IS NULL`
+
+	getInboxQuery = `
+SELECT n.NotificationId, n.NotificationType, n.Title, n.Message, n.Metadata, n.CreatedAt,
+	s.ReadAt IS NOT NULL AS IsRead, s.ArchivedAt IS NOT NULL AS Archived` + notificationInboxFrom + ` %s
+ORDER BY n.NotificationId DESC
+LIMIT ? OFFSET ?`
+
+	countInboxQuery  = "SELECT COUNT(*)" + notificationInboxFrom + " %s"
+	getInboxIdsQuery = "SELECT n.NotificationId" + notificationInboxFrom + " %s"
+
+	getUndeliveredNotificationsQuery = `
+SELECT n.NotificationId, n.UserId, n.NotificationType, n.Title, n.Message, n.Metadata` + notificationInboxFrom + `
+AND s.DeliveredAt IS NULL AND s.ReadAt IS NULL AND s.ArchivedAt IS NULL
+ORDER BY n.NotificationId DESC`
+
+	// anonymous sockets have no states, they get the recent broadcasts minus the ones in their Redis delivered set
+	getRecentBroadcastsQuery = `
+SELECT n.NotificationId, n.UserId, n.NotificationType, n.Title, n.Message, n.Metadata
+FROM Notifications n
+WHERE n.NotificationType IN ('NewMarker', 'System', 'Other') AND n.CreatedAt > ?
+ORDER BY n.NotificationId DESC`
+
+	getVisibleNotificationIdsQuery = "SELECT n.NotificationId" + notificationInboxFrom + " AND n.NotificationId IN (?)"
+
+	markNotificationsDeliveredQuery = `
+INSERT INTO NotificationStates (UserID, NotificationId, DeliveredAt)
+SELECT ?, NotificationId, NOW() FROM Notifications WHERE NotificationId IN (?)
+ON DUPLICATE KEY UPDATE DeliveredAt = COALESCE(NotificationStates.DeliveredAt, VALUES(DeliveredAt))`
+
+	markNotificationsReadQuery = `
+INSERT INTO NotificationStates (UserID, NotificationId, ReadAt)
+SELECT ?, NotificationId, NOW() FROM Notifications WHERE NotificationId IN (?)
+ON DUPLICATE KEY UPDATE ReadAt = COALESCE(NotificationStates.ReadAt, VALUES(ReadAt))`
+
+	// archiving reads it too
+	archiveNotificationsQuery = `
+INSERT INTO NotificationStates (UserID, NotificationId, ReadAt, ArchivedAt)
+SELECT ?, NotificationId, NOW(), NOW() FROM Notifications WHERE NotificationId IN (?)
+ON DUPLICATE KEY UPDATE ReadAt = COALESCE(NotificationStates.ReadAt, VALUES(ReadAt)),
+	ArchivedAt = COALESCE(NotificationStates.ArchivedAt, VALUES(ArchivedAt))`
+
+	unarchiveNotificationsQuery = "UPDATE NotificationStates SET ArchivedAt = NULL WHERE UserID = ? AND NotificationId IN (?)"
+
+	// personal notifications are gone for good, broadcasts are only hidden from the user
+	deletePersonalNotificationsQuery = `
+DELETE FROM Notifications
+WHERE UserId = ? AND NotificationId IN (?) AND NotificationType NOT IN ('NewMarker', 'System', 'Other')`
+
+	hideNotificationsQuery = `
+INSERT INTO NotificationStates (UserID, NotificationId, DeletedAt)
+SELECT ?, NotificationId, NOW() FROM Notifications WHERE NotificationId IN (?)
+ON DUPLICATE KEY UPDATE DeletedAt = VALUES(DeletedAt)`
+
+	// personal notifications used to be marked with Notifications.Viewed, only rows without a state yet are copied
+	migrateViewedColumnQuery = `
+INSERT INTO NotificationStates (UserID, NotificationId, DeliveredAt, ReadAt)
+SELECT CAST(n.UserId AS CHAR), n.NotificationId, n.UpdatedAt, n.UpdatedAt
+FROM Notifications n
+LEFT JOIN NotificationStates s ON s.NotificationId = n.NotificationId AND s.UserID = CAST(n.UserId AS CHAR)
+WHERE n.Viewed = TRUE AND n.UserId IS NOT NULL AND s.NotificationId IS NULL`
+
+	migrateViewedNotificationQuery = `
+INSERT INTO NotificationStates (UserID, NotificationId, DeliveredAt, ReadAt)
+SELECT ?, NotificationId, NOW(), NOW() FROM Notifications WHERE NotificationId = ?
+ON DUPLICATE KEY UPDATE DeliveredAt = COALESCE(NotificationStates.DeliveredAt, VALUES(DeliveredAt)),
+	ReadAt = COALESCE(NotificationStates.ReadAt, VALUES(ReadAt))`
+)
+
+// GetInbox lists a page of the box, newest first, with the unread count for the badge
+func (s *NotificationService) GetInbox(userID, box string, page, pageSize int) (notification.NotificationInbox, error) {
+	inbox := notification.NotificationInbox{CurrentPage: page, Notifications: []notification.InboxNotification{}}
+
+	filter, err := inboxFilter(box)
+	if err != nil {
+		return inbox, err
+	}
+
+	var total int
+	if err := s.DB.Get(&total, fmt.Sprintf(countInboxQuery, filter), userID, userID, userID); err != nil {
+		return inbox, fmt.Errorf("error counting notifications: %w", err)
+	}
+	inbox.TotalPages = (total + pageSize - 1) / pageSize
+
+	offset := (page - 1) * pageSize
+	if err := s.DB.Select(&inbox.Notifications, fmt.Sprintf(getInboxQuery, filter), userID, userID, userID, pageSize, offset); err != nil {
+		return inbox, fmt.Errorf("error fetching notifications: %w", err)
+	}
+
+	if inbox.UnreadCount, err = s.UnreadCount(userID); err != nil {
+		return inbox, err
+	}
+	return inbox, nil
+}
+
+// UnreadCount counts the notifications the user hasn't read or archived
+func (s *NotificationService) UnreadCount(userID string) (int, error) {
+	var count int
+	filter, _ := inboxFilter(NotificationBoxUnread)
+	if err := s.DB.Get(&count, fmt.Sprintf(countInboxQuery, filter), userID, userID, userID); err != nil {
+		return 0, fmt.Errorf("error counting unread notifications: %w", err)
+	}
+	return count, nil
+}
+
+// UpdateNotifications applies the action to the notifications the user can see and returns how many they were,
+// ErrNotificationNotFound when none
+func (s *NotificationService) UpdateNotifications(userID, action string, ids []int64) (int, error) {
+	var query string
+	switch action {
+	case NotificationActionRead:
+		query = markNotificationsReadQuery
+	case NotificationActionArchive:
+		query = archiveNotificationsQuery
+	case NotificationActionUnarchive:
+		query = unarchiveNotificationsQuery
+	case NotificationActionDelete:
+	default:
+		return 0, fmt.Errorf("%w: %s", ErrInvalidNotificationAction, action)
+	}
+	if len(ids) == 0 || len(ids) > maxNotificationBulk {
+		return 0, fmt.Errorf("%w: between 1 and %d ids", ErrInvalidNotificationAction, maxNotificationBulk)
+	}
+
+	visible, err := s.visibleNotificationIds(userID, ids)
+	if err != nil {
+		return 0, err
+	}
+	if len(visible) == 0 {
+		return 0, ErrNotificationNotFound
+	}
+
+	if action == NotificationActionDelete {
+		return len(visible), s.deleteNotifications(userID, visible)
+	}
+	if err := s.execWithIds(s.DB, query, userID, visible); err != nil {
+		return 0, fmt.Errorf("error updating notifications: %w", err)
+	}
+	return len(visible), nil
+}
+
+// MarkAllRead reads every unread notification of the user
+func (s *NotificationService) MarkAllRead(userID string) (int, error) {
+	filter, _ := inboxFilter(NotificationBoxUnread)
+	var ids []int64
+	if err := s.DB.Select(&ids, fmt.Sprintf(getInboxIdsQuery, filter), userID, userID, userID); err != nil {
+		return 0, fmt.Errorf("error fetching unread notifications: %w", err)
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	for chunk := range slices.Chunk(ids, 500) {
+		if err := s.execWithIds(s.DB, markNotificationsReadQuery, userID, chunk); err != nil {
+			return 0, fmt.Errorf("error marking notifications read: %w", err)
+		}
+	}
+	return len(ids), nil
+}
+
+// MarkNotificationDelivered records that a websocket sent the notification, so it isn't sent again on reconnect
+func (s *NotificationService) MarkNotificationDelivered(notificationId int64, userID string) {
+	if isAnonymousNotificationID(userID) {
+		s.markAnonymousDelivered(notificationId, userID)
+		return
+	}
+	if err := s.execWithIds(s.DB, markNotificationsDeliveredQuery, userID, []int64{notificationId}); err != nil {
+		log.Printf("Error marking notification as delivered: %v", err)
+	}
+}
+
+func anonymousDeliveredKey(userID string) string {
+	return "notifications:delivered:" + userID
+}
+
+// markAnonymousDelivered keeps the broadcast in the socket's delivered set, which lives as long as the backlog window
+func (s *NotificationService) markAnonymousDelivered(notificationId int64, userID string) {
+	ctx := context.Background()
+	client := s.Redis.Core.Client
+	key := anonymousDeliveredKey(userID)
+	for _, resp := range client.DoMulti(ctx,
+		client.B().Sadd().Key(key).Member(strconv.FormatInt(notificationId, 10)).Build(),
+		client.B().Expire().Key(key).Seconds(int64(anonymousBacklogWindow.Seconds())).Build(),
+	) {
+		if err := resp.Error(); err != nil {
+			log.Printf("Error marking notification as delivered: %v", err)
+			return
+		}
+	}
+}
+
+// anonymousBacklog is the recent broadcasts the anonymous socket wasn't sent yet
+func (s *NotificationService) anonymousBacklog(userID string) ([]NotificationRedis, error) {
+	notifications := []NotificationRedis{}
+	if err := s.DB.Select(&notifications, getRecentBroadcastsQuery, time.Now().Add(-anonymousBacklogWindow)); err != nil {
+		return nil, err
+	}
+	if len(notifications) == 0 {
+		return notifications, nil
+	}
+
+	client := s.Redis.Core.Client
+	delivered, err := client.Do(context.Background(), client.B().Smembers().Key(anonymousDeliveredKey(userID)).Build()).AsStrSlice()
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(notifications, func(n NotificationRedis) bool {
+		return slices.Contains(delivered, strconv.FormatInt(n.NotificationId, 10))
+	}), nil
+}
+
+func (s *NotificationService) visibleNotificationIds(userID string, ids []int64) ([]int64, error) {
+	query, args, err := sqlx.In(getVisibleNotificationIdsQuery, userID, userID, userID, ids)
+	if err != nil {
+		return nil, err
+	}
+	var visible []int64
+	if err := s.DB.Select(&visible, s.DB.Rebind(query), args...); err != nil {
+		return nil, fmt.Errorf("error fetching notifications: %w", err)
+	}
+	return visible, nil
+}
+
+func (s *NotificationService) deleteNotifications(userID string, ids []int64) error {
+	tx, err := s.DB.Beginx()
+	if err != nil {
+		return ErrBeginTransaction
+	}
+	defer tx.Rollback()
+
+	if err := s.execWithIds(tx, deletePersonalNotificationsQuery, userID, ids); err != nil {
+		return fmt.Errorf("error deleting notifications: %w", err)
+	}
+	if err := s.execWithIds(tx, hideNotificationsQuery, userID, ids); err != nil {
+		return fmt.Errorf("error hiding notifications: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return ErrCommitTransaction
+	}
+	return nil
+}
+
+func (s *NotificationService) execWithIds(db sqlx.Execer, query, userID string, ids []int64) error {
+	query, args, err := sqlx.In(query, userID, ids)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(s.DB.Rebind(query), args...)
+	return err
+}
+
+func RegisterNotificationLifecycle(lifecycle fx.Lifecycle, service *NotificationService, logger *zap.Logger) {
+	lifecycle.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			// before the inbox and the websocket serve from NotificationStates, or seen notifications come back unread
+			result, err := service.DB.ExecContext(ctx, migrateViewedColumnQuery)
+			if err != nil {
+				return fmt.Errorf("error migrating viewed notifications: %w", err)
+			}
+			if migrated, _ := result.RowsAffected(); migrated > 0 {
+				logger.Info("Viewed notifications moved to NotificationStates", zap.Int64("count", migrated))
+			}
+
+			go func() {
+				migrated, err := service.MigrateViewedNotifications(context.Background())
+				if err != nil {
+					logger.Error("Failed to migrate viewed notifications", zap.Error(err))
+				}
+				if migrated > 0 {
+					logger.Info("Viewed notifications moved to NotificationStates", zap.Int("count", migrated))
+				}
+			}()
+			return nil
+		},
+	})
+}
+
+// MigrateViewedNotifications moves the viewed:notification:<id>:<user> sets the websocket used to write
+// into NotificationStates, so broadcasts seen before the switch aren't sent again
+func (s *NotificationService) MigrateViewedNotifications(ctx context.Context) (int, error) {
+	client := s.Redis.Core.Client
+	migrated := 0
+	var cursor uint64
+	for {
+		entry, err := client.Do(ctx, client.B().Scan().Cursor(cursor).Match("viewed:notification:*").Count(500).Build()).AsScanEntry()
+		if err != nil {
+			return migrated, err
+		}
+
+		for _, key := range entry.Elements {
+			id, userID, ok := parseViewedNotificationKey(key)
+			if !ok {
+				continue
+			}
+			if _, err := s.DB.ExecContext(ctx, migrateViewedNotificationQuery, userID, id); err != nil {
+				return migrated, err
+			}
+			client.Do(ctx, client.B().Del().Key(key).Build())
+			migrated++
+		}
+
+		cursor = entry.Cursor
+		if cursor == 0 {
+			return migrated, nil
+		}
+	}
+}
+
+// parseViewedNotificationKey reads viewed:notification:<id>:<user>, user ids may be request ids with colons
+func parseViewedNotificationKey(key string) (int64, string, bool) {
+	rest, ok := strings.CutPrefix(key, "viewed:notification:")
+	if !ok {
+		return 0, "", false
+	}
+	idPart, userID, ok := strings.Cut(rest, ":")
+	if !ok || userID == "" {
+		return 0, "", false
+	}
+	id, err := strconv.ParseInt(idPart, 10, 64)
+	if err != nil {
+		return 0, "", false
+	}
+	return id, userID, true
+}
+
+func inboxFilter(box string) (string, error) {
+	switch box {
+	case "", NotificationBoxInbox:
+		return "AND s.ArchivedAt IS NULL", nil
+	case NotificationBoxUnread:
+		return "AND s.ReadAt IS NULL AND s.ArchivedAt IS NULL", nil
+	case NotificationBoxArchived:
+		return "AND s.ArchivedAt IS NOT NULL", nil
+	}
+	return "", fmt.Errorf("%w: unknown box %s", ErrInvalidNotificationAction, box)
+}
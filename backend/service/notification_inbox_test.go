@@ -0,0 +1,49 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotificationInbox(t *testing.T) {
+	t.Run("ViewedKeys", func(t *testing.T) {
+		id, userID, ok := parseViewedNotificationKey("viewed:notification:42:7")
+		assert.True(t, ok)
+		assert.Equal(t, int64(42), id)
+		assert.Equal(t, "7", userID)
+
+		// anonymous sockets use whatever request id they were given
+		id, userID, ok = parseViewedNotificationKey("viewed:notification:3:anon:f00d")
+		assert.True(t, ok)
+		assert.Equal(t, int64(3), id)
+		assert.Equal(t, "anon:f00d", userID)
+
+		for _, key := range []string{"viewed:notification:x:7", "viewed:notification:42", "viewed:notification:42:", "viewed:other:1:2"} {
+			_, _, ok := parseViewedNotificationKey(key)
+			assert.False(t, ok, key)
+		}
+	})
+
+	t.Run("Boxes", func(t *testing.T) {
+		for _, box := range []string{"", NotificationBoxInbox, NotificationBoxUnread, NotificationBoxArchived} {
+			_, err := inboxFilter(box)
+			assert.NoError(t, err, box)
+		}
+		_, err := inboxFilter("spam")
+		assert.ErrorIs(t, err, ErrInvalidNotificationAction)
+	})
+
+	t.Run("InvalidActions", func(t *testing.T) {
+		s := &NotificationService{}
+
+		_, err := s.UpdateNotifications("1", "star", []int64{1})
+		assert.ErrorIs(t, err, ErrInvalidNotificationAction)
+
+		_, err = s.UpdateNotifications("1", NotificationActionRead, nil)
+		assert.ErrorIs(t, err, ErrInvalidNotificationAction)
+
+		_, err = s.UpdateNotifications("1", NotificationActionDelete, make([]int64, maxNotificationBulk+1))
+		assert.ErrorIs(t, err, ErrInvalidNotificationAction)
+	})
+}
@@ -0,0 +1,346 @@
+package service
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Alfex4936/chulbong-kr/dto/notification"
+	sonic "github.com/bytedance/sonic"
+)
+
+// Personal notification types, users pick the channels of each of them
+const (
+	NotificationComment       = "Comment"
+	NotificationLike          = "Like" // favorites on the user's marker
+	NotificationReport        = "Report"
+	NotificationReportResult  = "ReportResult"
+	NotificationReportVote    = "ReportVote" // how a report the user voted on was settled
+	NotificationStoryReaction = "StoryReaction"
+	NotificationDirectMessage = "DirectMessage"
+	NotificationMeetup        = "Meetup"
+	NotificationAnnouncement  = "Announcement" // targeted broadcasts from the admins
+)
+
+var PersonalNotificationTypes = []string{
+	NotificationComment,
+	NotificationLike,
+	NotificationReport,
+	NotificationReportResult,
+	NotificationReportVote,
+	NotificationStoryReaction,
+	NotificationDirectMessage,
+	NotificationMeetup,
+	NotificationAnnouncement,
+}
+
+// How the email channel is delivered, digests batch the unread notifications into one email
+const (
+	EmailModeOff     = "off"
+	EmailModeInstant = "instant"
+	EmailModeDaily   = "daily"
+	EmailModeWeekly  = "weekly"
+)
+
+var emailModes = []string{EmailModeOff, EmailModeInstant, EmailModeDaily, EmailModeWeekly}
+
+const (
+	maxDigestNotifications = 50
+	notificationSiteURL    = "https://k-pullup.com"
+)
+
+const (
+	getNotificationPreferencesQuery = "SELECT NotificationType, InApp, Email FROM NotificationPreferences WHERE UserID = ?"
+	getNotificationPreferenceQuery  = "SELECT NotificationType, InApp, Email FROM NotificationPreferences WHERE UserID = ? AND NotificationType = ?"
+	upsertNotificationPreference    = `
+INSERT INTO NotificationPreferences (UserID, NotificationType, InApp, Email, UpdatedAt)
+VALUES (?, ?, ?, ?, NOW())
+ON DUPLICATE KEY UPDATE InApp = VALUES(InApp), Email = VALUES(Email), UpdatedAt = NOW()`
+
+	getNotificationSettingsQuery = `
+SELECT COALESCE(QuietHoursStart, '') AS QuietHoursStart, COALESCE(QuietHoursEnd, '') AS QuietHoursEnd, EmailMode
+FROM NotificationSettings WHERE UserID = ?`
+	upsertNotificationSettings = `
+INSERT INTO NotificationSettings (UserID, QuietHoursStart, QuietHoursEnd, EmailMode, UpdatedAt)
+VALUES (?, ?, ?, ?, NOW())
+ON DUPLICATE KEY UPDATE QuietHoursStart = VALUES(QuietHoursStart), QuietHoursEnd = VALUES(QuietHoursEnd),
+	EmailMode = VALUES(EmailMode), UpdatedAt = NOW()`
+
+	getEmailByUserIdQuery = "SELECT Email FROM Users WHERE UserID = ?"
+
+	getDigestRecipientsQuery = `
+SELECT s.UserID, u.Username, u.Email, s.LastDigestAt
+FROM NotificationSettings s
+JOIN Users u ON u.UserID = s.UserID
+WHERE s.EmailMode = ?`
+
+	// only one instance wins the update, so a digest goes out once
+	claimDigestQuery = "UPDATE NotificationSettings SET LastDigestAt = ? WHERE UserID = ? AND (LastDigestAt IS NULL OR LastDigestAt < ?)"
+	// gives the claim back, unless a later run has claimed the digest since
+	releaseDigestQuery = "UPDATE NotificationSettings SET LastDigestAt = ? WHERE UserID = ? AND LastDigestAt = ?"
+
+	getDigestNotificationsQuery = `
+SELECT n.* FROM Notifications n
+LEFT JOIN NotificationStates s ON s.NotificationId = n.NotificationId AND s.UserID = n.UserId
+WHERE n.UserId = ? AND n.CreatedAt > ?
+AND s.ReadAt IS NULL AND s.ArchivedAt IS NULL AND s.DeletedAt IS NULL
+AND n.NotificationType NOT IN (SELECT NotificationType FROM NotificationPreferences WHERE UserID = ? AND Email = FALSE)
+ORDER BY n.CreatedAt DESC
+LIMIT ?`
+)
+
+// NotifyUser delivers a personal notification on the channels the user picked for its type.
+// During quiet hours nothing is pushed or emailed, the notification waits in the inbox and the digest.
+func (s *NotificationService) NotifyUser(userID int, notificationType, title, message string, metadata any) error {
+	_, err := s.notify(userID, notificationType, title, message, metadata)
+	return err
+}
+
+// notify is NotifyUser returning the id of the stored notification, 0 when the user turned the type off
+func (s *NotificationService) notify(userID int, notificationType, title, message string, metadata any) (int64, error) {
+	settings, preference, err := s.notificationDelivery(userID, notificationType)
+	if err != nil {
+		// rather one unwanted notification than a lost one
+		log.Printf("Error checking notification preference: %v", err)
+	}
+	emailed := preference.Email && settings.EmailMode != EmailModeOff
+	if !preference.InApp && !emailed {
+		return 0, nil
+	}
+
+	rawMetadata, err := sonic.Marshal(metadata)
+	if err != nil {
+		return 0, err
+	}
+	userIDstr := strconv.Itoa(userID)
+	notificationId, err := s.storeNotification(userIDstr, notificationType, title, message, rawMetadata)
+	if err != nil {
+		return 0, err
+	}
+
+	if inQuietHours(settings.QuietHoursStart, settings.QuietHoursEnd, time.Now()) {
+		return notificationId, nil
+	}
+	if emailed && settings.EmailMode == EmailModeInstant {
+		go s.emailNotification(userID, title, message, rawMetadata)
+	}
+	if !preference.InApp {
+		return notificationId, nil
+	}
+	return notificationId, s.publishNotification(notificationId, userIDstr, notificationType, title, message, rawMetadata)
+}
+
+// notificationDelivery returns the user's settings and the preference for the type, defaults when never set
+func (s *NotificationService) notificationDelivery(userID int, notificationType string) (notification.NotificationSettings, notification.NotificationPreference, error) {
+	settings := notification.NotificationSettings{EmailMode: EmailModeOff}
+	preference := notification.NotificationPreference{Type: notificationType, InApp: true, Email: true}
+
+	if err := s.DB.Get(&settings, getNotificationSettingsQuery, userID); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return settings, preference, err
+	}
+	if err := s.DB.Get(&preference, getNotificationPreferenceQuery, userID, notificationType); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return settings, preference, err
+	}
+	return settings, preference, nil
+}
+
+func (s *NotificationService) emailNotification(userID int, title, message string, metadata json.RawMessage) {
+	var email string
+	if err := s.DB.Get(&email, getEmailByUserIdQuery, userID); err != nil || email == "" {
+		return
+	}
+	if err := s.SmtpService.SendNotificationEmail(email, title, message, notificationLink(metadata)); err != nil {
+		log.Printf("Error sending notification email: %v", err)
+	}
+}
+
+// GetNotificationSettings lists every personal notification type, the ones never set are on in both channels
+func (s *NotificationService) GetNotificationSettings(userID int) (notification.NotificationSettings, error) {
+	settings := notification.NotificationSettings{EmailMode: EmailModeOff}
+	if err := s.DB.Get(&settings, getNotificationSettingsQuery, userID); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return settings, fmt.Errorf("error fetching notification settings: %w", err)
+	}
+
+	var saved []notification.NotificationPreference
+	if err := s.DB.Select(&saved, getNotificationPreferencesQuery, userID); err != nil {
+		return settings, fmt.Errorf("error fetching notification preferences: %w", err)
+	}
+
+	settings.Preferences = make([]notification.NotificationPreference, len(PersonalNotificationTypes))
+	for i, ntype := range PersonalNotificationTypes {
+		settings.Preferences[i] = notification.NotificationPreference{Type: ntype, InApp: true, Email: true}
+		for _, p := range saved {
+			if p.Type == ntype {
+				settings.Preferences[i] = p
+			}
+		}
+	}
+	return settings, nil
+}
+
+// SetNotificationSettings saves the settings and the given types, the other types are left as they are
+func (s *NotificationService) SetNotificationSettings(userID int, settings notification.NotificationSettings) error {
+	if err := validateNotificationSettings(&settings); err != nil {
+		return err
+	}
+
+	tx, err := s.DB.Beginx()
+	if err != nil {
+		return ErrBeginTransaction
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(upsertNotificationSettings, userID, settings.QuietHoursStart, settings.QuietHoursEnd, settings.EmailMode); err != nil {
+		return fmt.Errorf("error saving notification settings: %w", err)
+	}
+	for _, p := range settings.Preferences {
+		if _, err := tx.Exec(upsertNotificationPreference, userID, p.Type, p.InApp, p.Email); err != nil {
+			return fmt.Errorf("error saving notification preference: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return ErrCommitTransaction
+	}
+	return nil
+}
+
+// SendDigests emails every user in the mode their unread notifications since the last digest
+func (s *NotificationService) SendDigests(mode string, now time.Time) (int, error) {
+	period := 24 * time.Hour
+	if mode == EmailModeWeekly {
+		period = 7 * 24 * time.Hour
+	}
+
+	var recipients []struct {
+		UserID       int        `db:"UserID"`
+		Username     string     `db:"Username"`
+		Email        string     `db:"Email"`
+		LastDigestAt *time.Time `db:"LastDigestAt"`
+	}
+	if err := s.DB.Select(&recipients, getDigestRecipientsQuery, mode); err != nil {
+		return 0, fmt.Errorf("error fetching digest recipients: %w", err)
+	}
+
+	sent := 0
+	for _, r := range recipients {
+		if r.Email == "" {
+			continue
+		}
+		since := now.Add(-period)
+		if r.LastDigestAt != nil {
+			since = *r.LastDigestAt
+		}
+
+		// whole seconds as DATETIME keeps them, so the release below matches the claim
+		claimedAt := now.Truncate(time.Second)
+		claimed, err := claimOnce(s.DB, claimDigestQuery, claimedAt, r.UserID, now.Add(-period/2))
+		if err != nil {
+			return sent, fmt.Errorf("error claiming digest: %w", err)
+		}
+		if !claimed {
+			continue // another instance has it
+		}
+
+		// the notifications since the last digest go out with the next one if this one fails
+		release := func() {
+			if _, err := s.DB.Exec(releaseDigestQuery, r.LastDigestAt, r.UserID, claimedAt); err != nil {
+				log.Printf("Error releasing notification digest of user %d: %v", r.UserID, err)
+			}
+		}
+
+		var notifications []Notification
+		if err := s.DB.Select(&notifications, getDigestNotificationsQuery, r.UserID, since, r.UserID, maxDigestNotifications); err != nil {
+			release()
+			return sent, fmt.Errorf("error fetching digest notifications: %w", err)
+		}
+		if len(notifications) == 0 {
+			continue
+		}
+
+		if err := s.SmtpService.SendNotificationDigestEmail(r.Email, r.Username, mode, notifications); err != nil {
+			log.Printf("Error sending notification digest to user %d: %v", r.UserID, err)
+			release()
+			continue
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// validateNotificationSettings fills in the defaults and rejects what can't be saved
+func validateNotificationSettings(settings *notification.NotificationSettings) error {
+	if settings.EmailMode == "" {
+		settings.EmailMode = EmailModeOff
+	}
+	if !slices.Contains(emailModes, settings.EmailMode) {
+		return fmt.Errorf("%w: unknown email mode %s", ErrInvalidNotificationSettings, settings.EmailMode)
+	}
+
+	settings.QuietHoursStart = strings.TrimSpace(settings.QuietHoursStart)
+	settings.QuietHoursEnd = strings.TrimSpace(settings.QuietHoursEnd)
+	if settings.QuietHoursStart != "" || settings.QuietHoursEnd != "" {
+		start, err := parseClock(settings.QuietHoursStart)
+		if err != nil {
+			return fmt.Errorf("%w: quiet hours start %q", ErrInvalidNotificationSettings, settings.QuietHoursStart)
+		}
+		end, err := parseClock(settings.QuietHoursEnd)
+		if err != nil {
+			return fmt.Errorf("%w: quiet hours end %q", ErrInvalidNotificationSettings, settings.QuietHoursEnd)
+		}
+		if start == end {
+			return fmt.Errorf("%w: quiet hours start and end are the same", ErrInvalidNotificationSettings)
+		}
+	}
+
+	for _, p := range settings.Preferences {
+		if !slices.Contains(PersonalNotificationTypes, p.Type) {
+			return fmt.Errorf("%w: %s", ErrInvalidNotificationType, p.Type)
+		}
+	}
+	return nil
+}
+
+// inQuietHours tells whether now falls between start and end in KST, the range may wrap midnight
+func inQuietHours(start, end string, now time.Time) bool {
+	from, err := parseClock(start)
+	if err != nil {
+		return false
+	}
+	to, err := parseClock(end)
+	if err != nil {
+		return false
+	}
+
+	local := now.In(kst)
+	minute := local.Hour()*60 + local.Minute()
+	if from < to {
+		return minute >= from && minute < to
+	}
+	return minute >= from || minute < to
+}
+
+// parseClock turns "HH:MM" into minutes after midnight
+func parseClock(clock string) (int, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// notificationLink is the absolute page a notification opens, the home page when it has no link
+func notificationLink(metadata json.RawMessage) string {
+	var meta struct {
+		Link string `json:"link"`
+	}
+	if len(metadata) > 0 && sonic.Unmarshal(metadata, &meta) == nil && strings.HasPrefix(meta.Link, "/") {
+		return notificationSiteURL + meta.Link
+	}
+	return notificationSiteURL
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Alfex4936/chulbong-kr/dto/notification"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotificationSettings(t *testing.T) {
+	t.Run("Validate", func(t *testing.T) {
+		settings := notification.NotificationSettings{
+			QuietHoursStart: " 23:00 ",
+			QuietHoursEnd:   "07:30",
+			Preferences:     []notification.NotificationPreference{{Type: NotificationComment, InApp: true}},
+		}
+		require.NoError(t, validateNotificationSettings(&settings))
+		assert.Equal(t, EmailModeOff, settings.EmailMode)
+		assert.Equal(t, "23:00", settings.QuietHoursStart)
+
+		invalid := []notification.NotificationSettings{
+			{EmailMode: "hourly"},
+			{QuietHoursStart: "22:00"},
+			{QuietHoursStart: "25:00", QuietHoursEnd: "07:00"},
+			{QuietHoursStart: "07:00", QuietHoursEnd: "07:00"},
+		}
+		for _, settings := range invalid {
+			assert.ErrorIs(t, validateNotificationSettings(&settings), ErrInvalidNotificationSettings, settings)
+		}
+
+		unknown := notification.NotificationSettings{Preferences: []notification.NotificationPreference{{Type: "NewMarker"}}}
+		assert.ErrorIs(t, validateNotificationSettings(&unknown), ErrInvalidNotificationType)
+	})
+
+	t.Run("QuietHours", func(t *testing.T) {
+		at := func(clock string) time.Time {
+			t, _ := time.ParseInLocation("2006-01-02 15:04", "2024-06-01 "+clock, kst)
+			return t.UTC()
+		}
+
+		assert.False(t, inQuietHours("", "", at("03:00")))
+
+		// wraps midnight
+		assert.True(t, inQuietHours("23:00", "07:00", at("23:00")))
+		assert.True(t, inQuietHours("23:00", "07:00", at("03:00")))
+		assert.False(t, inQuietHours("23:00", "07:00", at("07:00")))
+		assert.False(t, inQuietHours("23:00", "07:00", at("12:00")))
+
+		assert.True(t, inQuietHours("13:00", "14:00", at("13:30")))
+		assert.False(t, inQuietHours("13:00", "14:00", at("14:30")))
+	})
+
+	t.Run("Link", func(t *testing.T) {
+		assert.Equal(t, "https://k-pullup.com/pullup/7", notificationLink([]byte(`{"markerID":7,"link":"/pullup/7"}`)))
+		assert.Equal(t, "https://k-pullup.com", notificationLink([]byte(`{"conversationId":1}`)))
+		assert.Equal(t, "https://k-pullup.com", notificationLink([]byte(`{"link":"https://evil.example"}`)))
+		assert.Equal(t, "https://k-pullup.com", notificationLink(nil))
+	})
+
+	t.Run("DigestRows", func(t *testing.T) {
+		rows := notificationDigestRows([]Notification{
+			{Title: "새 댓글", Message: "<script>alert(1)</script>", Metadata: []byte(`{"link":"/pullup/3"}`), CreatedAt: time.Date(2024, 6, 1, 0, 30, 0, 0, time.UTC)},
+			{Title: "DM", Message: "안녕하세요", CreatedAt: time.Date(2024, 6, 1, 1, 0, 0, 0, time.UTC)},
+		})
+
+		assert.Equal(t, 2, strings.Count(rows, "<tr>"))
+		assert.Contains(t, rows, "06/01 09:30")
+		assert.Contains(t, rows, "&lt;script&gt;")
+		assert.NotContains(t, rows, "<script>")
+		assert.Contains(t, rows, `href="https://k-pullup.com/pullup/3"`)
+	})
+}
@@ -3,10 +3,11 @@ package service
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"log"
-	"sync"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/Alfex4936/chulbong-kr/dto/notification"
 	"github.com/Alfex4936/chulbong-kr/model"
@@ -17,14 +18,18 @@ import (
 )
 
 type NotificationService struct {
-	DB    *sqlx.DB
-	Redis *RedisService
+	DB             *sqlx.DB
+	Redis          *RedisService
+	SmtpService    *SmtpService
+	WebPushService *WebPushService
 }
 
-func NewNotificationService(db *sqlx.DB, redis *RedisService) *NotificationService {
+func NewNotificationService(db *sqlx.DB, redis *RedisService, smtp *SmtpService, webPush *WebPushService) *NotificationService {
 	return &NotificationService{
-		DB:    db,
-		Redis: redis,
+		DB:             db,
+		Redis:          redis,
+		SmtpService:    smtp,
+		WebPushService: webPush,
 	}
 }
 
@@ -33,22 +38,46 @@ type (
 	NotificationRedis = notification.NotificationRedis
 )
 
+// anonymousNotificationPrefix keeps anonymous sockets apart from accounts, they only get broadcasts
+const anonymousNotificationPrefix = "anon:"
+
+// AnonymousNotificationID is the id of a socket opened without logging in, it never matches an account id
+func AnonymousNotificationID(requestID string) string {
+	return anonymousNotificationPrefix + requestID
+}
+
+func isAnonymousNotificationID(userID string) bool {
+	return strings.HasPrefix(userID, anonymousNotificationPrefix)
+}
+
 // PostNotification posts a new notification into the database
 func (s *NotificationService) PostNotification(userID, notificationType, title, message string, metadata json.RawMessage) error {
+	notificationId, err := s.storeNotification(userID, notificationType, title, message, metadata)
+	if err != nil {
+		return err
+	}
+	return s.publishNotification(notificationId, userID, notificationType, title, message, metadata)
+}
+
+// storeNotification saves the notification unviewed, it's sent when the user connects next
+func (s *NotificationService) storeNotification(userID, notificationType, title, message string, metadata json.RawMessage) (int64, error) {
 	result, err := s.DB.Exec(
 		`INSERT INTO Notifications (UserId, NotificationType, Title, Message, Metadata, Viewed, CreatedAt, UpdatedAt) 
          VALUES (?, ?, ?, ?, ?, FALSE, NOW(), NOW())`,
 		userID, notificationType, title, message, metadata,
 	)
 	if err != nil {
-		return err
+		return 0, err
 	}
+	return result.LastInsertId()
+}
 
-	notificationId, _ := result.LastInsertId()
-
+// publishNotification sends a stored notification to the user's open websockets,
+// personal ones go out as Web Push when none is open
+func (s *NotificationService) publishNotification(notificationId int64, userID, notificationType, title, message string, metadata json.RawMessage) error {
 	var channelName string
 	// Determine the appropriate channel based on notification type
-	if notificationType == "Like" || notificationType == "Comment" {
+	if isPersonalNotification(notificationType) {
 		channelName = "notifications:user:" + userID
 	} else {
 		channelName = "notifications:broadcast"
@@ -68,118 +97,67 @@ func (s *NotificationService) PostNotification(userID, notificationType, title,
 		return err
 	}
 
-	err = s.Redis.Core.Client.Do(context.Background(), s.Redis.Core.Client.B().Publish().Channel(channelName).Message(rueidis.BinaryString(jsonData)).Build()).Error()
+	// every /ws/notification connection subscribes on its own, so receivers counts the live sockets
+	receivers, err := s.Redis.Core.Client.Do(context.Background(), s.Redis.Core.Client.B().Publish().Channel(channelName).Message(rueidis.BinaryString(jsonData)).Build()).AsInt64()
 	if err != nil {
 		return err
 	}
 
+	if receivers == 0 && isPersonalNotification(notificationType) && s.WebPushService.Enabled() {
+		go s.pushNotification(notificationData)
+	}
 	return nil
 }
 
-// GetNotifications retrieves notifications for a specific user (unviewed)
-func (s *NotificationService) GetNotifications(userID string) ([]NotificationRedis, error) {
-	var notifications []Notification
-	const query = `(SELECT * FROM Notifications 
-		WHERE UserId = ? AND Viewed = FALSE 
-		ORDER BY CreatedAt DESC)
-		UNION ALL
-		(SELECT * FROM Notifications 
-		WHERE NotificationType IN ('NewMarker', 'System', 'Other') AND Viewed = FALSE 
-		ORDER BY CreatedAt DESC)`
-	err := s.DB.Select(&notifications, query, userID)
+func (s *NotificationService) pushNotification(n NotificationRedis) {
+	userID, err := strconv.Atoi(n.UserId)
 	if err != nil {
-		return nil, err
-	}
-
-	var wg sync.WaitGroup
-	results := make([]NotificationRedis, len(notifications))
-	errs := make(chan error, len(notifications))
-
-	for i, n := range notifications {
-		wg.Add(1)
-		go func(idx int, notif Notification) {
-			defer wg.Done()
-			if notif.NotificationType == "Like" || notif.NotificationType == "Comment" {
-				if !notif.Viewed {
-					results[idx] = mapToNotificationRedis(notif)
-				}
-			} else {
-				viewed, err := s.IsNotificationViewed(notif.NotificationId, userID)
-				if err != nil {
-					errs <- err
-					return
-				}
-				if !viewed {
-					results[idx] = mapToNotificationRedis(notif)
-				}
-			}
-		}(i, n)
+		return
 	}
-	wg.Wait()
-	close(errs)
-
-	if len(errs) > 0 {
-		return nil, errors.New("failed checking notification viewed status")
+	delivered, err := s.WebPushService.Push(userID, notification.NotificationPush{
+		NotificationId: n.NotificationId,
+		Type:           n.NotificationType,
+		Title:          n.Title,
+		Body:           n.Message,
+		URL:            notificationLink(json.RawMessage(n.Metadata)),
+	})
+	if err != nil {
+		log.Printf("Error sending web push: %v", err)
+		return
 	}
-
-	filteredNotifications := []NotificationRedis{}
-	for _, res := range results {
-		if res.NotificationId != 0 {
-			filteredNotifications = append(filteredNotifications, res)
-		}
+	if delivered > 0 {
+		s.MarkNotificationDelivered(n.NotificationId, n.UserId)
 	}
-	return filteredNotifications, nil
 }
 
-// markNotificationAsViewed(notification, userID)
-func (s *NotificationService) MarkNotificationAsViewed(nid int64, ntype, userID string) {
-	if ntype == "Like" || ntype == "Comment" {
-		if err := s.MarkPersonalNotificationViewed(nid, userID); err != nil {
-			log.Printf("Error marking personal notification as viewed: %v", err)
-		}
-	} else {
-		s.MarkBroadcastNotificationViewed(nid, userID)
+// GetNotifications retrieves the notifications no websocket of the user has been sent yet
+func (s *NotificationService) GetNotifications(userID string) ([]NotificationRedis, error) {
+	if isAnonymousNotificationID(userID) {
+		return s.anonymousBacklog(userID)
 	}
-}
-
-func (s *NotificationService) MarkPersonalNotificationViewed(notificationId int64, userID string) error {
-	_, err := s.DB.Exec(`UPDATE Notifications SET Viewed = TRUE WHERE NotificationId = ? AND UserId = ?`, notificationId, userID)
-	return err
-}
-
-// REDIS
-func (s *NotificationService) MarkBroadcastNotificationViewed(notificationId int64, userID string) {
-	key := fmt.Sprintf("viewed:notification:%d:%s", notificationId, userID)
-	ctx := context.Background()
-	s.Redis.Core.Client.Do(ctx, s.Redis.Core.Client.B().Sadd().Key(key).Member("viewed").Build())
-
-	expireCmd := s.Redis.Core.Client.B().Expire().Key(key).Seconds(864000).Build() // 10 days
-	s.Redis.Core.Client.Do(ctx, expireCmd)
-
-}
-
-func (s *NotificationService) IsNotificationViewed(notificationId int64, userID string) (bool, error) {
-	key := fmt.Sprintf("viewed:notification:%d:%s", notificationId, userID)
-	exists, err := s.Redis.Core.Client.Do(context.Background(), s.Redis.Core.Client.B().Sismember().Key(key).Member("viewed").Build()).AsBool()
+	notifications := []NotificationRedis{}
+	err := s.DB.Select(&notifications, getUndeliveredNotificationsQuery, userID, userID, userID)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
-	return exists, nil
+	return notifications, nil
 }
 
 // SubscribeNotification subscribes to user-specific notification channels and handles messages as they arrive.
 func (s *NotificationService) SubscribeNotification(userID string, handleMessage func(msg rueidis.PubSubMessage)) (cancelFunc func(), err error) {
 	dedicatedClient, cancel := s.Redis.Core.Client.Dedicate()
 
-	userChannel := "notifications:user:" + userID
-	broadcastChannel := "notifications:broadcast"
+	channels := []string{"notifications:broadcast"}
+	if !isAnonymousNotificationID(userID) {
+		channels = append(channels, "notifications:user:"+userID)
+	}
 
 	wait := dedicatedClient.SetPubSubHooks(rueidis.PubSubHooks{
 		OnMessage: handleMessage, // pass the handling function directly
 	})
 
-	// Subscribe to the user-specific notifications channel
-	if err := dedicatedClient.Do(context.Background(), dedicatedClient.B().Subscribe().Channel(userChannel, broadcastChannel).Build()).Error(); err != nil {
+	// Subscribe to the user-specific notifications channel, anonymous sockets only get broadcasts
+	if err := dedicatedClient.Do(context.Background(), dedicatedClient.B().Subscribe().Channel(channels...).Build()).Error(); err != nil {
 		cancel()
 		log.Printf("🎯 Subscription failed: %v", err)
 		return nil, err
@@ -207,13 +185,7 @@ func HandleNotification(data []byte) {
 	fmt.Printf("Notification: %+v\n", notification)
 }
 
-func mapToNotificationRedis(n Notification) NotificationRedis {
-	return NotificationRedis{
-		NotificationId:   n.NotificationId,
-		UserId:           n.UserId,
-		NotificationType: n.NotificationType,
-		Title:            n.Title,
-		Message:          n.Message,
-		Metadata:         n.Metadata,
-	}
+// isPersonalNotification tells notifications for one user apart from the ones everyone gets
+func isPersonalNotification(ntype string) bool {
+	return slices.Contains(PersonalNotificationTypes, ntype)
 }
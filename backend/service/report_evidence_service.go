@@ -0,0 +1,188 @@
+package service
+
+import (
+	"fmt"
+	"mime/multipart"
+	"strings"
+	"time"
+
+	"github.com/Alfex4936/chulbong-kr/config"
+	"github.com/Alfex4936/chulbong-kr/dto"
+	"github.com/Alfex4936/chulbong-kr/util"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+// Evidence of a report, verified when one of its photos was taken recently at the proposed location
+const (
+	EvidenceVerified = "verified"
+	EvidenceFlagged  = "flagged" // the photos have a location but none backs the report
+	EvidenceMissing  = "missing" // no photo has a location
+
+	EvidenceNoGPS    = "no_gps"
+	EvidenceNoTime   = "no_time"
+	EvidenceStale    = "stale"
+	EvidenceMismatch = "mismatch"
+	EvidenceFar      = "far"
+)
+
+// ReportPhotoEvidence(ReportID, PhotoURL, Latitude, Longitude, TakenAt, Distance, Flags) keeps the EXIF check of each report photo, Flags is comma separated
+const (
+	insertReportEvidenceQuery = `
+INSERT INTO ReportPhotoEvidence (ReportID, PhotoURL, Latitude, Longitude, TakenAt, Distance, Flags)
+VALUES (?, ?, ?, ?, ?, ?, ?)`
+
+	getReportEvidenceQuery = `
+SELECT ReportID, PhotoURL, Latitude, Longitude, TakenAt, Distance, Flags
+FROM ReportPhotoEvidence
+WHERE ReportID IN (?)
+ORDER BY ReportID, PhotoURL`
+)
+
+// ReportEvidenceService checks report photos against the location the report proposes
+type ReportEvidenceService struct {
+	DB     *sqlx.DB
+	Config *config.ReportEvidenceConfig
+	Logger *zap.Logger
+}
+
+func NewReportEvidenceService(db *sqlx.DB, cfg *config.ReportEvidenceConfig, logger *zap.Logger) *ReportEvidenceService {
+	return &ReportEvidenceService{
+		DB:     db,
+		Config: cfg,
+		Logger: logger,
+	}
+}
+
+// Inspect reads the EXIF of the photos, in order, and checks it against the proposed location
+func (s *ReportEvidenceService) Inspect(files []*multipart.FileHeader, latitude, longitude float64, now time.Time) dto.ReportEvidence {
+	metadata := make([]util.PhotoMetadata, len(files))
+	for i, file := range files {
+		f, err := file.Open()
+		if err != nil {
+			continue // the upload fails on it too
+		}
+		metadata[i] = util.GetPhotoMetadataByReader(f)
+		f.Close()
+	}
+	return evaluateEvidence(metadata, latitude, longitude, now, s.Config)
+}
+
+// CheckPolicy refuses a move farther than the configured distance unless a photo verifies it
+func (s *ReportEvidenceService) CheckPolicy(report *dto.MarkerReportRequest, evidence dto.ReportEvidence) error {
+	if s.Config.RequiredMove <= 0 || evidence.Status == EvidenceVerified {
+		return nil
+	}
+	moved := util.CalculateDistanceApproximately(report.Latitude, report.Longitude, report.NewLatitude, report.NewLongitude)
+	if moved > s.Config.RequiredMove {
+		return ErrReportEvidenceRequired
+	}
+	return nil
+}
+
+// SaveTx keeps the evidence of the report, the photo URLs must be filled in
+func (s *ReportEvidenceService) SaveTx(tx *sqlx.Tx, reportID int64, evidence dto.ReportEvidence) error {
+	for _, photo := range evidence.Photos {
+		if _, err := tx.Exec(insertReportEvidenceQuery, reportID, photo.PhotoURL, photo.Latitude, photo.Longitude,
+			photo.TakenAt, photo.Distance, strings.Join(photo.Flags, ",")); err != nil {
+			return fmt.Errorf("error saving report photo evidence: %w", err)
+		}
+	}
+	return nil
+}
+
+// AttachEvidence fills in the evidence of the queued reports, reports from before the check have none
+func (s *ReportEvidenceService) AttachEvidence(items []dto.ReportQueueItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+	ids := make([]int, len(items))
+	for i, item := range items {
+		ids[i] = item.ReportID
+	}
+
+	query, args, err := sqlx.In(getReportEvidenceQuery, ids)
+	if err != nil {
+		return err
+	}
+	var rows []struct {
+		ReportID  int        `db:"ReportID"`
+		PhotoURL  string     `db:"PhotoURL"`
+		Latitude  *float64   `db:"Latitude"`
+		Longitude *float64   `db:"Longitude"`
+		TakenAt   *time.Time `db:"TakenAt"`
+		Distance  *float64   `db:"Distance"`
+		Flags     string     `db:"Flags"`
+	}
+	if err := s.DB.Select(&rows, s.DB.Rebind(query), args...); err != nil {
+		return fmt.Errorf("error fetching report evidence: %w", err)
+	}
+
+	photos := make(map[int][]dto.ReportPhotoEvidence, len(items))
+	for _, row := range rows {
+		flags := []string{}
+		if row.Flags != "" {
+			flags = strings.Split(row.Flags, ",")
+		}
+		photos[row.ReportID] = append(photos[row.ReportID], dto.ReportPhotoEvidence{
+			PhotoURL:  row.PhotoURL,
+			Latitude:  row.Latitude,
+			Longitude: row.Longitude,
+			TakenAt:   row.TakenAt,
+			Distance:  row.Distance,
+			Flags:     flags,
+		})
+	}
+	for i := range items {
+		if p, ok := photos[items[i].ReportID]; ok {
+			items[i].Evidence = dto.ReportEvidence{Status: reportEvidenceStatus(p), Photos: p}
+		}
+	}
+	return nil
+}
+
+// evaluateEvidence flags each photo by how far from the proposed location and how long ago it was taken
+func evaluateEvidence(metadata []util.PhotoMetadata, latitude, longitude float64, now time.Time, cfg *config.ReportEvidenceConfig) dto.ReportEvidence {
+	photos := make([]dto.ReportPhotoEvidence, len(metadata))
+	for i, meta := range metadata {
+		photo := dto.ReportPhotoEvidence{Flags: []string{}}
+
+		if meta.HasLocation {
+			distance := util.CalculateDistanceApproximately(latitude, longitude, meta.Latitude, meta.Longitude)
+			photo.Latitude, photo.Longitude, photo.Distance = &meta.Latitude, &meta.Longitude, &distance
+			switch {
+			case distance > cfg.FarRadius:
+				photo.Flags = append(photo.Flags, EvidenceFar)
+			case distance > cfg.MatchRadius:
+				photo.Flags = append(photo.Flags, EvidenceMismatch)
+			}
+		} else {
+			photo.Flags = append(photo.Flags, EvidenceNoGPS)
+		}
+
+		if meta.HasTime {
+			photo.TakenAt = &meta.TakenAt
+			if now.Sub(meta.TakenAt) > cfg.MaxAge {
+				photo.Flags = append(photo.Flags, EvidenceStale)
+			}
+		} else {
+			photo.Flags = append(photo.Flags, EvidenceNoTime)
+		}
+
+		photos[i] = photo
+	}
+	return dto.ReportEvidence{Status: reportEvidenceStatus(photos), Photos: photos}
+}
+
+func reportEvidenceStatus(photos []dto.ReportPhotoEvidence) string {
+	status := EvidenceMissing
+	for _, photo := range photos {
+		if len(photo.Flags) == 0 {
+			return EvidenceVerified
+		}
+		if photo.Distance != nil {
+			status = EvidenceFlagged
+		}
+	}
+	return status
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Alfex4936/chulbong-kr/config"
+	"github.com/Alfex4936/chulbong-kr/dto"
+	"github.com/Alfex4936/chulbong-kr/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReportEvidence(t *testing.T) {
+	cfg := &config.ReportEvidenceConfig{
+		MatchRadius: 50,
+		FarRadius:   1000,
+		MaxAge:      30 * 24 * time.Hour,
+	}
+	now := time.Date(2024, 6, 10, 12, 0, 0, 0, time.UTC)
+	lat, lng := 37.5665, 126.9780 // 서울시청
+
+	t.Run("Flags", func(t *testing.T) {
+		evidence := evaluateEvidence([]util.PhotoMetadata{
+			{Latitude: 37.5666, Longitude: 126.9780, TakenAt: now.Add(-time.Hour), HasLocation: true, HasTime: true},
+			{Latitude: 37.5670, Longitude: 126.9780, TakenAt: now.Add(-40 * 24 * time.Hour), HasLocation: true, HasTime: true},
+			{Latitude: 35.1796, Longitude: 129.0756, HasLocation: true}, // 부산
+			{},
+		}, lat, lng, now, cfg)
+
+		require.Len(t, evidence.Photos, 4)
+		assert.Equal(t, EvidenceVerified, evidence.Status)
+		assert.Empty(t, evidence.Photos[0].Flags)
+		assert.InDelta(t, 11, *evidence.Photos[0].Distance, 1)
+		assert.Equal(t, []string{EvidenceMismatch, EvidenceStale}, evidence.Photos[1].Flags)
+		assert.Equal(t, []string{EvidenceFar, EvidenceNoTime}, evidence.Photos[2].Flags)
+		assert.Equal(t, []string{EvidenceNoGPS, EvidenceNoTime}, evidence.Photos[3].Flags)
+		assert.Nil(t, evidence.Photos[3].Distance)
+	})
+
+	t.Run("Status", func(t *testing.T) {
+		stale := evaluateEvidence([]util.PhotoMetadata{
+			{Latitude: lat, Longitude: lng, TakenAt: now.Add(-31 * 24 * time.Hour), HasLocation: true, HasTime: true},
+			{},
+		}, lat, lng, now, cfg)
+		assert.Equal(t, EvidenceFlagged, stale.Status)
+
+		stripped := evaluateEvidence([]util.PhotoMetadata{{}, {TakenAt: now, HasTime: true}}, lat, lng, now, cfg)
+		assert.Equal(t, EvidenceMissing, stripped.Status)
+
+		assert.Equal(t, EvidenceMissing, reportEvidenceStatus(nil))
+	})
+
+	t.Run("Policy", func(t *testing.T) {
+		s := &ReportEvidenceService{Config: &config.ReportEvidenceConfig{RequiredMove: 10}}
+		moved := &dto.MarkerReportRequest{Latitude: lat, Longitude: lng, NewLatitude: 37.5667, NewLongitude: lng} // about 22m
+		stayed := &dto.MarkerReportRequest{Latitude: lat, Longitude: lng, NewLatitude: lat, NewLongitude: lng}
+
+		assert.ErrorIs(t, s.CheckPolicy(moved, dto.ReportEvidence{Status: EvidenceFlagged}), ErrReportEvidenceRequired)
+		assert.ErrorIs(t, s.CheckPolicy(moved, dto.ReportEvidence{Status: EvidenceMissing}), ErrReportEvidenceRequired)
+		assert.NoError(t, s.CheckPolicy(moved, dto.ReportEvidence{Status: EvidenceVerified}))
+		assert.NoError(t, s.CheckPolicy(stayed, dto.ReportEvidence{Status: EvidenceMissing}))
+
+		s.Config.RequiredMove = 0
+		assert.NoError(t, s.CheckPolicy(moved, dto.ReportEvidence{Status: EvidenceMissing}))
+	})
+}
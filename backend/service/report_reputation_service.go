@@ -0,0 +1,423 @@
+package service
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Alfex4936/chulbong-kr/config"
+	"github.com/Alfex4936/chulbong-kr/dto"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+// Automatic decisions, every one is kept in ReportAutoDecisions so an admin can revert it
+const (
+	AutoDecisionApproved  = "auto_approved"
+	AutoDecisionThrottled = "throttled"
+
+	autoApproveReason  = "자동 승인"
+	defaultAutoDecList = 20
+	maxAutoDecListPage = 100
+)
+
+// ReportAutoDecisions(DecisionID, Decision, ReportID, MarkerID, UserID, Reputation, Snapshot, CreatedAt, RevertedBy, RevertedAt) audits what was decided without a reviewer,
+// Snapshot is the marker before an automatic approval so the approval can be undone.
+// ReportThrottleExemptions(UserID, ExemptUntil, CreatedBy) lifts the throttle for reporters an admin vouched for.
+const (
+	// Only decisions another reviewer made count. Automatic approvals and community votes leave DecidedBy empty,
+	// and owners can decide reports on their own markers, either would let reporters vouch for themselves.
+	getReporterStatsQuery = `
+SELECT COALESCE(SUM(r.Status = 'APPROVED' AND r.Reviewed), 0) AS Approved,
+	COALESCE(SUM(r.Status = 'DENIED' AND r.Reviewed), 0) AS Denied,
+	COALESCE(SUM(r.Status = 'PENDING'), 0) AS Pending,
+	COALESCE(SUM(r.Status = 'APPROVED' AND r.Reviewed AND r.CreatedAt >= ?), 0) AS RecentApproved,
+	COALESCE(SUM(r.Status = 'DENIED' AND r.Reviewed AND r.CreatedAt >= ?), 0) AS RecentDenied,
+	COALESCE(SUM(r.CreatedAt >= ?), 0) AS ReportsToday
+FROM (
+	SELECT r.Status, r.CreatedAt,
+		ad.DecisionID IS NULL AND (rv.DecidedBy IS NOT NULL OR rv.DecidedAt IS NULL)
+			AND COALESCE(rv.DecidedBy, 0) <> r.UserID AND COALESCE(m.UserID, 0) <> r.UserID AS Reviewed
+	FROM Reports r
+	LEFT JOIN Markers m ON m.MarkerID = r.MarkerID
+	LEFT JOIN ReportAutoDecisions ad ON ad.ReportID = r.ReportID AND ad.Decision = 'auto_approved' AND ad.RevertedAt IS NULL
+	LEFT JOIN ReportReviews rv ON rv.ReportID = r.ReportID
+	WHERE r.UserID = ?
+) r`
+
+	getThrottleExemptionQuery = "SELECT MAX(ExemptUntil) FROM ReportThrottleExemptions WHERE UserID = ? AND ExemptUntil > ?"
+
+	upsertThrottleExemptionQuery = `
+INSERT INTO ReportThrottleExemptions (UserID, ExemptUntil, CreatedBy)
+VALUES (?, ?, ?)
+ON DUPLICATE KEY UPDATE ExemptUntil = VALUES(ExemptUntil), CreatedBy = VALUES(CreatedBy)`
+
+	insertAutoDecisionQuery = `
+INSERT INTO ReportAutoDecisions (Decision, ReportID, MarkerID, UserID, Reputation, Snapshot, CreatedAt)
+VALUES (?, ?, ?, ?, ?, ?, NOW())`
+
+	getReportSnapshotQuery = `
+SELECT m.MarkerID, ST_X(m.Location) AS Latitude, ST_Y(m.Location) AS Longitude, COALESCE(m.Description, '') AS Description, m.State
+FROM Reports r
+JOIN Markers m ON m.MarkerID = r.MarkerID
+WHERE r.ReportID = ? AND r.Status = 'PENDING'
+FOR UPDATE`
+	getMarkerPhotosSnapshotQuery = "SELECT PhotoURL, ThumbnailURL, UploadedAt FROM Photos WHERE MarkerID = ?"
+	getReportPhotosSnapshotQuery = "SELECT PhotoURL, UploadedAt FROM ReportPhotos WHERE ReportID = ?"
+
+	approvePendingReportQuery = "UPDATE Reports SET Status = 'APPROVED' WHERE ReportID = ? AND Status = 'PENDING'"
+	denyPendingReportQuery    = "UPDATE Reports SET Status = 'DENIED' WHERE ReportID = ? AND Status = 'PENDING'"
+
+	getAutoDecisionQuery = `
+SELECT DecisionID, Decision, ReportID, MarkerID, UserID, Snapshot, RevertedAt
+FROM ReportAutoDecisions
+WHERE DecisionID = ?
+FOR UPDATE`
+	revertAutoDecisionQuery = "UPDATE ReportAutoDecisions SET RevertedBy = ?, RevertedAt = NOW() WHERE DecisionID = ?"
+
+	reopenReportQuery        = "UPDATE Reports SET Status = 'PENDING' WHERE ReportID = ? AND Status = 'APPROVED'"
+	clearReportDecisionQuery = "UPDATE ReportReviews SET Reason = NULL, DecidedBy = NULL, DecidedAt = NULL WHERE ReportID = ?"
+	restoreMarkerQuery       = "UPDATE Markers SET Location = ST_PointFromText(?, 4326), Description = ?, UpdatedAt = CURRENT_TIMESTAMP WHERE MarkerID = ?"
+	deleteMarkerPhotosByURL  = "DELETE FROM Photos WHERE MarkerID = ? AND PhotoURL IN (?)"
+	restoreReportPhotoQuery  = "INSERT INTO ReportPhotos (ReportID, PhotoURL, UploadedAt) VALUES (?, ?, ?)"
+	deleteThanksCommentQuery = "DELETE FROM Comments WHERE CommentID = ? AND UserID = 1"
+	restoreMarkerPhotoQuery  = `
+INSERT INTO Photos (MarkerID, PhotoURL, ThumbnailURL, UploadedAt)
+SELECT ?, ?, ?, ? FROM DUAL
+WHERE NOT EXISTS (SELECT 1 FROM Photos WHERE MarkerID = ? AND PhotoURL = ?)`
+
+	listAutoDecisionsQuery = `
+SELECT ad.DecisionID, ad.Decision, ad.ReportID, ad.MarkerID, ad.UserID, COALESCE(u.Username, '') AS Username,
+	ad.Reputation, ad.CreatedAt, ad.RevertedBy, ad.RevertedAt
+FROM ReportAutoDecisions ad
+LEFT JOIN Users u ON u.UserID = ad.UserID
+WHERE ad.Decision LIKE ?
+ORDER BY ad.DecisionID DESC
+LIMIT ? OFFSET ?`
+	countAutoDecisionsQuery = "SELECT COUNT(*) FROM ReportAutoDecisions WHERE Decision LIKE ?"
+)
+
+// ReportReputationService judges reporters by how their past reports were decided
+type ReportReputationService struct {
+	DB          *sqlx.DB
+	Config      *config.ReportTrustConfig
+	UserService *UserService
+	Logger      *zap.Logger
+}
+
+func NewReportReputationService(db *sqlx.DB, cfg *config.ReportTrustConfig, userService *UserService, logger *zap.Logger) *ReportReputationService {
+	return &ReportReputationService{
+		DB:          db,
+		Config:      cfg,
+		UserService: userService,
+		Logger:      logger,
+	}
+}
+
+// GetReputation counts the reporter's decided reports and contribution points and applies the trust rules
+func (s *ReportReputationService) GetReputation(userID int, now time.Time) (dto.ReporterReputation, error) {
+	rep := dto.ReporterReputation{UserID: userID}
+
+	windowStart := now.Add(-s.Config.ThrottleWindow)
+	if err := s.DB.Get(&rep, getReporterStatsQuery, windowStart, windowStart, now.Add(-24*time.Hour), userID); err != nil {
+		return rep, fmt.Errorf("error counting reports of user %d: %w", userID, err)
+	}
+	if err := s.DB.Get(&rep.ExemptUntil, getThrottleExemptionQuery, userID, now); err != nil {
+		return rep, fmt.Errorf("error fetching throttle exemption of user %d: %w", userID, err)
+	}
+
+	contribution, _, err := s.UserService.GetUserContributionScores(userID)
+	if err != nil {
+		return rep, err
+	}
+	rep.Contribution = contribution
+
+	evaluateReputation(&rep, s.Config)
+	return rep, nil
+}
+
+// CheckReporter returns ErrReportThrottled when a throttled reporter used up the reports for today, the refusal is audited
+func (s *ReportReputationService) CheckReporter(userID, markerID int, now time.Time) (dto.ReporterReputation, error) {
+	rep, err := s.GetReputation(userID, now)
+	if err != nil {
+		return rep, err
+	}
+	if !rep.Throttled || rep.ReportsToday < s.Config.ThrottlePerDay {
+		return rep, nil
+	}
+
+	if err := insertAutoDecision(s.DB, AutoDecisionThrottled, nil, markerID, userID, rep, nil); err != nil {
+		s.Logger.Error("Failed to audit throttled report", zap.Int("userID", userID), zap.Error(err))
+	}
+	return rep, ErrReportThrottled
+}
+
+// evaluateReputation scores the reporter and decides if they're trusted or throttled under the rules
+func evaluateReputation(rep *dto.ReporterReputation, cfg *config.ReportTrustConfig) {
+	rep.Score = reportApprovalRate(rep.Approved, rep.Denied)
+
+	rep.Throttled = cfg.ThrottlePerDay > 0 && rep.ExemptUntil == nil &&
+		rep.RecentDenied >= cfg.ThrottleMinDenied &&
+		reportApprovalRate(rep.RecentApproved, rep.RecentDenied) < cfg.ThrottleRate
+
+	rep.Trusted = cfg.AutoApprove && !rep.Throttled &&
+		rep.Approved+rep.Denied >= cfg.MinDecided &&
+		rep.Score >= cfg.MinApprovalRate &&
+		rep.Contribution >= cfg.MinContribution
+}
+
+// reportApprovalRate is the Laplace smoothed share of approved reports, 0.5 for a reporter without any
+func reportApprovalRate(approved, denied int) float64 {
+	return float64(approved+1) / float64(approved+denied+2)
+}
+
+func insertAutoDecision(db sqlx.Execer, decision string, reportID *int, markerID, userID int, rep dto.ReporterReputation, snapshot *reportSnapshot) error {
+	reputation, err := json.Marshal(rep)
+	if err != nil {
+		return err
+	}
+	var snap []byte
+	if snapshot != nil {
+		if snap, err = json.Marshal(snapshot); err != nil {
+			return err
+		}
+	}
+	if _, err := db.Exec(insertAutoDecisionQuery, decision, reportID, markerID, userID, reputation, snap); err != nil {
+		return fmt.Errorf("error saving automatic decision: %w", err)
+	}
+	return nil
+}
+
+// reportSnapshot is the marker as it was before an automatic approval
+type reportSnapshot struct {
+	MarkerID     int             `json:"markerId" db:"MarkerID"`
+	Latitude     float64         `json:"latitude" db:"Latitude"`
+	Longitude    float64         `json:"longitude" db:"Longitude"`
+	Description  string          `json:"description" db:"Description"`
+	State        string          `json:"state,omitempty" db:"State"`
+	Photos       []snapshotPhoto `json:"photos" db:"-"`
+	ReportPhotos []snapshotPhoto `json:"reportPhotos" db:"-"`
+	CommentID    int             `json:"commentId" db:"-"`
+}
+
+type snapshotPhoto struct {
+	PhotoURL     string    `json:"photoUrl" db:"PhotoURL"`
+	ThumbnailURL *string   `json:"thumbnailUrl,omitempty" db:"ThumbnailURL"`
+	UploadedAt   time.Time `json:"uploadedAt" db:"UploadedAt"`
+}
+
+// autoApproveReport approves the report of a trusted reporter like a reviewer would, keeping what it changed
+func (s *ReportService) autoApproveReport(reportID int, rep dto.ReporterReputation) error {
+	tx, err := s.DB.Beginx()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBeginTransaction, err)
+	}
+	defer tx.Rollback()
+
+	var snapshot reportSnapshot
+	if err := tx.Get(&snapshot, getReportSnapshotQuery, reportID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrReportNotPending
+		}
+		return fmt.Errorf("error fetching marker of report %d: %w", reportID, err)
+	}
+	if err := tx.Select(&snapshot.Photos, getMarkerPhotosSnapshotQuery, snapshot.MarkerID); err != nil {
+		return fmt.Errorf("error fetching marker photos: %w", err)
+	}
+	if err := tx.Select(&snapshot.ReportPhotos, getReportPhotosSnapshotQuery, reportID); err != nil {
+		return fmt.Errorf("error fetching report photos: %w", err)
+	}
+
+	if _, snapshot.CommentID, err = s.approvePendingReportTx(tx, reportID, autoApproveReason); err != nil {
+		return err
+	}
+	if err := insertAutoDecision(tx, AutoDecisionApproved, &reportID, snapshot.MarkerID, rep.UserID, rep, &snapshot); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%w: %v", ErrCommitTransaction, err)
+	}
+
+	s.UpdateDbLocation(reportID)
+	s.States.Changed(snapshot.MarkerID)
+
+	s.EventBus.Publish(DomainEvent{Name: EventReportApproved, MarkerID: snapshot.MarkerID, ReportID: reportID, Text: autoApproveReason})
+	return nil
+}
+
+// approvePendingReportTx applies a pending report to the marker when nobody reviewed it, the reason is shown to the reporter
+func (s *ReportService) approvePendingReportTx(tx *sqlx.Tx, reportID int, reason string) (markerID, commentID int, err error) {
+	res, err := tx.Exec(approvePendingReportQuery, reportID)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error approving report: %w", err)
+	}
+	if count, _ := res.RowsAffected(); count == 0 {
+		return 0, 0, ErrReportNotPending
+	}
+	if _, err := tx.Exec(upsertReportDecisionQuery, reportID, reason, nil); err != nil {
+		return 0, 0, fmt.Errorf("error saving report decision: %w", err)
+	}
+	if err := s.UpdateMarkerWithReportDetailsTx(tx, reportID); err != nil {
+		return 0, 0, err
+	}
+	return s.thankReporterTx(tx, reportID)
+}
+
+// RevertAutoDecision undoes an automatic decision. An approval puts the marker back as it was and the report back in the queue,
+// changes made to the marker after the approval are lost. A throttle exempts the reporter for one throttle window.
+func (s *ReportService) RevertAutoDecision(decisionID, adminID int, now time.Time) error {
+	tx, err := s.DB.Beginx()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBeginTransaction, err)
+	}
+	defer tx.Rollback()
+
+	var decision struct {
+		DecisionID int        `db:"DecisionID"`
+		Decision   string     `db:"Decision"`
+		ReportID   *int       `db:"ReportID"`
+		MarkerID   int        `db:"MarkerID"`
+		UserID     int        `db:"UserID"`
+		Snapshot   []byte     `db:"Snapshot"`
+		RevertedAt *time.Time `db:"RevertedAt"`
+	}
+	if err := tx.Get(&decision, getAutoDecisionQuery, decisionID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrAutoDecisionNotFound
+		}
+		return fmt.Errorf("error fetching automatic decision %d: %w", decisionID, err)
+	}
+	if decision.RevertedAt != nil {
+		return ErrAutoDecisionReverted
+	}
+
+	switch decision.Decision {
+	case AutoDecisionApproved:
+		if decision.ReportID == nil {
+			return ErrReportNotFound
+		}
+		var snapshot reportSnapshot
+		if err := json.Unmarshal(decision.Snapshot, &snapshot); err != nil {
+			return fmt.Errorf("error reading snapshot of automatic decision %d: %w", decisionID, err)
+		}
+		if err := restoreReportSnapshotTx(tx, *decision.ReportID, snapshot); err != nil {
+			return err
+		}
+	case AutoDecisionThrottled:
+		if _, err := tx.Exec(upsertThrottleExemptionQuery, decision.UserID, now.Add(s.Reputation.Config.ThrottleWindow), adminID); err != nil {
+			return fmt.Errorf("error exempting user %d from the throttle: %w", decision.UserID, err)
+		}
+	}
+
+	if _, err := tx.Exec(revertAutoDecisionQuery, adminID, decisionID); err != nil {
+		return fmt.Errorf("error reverting automatic decision %d: %w", decisionID, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%w: %v", ErrCommitTransaction, err)
+	}
+
+	if decision.Decision == AutoDecisionApproved {
+		s.UpdateDbLocation(*decision.ReportID)
+		s.States.Changed(decision.MarkerID)
+	}
+	return nil
+}
+
+// restoreReportSnapshotTx reopens the report and undoes what approving it did to the marker
+func restoreReportSnapshotTx(tx *sqlx.Tx, reportID int, snapshot reportSnapshot) error {
+	res, err := tx.Exec(reopenReportQuery, reportID)
+	if err != nil {
+		return fmt.Errorf("error reopening report %d: %w", reportID, err)
+	}
+	if count, _ := res.RowsAffected(); count == 0 {
+		return ErrReportNotFound
+	}
+	if _, err := tx.Exec(clearReportDecisionQuery, reportID); err != nil {
+		return fmt.Errorf("error clearing report decision: %w", err)
+	}
+
+	point := formatPoint(snapshot.Latitude, snapshot.Longitude)
+	if _, err := tx.Exec(restoreMarkerQuery, point, snapshot.Description, snapshot.MarkerID); err != nil {
+		return fmt.Errorf("error restoring marker %d: %w", snapshot.MarkerID, err)
+	}
+
+	// snapshots from before marker states have none, those markers keep the state they have
+	if snapshot.State != "" {
+		var state string
+		if err := tx.Get(&state, getMarkerStateForUpdateQuery, snapshot.MarkerID); err != nil {
+			return fmt.Errorf("error fetching state of marker %d: %w", snapshot.MarkerID, err)
+		}
+		if state != snapshot.State {
+			if err := recordMarkerStateTx(tx, snapshot.MarkerID, state, snapshot.State, MarkerEventRestored, nil, &reportID); err != nil {
+				return err
+			}
+		}
+	}
+
+	// the report photos go back to the report, the marker photos they pushed out come back
+	if len(snapshot.ReportPhotos) > 0 {
+		urls := make([]string, len(snapshot.ReportPhotos))
+		for i, photo := range snapshot.ReportPhotos {
+			urls[i] = photo.PhotoURL
+		}
+		query, args, err := sqlx.In(deleteMarkerPhotosByURL, snapshot.MarkerID, urls)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(tx.Rebind(query), args...); err != nil {
+			return fmt.Errorf("error removing report photos from marker: %w", err)
+		}
+	}
+	for _, photo := range snapshot.ReportPhotos {
+		if _, err := tx.Exec(restoreReportPhotoQuery, reportID, photo.PhotoURL, photo.UploadedAt); err != nil {
+			return fmt.Errorf("error restoring report photo: %w", err)
+		}
+	}
+	for _, photo := range snapshot.Photos {
+		if _, err := tx.Exec(restoreMarkerPhotoQuery, snapshot.MarkerID, photo.PhotoURL, photo.ThumbnailURL, photo.UploadedAt,
+			snapshot.MarkerID, photo.PhotoURL); err != nil {
+			return fmt.Errorf("error restoring marker photo: %w", err)
+		}
+	}
+
+	if snapshot.CommentID != 0 {
+		if _, err := tx.Exec(deleteThanksCommentQuery, snapshot.CommentID); err != nil {
+			return fmt.Errorf("error deleting report comment: %w", err)
+		}
+	}
+	return nil
+}
+
+// ListAutoDecisions pages through the automatic decisions, the newest first. decision is auto_approved, throttled or empty for both.
+func (s *ReportService) ListAutoDecisions(decision string, page, pageSize int) (dto.ReportAutoDecisionList, error) {
+	list := dto.ReportAutoDecisionList{Decisions: []dto.ReportAutoDecision{}}
+
+	pattern := "%"
+	switch decision {
+	case "":
+	case AutoDecisionApproved, AutoDecisionThrottled:
+		pattern = decision
+	default:
+		return list, fmt.Errorf("%w: unknown decision %q", ErrInvalidReportQueue, decision)
+	}
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > maxAutoDecListPage {
+		pageSize = defaultAutoDecList
+	}
+	list.CurrentPage = page
+
+	if err := s.DB.Get(&list.Total, countAutoDecisionsQuery, pattern); err != nil {
+		return list, fmt.Errorf("error counting automatic decisions: %w", err)
+	}
+	list.TotalPages = (list.Total + pageSize - 1) / pageSize
+
+	if err := s.DB.Select(&list.Decisions, listAutoDecisionsQuery, pattern, pageSize, (page-1)*pageSize); err != nil {
+		return list, fmt.Errorf("error fetching automatic decisions: %w", err)
+	}
+	return list, nil
+}
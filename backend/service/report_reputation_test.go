@@ -0,0 +1,79 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Alfex4936/chulbong-kr/config"
+	"github.com/Alfex4936/chulbong-kr/dto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReporterReputation(t *testing.T) {
+	cfg := &config.ReportTrustConfig{
+		AutoApprove:       true,
+		MinDecided:        20,
+		MinApprovalRate:   0.9,
+		MinContribution:   100,
+		ThrottleWindow:    30 * 24 * time.Hour,
+		ThrottleMinDenied: 5,
+		ThrottleRate:      0.3,
+		ThrottlePerDay:    1,
+	}
+
+	t.Run("ApprovalRate", func(t *testing.T) {
+		assert.Equal(t, 0.5, reportApprovalRate(0, 0))
+		assert.Equal(t, 0.75, reportApprovalRate(2, 0))
+		assert.InDelta(t, 0.958, reportApprovalRate(45, 1), 0.001)
+	})
+
+	t.Run("Trusted", func(t *testing.T) {
+		rep := dto.ReporterReputation{Approved: 30, Denied: 1, Contribution: 250}
+		evaluateReputation(&rep, cfg)
+		assert.True(t, rep.Trusted)
+		assert.False(t, rep.Throttled)
+		assert.InDelta(t, 0.939, rep.Score, 0.001)
+
+		for name, rep := range map[string]dto.ReporterReputation{
+			"TooFewReports":   {Approved: 15, Contribution: 250},
+			"TooManyDenied":   {Approved: 30, Denied: 5, Contribution: 250},
+			"LowContribution": {Approved: 30, Denied: 1, Contribution: 99},
+		} {
+			evaluateReputation(&rep, cfg)
+			assert.False(t, rep.Trusted, name)
+		}
+
+		disabled := *cfg
+		disabled.AutoApprove = false
+		rep = dto.ReporterReputation{Approved: 30, Denied: 1, Contribution: 250}
+		evaluateReputation(&rep, &disabled)
+		assert.False(t, rep.Trusted)
+	})
+
+	t.Run("Throttled", func(t *testing.T) {
+		rep := dto.ReporterReputation{Approved: 40, Denied: 8, RecentApproved: 1, RecentDenied: 6, Contribution: 500}
+		evaluateReputation(&rep, cfg)
+		assert.True(t, rep.Throttled)
+		// a throttled reporter is never trusted, whatever they did before
+		assert.False(t, rep.Trusted)
+
+		rep = dto.ReporterReputation{RecentApproved: 1, RecentDenied: 4}
+		evaluateReputation(&rep, cfg)
+		assert.False(t, rep.Throttled, "too few denied to judge")
+
+		rep = dto.ReporterReputation{RecentApproved: 4, RecentDenied: 6}
+		evaluateReputation(&rep, cfg)
+		assert.False(t, rep.Throttled, "mostly fine")
+
+		exempt := time.Now().Add(time.Hour)
+		rep = dto.ReporterReputation{RecentDenied: 10, ExemptUntil: &exempt}
+		evaluateReputation(&rep, cfg)
+		assert.False(t, rep.Throttled)
+
+		off := *cfg
+		off.ThrottlePerDay = 0
+		rep = dto.ReporterReputation{RecentDenied: 10}
+		evaluateReputation(&rep, &off)
+		assert.False(t, rep.Throttled)
+	})
+}
@@ -0,0 +1,366 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Alfex4936/chulbong-kr/dto"
+	"github.com/Alfex4936/chulbong-kr/util"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+// ReportReviewSLA is how long a report may wait for a decision before it's overdue
+const ReportReviewSLA = 72 * time.Hour
+
+// Report types in the review queue, a report either moves or edits the marker or says it's gone
+const (
+	ReportTypeMoved   = "moved"
+	ReportTypeRemoved = "removed"
+
+	ReportActionApprove = "approve"
+	ReportActionDeny    = "deny"
+
+	maxReportBulk       = 100
+	maxReviewReasonLen  = 500
+	defaultReportQueue  = 20
+	maxReportQueuePage  = 100
+	reportAssigneeMe    = "me"
+	reportAssigneeNone  = "none"
+	reportStatusPending = "PENDING"
+)
+
+var reportStatuses = []string{"PENDING", "APPROVED", "DENIED"}
+
+// ReportReviews(ReportID, AssigneeID, AssignedAt, Reason, DecidedBy, DecidedAt) keeps who reviews a report and the decision
+const (
+	reportQueueFrom = `
+FROM Reports r
+LEFT JOIN Markers m ON m.MarkerID = r.MarkerID
+LEFT JOIN ReportReviews rv ON rv.ReportID = r.ReportID`
+
+	getReportQueueQuery = `
+SELECT r.ReportID, r.MarkerID, r.UserID AS ReporterID, COALESCE(ru.Username, '') AS ReporterName,
+	ST_X(r.Location) AS Latitude, ST_Y(r.Location) AS Longitude,
+	ST_X(r.NewLocation) AS NewLatitude, ST_Y(r.NewLocation) AS NewLongitude,
+	r.Description, COALESCE(m.Address, '') AS Address, r.Status, r.DoesExist, r.CreatedAt,
+	rv.AssigneeID, COALESCE(au.Username, '') AS AssigneeName, rv.AssignedAt, COALESCE(rv.Reason, '') AS Reason` + reportQueueFrom + `
+LEFT JOIN Users ru ON ru.UserID = r.UserID
+LEFT JOIN Users au ON au.UserID = rv.AssigneeID
+WHERE %s
+ORDER BY r.CreatedAt ASC, r.ReportID ASC
+LIMIT ? OFFSET ?`
+
+	countReportQueueQuery = "SELECT COUNT(*)" + reportQueueFrom + " WHERE %s"
+
+	getReportQueueSummaryQuery = `
+SELECT COUNT(*) AS Pending,
+	COALESCE(SUM(r.CreatedAt <= ?), 0) AS Overdue,
+	COALESCE(SUM(rv.AssigneeID IS NULL), 0) AS Unassigned
+FROM Reports r
+LEFT JOIN ReportReviews rv ON rv.ReportID = r.ReportID
+WHERE r.Status = 'PENDING'`
+
+	getReportQueuePhotosQuery = "SELECT ReportID, PhotoURL FROM ReportPhotos WHERE ReportID IN (?)"
+
+	getReportStatusesQuery = "SELECT ReportID, Status FROM Reports WHERE ReportID IN (?)"
+
+	isAdminQuery = "SELECT EXISTS(SELECT 1 FROM Users WHERE UserID = ? AND Role = 'admin')"
+
+	assignReportsQuery = `
+INSERT INTO ReportReviews (ReportID, AssigneeID, AssignedAt)
+SELECT ReportID, ?, NOW() FROM Reports WHERE ReportID IN (?) AND Status = 'PENDING'
+ON DUPLICATE KEY UPDATE AssigneeID = VALUES(AssigneeID), AssignedAt = VALUES(AssignedAt)`
+
+	unassignReportsQuery = "UPDATE ReportReviews SET AssigneeID = NULL, AssignedAt = NULL WHERE ReportID IN (?)"
+
+	upsertReportDecisionQuery = `
+INSERT INTO ReportReviews (ReportID, Reason, DecidedBy, DecidedAt)
+VALUES (?, ?, ?, NOW())
+ON DUPLICATE KEY UPDATE Reason = VALUES(Reason), DecidedBy = VALUES(DecidedBy), DecidedAt = VALUES(DecidedAt)`
+)
+
+// GetReportQueue lists a page of the reports matching the filter, the oldest first so the SLA is met in order
+func (s *ReportService) GetReportQueue(filter dto.ReportQueueFilter, reviewerID int, now time.Time) (dto.ReportQueue, error) {
+	queue := dto.ReportQueue{Reports: []dto.ReportQueueItem{}}
+
+	where, args, err := reportQueueFilter(&filter, reviewerID, now)
+	if err != nil {
+		return queue, err
+	}
+	queue.CurrentPage = filter.Page
+
+	if err := s.DB.Get(&queue.Total, fmt.Sprintf(countReportQueueQuery, where), args...); err != nil {
+		return queue, fmt.Errorf("error counting report queue: %w", err)
+	}
+	queue.TotalPages = (queue.Total + filter.PageSize - 1) / filter.PageSize
+
+	offset := (filter.Page - 1) * filter.PageSize
+	if err := s.DB.Select(&queue.Reports, fmt.Sprintf(getReportQueueQuery, where), append(args, filter.PageSize, offset)...); err != nil {
+		return queue, fmt.Errorf("error fetching report queue: %w", err)
+	}
+	if err := s.attachQueuePhotos(queue.Reports); err != nil {
+		return queue, err
+	}
+	if err := s.Evidence.AttachEvidence(queue.Reports); err != nil {
+		return queue, err
+	}
+	for i := range queue.Reports {
+		fillReportQueueItem(&queue.Reports[i], now)
+	}
+
+	if queue.Summary, err = s.GetReportQueueSummary(now); err != nil {
+		return queue, err
+	}
+	return queue, nil
+}
+
+// GetReportQueueSummary counts the pending, overdue and unassigned reports
+func (s *ReportService) GetReportQueueSummary(now time.Time) (dto.ReportQueueSummary, error) {
+	var summary dto.ReportQueueSummary
+	if err := s.DB.Get(&summary, getReportQueueSummaryQuery, now.Add(-ReportReviewSLA)); err != nil {
+		return summary, fmt.Errorf("error counting pending reports: %w", err)
+	}
+	return summary, nil
+}
+
+func (s *ReportService) attachQueuePhotos(reports []dto.ReportQueueItem) error {
+	if len(reports) == 0 {
+		return nil
+	}
+	ids := make([]int, len(reports))
+	for i, r := range reports {
+		ids[i] = r.ReportID
+	}
+
+	query, args, err := sqlx.In(getReportQueuePhotosQuery, ids)
+	if err != nil {
+		return err
+	}
+	var photos []struct {
+		ReportID int    `db:"ReportID"`
+		PhotoURL string `db:"PhotoURL"`
+	}
+	if err := s.DB.Select(&photos, s.DB.Rebind(query), args...); err != nil {
+		return fmt.Errorf("error fetching report photos: %w", err)
+	}
+
+	for i := range reports {
+		reports[i].PhotoURLs = []string{}
+		for _, p := range photos {
+			if p.ReportID == reports[i].ReportID {
+				reports[i].PhotoURLs = append(reports[i].PhotoURLs, p.PhotoURL)
+			}
+		}
+	}
+	return nil
+}
+
+// AssignReports gives the pending reports to an admin, assigneeID 0 takes them back to the pool.
+// Reviewed reports are left alone.
+func (s *ReportService) AssignReports(reportIDs []int, assigneeID int) (int64, error) {
+	if len(reportIDs) == 0 || len(reportIDs) > maxReportBulk {
+		return 0, fmt.Errorf("%w: 1 to %d reports at a time", ErrInvalidReportQueue, maxReportBulk)
+	}
+
+	var (
+		query string
+		args  []any
+		err   error
+	)
+	if assigneeID == 0 {
+		query, args, err = sqlx.In(unassignReportsQuery, reportIDs)
+	} else {
+		var isAdmin bool
+		if err := s.DB.Get(&isAdmin, isAdminQuery, assigneeID); err != nil {
+			return 0, fmt.Errorf("error checking assignee: %w", err)
+		}
+		if !isAdmin {
+			return 0, fmt.Errorf("%w: reports can only be assigned to admins", ErrInvalidReportQueue)
+		}
+		query, args, err = sqlx.In(assignReportsQuery, assigneeID, reportIDs)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := s.DB.Exec(s.DB.Rebind(query), args...)
+	if err != nil {
+		return 0, fmt.Errorf("error assigning reports: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// DecideReports approves or denies the pending reports one by one, a failed one doesn't stop the rest
+func (s *ReportService) DecideReports(req dto.ReportBulkRequest, reviewerID int) (dto.ReportBulkResult, error) {
+	result := dto.ReportBulkResult{Succeeded: []int{}, Failed: map[int]string{}}
+
+	if err := validateReportBulk(&req); err != nil {
+		return result, err
+	}
+
+	query, args, err := sqlx.In(getReportStatusesQuery, req.ReportIDs)
+	if err != nil {
+		return result, err
+	}
+	var statuses []struct {
+		ReportID int    `db:"ReportID"`
+		Status   string `db:"Status"`
+	}
+	if err := s.DB.Select(&statuses, s.DB.Rebind(query), args...); err != nil {
+		return result, fmt.Errorf("error fetching reports: %w", err)
+	}
+
+	status := make(map[int]string, len(statuses))
+	for _, r := range statuses {
+		status[r.ReportID] = r.Status
+	}
+
+	for _, reportID := range req.ReportIDs {
+		switch current, ok := status[reportID]; {
+		case !ok:
+			result.Failed[reportID] = ErrReportNotFound.Error()
+			continue
+		case current != reportStatusPending:
+			result.Failed[reportID] = ErrReportNotPending.Error()
+			continue
+		}
+
+		if req.Action == ReportActionApprove {
+			err = s.approveReport(reportID, reviewerID, req.Reason)
+		} else {
+			err = s.denyReport(reportID, reviewerID, req.Reason)
+		}
+		if errors.Is(err, ErrReportNotPending) {
+			result.Failed[reportID] = err.Error() // decided by someone else meanwhile
+			continue
+		}
+		if err != nil {
+			s.Logger.Error("Failed to decide report", zap.Int("reportID", reportID), zap.String("action", req.Action), zap.Error(err))
+			result.Failed[reportID] = "failed to " + req.Action + " report"
+			continue
+		}
+		result.Succeeded = append(result.Succeeded, reportID)
+	}
+	return result, nil
+}
+
+// reportQueueFilter turns the filter into a WHERE clause, filling in the paging defaults
+func reportQueueFilter(filter *dto.ReportQueueFilter, reviewerID int, now time.Time) (string, []any, error) {
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.PageSize < 1 || filter.PageSize > maxReportQueuePage {
+		filter.PageSize = defaultReportQueue
+	}
+
+	conditions := []string{"r.Status = ?"}
+	status := strings.ToUpper(strings.TrimSpace(filter.Status))
+	if status == "" {
+		status = reportStatusPending
+	}
+	if !slices.Contains(reportStatuses, status) {
+		return "", nil, fmt.Errorf("%w: unknown status %q", ErrInvalidReportQueue, filter.Status)
+	}
+	filter.Status = status
+	args := []any{status}
+
+	switch filter.Type {
+	case "":
+	case ReportTypeMoved:
+		conditions = append(conditions, "r.DoesExist = TRUE")
+	case ReportTypeRemoved:
+		conditions = append(conditions, "r.DoesExist = FALSE")
+	default:
+		return "", nil, fmt.Errorf("%w: unknown type %q", ErrInvalidReportQueue, filter.Type)
+	}
+
+	if region := strings.TrimSpace(filter.Region); region != "" {
+		province, ok := reportQueueProvince(region)
+		if !ok {
+			return "", nil, fmt.Errorf("%w: unknown region %q", ErrInvalidReportQueue, filter.Region)
+		}
+		conditions = append(conditions, "m.Address LIKE ?")
+		args = append(args, province+" %")
+	}
+
+	switch assignee := strings.TrimSpace(filter.Assignee); assignee {
+	case "":
+	case reportAssigneeNone:
+		conditions = append(conditions, "rv.AssigneeID IS NULL")
+	case reportAssigneeMe:
+		conditions = append(conditions, "rv.AssigneeID = ?")
+		args = append(args, reviewerID)
+	default:
+		assigneeID, err := strconv.Atoi(assignee)
+		if err != nil || assigneeID <= 0 {
+			return "", nil, fmt.Errorf("%w: invalid assignee %q", ErrInvalidReportQueue, filter.Assignee)
+		}
+		conditions = append(conditions, "rv.AssigneeID = ?")
+		args = append(args, assigneeID)
+	}
+
+	if filter.MinAgeHours < 0 || filter.MaxAgeHours < 0 || (filter.MaxAgeHours > 0 && filter.MaxAgeHours < filter.MinAgeHours) {
+		return "", nil, fmt.Errorf("%w: invalid age range", ErrInvalidReportQueue)
+	}
+	if filter.MinAgeHours > 0 {
+		conditions = append(conditions, "r.CreatedAt <= ?")
+		args = append(args, now.Add(-time.Duration(filter.MinAgeHours)*time.Hour))
+	}
+	if filter.MaxAgeHours > 0 {
+		conditions = append(conditions, "r.CreatedAt >= ?")
+		args = append(args, now.Add(-time.Duration(filter.MaxAgeHours)*time.Hour))
+	}
+	if filter.Overdue {
+		conditions = append(conditions, "r.CreatedAt <= ?")
+		args = append(args, now.Add(-ReportReviewSLA))
+	}
+
+	return strings.Join(conditions, " AND "), args, nil
+}
+
+// reportQueueProvince accepts a region code or any province name standardizeProvinceForDB knows
+func reportQueueProvince(region string) (string, bool) {
+	for _, r := range regions {
+		if r.Code == region {
+			return r.Name, true
+		}
+	}
+	province := standardizeProvinceForDB(region)
+	return province, slices.ContainsFunc(regions, func(r Region) bool { return r.Name == province })
+}
+
+// fillReportQueueItem works out the type, the SLA and how far the marker would move
+func fillReportQueueItem(item *dto.ReportQueueItem, now time.Time) {
+	item.Type = ReportTypeMoved
+	if !item.DoesExist {
+		item.Type = ReportTypeRemoved
+	}
+	item.DueAt = item.CreatedAt.Add(ReportReviewSLA)
+	item.Overdue = item.Status == reportStatusPending && now.After(item.DueAt)
+	item.Distance = util.CalculateDistanceApproximately(item.Latitude, item.Longitude, item.NewLatitude, item.NewLongitude)
+}
+
+func validateReportBulk(req *dto.ReportBulkRequest) error {
+	if req.Action != ReportActionApprove && req.Action != ReportActionDeny {
+		return fmt.Errorf("%w: unknown action %q", ErrInvalidReportQueue, req.Action)
+	}
+	if len(req.ReportIDs) == 0 || len(req.ReportIDs) > maxReportBulk {
+		return fmt.Errorf("%w: 1 to %d reports at a time", ErrInvalidReportQueue, maxReportBulk)
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if len([]rune(req.Reason)) > maxReviewReasonLen {
+		return fmt.Errorf("%w: reason is longer than %d characters", ErrInvalidReportQueue, maxReviewReasonLen)
+	}
+	// the reporter reads the reason, a denial without one helps nobody
+	if req.Action == ReportActionDeny && req.Reason == "" {
+		return fmt.Errorf("%w: a reason is needed to deny reports", ErrInvalidReportQueue)
+	}
+	slices.Sort(req.ReportIDs)
+	req.ReportIDs = slices.Compact(req.ReportIDs)
+	return nil
+}
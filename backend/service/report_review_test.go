@@ -0,0 +1,135 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Alfex4936/chulbong-kr/dto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReportQueue(t *testing.T) {
+	now := time.Date(2024, 6, 10, 12, 0, 0, 0, time.UTC)
+
+	t.Run("DefaultFilter", func(t *testing.T) {
+		filter := dto.ReportQueueFilter{PageSize: 1000}
+		where, args, err := reportQueueFilter(&filter, 7, now)
+		require.NoError(t, err)
+		assert.Equal(t, "r.Status = ?", where)
+		assert.Equal(t, []any{"PENDING"}, args)
+		assert.Equal(t, 1, filter.Page)
+		assert.Equal(t, defaultReportQueue, filter.PageSize)
+	})
+
+	t.Run("AllFilters", func(t *testing.T) {
+		filter := dto.ReportQueueFilter{
+			Status:      "pending",
+			Type:        ReportTypeRemoved,
+			Region:      "so",
+			Assignee:    "me",
+			MinAgeHours: 24,
+			MaxAgeHours: 48,
+			Overdue:     true,
+		}
+		where, args, err := reportQueueFilter(&filter, 7, now)
+		require.NoError(t, err)
+		assert.Equal(t, "r.Status = ? AND r.DoesExist = FALSE AND m.Address LIKE ? AND rv.AssigneeID = ? AND "+
+			"r.CreatedAt <= ? AND r.CreatedAt >= ? AND r.CreatedAt <= ?", where)
+		assert.Equal(t, []any{
+			"PENDING", "서울특별시 %", 7,
+			now.Add(-24 * time.Hour), now.Add(-48 * time.Hour), now.Add(-ReportReviewSLA),
+		}, args)
+	})
+
+	t.Run("Regions", func(t *testing.T) {
+		for region, province := range map[string]string{"gg": "경기도", "경기": "경기도", "부산광역시": "부산광역시"} {
+			got, ok := reportQueueProvince(region)
+			assert.True(t, ok, region)
+			assert.Equal(t, province, got)
+		}
+		_, ok := reportQueueProvince("xx")
+		assert.False(t, ok)
+	})
+
+	t.Run("Assignees", func(t *testing.T) {
+		filter := dto.ReportQueueFilter{Assignee: "none"}
+		where, _, err := reportQueueFilter(&filter, 7, now)
+		require.NoError(t, err)
+		assert.True(t, strings.HasSuffix(where, "rv.AssigneeID IS NULL"), where)
+
+		filter = dto.ReportQueueFilter{Assignee: "42"}
+		_, args, err := reportQueueFilter(&filter, 7, now)
+		require.NoError(t, err)
+		assert.Equal(t, []any{"PENDING", 42}, args)
+	})
+
+	t.Run("InvalidFilters", func(t *testing.T) {
+		for _, filter := range []dto.ReportQueueFilter{
+			{Status: "DELETED"},
+			{Type: "spam"},
+			{Region: "도쿄"},
+			{Assignee: "someone"},
+			{Assignee: "-1"},
+			{MinAgeHours: -1},
+			{MinAgeHours: 48, MaxAgeHours: 24},
+		} {
+			_, _, err := reportQueueFilter(&filter, 7, now)
+			assert.ErrorIs(t, err, ErrInvalidReportQueue, filter)
+		}
+	})
+
+	t.Run("SLA", func(t *testing.T) {
+		item := dto.ReportQueueItem{
+			Status:    "PENDING",
+			DoesExist: true,
+			CreatedAt: now.Add(-ReportReviewSLA - time.Minute),
+			Latitude:  37.5665, Longitude: 126.9780,
+			NewLatitude: 37.5666, NewLongitude: 126.9780,
+		}
+		fillReportQueueItem(&item, now)
+		assert.Equal(t, ReportTypeMoved, item.Type)
+		assert.True(t, item.Overdue)
+		assert.Equal(t, item.CreatedAt.Add(ReportReviewSLA), item.DueAt)
+		assert.InDelta(t, 11, item.Distance, 1)
+
+		item = dto.ReportQueueItem{Status: "PENDING", CreatedAt: now.Add(-time.Hour)}
+		fillReportQueueItem(&item, now)
+		assert.Equal(t, ReportTypeRemoved, item.Type)
+		assert.False(t, item.Overdue)
+
+		// decided reports are never overdue
+		item = dto.ReportQueueItem{Status: "DENIED", CreatedAt: now.Add(-30 * 24 * time.Hour)}
+		fillReportQueueItem(&item, now)
+		assert.False(t, item.Overdue)
+	})
+
+	t.Run("Bulk", func(t *testing.T) {
+		req := dto.ReportBulkRequest{Action: ReportActionApprove, ReportIDs: []int{3, 1, 3, 2}}
+		require.NoError(t, validateReportBulk(&req))
+		assert.Equal(t, []int{1, 2, 3}, req.ReportIDs)
+
+		req = dto.ReportBulkRequest{Action: ReportActionDeny, ReportIDs: []int{1}, Reason: " 사진이 흐려요 "}
+		require.NoError(t, validateReportBulk(&req))
+		assert.Equal(t, "사진이 흐려요", req.Reason)
+
+		for _, invalid := range []dto.ReportBulkRequest{
+			{Action: "delete", ReportIDs: []int{1}},
+			{Action: ReportActionApprove},
+			{Action: ReportActionApprove, ReportIDs: make([]int, maxReportBulk+1)},
+			{Action: ReportActionDeny, ReportIDs: []int{1}},
+			{Action: ReportActionApprove, ReportIDs: []int{1}, Reason: strings.Repeat("가", maxReviewReasonLen+1)},
+		} {
+			assert.ErrorIs(t, validateReportBulk(&invalid), ErrInvalidReportQueue)
+		}
+	})
+
+	t.Run("ReasonInNotification", func(t *testing.T) {
+		n := buildPersonalNotification(DomainEvent{Name: EventReportDenied, MarkerID: 5, ReportID: 9, Text: "위치가 달라요"}, 3, "서울특별시 종로구")
+		assert.Contains(t, n.Message, "사유: 위치가 달라요")
+
+		n = buildPersonalNotification(DomainEvent{Name: EventReportApproved, MarkerID: 5, ReportID: 9}, 3, "")
+		assert.NotContains(t, n.Message, "사유")
+	})
+}
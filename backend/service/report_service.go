@@ -25,10 +25,11 @@ ORDER BY r.CreatedAt DESC`
 	getAllReportsByQuery = `
 SELECT r.ReportID, r.MarkerID, r.UserID, ST_X(r.Location) AS Latitude, ST_Y(r.Location) AS Longitude,
 ST_X(r.NewLocation) AS NewLatitude, ST_Y(r.NewLocation) AS NewLongitude,
-r.Description, r.CreatedAt, r.Status, m.Address, COALESCE(p.PhotoURL, '') AS PhotoURL
+r.Description, r.CreatedAt, r.Status, m.Address, COALESCE(rv.Reason, '') AS Reason, COALESCE(p.PhotoURL, '') AS PhotoURL
 FROM Reports r
 LEFT JOIN ReportPhotos p ON r.ReportID = p.ReportID
 LEFT JOIN Markers m ON r.MarkerID = m.MarkerID
+LEFT JOIN ReportReviews rv ON r.ReportID = rv.ReportID
 WHERE r.MarkerID = ?
 ORDER BY r.CreatedAt DESC`
 
@@ -40,7 +41,7 @@ ORDER BY r.CreatedAt DESC`
 	approveReportQuery = `
 UPDATE Reports
 SET Status = 'APPROVED'
-WHERE ReportID = ?
+WHERE ReportID = ? AND Status = 'PENDING'
 AND (
 	MarkerID IN (
 		SELECT MarkerID
@@ -67,7 +68,7 @@ AND (
 	denyReportQuery = `
 UPDATE Reports
 SET Status = 'DENIED'
-WHERE ReportID = ?
+WHERE ReportID = ? AND Status = 'PENDING'
 AND (
 	MarkerID IN (
 		SELECT MarkerID
@@ -151,18 +152,33 @@ type ReportService struct {
 	S3Service       *S3Service
 	LocationService *MarkerLocationService
 	CacheService    *MarkerCacheService
+	EventBus        *EventBus
+	Reputation      *ReportReputationService
+	Evidence        *ReportEvidenceService
+	States          *MarkerStateService
+	Comments        *MarkerCommentService
 	Logger          *zap.Logger
 }
 
 func NewReportService(db *sqlx.DB, s3Service *S3Service,
 	location *MarkerLocationService,
 	cache *MarkerCacheService,
+	bus *EventBus,
+	reputation *ReportReputationService,
+	evidence *ReportEvidenceService,
+	states *MarkerStateService,
+	comments *MarkerCommentService,
 	logger *zap.Logger) *ReportService {
 	return &ReportService{
 		DB:              db,
 		S3Service:       s3Service,
 		LocationService: location,
 		CacheService:    cache,
+		EventBus:        bus,
+		Reputation:      reputation,
+		Evidence:        evidence,
+		States:          states,
+		Comments:        comments,
 		Logger:          logger,
 	}
 }
@@ -225,7 +241,7 @@ func (s *ReportService) GetAllReportsBy(markerID int) ([]dto.MarkerReportRespons
 			url string
 		)
 		if err := rows.Scan(&r.ReportID, &r.MarkerID, &r.UserID, &r.Latitude, &r.Longitude,
-			&r.NewLatitude, &r.NewLongitude, &r.Description, &r.CreatedAt, &r.Status, &r.Address, &url); err != nil {
+			&r.NewLatitude, &r.NewLongitude, &r.Description, &r.CreatedAt, &r.Status, &r.Address, &r.Reason, &url); err != nil {
 			return nil, err
 		}
 		// Check if the URL is not empty before appending
@@ -262,16 +278,36 @@ func (s *ReportService) CreateReport(report *dto.MarkerReportRequest, form *mult
 		return ErrNoPhotos
 	}
 
-	// Channels for collecting file URLs and errors
-	fileURLChan := make(chan string, len(files))
+	// Reporters whose reports keep getting denied may only file a few a day, trusted ones skip the review
+	now := time.Now()
+	var reputation dto.ReporterReputation
+	if report.UserID != 0 {
+		var err error
+		reputation, err = s.Reputation.CheckReporter(report.UserID, report.MarkerID, now)
+		if errors.Is(err, ErrReportThrottled) {
+			return err
+		}
+		if err != nil {
+			// the review queue still catches it
+			s.Logger.Error("Failed to check reporter reputation", zap.Int("userID", report.UserID), zap.Error(err))
+		}
+	}
+
+	// Check the photos were taken where the marker is proposed to be, before paying for the uploads
+	evidence := s.Evidence.Inspect(files, report.NewLatitude, report.NewLongitude, now)
+	if err := s.Evidence.CheckPolicy(report, evidence); err != nil {
+		return err
+	}
+
+	// Concurrently upload files to S3, each into its own slot so the evidence stays with its photo
+	fileURLs := make([]string, len(files))
 	errorChan := make(chan error, len(files))
 
 	var wg sync.WaitGroup
 
-	// Concurrently upload files to S3
-	for _, file := range files {
+	for i, file := range files {
 		wg.Add(1)
-		go func(file *multipart.FileHeader) {
+		go func(i int, file *multipart.FileHeader) {
 			defer wg.Done()
 			// TODO: Make thumbnail for report photos too
 			fileURL, _, err := s.S3Service.UploadFileToS3("reports", file, true)
@@ -279,13 +315,12 @@ func (s *ReportService) CreateReport(report *dto.MarkerReportRequest, form *mult
 				errorChan <- fmt.Errorf("%w: %v", ErrFileUpload, err)
 				return
 			}
-			fileURLChan <- fileURL
-		}(file)
+			fileURLs[i] = fileURL
+		}(i, file)
 	}
 
 	// Wait for all uploads to finish
 	wg.Wait()
-	close(fileURLChan)
 	close(errorChan)
 
 	// Check for errors in file uploads
@@ -298,10 +333,8 @@ func (s *ReportService) CreateReport(report *dto.MarkerReportRequest, form *mult
 		return fmt.Errorf("file upload errors: %s", strings.Join(uploadErrors, "; "))
 	}
 
-	// Collect all uploaded file URLs
-	fileURLs := make([]string, 0, len(files))
-	for url := range fileURLChan {
-		fileURLs = append(fileURLs, url)
+	for i := range evidence.Photos {
+		evidence.Photos[i].PhotoURL = fileURLs[i]
 	}
 
 	// Begin a transaction for database operations
@@ -332,15 +365,49 @@ func (s *ReportService) CreateReport(report *dto.MarkerReportRequest, form *mult
 		}
 	}
 
+	if err := s.Evidence.SaveTx(tx, reportID, evidence); err != nil {
+		return err
+	}
+
+	// the marker is missing until the report is decided
+	var stateChanged bool
+	if !report.DoesExist {
+		var reporterID *int
+		if report.UserID != 0 {
+			reporterID = &report.UserID
+		}
+		rid := int(reportID)
+		if _, stateChanged, err = transitionMarkerTx(tx, report.MarkerID, MarkerEventReportedMissing, reporterID, &rid); err != nil {
+			return err
+		}
+	}
+
 	// Commit the transaction after all operations succeed
 	if err := tx.Commit(); err != nil {
 		return fmt.Errorf("%w: %v", ErrCommitTransaction, err)
 	}
 
+	if stateChanged {
+		s.States.Changed(report.MarkerID)
+	}
+
+	s.EventBus.Publish(DomainEvent{Name: EventMarkerReported, ActorID: report.UserID, MarkerID: report.MarkerID, ReportID: int(reportID)})
+
+	// flagged photos need a reviewer even from trusted reporters
+	if reputation.Trusted && evidence.Status != EvidenceFlagged {
+		if err := s.autoApproveReport(int(reportID), reputation); err != nil {
+			s.Logger.Error("Failed to auto-approve report", zap.Int64("reportID", reportID), zap.Error(err))
+		}
+	}
 	return nil
 }
 
 func (s *ReportService) ApproveReport(reportID, userID int) error {
+	return s.approveReport(reportID, userID, "")
+}
+
+// approveReport applies the report to the marker, the reason is shown to the reporter
+func (s *ReportService) approveReport(reportID, userID int, reason string) error {
 	tx, err := s.DB.Beginx()
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
@@ -359,7 +426,11 @@ func (s *ReportService) ApproveReport(reportID, userID int) error {
 	}
 
 	if count, _ := res.RowsAffected(); count == 0 {
-		return errors.New("no report updated, either report does not exist or user is not the owner")
+		return s.reportNotUpdatedError(reportID)
+	}
+
+	if _, err = tx.Exec(upsertReportDecisionQuery, reportID, reason, userID); err != nil {
+		return fmt.Errorf("error saving report decision: %w", err)
 	}
 
 	// Update the marker with report details
@@ -367,6 +438,26 @@ func (s *ReportService) ApproveReport(reportID, userID int) error {
 		return err
 	}
 
+	markerID, _, err := s.thankReporterTx(tx, reportID)
+	if err != nil {
+		return err
+	}
+
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	// Update location, invalidate cache and reindex the marker
+	s.UpdateDbLocation(reportID)
+	s.States.Changed(markerID)
+
+	s.EventBus.Publish(DomainEvent{Name: EventReportApproved, ActorID: userID, MarkerID: markerID, ReportID: reportID, Text: reason})
+	return nil
+}
+
+// thankReporterTx comments on the marker as k-pullup who the approved report came from
+func (s *ReportService) thankReporterTx(tx *sqlx.Tx, reportID int) (markerID, commentID int, err error) {
 	// Fetch report details
 	var report struct {
 		MarkerID int `db:"MarkerID"`
@@ -374,7 +465,7 @@ func (s *ReportService) ApproveReport(reportID, userID int) error {
 	}
 	err = tx.Get(&report, getReportByMarkerUserIdsQuery, reportID)
 	if err != nil {
-		return fmt.Errorf("failed to fetch report details: %w", err)
+		return 0, 0, fmt.Errorf("failed to fetch report details: %w", err)
 	}
 
 	// Determine comment text
@@ -386,43 +477,69 @@ func (s *ReportService) ApproveReport(reportID, userID int) error {
 		var username string
 		err = tx.Get(&username, getUsernameByIdQuery, report.UserID)
 		if err != nil {
-			return fmt.Errorf("failed to fetch username: %w", err)
+			return 0, 0, fmt.Errorf("failed to fetch username: %w", err)
 		}
 		commentText = fmt.Sprintf("🔉 %s님께서 정보 제공", username)
 	}
 
 	// Add comment as admin
-	commentService := NewMarkerCommentService(s.DB)
-	_, err = commentService.CreateCommentTx(tx, report.MarkerID, 1, "k-pullup", commentText)
+	comment, err := s.Comments.CreateCommentTx(tx, report.MarkerID, 1, "k-pullup", commentText)
 	if err != nil {
-		return fmt.Errorf("failed to create comment: %w", err)
+		return 0, 0, fmt.Errorf("failed to create comment: %w", err)
 	}
-
-	// Commit transaction
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("error committing transaction: %w", err)
-	}
-
-	// Update location and invalidate cache
-	s.UpdateDbLocation(reportID)
-	s.CacheService.InvalidateFullMarkersCache()
-
-	return nil
+	return report.MarkerID, comment.CommentID, nil
 }
 
 func (s *ReportService) DenyReport(reportID, userID int) error {
-	res, err := s.DB.Exec(denyReportQuery, reportID, userID, reportID, userID)
+	return s.denyReport(reportID, userID, "")
+}
+
+// denyReport rejects the report, the reason is shown to the reporter.
+// The marker of a denied "does not exist" report is verified again, unless another one is pending.
+func (s *ReportService) denyReport(reportID, userID int, reason string) error {
+	tx, err := s.DB.Beginx()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBeginTransaction, err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(denyReportQuery, reportID, userID, reportID, userID)
 	if err != nil {
 		return fmt.Errorf("error denying report: %w", err)
 	}
 	// Check if the row was actually updated
 	if count, _ := res.RowsAffected(); count == 0 {
-		return fmt.Errorf("no report updated, either report does not exist or user is not the owner")
+		return s.reportNotUpdatedError(reportID)
+	}
+
+	if _, err := tx.Exec(upsertReportDecisionQuery, reportID, reason, userID); err != nil {
+		return fmt.Errorf("error saving report decision: %w", err)
+	}
+	markerID, stateChanged, err := reportMarkerTransitionTx(tx, reportID, MarkerEventMissingDenied)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%w: %v", ErrCommitTransaction, err)
+	}
+	if stateChanged {
+		s.States.Changed(markerID)
 	}
 
+	s.EventBus.Publish(DomainEvent{Name: EventReportDenied, ActorID: userID, ReportID: reportID, Text: reason})
 	return nil
 }
 
+// reportNotUpdatedError tells a report decided in the meantime apart from one the user may not decide
+func (s *ReportService) reportNotUpdatedError(reportID int) error {
+	var status string
+	if err := s.DB.Get(&status, getReportStatusQuery, reportID); err == nil && status != reportStatusPending {
+		return ErrReportNotPending
+	}
+	return errors.New("no report updated, either report does not exist or user is not the owner")
+}
+
 func (s *ReportService) UpdateMarkerWithReportDetailsTx(tx *sqlx.Tx, reportID int) error {
 
 	if _, err := tx.Exec(updateMarkeryReportQuery, reportID); err != nil {
@@ -430,7 +547,8 @@ func (s *ReportService) UpdateMarkerWithReportDetailsTx(tx *sqlx.Tx, reportID in
 	}
 
 	// Move approved report photos to the Photos table
-	if _, err := tx.Exec(updateReportPhotoQuery, reportID); err != nil {
+	photos, err := tx.Exec(updateReportPhotoQuery, reportID)
+	if err != nil {
 		return fmt.Errorf("error transferring report photos to marker photos: %w", err)
 	}
 
@@ -443,6 +561,17 @@ func (s *ReportService) UpdateMarkerWithReportDetailsTx(tx *sqlx.Tx, reportID in
 		return fmt.Errorf("error deleting report photos after moving: %w", err)
 	}
 
+	// a "does not exist" report removes the marker, the photos of any other report back it up
+	markerID, removed, err := reportMarkerTransitionTx(tx, reportID, MarkerEventRemovalApproved)
+	if err != nil {
+		return err
+	}
+	if moved, _ := photos.RowsAffected(); moved > 0 && !removed {
+		if _, _, err := transitionMarkerTx(tx, markerID, MarkerEventPhotoAdded, nil, &reportID); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -477,16 +606,36 @@ func (s *ReportService) DeleteReport(reportID, userID, markerID int) error {
 		return fmt.Errorf("deleting photos: %w", err)
 	}
 
+	var report struct {
+		MarkerID  int  `db:"MarkerID"`
+		DoesExist bool `db:"DoesExist"`
+	}
+	if err := tx.Get(&report, getReportForStateQuery, reportID); err != nil {
+		return fmt.Errorf("error fetching report: %w", err)
+	}
+
 	// Then delete the report
 	if _, err := tx.Exec(deleteReportQuery, reportID); err != nil {
 		return fmt.Errorf("error deleting report: %w", err)
 	}
 
+	// a withdrawn "does not exist" report no longer keeps the marker missing
+	var stateChanged bool
+	if !report.DoesExist {
+		if stateChanged, err = settleMissingMarkerTx(tx, report.MarkerID, nil); err != nil {
+			return err
+		}
+	}
+
 	// Commit the transaction
 	if err := tx.Commit(); err != nil {
 		return fmt.Errorf("could not commit transaction: %w", err)
 	}
 
+	if stateChanged {
+		s.States.Changed(report.MarkerID)
+	}
+
 	// Delete photos from S3 in a goroutine
 	go func(photoURLs []string) {
 		for _, photoURL := range photoURLs {
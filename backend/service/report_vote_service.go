@@ -0,0 +1,232 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Alfex4936/chulbong-kr/config"
+	"github.com/Alfex4936/chulbong-kr/dto"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+// Votes on pending reports, for when the marker owner never reviews them
+const (
+	ReportVoteUp   = "up"
+	ReportVoteDown = "down"
+
+	communityApproveReason = "커뮤니티 투표로 승인"
+	communityDenyReason    = "커뮤니티 투표로 반려"
+)
+
+var reportVoteValues = map[string]int{ReportVoteUp: 1, ReportVoteDown: -1}
+
+// ReportVotes(ReportID, UserID, Vote, Weight, CreatedAt) keeps one vote per user on a report, Vote is 1 or -1
+const (
+	getReportForVoteQuery  = "SELECT COALESCE(UserID, 0) AS UserID, Status FROM Reports WHERE ReportID = ?"
+	getVoterCreatedAtQuery = "SELECT CreatedAt FROM Users WHERE UserID = ?"
+
+	upsertReportVoteQuery = `
+INSERT INTO ReportVotes (ReportID, UserID, Vote, Weight, CreatedAt)
+VALUES (?, ?, ?, ?, NOW())
+ON DUPLICATE KEY UPDATE Vote = VALUES(Vote), Weight = VALUES(Weight), CreatedAt = VALUES(CreatedAt)`
+
+	tallyReportVotesQuery = `
+SELECT COALESCE(SUM(CASE WHEN Vote > 0 THEN Weight ELSE 0 END), 0) AS Up,
+	COALESCE(SUM(CASE WHEN Vote < 0 THEN Weight ELSE 0 END), 0) AS Down,
+	COALESCE(SUM(Weight > 0), 0) AS Voters
+FROM ReportVotes
+WHERE ReportID = ?`
+
+	getMyReportVoteQuery = "SELECT COALESCE(MAX(Vote), 0) FROM ReportVotes WHERE ReportID = ? AND UserID = ?"
+	getReportVotersQuery = "SELECT UserID FROM ReportVotes WHERE ReportID = ?"
+	getReportStatusQuery = "SELECT Status FROM Reports WHERE ReportID = ?"
+)
+
+// ReportVoteService lets established users settle the reports a marker's owner leaves pending
+type ReportVoteService struct {
+	DB            *sqlx.DB
+	Config        *config.ReportVoteConfig
+	ReportService *ReportService
+	Logger        *zap.Logger
+}
+
+func NewReportVoteService(db *sqlx.DB, cfg *config.ReportVoteConfig, reports *ReportService, logger *zap.Logger) *ReportVoteService {
+	return &ReportVoteService{
+		DB:            db,
+		Config:        cfg,
+		ReportService: reports,
+		Logger:        logger,
+	}
+}
+
+// CastVote records the user's vote, voting again replaces it, and settles the report once the votes reach the quorum
+func (s *ReportVoteService) CastVote(reportID, userID int, req dto.ReportVoteRequest, now time.Time) (dto.ReportVoteTally, error) {
+	tally := dto.ReportVoteTally{ReportID: reportID, Quorum: s.Config.Quorum}
+
+	vote, ok := reportVoteValues[req.Vote]
+	if !ok {
+		return tally, ErrInvalidReportVote
+	}
+
+	var report struct {
+		UserID int    `db:"UserID"`
+		Status string `db:"Status"`
+	}
+	if err := s.DB.Get(&report, getReportForVoteQuery, reportID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return tally, ErrReportNotFound
+		}
+		return tally, fmt.Errorf("error fetching report %d: %w", reportID, err)
+	}
+	if report.Status != reportStatusPending {
+		return tally, ErrReportNotPending
+	}
+	if report.UserID == userID {
+		return tally, ErrReportOwnVote
+	}
+
+	var createdAt time.Time
+	if err := s.DB.Get(&createdAt, getVoterCreatedAtQuery, userID); err != nil {
+		return tally, fmt.Errorf("error fetching user %d: %w", userID, err)
+	}
+	rep, err := s.ReportService.Reputation.GetReputation(userID, now)
+	if err != nil {
+		return tally, err
+	}
+	if !canVoteOnReport(createdAt, now, rep, s.Config) {
+		return tally, ErrReportVoteNotAllowed
+	}
+
+	if _, err := s.DB.Exec(upsertReportVoteQuery, reportID, userID, vote, reportVoteWeight(rep)); err != nil {
+		return tally, fmt.Errorf("error saving vote on report %d: %w", reportID, err)
+	}
+	if err := s.DB.Get(&tally, tallyReportVotesQuery, reportID); err != nil {
+		return tally, fmt.Errorf("error counting votes on report %d: %w", reportID, err)
+	}
+	tally.MyVote, tally.Status = req.Vote, reportStatusPending
+
+	status := settleReportVote(tally, s.Config)
+	if status == "" {
+		return tally, nil
+	}
+	err = s.ReportService.resolveReportByVote(reportID, status)
+	switch {
+	case err == nil:
+		tally.Status = status
+	case errors.Is(err, ErrReportNotPending):
+		// another vote or a reviewer settled it first
+		s.DB.Get(&tally.Status, getReportStatusQuery, reportID)
+	default:
+		// the vote counts, the next one settles the report
+		s.Logger.Error("Failed to settle report by vote", zap.Int("reportID", reportID), zap.Error(err))
+	}
+	return tally, nil
+}
+
+// GetTally counts the votes on the report, MyVote is the user's when userID isn't 0
+func (s *ReportVoteService) GetTally(reportID, userID int) (dto.ReportVoteTally, error) {
+	tally := dto.ReportVoteTally{ReportID: reportID, Quorum: s.Config.Quorum}
+
+	if err := s.DB.Get(&tally.Status, getReportStatusQuery, reportID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return tally, ErrReportNotFound
+		}
+		return tally, fmt.Errorf("error fetching report %d: %w", reportID, err)
+	}
+	if err := s.DB.Get(&tally, tallyReportVotesQuery, reportID); err != nil {
+		return tally, fmt.Errorf("error counting votes on report %d: %w", reportID, err)
+	}
+
+	if userID != 0 {
+		var vote int
+		if err := s.DB.Get(&vote, getMyReportVoteQuery, reportID, userID); err != nil {
+			return tally, fmt.Errorf("error fetching vote on report %d: %w", reportID, err)
+		}
+		for name, value := range reportVoteValues {
+			if value == vote {
+				tally.MyVote = name
+			}
+		}
+	}
+	return tally, nil
+}
+
+// resolveReportByVote settles a pending report the way the community voted and lets the voters know
+func (s *ReportService) resolveReportByVote(reportID int, status string) error {
+	tx, err := s.DB.Beginx()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBeginTransaction, err)
+	}
+	defer tx.Rollback()
+
+	var markerID int
+	var stateChanged bool
+	reason, event := communityApproveReason, EventReportApproved
+	if status == "APPROVED" {
+		if markerID, _, err = s.approvePendingReportTx(tx, reportID, reason); err != nil {
+			return err
+		}
+	} else {
+		reason, event = communityDenyReason, EventReportDenied
+		res, err := tx.Exec(denyPendingReportQuery, reportID)
+		if err != nil {
+			return fmt.Errorf("error denying report: %w", err)
+		}
+		if count, _ := res.RowsAffected(); count == 0 {
+			return ErrReportNotPending
+		}
+		if _, err := tx.Exec(upsertReportDecisionQuery, reportID, reason, nil); err != nil {
+			return fmt.Errorf("error saving report decision: %w", err)
+		}
+		if markerID, stateChanged, err = reportMarkerTransitionTx(tx, reportID, MarkerEventMissingDenied); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%w: %v", ErrCommitTransaction, err)
+	}
+
+	if status == "APPROVED" {
+		s.UpdateDbLocation(reportID)
+	}
+	if status == "APPROVED" || stateChanged {
+		s.States.Changed(markerID)
+	}
+
+	s.EventBus.Publish(DomainEvent{Name: event, MarkerID: markerID, ReportID: reportID, Text: reason})
+	s.EventBus.Publish(DomainEvent{Name: EventReportVoteResolved, MarkerID: markerID, ReportID: reportID, Text: status})
+	return nil
+}
+
+// canVoteOnReport lets established accounts that contributed vote, throwaway accounts can't.
+// Where the voter says they are isn't checked, any client can claim to be near a marker.
+func canVoteOnReport(createdAt, now time.Time, rep dto.ReporterReputation, cfg *config.ReportVoteConfig) bool {
+	return now.Sub(createdAt) >= cfg.MinAccountAge && rep.Contribution >= cfg.MinContribution
+}
+
+// reportVoteWeight is nothing for users without a reviewed report, up to 2 for reporters who are always right
+func reportVoteWeight(rep dto.ReporterReputation) float64 {
+	if rep.Approved+rep.Denied == 0 {
+		return 0
+	}
+	return 2 * rep.Score
+}
+
+// settleReportVote is APPROVED or DENIED once enough votes are in and one side has the majority, empty otherwise
+func settleReportVote(tally dto.ReportVoteTally, cfg *config.ReportVoteConfig) string {
+	total := tally.Up + tally.Down
+	if tally.Voters < cfg.MinVoters || total < cfg.Quorum || total == 0 {
+		return ""
+	}
+	switch {
+	case tally.Up/total >= cfg.Majority:
+		return "APPROVED"
+	case tally.Down/total >= cfg.Majority:
+		return "DENIED"
+	}
+	return ""
+}
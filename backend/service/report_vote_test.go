@@ -0,0 +1,75 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Alfex4936/chulbong-kr/config"
+	"github.com/Alfex4936/chulbong-kr/dto"
+	"github.com/Alfex4936/chulbong-kr/dto/notification"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReportVote(t *testing.T) {
+	cfg := &config.ReportVoteConfig{
+		Quorum:          5,
+		MinVoters:       3,
+		Majority:        0.7,
+		MinAccountAge:   30 * 24 * time.Hour,
+		MinContribution: 30,
+	}
+
+	t.Run("Settle", func(t *testing.T) {
+		for name, c := range map[string]struct {
+			tally dto.ReportVoteTally
+			want  string
+		}{
+			"Approved":      {dto.ReportVoteTally{Up: 4.5, Down: 1, Voters: 4}, "APPROVED"},
+			"Denied":        {dto.ReportVoteTally{Up: 0.4, Down: 5, Voters: 3}, "DENIED"},
+			"BelowQuorum":   {dto.ReportVoteTally{Up: 4, Voters: 4}, ""},
+			"TooFewVoters":  {dto.ReportVoteTally{Up: 6, Voters: 2}, ""},
+			"NoMajority":    {dto.ReportVoteTally{Up: 3, Down: 2, Voters: 5}, ""},
+			"NobodyVoted":   {dto.ReportVoteTally{}, ""},
+			"ExactMajority": {dto.ReportVoteTally{Up: 7, Down: 3, Voters: 10}, "APPROVED"},
+		} {
+			assert.Equal(t, c.want, settleReportVote(c.tally, cfg), name)
+		}
+	})
+
+	t.Run("Weight", func(t *testing.T) {
+		newcomer := dto.ReporterReputation{Score: reportApprovalRate(0, 0)}
+		assert.Zero(t, reportVoteWeight(newcomer))
+
+		started := dto.ReporterReputation{Approved: 1, Denied: 1, Score: reportApprovalRate(1, 1)}
+		assert.Equal(t, 1.0, reportVoteWeight(started))
+
+		reliable := dto.ReporterReputation{Approved: 48, Score: reportApprovalRate(48, 0)}
+		assert.InDelta(t, 1.96, reportVoteWeight(reliable), 0.001)
+
+		unreliable := dto.ReporterReputation{Denied: 8, Score: reportApprovalRate(0, 8)}
+		assert.Less(t, reportVoteWeight(unreliable), 0.25)
+	})
+
+	t.Run("Eligibility", func(t *testing.T) {
+		now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+		old, fresh := now.AddDate(0, -2, 0), now.AddDate(0, 0, -3)
+
+		assert.True(t, canVoteOnReport(old, now, dto.ReporterReputation{Contribution: 30}, cfg))
+		assert.False(t, canVoteOnReport(fresh, now, dto.ReporterReputation{Contribution: 300}, cfg))
+		assert.False(t, canVoteOnReport(old, now, dto.ReporterReputation{Contribution: 5}, cfg))
+	})
+
+	t.Run("VoterNotification", func(t *testing.T) {
+		n := buildPersonalNotification(DomainEvent{Name: EventReportVoteResolved, MarkerID: 5, ReportID: 9, Text: "DENIED"}, 3, "서울특별시 종로구")
+		assert.Equal(t, 3, n.UserID)
+		assert.Equal(t, NotificationReportVote, n.Type)
+		assert.Contains(t, n.Message, "서울특별시 종로구")
+		assert.Contains(t, n.Message, "반려")
+		assert.Equal(t, "DENIED", n.Metadata.(notification.NotificationReportMetadata).Status)
+
+		n = buildPersonalNotification(DomainEvent{Name: EventReportVoteResolved, MarkerID: 5, ReportID: 9, Text: "APPROVED"}, 3, "")
+		assert.NotContains(t, n.Message, "회원님의")
+		assert.Contains(t, n.Message, "승인")
+		assert.True(t, isPersonalNotification(NotificationReportVote))
+	})
+}
@@ -9,6 +9,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/Alfex4936/chulbong-kr/dto"
 	"github.com/blevesearch/bleve/v2"
 	"github.com/jmoiron/sqlx"
 	"github.com/robfig/cron/v3"
@@ -29,7 +30,11 @@ SELECT PhotoID, PhotoURL FROM ReportPhotos
 LEFT JOIN Reports ON ReportPhotos.ReportID = Reports.ReportID
 WHERE Reports.ReportID IS NULL`
 
-	deleteViewedNotificationsQuery = "DELETE FROM Notifications WHERE Viewed = TRUE AND UpdatedAt < NOW() - INTERVAL ? DAY"
+	// personal notifications read a while ago, archived ones are kept
+	deleteViewedNotificationsQuery = `
+DELETE n FROM Notifications n
+JOIN NotificationStates s ON s.NotificationId = n.NotificationId AND s.UserID = n.UserId
+WHERE s.ReadAt < NOW() - INTERVAL ? DAY AND s.ArchivedAt IS NULL`
 )
 
 type SchedulerService struct {
@@ -43,6 +48,11 @@ type SchedulerService struct {
 	ReportService       *ReportService
 	ChatService         *ChatService
 	BleveSearchService  *BleveSearchService
+	SearchAnalytics     *SearchAnalyticsService
+	SearchIndexService  *SearchIndexService
+	MeetupService       *MeetupService
+	NotificationService *NotificationService
+	WebPushService      *WebPushService
 	cron                *cron.Cron
 	adminEmail          string
 
@@ -57,6 +67,11 @@ func NewSchedulerService(
 	markerService *MarkerManageService, redisService *RedisService,
 	smtpService *SmtpService, reportService *ReportService,
 	bleveService *BleveSearchService,
+	searchAnalytics *SearchAnalyticsService,
+	searchIndex *SearchIndexService,
+	meetupService *MeetupService,
+	notificationService *NotificationService,
+	webPushService *WebPushService,
 
 ) *SchedulerService {
 	// Prepare query parameters
@@ -75,6 +90,11 @@ func NewSchedulerService(
 		ReportService:       reportService,
 		ChatService:         chatService,
 		BleveSearchService:  bleveService,
+		SearchAnalytics:     searchAnalytics,
+		SearchIndexService:  searchIndex,
+		MeetupService:       meetupService,
+		NotificationService: notificationService,
+		WebPushService:      webPushService,
 		cron: cron.New(cron.WithChain(
 			cron.Recover(cron.DefaultLogger),
 		)),
@@ -115,6 +135,13 @@ func (s *SchedulerService) RunAllCrons(logger *zap.Logger) {
 	s.CronDeleteExpiredStories(logger)
 	s.CronDeleteExpiredMessages(logger)
 	s.CronBleveIndexBatch(logger)
+	s.CronPersistSearchAnalytics(logger)
+	s.CronSyncExpiredStoryCaptions(logger)
+	s.CronPruneChatArchive(logger)
+	s.CronSendMeetupReminders(logger)
+	s.CronSendNotificationDigests(logger)
+	s.CronPrunePushSubscriptions(logger)
+	s.CronSendBroadcasts(logger)
 
 	// reports, err := s.ReportService.GetPendingReports()
 	// if err != nil {
@@ -139,6 +166,17 @@ func (s *SchedulerService) Schedule(spec string, cmd func()) (cron.EntryID, erro
 	return s.cron.AddJob(spec, job)
 }
 
+// claimOnce runs a conditional UPDATE that marks a job item as taken, false when nothing matched.
+// Every instance runs the same jobs, only one wins the update, so the item is handled once.
+func claimOnce(db *sqlx.DB, query string, args ...any) (bool, error) {
+	result, err := db.Exec(query, args...)
+	if err != nil {
+		return false, err
+	}
+	claimed, err := result.RowsAffected()
+	return claimed > 0, err
+}
+
 func (s *SchedulerService) CronCleanUpPasswordTokens(logger *zap.Logger) {
 	_, err := s.Schedule("@daily", func() {
 		if err := s.TokenService.DeleteExpiredPasswordTokens(); err != nil {
@@ -183,15 +221,15 @@ func (s *SchedulerService) CronResetClickRanking(logger *zap.Logger) {
 func (s *SchedulerService) CronSendPendingReportsEmail(logger *zap.Logger) {
 	// Convert 12 PM KST to UTC (3 AM UTC)
 	_, err := s.Schedule("0 3 * * *", func() {
-		reports, err := s.ReportService.GetPendingReports()
+		queue, err := s.ReportService.GetReportQueue(dto.ReportQueueFilter{PageSize: 100}, 0, time.Now())
 		if err != nil {
 			// Log the error
 			logger.Error("Error fetching pending reports", zap.Error(err))
 			return
 		}
 
-		if len(reports) > 0 {
-			if err := s.SmtpService.SendPendingReportsEmail(s.adminEmail, reports); err != nil {
+		if len(queue.Reports) > 0 {
+			if err := s.SmtpService.SendPendingReportsEmail(s.adminEmail, queue); err != nil {
 				// Log the error
 				logger.Error("Error sending pending reports email", zap.Error(err))
 			} else {
@@ -206,6 +244,100 @@ func (s *SchedulerService) CronSendPendingReportsEmail(logger *zap.Logger) {
 	}
 }
 
+// CronSendNotificationDigests emails the daily digests every morning and the weekly ones on Mondays
+func (s *SchedulerService) CronSendNotificationDigests(logger *zap.Logger) {
+	// 9 AM KST (0 AM UTC)
+	_, err := s.Schedule("0 0 * * *", func() {
+		now := time.Now()
+		modes := []string{EmailModeDaily}
+		if now.In(kst).Weekday() == time.Monday {
+			modes = append(modes, EmailModeWeekly)
+		}
+
+		for _, mode := range modes {
+			sent, err := s.NotificationService.SendDigests(mode, now)
+			if err != nil {
+				logger.Error("Error sending notification digests", zap.String("mode", mode), zap.Error(err))
+			}
+			if sent > 0 {
+				logger.Info("Notification digests sent", zap.String("mode", mode), zap.Int("count", sent))
+			}
+		}
+	})
+
+	if err != nil {
+		logger.Error("Error scheduling the notification digest job", zap.Error(err))
+		return
+	}
+}
+
+// CronPrunePushSubscriptions deletes the Web Push subscriptions past their expiration time,
+// the ones push services reject are deleted as soon as a push fails
+func (s *SchedulerService) CronPrunePushSubscriptions(logger *zap.Logger) {
+	_, err := s.Schedule("30 4 * * *", func() {
+		pruned, err := s.WebPushService.PruneExpiredSubscriptions()
+		if err != nil {
+			logger.Error("Error pruning push subscriptions", zap.Error(err))
+			return
+		}
+		if pruned > 0 {
+			logger.Info("Expired push subscriptions pruned", zap.Int64("count", pruned))
+		}
+	})
+
+	if err != nil {
+		logger.Error("Error scheduling the push subscription cleanup job", zap.Error(err))
+		return
+	}
+}
+
+// CronSendBroadcasts sends the targeted broadcasts once their scheduled time has come
+func (s *SchedulerService) CronSendBroadcasts(logger *zap.Logger) {
+	_, err := s.Schedule("* * * * *", func() {
+		notified, err := s.NotificationService.SendDueBroadcasts(time.Now())
+		if err != nil {
+			logger.Error("Error sending broadcasts", zap.Error(err))
+		}
+		if notified > 0 {
+			logger.Info("Broadcast notifications sent", zap.Int("count", notified))
+		}
+	})
+
+	if err != nil {
+		logger.Error("Error scheduling the broadcast job", zap.Error(err))
+		return
+	}
+}
+
+// CronPersistSearchAnalytics saves yesterday's search counters into MySQL before Redis expires them.
+func (s *SchedulerService) CronPersistSearchAnalytics(logger *zap.Logger) {
+	_, err := s.Schedule("30 0 * * *", func() {
+		yesterday := time.Now().AddDate(0, 0, -1)
+		if err := s.SearchAnalytics.PersistDay(yesterday); err != nil {
+			logger.Error("Error persisting search analytics", zap.Error(err))
+		}
+	})
+
+	if err != nil {
+		logger.Error("Error scheduling the search analytics job", zap.Error(err))
+		return
+	}
+}
+
+// CronSyncExpiredStoryCaptions removes captions of expired stories from the search index.
+func (s *SchedulerService) CronSyncExpiredStoryCaptions(logger *zap.Logger) {
+	_, err := s.Schedule("5 * * * *", func() {
+		if err := s.SearchIndexService.SyncExpiredStories(time.Now().Add(-time.Hour)); err != nil {
+			logger.Error("Error syncing expired story captions", zap.Error(err))
+		}
+	})
+
+	if err != nil {
+		logger.Error("Error scheduling the story caption sync job", zap.Error(err))
+		return
+	}
+}
+
 func (s *SchedulerService) CronProcessClickEventsBatch(interval time.Duration, logger *zap.Logger) {
 	var spec string
 
@@ -574,6 +706,37 @@ func (s *SchedulerService) CronDeleteExpiredMessages(logger *zap.Logger) {
 	}
 }
 
+func (s *SchedulerService) CronPruneChatArchive(logger *zap.Logger) {
+	_, err := s.Schedule("30 4 * * *", func() { // Runs daily at 4:30 AM
+		deleted, err := s.ChatService.Archive.Prune(time.Now())
+		if err != nil {
+			logger.Error("Error pruning chat archive", zap.Error(err))
+			return
+		}
+		if deleted > 0 {
+			logger.Info("Pruned chat archive", zap.Int64("deleted", deleted))
+		}
+	})
+	if err != nil {
+		logger.Error("Error scheduling the chat archive prune job", zap.Error(err))
+	}
+}
+
+func (s *SchedulerService) CronSendMeetupReminders(logger *zap.Logger) {
+	_, err := s.Schedule("*/5 * * * *", func() { // Runs every 5 minutes
+		sent, err := s.MeetupService.SendReminders(time.Now())
+		if err != nil {
+			logger.Error("Error sending meetup reminders", zap.Error(err))
+		}
+		if sent > 0 {
+			logger.Info("Sent meetup reminders", zap.Int("meetups", sent))
+		}
+	})
+	if err != nil {
+		logger.Error("Error scheduling the meetup reminder job", zap.Error(err))
+	}
+}
+
 func (s *SchedulerService) RefreshBleveAlias(logger *zap.Logger) {
 	// Check if there are pending documents
 	if atomic.LoadUint32(&s.BleveSearchService.pendingDocs) == 0 {
@@ -0,0 +1,318 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Alfex4936/chulbong-kr/dto"
+	"github.com/jmoiron/sqlx"
+	"github.com/redis/rueidis"
+	"go.uber.org/zap"
+)
+
+const (
+	SearchSourceMarker       = "marker"
+	SearchSourceAutoComplete = "autocomplete"
+
+	searchAnalyticsTTL       = 35 * 24 * time.Hour
+	searchAnalyticsMaxDays   = 30
+	searchAnalyticsPositions = 10 // CTR is tracked for the first N positions only
+	searchAnalyticsMaxQuery  = 100
+	searchAnalyticsDayLayout = "20060102"
+
+	// search:analytics:<day>:<kind>
+	searchAnalyticsKey = "search:analytics:%s:%s"
+
+	upsertSearchQueryStatsQuery = `
+INSERT INTO SearchQueryStats (Day, Source, Query, Searches, ZeroResults, Clicks)
+VALUES (?, ?, ?, ?, ?, ?)
+ON DUPLICATE KEY UPDATE Searches = VALUES(Searches), ZeroResults = VALUES(ZeroResults), Clicks = VALUES(Clicks)`
+)
+
+type SearchAnalyticsService struct {
+	DB     *sqlx.DB
+	Redis  *RedisService
+	Logger *zap.Logger
+}
+
+func NewSearchAnalyticsService(db *sqlx.DB, redis *RedisService, logger *zap.Logger) *SearchAnalyticsService {
+	return &SearchAnalyticsService{
+		DB:     db,
+		Redis:  redis,
+		Logger: logger,
+	}
+}
+
+// RecordQuery stores one search request with its result count and latency.
+// Counters are bucketed per day so old data simply expires.
+func (s *SearchAnalyticsService) RecordQuery(source, term string, resultCount int, took time.Duration) {
+	query := normalizeSearchQuery(term)
+	if query == "" {
+		return
+	}
+
+	day := time.Now().Format(searchAnalyticsDayLayout)
+	client := s.Redis.Core.Client
+
+	queriesKey := analyticsKey(day, source+":queries")
+	zeroKey := analyticsKey(day, source+":zero")
+	statsKey := analyticsKey(day, "stats")
+	positionsKey := analyticsKey(day, "positions")
+
+	cmds := make(rueidis.Commands, 0, 12)
+	cmds = append(cmds,
+		client.B().Zincrby().Key(queriesKey).Increment(1).Member(query).Build(),
+		client.B().Hincrby().Key(statsKey).Field(source+":searches").Increment(1).Build(),
+		client.B().Hincrby().Key(statsKey).Field(source+":took_ms").Increment(took.Milliseconds()).Build(),
+		client.B().Expire().Key(queriesKey).Seconds(int64(searchAnalyticsTTL.Seconds())).Build(),
+		client.B().Expire().Key(statsKey).Seconds(int64(searchAnalyticsTTL.Seconds())).Build(),
+	)
+
+	if resultCount == 0 {
+		cmds = append(cmds,
+			client.B().Zincrby().Key(zeroKey).Increment(1).Member(query).Build(),
+			client.B().Hincrby().Key(statsKey).Field(source+":zero").Increment(1).Build(),
+			client.B().Expire().Key(zeroKey).Seconds(int64(searchAnalyticsTTL.Seconds())).Build(),
+		)
+	} else if source == SearchSourceMarker {
+		// Every shown position counts as one impression for CTR by position
+		shown := min(resultCount, searchAnalyticsPositions)
+		for pos := 1; pos <= shown; pos++ {
+			cmds = append(cmds, client.B().Hincrby().Key(positionsKey).Field("imp:"+strconv.Itoa(pos)).Increment(1).Build())
+		}
+		cmds = append(cmds, client.B().Expire().Key(positionsKey).Seconds(int64(searchAnalyticsTTL.Seconds())).Build())
+	}
+
+	for _, resp := range client.DoMulti(context.Background(), cmds...) {
+		if err := resp.Error(); err != nil {
+			s.Logger.Error("Error recording search query", zap.String("query", query), zap.Error(err))
+			return
+		}
+	}
+}
+
+// RecordClick stores which marker was picked from a search result list and at which position (1-based).
+func (s *SearchAnalyticsService) RecordClick(term string, markerID, position int) error {
+	query := normalizeSearchQuery(term)
+	if query == "" || markerID <= 0 || position <= 0 {
+		return ErrInvalidSearchClick
+	}
+
+	day := time.Now().Format(searchAnalyticsDayLayout)
+	client := s.Redis.Core.Client
+
+	queryClicksKey := analyticsKey(day, SearchSourceMarker+":clicks")
+	markerClicksKey := analyticsKey(day, "marker_clicks")
+	statsKey := analyticsKey(day, "stats")
+	positionsKey := analyticsKey(day, "positions")
+
+	cmds := rueidis.Commands{
+		client.B().Zincrby().Key(queryClicksKey).Increment(1).Member(query).Build(),
+		client.B().Zincrby().Key(markerClicksKey).Increment(1).Member(strconv.Itoa(markerID)).Build(),
+		client.B().Hincrby().Key(statsKey).Field(SearchSourceMarker + ":clicks").Increment(1).Build(),
+		client.B().Expire().Key(queryClicksKey).Seconds(int64(searchAnalyticsTTL.Seconds())).Build(),
+		client.B().Expire().Key(markerClicksKey).Seconds(int64(searchAnalyticsTTL.Seconds())).Build(),
+		client.B().Expire().Key(statsKey).Seconds(int64(searchAnalyticsTTL.Seconds())).Build(),
+	}
+	if position <= searchAnalyticsPositions {
+		cmds = append(cmds,
+			client.B().Hincrby().Key(positionsKey).Field("click:"+strconv.Itoa(position)).Increment(1).Build(),
+			client.B().Expire().Key(positionsKey).Seconds(int64(searchAnalyticsTTL.Seconds())).Build(),
+		)
+	}
+
+	for _, resp := range client.DoMulti(context.Background(), cmds...) {
+		if err := resp.Error(); err != nil {
+			return fmt.Errorf("error recording search click: %w", err)
+		}
+	}
+	return nil
+}
+
+// GetReport aggregates the last `days` days of analytics from Redis.
+func (s *SearchAnalyticsService) GetReport(days, limit int) (dto.SearchAnalyticsReport, error) {
+	if days <= 0 {
+		days = 7
+	}
+	days = min(days, searchAnalyticsMaxDays)
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+
+	now := time.Now()
+	dayKeys := make([]string, 0, days)
+	for i := 0; i < days; i++ {
+		dayKeys = append(dayKeys, now.AddDate(0, 0, -i).Format(searchAnalyticsDayLayout))
+	}
+
+	report := dto.SearchAnalyticsReport{
+		From: dayKeys[len(dayKeys)-1],
+		To:   dayKeys[0],
+	}
+
+	ctx := context.Background()
+	client := s.Redis.Core.Client
+
+	// Totals and CTR by position
+	stats := make(map[string]int64)
+	positions := make(map[string]int64)
+	for _, day := range dayKeys {
+		if err := mergeHashCounters(ctx, client, analyticsKey(day, "stats"), stats); err != nil {
+			return report, fmt.Errorf("error fetching search stats: %w", err)
+		}
+		if err := mergeHashCounters(ctx, client, analyticsKey(day, "positions"), positions); err != nil {
+			return report, fmt.Errorf("error fetching search positions: %w", err)
+		}
+	}
+
+	report.TotalSearches = stats[SearchSourceMarker+":searches"]
+	report.ZeroResultSearches = stats[SearchSourceMarker+":zero"]
+	report.TotalClicks = stats[SearchSourceMarker+":clicks"]
+	report.AutoCompleteSearches = stats[SearchSourceAutoComplete+":searches"]
+	if report.TotalSearches > 0 {
+		report.AvgTookMs = float64(stats[SearchSourceMarker+":took_ms"]) / float64(report.TotalSearches)
+	}
+
+	report.PositionCTR = make([]dto.SearchPositionStat, 0, searchAnalyticsPositions)
+	for pos := 1; pos <= searchAnalyticsPositions; pos++ {
+		stat := dto.SearchPositionStat{
+			Position:    pos,
+			Impressions: positions["imp:"+strconv.Itoa(pos)],
+			Clicks:      positions["click:"+strconv.Itoa(pos)],
+		}
+		if stat.Impressions > 0 {
+			stat.CTR = float64(stat.Clicks) / float64(stat.Impressions)
+		}
+		report.PositionCTR = append(report.PositionCTR, stat)
+	}
+
+	// Top and zero-result queries
+	queries, err := s.unionScores(ctx, dayKeys, SearchSourceMarker+":queries")
+	if err != nil {
+		return report, err
+	}
+	clicks, err := s.unionScores(ctx, dayKeys, SearchSourceMarker+":clicks")
+	if err != nil {
+		return report, err
+	}
+	zero, err := s.unionScores(ctx, dayKeys, SearchSourceMarker+":zero")
+	if err != nil {
+		return report, err
+	}
+
+	report.TopQueries = topQueryStats(queries, clicks, limit)
+	report.ZeroResultQueries = topQueryStats(zero, nil, limit)
+
+	return report, nil
+}
+
+// PersistDay copies one day's per-query counters from Redis into MySQL,
+// so the numbers survive after the Redis keys expire.
+func (s *SearchAnalyticsService) PersistDay(day time.Time) error {
+	dayKey := day.Format(searchAnalyticsDayLayout)
+	ctx := context.Background()
+
+	for _, source := range []string{SearchSourceMarker, SearchSourceAutoComplete} {
+		queries, err := s.unionScores(ctx, []string{dayKey}, source+":queries")
+		if err != nil {
+			return err
+		}
+		if len(queries) == 0 {
+			continue
+		}
+		zero, err := s.unionScores(ctx, []string{dayKey}, source+":zero")
+		if err != nil {
+			return err
+		}
+		clicks, err := s.unionScores(ctx, []string{dayKey}, source+":clicks")
+		if err != nil {
+			return err
+		}
+
+		tx, err := s.DB.Beginx()
+		if err != nil {
+			return fmt.Errorf("error starting transaction: %w", err)
+		}
+		for query, searches := range queries {
+			_, err = tx.Exec(upsertSearchQueryStatsQuery, day.Format("2006-01-02"), source, query, searches, zero[query], clicks[query])
+			if err != nil {
+				tx.Rollback()
+				return fmt.Errorf("error saving search stats: %w", err)
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("error committing search stats: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (s *SearchAnalyticsService) unionScores(ctx context.Context, days []string, kind string) (map[string]int64, error) {
+	keys := make([]string, 0, len(days))
+	for _, day := range days {
+		keys = append(keys, analyticsKey(day, kind))
+	}
+
+	client := s.Redis.Core.Client
+	scores, err := client.Do(ctx, client.B().Zunion().Numkeys(int64(len(keys))).Key(keys...).Withscores().Build()).AsZScores()
+	if err != nil && !rueidis.IsRedisNil(err) {
+		return nil, fmt.Errorf("error fetching %s: %w", kind, err)
+	}
+
+	result := make(map[string]int64, len(scores))
+	for _, score := range scores {
+		result[score.Member] = int64(score.Score)
+	}
+	return result, nil
+}
+
+func mergeHashCounters(ctx context.Context, client rueidis.Client, key string, into map[string]int64) error {
+	values, err := client.Do(ctx, client.B().Hgetall().Key(key).Build()).AsStrMap()
+	if err != nil && !rueidis.IsRedisNil(err) {
+		return err
+	}
+	for field, value := range values {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		into[field] += n
+	}
+	return nil
+}
+
+func topQueryStats(counts, clicks map[string]int64, limit int) []dto.SearchQueryStat {
+	stats := make([]dto.SearchQueryStat, 0, len(counts))
+	for query, count := range counts {
+		stats = append(stats, dto.SearchQueryStat{Query: query, Count: count, Clicks: clicks[query]})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Count == stats[j].Count {
+			return stats[i].Query < stats[j].Query
+		}
+		return stats[i].Count > stats[j].Count
+	})
+	if len(stats) > limit {
+		stats = stats[:limit]
+	}
+	return stats
+}
+
+func analyticsKey(day, kind string) string {
+	return fmt.Sprintf(searchAnalyticsKey, day, kind)
+}
+
+// normalizeSearchQuery lowercases and collapses whitespace so "서울  강남" and "서울 강남" count as one query.
+func normalizeSearchQuery(term string) string {
+	query := strings.ToLower(strings.Join(strings.Fields(term), " "))
+	if utf8.RuneCountInString(query) > searchAnalyticsMaxQuery {
+		query = string([]rune(query)[:searchAnalyticsMaxQuery])
+	}
+	return query
+}
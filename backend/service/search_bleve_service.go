@@ -31,10 +31,25 @@ import (
 
 const (
 	Analyzer     = "koCJKEdgeNgram"
-	nearDistance = "2km"
+	nearDistance = "2km" // around a station when no map area is given
+
+	areaBoost = 300.0 // how much markers inside the visible map area are pushed up
+
+	getAllMarkersForIndexQuery = "SELECT MarkerID, Address, ST_X(Location) AS Latitude, ST_Y(Location) AS Longitude, State FROM Markers WHERE State <> 'removed'"
 )
 
 var (
+	// contentFields are searched on top of the address, weighted well below it
+	// so "농구장" still ranks a marker in 농구장길 above one whose comment mentions a basketball court.
+	contentFields = []struct {
+		Name  string
+		Boost float64
+	}{
+		{"description", 120.0},
+		{"captions", 90.0},
+		{"comments", 60.0},
+	}
+
 	// Map of Hangul initial consonant Unicode values to their corresponding Korean consonants.
 	initialConsonantMap = map[rune]rune{
 		0x1100: 'ㄱ', 0x1101: 'ㄲ', 0x1102: 'ㄴ', 0x1103: 'ㄷ', 0x1104: 'ㄸ',
@@ -128,6 +143,9 @@ type BleveSearchService struct {
 	batchPool   []*bleve.Batch
 	batchLock   sync.Mutex
 	pendingDocs uint32
+
+	// synonyms and landmark aliases, swapped atomically on reload
+	dictionary atomic.Pointer[SearchDictionary]
 }
 
 func NewBleveSearchService(
@@ -136,22 +154,29 @@ func NewBleveSearchService(
 	db *sqlx.DB, stationMap map[string]dto.KoreaStation) *BleveSearchService {
 	searchCache := gocache.New[dto.MarkerSearchResponse](localCacheStorage)
 
-	getMarkerStmt, _ := db.Preparex("SELECT MarkerID, Address FROM Markers")
+	getMarkerStmt, _ := db.Preparex(getAllMarkersForIndexQuery)
 	levenshtein.CaseSensitive = false
 	levenshtein.InsertCost = 1
 	levenshtein.ReplaceCost = 2
 	levenshtein.DeleteCost = 1
 
-	return &BleveSearchService{Index: index, Shards: shards,
+	service := &BleveSearchService{Index: index, Shards: shards,
 		searchCache: searchCache, Logger: logger, DB: db,
 		GetAllMarkersStmt: getMarkerStmt, stationMap: stationMap,
 		batchPool: make([]*bleve.Batch, len(shards)),
 	}
+	service.dictionary.Store(&SearchDictionary{})
+
+	return service
 }
 
 func RegisteBleveLifecycle(lifecycle fx.Lifecycle, service *BleveSearchService) {
 	lifecycle.Append(fx.Hook{
 		OnStart: func(context.Context) error {
+			if !service.HasGeoMapping() {
+				// the mapping is stored in the index, re-indexing documents can't add it
+				service.Logger.Error("Bleve index has no geopoint mapping for coordinates, rebuild it with the bleve tool (backend/bleve) for station and area search")
+			}
 			return nil
 		},
 		OnStop: func(context.Context) error {
@@ -161,10 +186,23 @@ func RegisteBleveLifecycle(lifecycle fx.Lifecycle, service *BleveSearchService)
 	})
 }
 
-// SearchMarkerAddress calls bleve (Lucene-like) search
-func (s *BleveSearchService) SearchMarkerAddress(t string) (dto.MarkerSearchResponse, error) {
+// SearchMarkerAddress calls bleve (Lucene-like) search, only markers in one of the states when any are given
+func (s *BleveSearchService) SearchMarkerAddress(t string, states ...string) (dto.MarkerSearchResponse, error) {
+	return s.SearchMarkerAddressInArea(t, nil, states...)
+}
+
+// SearchMarkerAddressInArea is SearchMarkerAddress combined with a map area,
+// which either restricts the results or ranks markers inside it first.
+func (s *BleveSearchService) SearchMarkerAddressInArea(t string, area *dto.GeoFilter, states ...string) (dto.MarkerSearchResponse, error) {
 	// t is already trimmed
 	cacheKey := fmt.Sprintf("search:%s", t)
+	if areaKey := area.CacheKey(); areaKey != "" {
+		cacheKey += ":" + areaKey
+	}
+	if len(states) > 0 {
+		cacheKey += ":state:" + strings.Join(states, ",")
+	}
+	scope := searchScope{area: area, states: states}
 	cachedResponse, err := s.searchCache.Get(context.Background(), cacheKey)
 	if err == nil {
 		return cachedResponse, nil
@@ -194,9 +232,25 @@ func (s *BleveSearchService) SearchMarkerAddress(t string) (dto.MarkerSearchResp
 	resultsChan := make(chan *bleve_search.DocumentMatch, 100)
 	tookTimesChan := make(chan time.Duration, 1)
 
+	dict := s.dictionary.Load()
+
 	// Launch a single goroutine to perform the search
 	go func() {
-		performWholeQuerySearch(s.Index, t, terms, resultsChan, tookTimesChan, s.stationMap)
+		performWholeQuerySearch(s.Index, t, terms, resultsChan, tookTimesChan, s.stationMap, scope)
+
+		// Landmark names etc. are rewritten into addresses from the synonym dictionary
+		for _, expanded := range dict.Expand(t) {
+			expandedTerms := strings.Fields(expanded)
+			expandedTerms[0] = standardizeInitials(expandedTerms[0])
+			performWholeQuerySearch(s.Index, expanded, expandedTerms, resultsChan, tookTimesChan, s.stationMap, scope)
+		}
+
+		if dict.HasAliases() {
+			performAliasSearch(s.Index, t, resultsChan, tookTimesChan, scope)
+		}
+
+		performContentSearch(s.Index, t, terms, resultsChan, tookTimesChan, scope)
+
 		close(resultsChan)
 		close(tookTimesChan)
 	}()
@@ -235,7 +289,7 @@ func (s *BleveSearchService) SearchMarkerAddress(t string) (dto.MarkerSearchResp
 
 	if len(allResults) == 0 { // or if len <= 3?
 		// If no results, try fuzzy search with controlled fuzziness
-		fuzzyResults, fuzzyTook := performFuzzySearch(s.Index, terms)
+		fuzzyResults, fuzzyTook := performFuzzySearch(s.Index, terms, scope)
 		allResults = fuzzyResults
 		totalTook += fuzzyTook
 	}
@@ -297,6 +351,9 @@ func (s *BleveSearchService) InsertMarkerIndex(indexBody MarkerIndexData) error
 	indexBody.FullAddress = indexBody.Address
 	indexBody.Address = rest
 	indexBody.InitialConsonants = ExtractInitialConsonants(indexBody.FullAddress)
+	if indexBody.Aliases == "" {
+		indexBody.Aliases = s.dictionary.Load().AliasesOf(indexBody.MarkerID)
+	}
 
 	batch := s.batchPool[shardIndex]
 	if batch == nil {
@@ -353,6 +410,13 @@ func (s *BleveSearchService) InvalidateCache() {
 	s.searchCache.Clear(context.Background())
 }
 
+// ReloadDictionary swaps the synonym/alias dictionary without restarting the index
+func (s *BleveSearchService) ReloadDictionary(dict *SearchDictionary) {
+	s.dictionary.Store(dict)
+	s.InvalidateCache()
+	s.Logger.Info("Search dictionary reloaded", zap.Int("synonyms", len(dict.Synonyms)), zap.Int("aliases", len(dict.Aliases)))
+}
+
 func (s *BleveSearchService) CheckIndexes() error {
 	// Step 1: Fetch all valid marker IDs from the database along with their addresses
 	markers, err := s.GetAllMarkers()
@@ -364,8 +428,10 @@ func (s *BleveSearchService) CheckIndexes() error {
 	markerDataMap := make(map[int]dto.MarkerIndexData, len(markers))
 	for _, marker := range markers {
 		markerDataMap[marker.MarkerID] = dto.MarkerIndexData{
-			MarkerID: marker.MarkerID,
-			Address:  marker.Address,
+			MarkerID:    marker.MarkerID,
+			Address:     marker.Address,
+			Coordinates: &dto.GeoPoint{Lat: marker.Latitude, Lon: marker.Longitude},
+			State:       marker.State,
 		}
 	}
 
@@ -373,6 +439,10 @@ func (s *BleveSearchService) CheckIndexes() error {
 	query := bleve.NewMatchAllQuery()
 	searchRequest := bleve.NewSearchRequest(query)
 	searchRequest.Size = 10000
+	searchRequest.Fields = []string{"coordinates", "state"}
+
+	// documents indexed before coordinates and states were added, re-indexed in step 5
+	outdated := make(map[int]bool)
 
 	searchResult, err := s.Index.Search(searchRequest)
 	if err != nil {
@@ -387,6 +457,10 @@ func (s *BleveSearchService) CheckIndexes() error {
 			continue
 		}
 
+		if hit.Fields["coordinates"] == nil || hit.Fields["state"] == nil {
+			outdated[markerID] = true
+		}
+
 		// Check if this marker exists in the database
 		if _, existsInDB := markerDataMap[markerID]; !existsInDB {
 			// Step 4: If the MarkerID doesn't exist in the database, delete it from the index
@@ -407,8 +481,8 @@ func (s *BleveSearchService) CheckIndexes() error {
 			continue
 		}
 
-		// If the marker doesn't exist in the index but is in the database, index it
-		if !exists {
+		// If the marker doesn't exist in the index but is in the database, or its document is outdated, index it
+		if !exists || outdated[markerID] {
 			err = s.InsertMarkerIndex(markerData)
 			if err != nil {
 				s.Logger.Error("Failed to index marker", zap.Int("markerID", markerID), zap.Error(err))
@@ -421,6 +495,16 @@ func (s *BleveSearchService) CheckIndexes() error {
 	return nil
 }
 
+// HasGeoMapping tells whether the index maps coordinates as a geopoint, indexes built before it was added don't
+func (s *BleveSearchService) HasGeoMapping() bool {
+	for _, shard := range s.Shards {
+		if shard.Mapping().FieldMappingForPath("coordinates").Type != "geopoint" {
+			return false
+		}
+	}
+	return true
+}
+
 // GetAllMarkers now returns a simplified list of markers
 func (s *BleveSearchService) GetAllMarkers() ([]dto.MarkerOnlyWithAddr, error) {
 	var markers []dto.MarkerOnlyWithAddr
@@ -454,7 +538,7 @@ func (s *BleveSearchService) MarkerExists(markerID int) (bool, error) {
 	return false, nil
 }
 
-func (s *BleveSearchService) SearchMarkersNearLocation(t string) (dto.MarkerSearchResponse, error) {
+func (s *BleveSearchService) SearchMarkersNearLocation(t string, states ...string) (dto.MarkerSearchResponse, error) {
 	// Preprocess the search term
 	s.Logger.Info("Preprocessed search term", zap.String("term", t))
 
@@ -475,8 +559,8 @@ func (s *BleveSearchService) SearchMarkersNearLocation(t string) (dto.MarkerSear
 	geoQuery.SetField("coordinates")
 
 	// Build the search request
-	searchRequest := bleve.NewSearchRequestOptions(geoQuery, 15, 0, false)
-	searchRequest.Fields = []string{"fullAddress", "coordinates"}
+	searchRequest := bleve.NewSearchRequestOptions(withStates(geoQuery, states), 15, 0, false)
+	searchRequest.Fields = []string{"fullAddress", "coordinates", "state"}
 	searchRequest.SortBy([]string{"_score", "markerId"})
 
 	// Perform the search
@@ -677,7 +761,7 @@ func (s *BleveSearchService) IndexAndRefresh(id int, data MarkerIndexData) error
 // 	}
 // }
 
-func performWholeQuerySearch(index bleve.Index, t string, terms []string, results chan<- *bleve_search.DocumentMatch, tookTimes chan<- time.Duration, stationMap map[string]dto.KoreaStation) {
+func performWholeQuerySearch(index bleve.Index, t string, terms []string, results chan<- *bleve_search.DocumentMatch, tookTimes chan<- time.Duration, stationMap map[string]dto.KoreaStation, scope searchScope) {
 	// Pre-process terms to assign them to fields
 	termAssignments := assignTermsToFields(terms)
 
@@ -840,14 +924,14 @@ func performWholeQuerySearch(index bleve.Index, t string, terms []string, result
 	}
 
 	// Build the search request
-	searchRequest := bleve.NewSearchRequestOptions(boolQuery, 15, 0, false)
-	searchRequest.Fields = []string{"fullAddress", "address", "province", "city", "initialConsonants"}
+	searchRequest := bleve.NewSearchRequestOptions(scope.apply(boolQuery), 15, 0, false)
+	searchRequest.Fields = []string{"fullAddress", "address", "province", "city", "initialConsonants", "state"}
 	searchRequest.Size = 15
 	searchRequest.Highlight = bleve.NewHighlightWithStyle("html")
 
 	if isStation {
 		// TODO: Gotta update the main function to know not sort
-		sortGeo, _ := search.NewSortGeoDistance("location", "m", stationLng, stationLat, false)
+		sortGeo, _ := search.NewSortGeoDistance("coordinates", "m", stationLng, stationLat, false)
 		searchRequest.SortByCustom(search.SortOrder{sortGeo})
 	} else {
 		searchRequest.SortBy([]string{"-_score", "markerId"}) // Sort by descending score
@@ -864,6 +948,70 @@ func performWholeQuerySearch(index bleve.Index, t string, terms []string, result
 	}
 }
 
+// performAliasSearch matches the whole term against landmark names attached to markers
+func performAliasSearch(index bleve.Index, t string, results chan<- *bleve_search.DocumentMatch, tookTimes chan<- time.Duration, scope searchScope) {
+	aliasQuery := bleve.NewMatchPhraseQuery(t)
+	aliasQuery.SetField("aliases")
+	aliasQuery.SetBoost(400.0)
+
+	aliasPrefixQuery := bleve.NewPrefixQuery(strings.ToLower(t))
+	aliasPrefixQuery.SetField("aliases")
+	aliasPrefixQuery.SetBoost(200.0)
+
+	searchRequest := bleve.NewSearchRequestOptions(scope.apply(bleve.NewDisjunctionQuery(aliasQuery, aliasPrefixQuery)), 10, 0, false)
+	searchRequest.Fields = []string{"fullAddress", "address", "province", "city", "initialConsonants", "state"}
+	searchRequest.SortBy([]string{"-_score", "markerId"})
+
+	searchResult, err := index.Search(searchRequest)
+	if err != nil {
+		return
+	}
+
+	tookTimes <- searchResult.Took
+	for _, hit := range searchResult.Hits {
+		results <- hit
+	}
+}
+
+// performContentSearch looks for the term in descriptions, comments and story captions
+func performContentSearch(index bleve.Index, t string, terms []string, results chan<- *bleve_search.DocumentMatch, tookTimes chan<- time.Duration, scope searchScope) {
+	queries := make([]query.Query, 0, len(contentFields)*(len(terms)+1))
+	highlightFields := make([]string, 0, len(contentFields))
+
+	for _, field := range contentFields {
+		phraseQuery := bleve.NewMatchPhraseQuery(t)
+		phraseQuery.SetField(field.Name)
+		phraseQuery.SetBoost(field.Boost * 2)
+		queries = append(queries, phraseQuery)
+
+		// Korean particles stick to the word ("농구장에서"), so prefix on each term as well
+		for _, term := range terms {
+			prefixQuery := bleve.NewPrefixQuery(strings.ToLower(term))
+			prefixQuery.SetField(field.Name)
+			prefixQuery.SetBoost(field.Boost)
+			queries = append(queries, prefixQuery)
+		}
+
+		highlightFields = append(highlightFields, field.Name)
+	}
+
+	searchRequest := bleve.NewSearchRequestOptions(scope.apply(bleve.NewDisjunctionQuery(queries...)), 10, 0, false)
+	searchRequest.Fields = []string{"fullAddress", "address", "province", "city", "initialConsonants", "state"}
+	searchRequest.Highlight = bleve.NewHighlightWithStyle("html")
+	searchRequest.Highlight.Fields = highlightFields
+	searchRequest.SortBy([]string{"-_score", "markerId"})
+
+	searchResult, err := index.Search(searchRequest)
+	if err != nil {
+		return
+	}
+
+	tookTimes <- searchResult.Took
+	for _, hit := range searchResult.Hits {
+		results <- hit
+	}
+}
+
 // Perform search with facets
 func performSearchFacet(index bleve.Index, term string, results chan<- *bleve_search.DocumentMatch, tookTimes chan<- time.Duration) {
 	var queries []query.Query
@@ -940,7 +1088,7 @@ func performSearchFacet(index bleve.Index, term string, results chan<- *bleve_se
 	disjunctionQuery := bleve.NewDisjunctionQuery(queries...)
 	searchRequest := bleve.NewSearchRequest(disjunctionQuery)
 	searchRequest.Highlight = bleve.NewHighlightWithStyle("html")
-	searchRequest.Fields = []string{"fullAddress", "address", "province", "city", "initialConsonants"}
+	searchRequest.Fields = []string{"fullAddress", "address", "province", "city", "initialConsonants", "state"}
 	searchRequest.Size = 10
 	searchRequest.SortBy([]string{"_score", "markerId"})
 
@@ -970,15 +1118,15 @@ func performSearchFacet(index bleve.Index, term string, results chan<- *bleve_se
 	}
 }
 
-func performFuzzySearch(index bleve.Index, terms []string) ([]*bleve_search.DocumentMatch, time.Duration) {
+func performFuzzySearch(index bleve.Index, terms []string, scope searchScope) ([]*bleve_search.DocumentMatch, time.Duration) {
 	var allResults []*bleve_search.DocumentMatch
 	var totalTook time.Duration
 
 	for _, term := range terms {
 		fuzzyQuery := bleve.NewFuzzyQuery(term)
 		fuzzyQuery.Fuzziness = 1
-		searchRequest := bleve.NewSearchRequest(fuzzyQuery)
-		searchRequest.Fields = []string{"fullAddress", "address", "province", "city", "initialConsonants"}
+		searchRequest := bleve.NewSearchRequest(scope.apply(fuzzyQuery))
+		searchRequest.Fields = []string{"fullAddress", "address", "province", "city", "initialConsonants", "state"}
 		searchRequest.Size = 10
 		searchRequest.Highlight = bleve.NewHighlightWithStyle("html")
 		searchRequest.SortBy([]string{"-_score", "markerId"})
@@ -994,6 +1142,71 @@ func performFuzzySearch(index bleve.Index, terms []string) ([]*bleve_search.Docu
 	return allResults, totalTook
 }
 
+// newAreaQuery builds a geo query on the coordinates field, nil when no area is given
+func newAreaQuery(area *dto.GeoFilter) query.BoostableQuery {
+	switch {
+	case area.HasBounds():
+		// top-left, bottom-right
+		q := bleve.NewGeoBoundingBoxQuery(area.MinLng, area.MaxLat, area.MaxLng, area.MinLat)
+		q.SetField("coordinates")
+		return q
+	case area.HasRadius():
+		q := bleve.NewGeoDistanceQuery(area.Lng, area.Lat, fmt.Sprintf("%.0fm", area.Radius))
+		q.SetField("coordinates")
+		return q
+	default:
+		return nil
+	}
+}
+
+// withArea keeps the text relevance of q and either restricts it to the area or boosts matches inside it
+func withArea(q query.Query, area *dto.GeoFilter) query.Query {
+	areaQuery := newAreaQuery(area)
+	if areaQuery == nil {
+		return q
+	}
+
+	combined := bleve.NewBooleanQuery()
+	combined.AddMust(q)
+	if area.Restrict {
+		combined.AddMust(areaQuery)
+	} else {
+		areaQuery.SetBoost(areaBoost)
+		combined.AddShould(areaQuery)
+	}
+	return combined
+}
+
+// withStates keeps only matches of q in one of the states, no states keeps them all.
+// The filter is part of the query so it applies before the result limit.
+func withStates(q query.Query, states []string) query.Query {
+	if len(states) == 0 {
+		return q
+	}
+
+	stateQueries := make([]query.Query, 0, len(states))
+	for _, state := range states {
+		stateQuery := bleve.NewTermQuery(state)
+		stateQuery.SetField("state")
+		stateQueries = append(stateQueries, stateQuery)
+	}
+
+	combined := bleve.NewBooleanQuery()
+	combined.AddMust(q)
+	combined.AddMust(bleve.NewDisjunctionQuery(stateQueries...))
+	return combined
+}
+
+// searchScope is the map area and the states every query of a search is limited to
+type searchScope struct {
+	area   *dto.GeoFilter
+	states []string
+}
+
+func (sc searchScope) apply(q query.Query) query.Query {
+	return withStates(withArea(q, sc.area), sc.states)
+}
+
 func extractMarkers(allResults []*bleve_search.DocumentMatch) []dto.ZincMarker {
 	markers := make([]dto.ZincMarker, 0, len(allResults))
 	for _, hit := range allResults {
@@ -1004,10 +1217,21 @@ func extractMarkers(allResults []*bleve_search.DocumentMatch) []dto.ZincMarker {
 		} else {
 			address = hit.Fields["fullAddress"].(string)
 		}
-		markers = append(markers, dto.ZincMarker{
+		state, _ := hit.Fields["state"].(string) // documents indexed before states have none
+		marker := dto.ZincMarker{
 			MarkerID: intID,
 			Address:  address,
-		})
+			State:    state,
+		}
+		// Show why the marker matched when it wasn't its address
+		for _, field := range contentFields {
+			if fragments, ok := hit.Fragments[field.Name]; ok && len(fragments) > 0 && strings.Contains(fragments[0], "<mark>") {
+				marker.MatchedField = field.Name
+				marker.Highlight = fragments[0]
+				break
+			}
+		}
+		markers = append(markers, marker)
 	}
 	return markers
 }
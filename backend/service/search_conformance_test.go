@@ -0,0 +1,332 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Alfex4936/chulbong-kr/config"
+	"github.com/Alfex4936/chulbong-kr/dto"
+	"github.com/blevesearch/bleve/v2"
+	"github.com/dgraph-io/ristretto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	gocache "github.com/eko/gocache/lib/v4/cache"
+	ristretto_store "github.com/eko/gocache/store/ristretto/v4"
+)
+
+var conformanceStations = map[string]dto.KoreaStation{
+	"잠실역": {Name: "잠실역", Latitude: 37.5133, Longitude: 127.1001},
+}
+
+// runMarkerSearcherConformance is the shared suite every MarkerSearcher backend has to pass.
+func runMarkerSearcherConformance(t *testing.T, searcher MarkerSearcher) {
+	flush := func() {
+		if f, ok := searcher.(interface{ FlushAllBatches() error }); ok {
+			require.NoError(t, f.FlushAllBatches())
+		}
+	}
+
+	markers := []dto.MarkerIndexData{
+		{MarkerID: 1, Address: "서울특별시 송파구 방이동 88"},
+		{MarkerID: 2, Address: "경기도 수원시 영통구 매탄동 1234"},
+		{MarkerID: 3, Address: "부산광역시 해운대구 좌동 1395"},
+	}
+	for _, marker := range markers {
+		require.NoError(t, searcher.InsertMarkerIndex(marker))
+	}
+	flush()
+
+	t.Run("Exists", func(t *testing.T) {
+		for _, marker := range markers {
+			exists, err := searcher.MarkerExists(marker.MarkerID)
+			require.NoError(t, err)
+			assert.True(t, exists, "marker %d should be indexed", marker.MarkerID)
+		}
+
+		exists, err := searcher.MarkerExists(9999)
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+
+	t.Run("Search", func(t *testing.T) {
+		response, err := searcher.SearchMarkerAddress("해운대구")
+		require.NoError(t, err)
+		require.NotEmpty(t, response.Markers)
+		assert.Equal(t, 3, response.Markers[0].MarkerID)
+	})
+
+	t.Run("AutoComplete", func(t *testing.T) {
+		suggestions, err := searcher.AutoComplete("경기도")
+		require.NoError(t, err)
+		require.NotEmpty(t, suggestions)
+		assert.Contains(t, suggestions[0], "수원시")
+	})
+
+	t.Run("NearbyUnknownStation", func(t *testing.T) {
+		response, err := searcher.SearchMarkersNearLocation("없는역")
+		require.NoError(t, err)
+		assert.NotNil(t, response.Markers)
+	})
+
+	t.Run("Reindex", func(t *testing.T) {
+		require.NoError(t, searcher.InsertMarkerIndex(dto.MarkerIndexData{MarkerID: 3, Address: "부산광역시 해운대구 좌동 1395", Description: "농구장 옆 철봉"}))
+		flush()
+
+		response, err := searcher.SearchMarkerAddress("해운대구")
+		require.NoError(t, err)
+		require.Len(t, response.Markers, 1)
+		assert.Equal(t, 3, response.Markers[0].MarkerID)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		require.NoError(t, searcher.DeleteMarkerIndex(2))
+		flush()
+
+		exists, err := searcher.MarkerExists(2)
+		require.NoError(t, err)
+		assert.False(t, exists)
+
+		exists, err = searcher.MarkerExists(1)
+		require.NoError(t, err)
+		assert.True(t, exists)
+	})
+}
+
+func TestBleveMarkerSearcherConformance(t *testing.T) {
+	runMarkerSearcherConformance(t, newTestBleveSearchService(t))
+}
+
+func TestBleveSearchMarkerAddressInArea(t *testing.T) {
+	service := newTestBleveSearchService(t)
+
+	markers := []dto.MarkerIndexData{
+		{MarkerID: 1, Address: "서울특별시 송파구 올림픽 공원", Coordinates: &dto.GeoPoint{Lat: 37.5206, Lon: 127.1214}, State: MarkerStateVerified},
+		{MarkerID: 2, Address: "서울특별시 영등포구 여의도 공원", Coordinates: &dto.GeoPoint{Lat: 37.5259, Lon: 126.9226}, State: MarkerStateMissing},
+		{MarkerID: 3, Address: "부산광역시 부산진구 시민 공원", Coordinates: &dto.GeoPoint{Lat: 35.1681, Lon: 129.0573}, State: MarkerStateUnverified},
+	}
+	for _, marker := range markers {
+		require.NoError(t, service.InsertMarkerIndex(marker))
+	}
+	require.NoError(t, service.FlushAllBatches())
+
+	require.True(t, service.HasGeoMapping())
+
+	busan := dto.GeoFilter{MinLat: 35.0, MinLng: 128.8, MaxLat: 35.3, MaxLng: 129.3}
+
+	t.Run("Boost", func(t *testing.T) {
+		response, err := service.SearchMarkerAddressInArea("공원", &busan)
+		require.NoError(t, err)
+		require.Len(t, response.Markers, 3)
+		assert.Equal(t, 3, response.Markers[0].MarkerID)
+	})
+
+	t.Run("Restrict", func(t *testing.T) {
+		restricted := busan
+		restricted.Restrict = true
+		response, err := service.SearchMarkerAddressInArea("공원", &restricted)
+		require.NoError(t, err)
+		require.Len(t, response.Markers, 1)
+		assert.Equal(t, 3, response.Markers[0].MarkerID)
+	})
+
+	t.Run("Radius", func(t *testing.T) {
+		response, err := service.SearchMarkerAddressInArea("공원", &dto.GeoFilter{Lat: 37.5206, Lng: 127.1214, Radius: 3000, Restrict: true})
+		require.NoError(t, err)
+		require.Len(t, response.Markers, 1)
+		assert.Equal(t, 1, response.Markers[0].MarkerID)
+	})
+
+	t.Run("States", func(t *testing.T) {
+		response, err := service.SearchMarkerAddressInArea("공원", &busan, MarkerStateVerified, MarkerStateMissing)
+		require.NoError(t, err)
+		require.Len(t, response.Markers, 2)
+		for _, marker := range response.Markers {
+			assert.NotEqual(t, MarkerStateUnverified, marker.State)
+		}
+	})
+}
+
+func TestBleveSearchMarkerContent(t *testing.T) {
+	service := newTestBleveSearchService(t)
+
+	markers := []dto.MarkerIndexData{
+		{MarkerID: 1, Address: "서울특별시 송파구 방이동 88", Description: "농구장 옆에 있는 철봉"},
+		{MarkerID: 2, Address: "경기도 수원시 영통구 매탄동 1234", Comments: "평행봉도 있어요\n밤에는 조명이 없어요"},
+		{MarkerID: 3, Address: "부산광역시 해운대구 좌동 1395", Captions: "오늘 턱걸이 20개 성공"},
+	}
+	for _, marker := range markers {
+		require.NoError(t, service.InsertMarkerIndex(marker))
+	}
+	require.NoError(t, service.FlushAllBatches())
+
+	tests := []struct {
+		term     string
+		markerID int
+		field    string
+	}{
+		{"농구장", 1, "description"},
+		{"평행봉", 2, "comments"},
+		{"턱걸이", 3, "captions"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			response, err := service.SearchMarkerAddress(tt.term)
+			require.NoError(t, err)
+			require.NotEmpty(t, response.Markers)
+			assert.Equal(t, tt.markerID, response.Markers[0].MarkerID)
+			assert.Equal(t, tt.field, response.Markers[0].MatchedField)
+			assert.Contains(t, response.Markers[0].Highlight, "<mark>"+tt.term)
+		})
+	}
+
+	t.Run("AddressFirst", func(t *testing.T) {
+		response, err := service.SearchMarkerAddress("송파구")
+		require.NoError(t, err)
+		require.NotEmpty(t, response.Markers)
+		assert.Equal(t, 1, response.Markers[0].MarkerID)
+		assert.Empty(t, response.Markers[0].MatchedField)
+	})
+}
+
+func TestZincMarkerSearcherConformance(t *testing.T) {
+	server := httptest.NewServer(newFakeZincServer())
+	defer server.Close()
+
+	zinc := NewZincSearchService(&config.ZincSearchConfig{ZincAPI: server.URL}, server.Client(), conformanceStations)
+	runMarkerSearcherConformance(t, zinc)
+}
+
+func TestNewMarkerSearcher(t *testing.T) {
+	bleveService := &BleveSearchService{}
+	zincService := &ZincSearchService{}
+
+	searcher, err := NewMarkerSearcher(&config.SearchConfig{Backend: config.SearchBackendBleve}, bleveService, zincService)
+	require.NoError(t, err)
+	assert.Same(t, bleveService, searcher)
+
+	searcher, err = NewMarkerSearcher(&config.SearchConfig{Backend: config.SearchBackendZinc}, bleveService, zincService)
+	require.NoError(t, err)
+	assert.Same(t, zincService, searcher)
+
+	_, err = NewMarkerSearcher(&config.SearchConfig{Backend: "elastic"}, bleveService, zincService)
+	assert.Error(t, err)
+}
+
+func newTestBleveSearchService(t *testing.T) *BleveSearchService {
+	t.Helper()
+
+	shards := make([]bleve.Index, 0, 3)
+	alias := bleve.NewIndexAlias()
+	indexMapping := bleve.NewIndexMapping()
+	indexMapping.DefaultMapping.AddFieldMappingsAt("coordinates", bleve.NewGeoPointFieldMapping())
+	stateFieldMapping := bleve.NewKeywordFieldMapping()
+	stateFieldMapping.Store = true
+	indexMapping.DefaultMapping.AddFieldMappingsAt("state", stateFieldMapping)
+
+	for i := 0; i < 3; i++ {
+		shard, err := bleve.NewMemOnly(indexMapping)
+		require.NoError(t, err)
+		t.Cleanup(func() { shard.Close() })
+		shards = append(shards, shard)
+		alias.Add(shard)
+	}
+
+	cache, err := ristretto.NewCache(&ristretto.Config{NumCounters: 1e4, MaxCost: 1 << 20, BufferItems: 64})
+	require.NoError(t, err)
+
+	service := &BleveSearchService{
+		Index:       alias,
+		Shards:      shards,
+		Logger:      zap.NewNop(),
+		searchCache: gocache.New[dto.MarkerSearchResponse](ristretto_store.NewRistretto(cache)),
+		stationMap:  conformanceStations,
+		batchPool:   make([]*bleve.Batch, len(shards)),
+	}
+	service.dictionary.Store(&SearchDictionary{})
+	return service
+}
+
+// fakeZincServer is a tiny in-memory stand-in for the zincsearch document and search API.
+type fakeZincServer struct {
+	mu     sync.Mutex
+	nextID int
+	docs   map[string]dto.MarkerIndexData
+}
+
+func newFakeZincServer() *fakeZincServer {
+	return &fakeZincServer{docs: make(map[string]dto.MarkerIndexData)}
+}
+
+func (z *fakeZincServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/api/markers/_doc":
+		var doc dto.MarkerIndexData
+		if err := json.NewDecoder(r.Body).Decode(&doc); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		z.nextID++
+		z.docs["doc"+strconv.Itoa(z.nextID)] = doc
+		w.Write([]byte(`{"message":"ok"}`))
+
+	case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/api/markers/_doc/"):
+		var doc dto.MarkerIndexData
+		if err := json.NewDecoder(r.Body).Decode(&doc); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		z.docs[strings.TrimPrefix(r.URL.Path, "/api/markers/_doc/")] = doc
+		w.Write([]byte(`{"message":"ok"}`))
+
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/api/markers/_doc/"):
+		delete(z.docs, strings.TrimPrefix(r.URL.Path, "/api/markers/_doc/"))
+		w.Write([]byte(`{"message":"deleted"}`))
+
+	case r.Method == http.MethodPost && r.URL.Path == "/api/markers/_search":
+		var req struct {
+			SearchType string `json:"search_type"`
+			Query      struct {
+				Term  string `json:"term"`
+				Field string `json:"field"`
+			} `json:"query"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		hits := make([]dto.HitDetail, 0)
+		for id, doc := range z.docs {
+			var match bool
+			switch req.SearchType {
+			case "match": // only used for markerId lookups
+				match = strconv.Itoa(doc.MarkerID) == req.Query.Term
+			case "prefix":
+				match = strings.HasPrefix(doc.Address, req.Query.Term)
+			default:
+				match = strings.Contains(doc.Address, req.Query.Term)
+			}
+			if match {
+				hits = append(hits, dto.HitDetail{ID: id, Source: dto.ZincMarker{MarkerID: doc.MarkerID, Address: doc.Address}})
+			}
+		}
+
+		resp := dto.ElasticsearchResponse{Took: 1}
+		resp.Hits.Total.Value = len(hits)
+		resp.Hits.Hits = hits
+		json.NewEncoder(w).Encode(resp)
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Alfex4936/chulbong-kr/dto"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+const (
+	maxIndexedComments = 50 // newest ones win, a marker with hundreds of comments shouldn't dominate results
+
+	// removed markers come back as no rows, so syncing them drops their document
+	getMarkerForIndexQuery = `
+SELECT MarkerID, Address, ST_X(Location) AS Latitude, ST_Y(Location) AS Longitude, COALESCE(Description, '') AS Description, State
+FROM Markers
+WHERE MarkerID = ? AND State <> 'removed'`
+
+	getCommentsForIndexQuery = `
+SELECT CommentText
+FROM Comments
+WHERE MarkerID = ? AND DeletedAt IS NULL
+ORDER BY PostedAt DESC
+LIMIT ?`
+
+	getCaptionsForIndexQuery = "SELECT Caption FROM Stories WHERE MarkerID = ? AND ExpiresAt > ? AND Caption <> ''"
+
+	getMarkersWithExpiredStoriesQuery = "SELECT DISTINCT MarkerID FROM Stories WHERE ExpiresAt BETWEEN ? AND ?"
+)
+
+// SearchIndexService keeps the search documents of markers in sync with what users write about them.
+type SearchIndexService struct {
+	DB             *sqlx.DB
+	MarkerSearcher MarkerSearcher
+	Logger         *zap.Logger
+}
+
+func NewSearchIndexService(db *sqlx.DB, searcher MarkerSearcher, logger *zap.Logger) *SearchIndexService {
+	return &SearchIndexService{
+		DB:             db,
+		MarkerSearcher: searcher,
+		Logger:         logger,
+	}
+}
+
+type markerIndexRow struct {
+	MarkerID    int            `db:"MarkerID"`
+	Address     sql.NullString `db:"Address"`
+	Latitude    float64        `db:"Latitude"`
+	Longitude   float64        `db:"Longitude"`
+	Description string         `db:"Description"`
+	State       string         `db:"State"`
+}
+
+// GetMarkerIndexData loads the address, description, comments and active captions of a marker
+func (s *SearchIndexService) GetMarkerIndexData(markerID int) (dto.MarkerIndexData, error) {
+	var marker markerIndexRow
+	if err := s.DB.Get(&marker, getMarkerForIndexQuery, markerID); err != nil {
+		return dto.MarkerIndexData{}, err
+	}
+
+	var comments []string
+	if err := s.DB.Select(&comments, getCommentsForIndexQuery, markerID, maxIndexedComments); err != nil {
+		return dto.MarkerIndexData{}, fmt.Errorf("error fetching comments: %w", err)
+	}
+
+	var captions []string
+	if err := s.DB.Select(&captions, getCaptionsForIndexQuery, markerID, time.Now()); err != nil {
+		return dto.MarkerIndexData{}, fmt.Errorf("error fetching story captions: %w", err)
+	}
+
+	return dto.MarkerIndexData{
+		MarkerID:    marker.MarkerID,
+		Address:     marker.Address.String,
+		Coordinates: &dto.GeoPoint{Lat: marker.Latitude, Lon: marker.Longitude},
+		Description: marker.Description,
+		Comments:    strings.Join(comments, "\n"),
+		Captions:    strings.Join(captions, "\n"),
+		State:       marker.State,
+	}, nil
+}
+
+// SyncMarker re-indexes a marker after its description, comments, stories or state changed.
+func (s *SearchIndexService) SyncMarker(markerID int) error {
+	indexData, err := s.GetMarkerIndexData(markerID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return s.MarkerSearcher.DeleteMarkerIndex(markerID)
+	}
+	if err != nil {
+		return err
+	}
+
+	if indexData.Address == "" {
+		// address is still being fetched, CreateMarkerWithPhotos indexes it once it's there
+		return nil
+	}
+
+	if err := s.MarkerSearcher.InsertMarkerIndex(indexData); err != nil {
+		return err
+	}
+
+	// bleve batches writes, flush so the change is searchable right away
+	if flusher, ok := s.MarkerSearcher.(interface{ FlushAllBatches() error }); ok {
+		return flusher.FlushAllBatches()
+	}
+	return nil
+}
+
+// SyncMarkerAsync is SyncMarker for request handlers that shouldn't wait on the index
+func (s *SearchIndexService) SyncMarkerAsync(markerID int) {
+	go func() {
+		if err := s.SyncMarker(markerID); err != nil {
+			s.Logger.Error("Failed to sync marker search index", zap.Int("markerID", markerID), zap.Error(err))
+		}
+	}()
+}
+
+// SyncExpiredStories drops captions of stories that expired since the given time
+func (s *SearchIndexService) SyncExpiredStories(since time.Time) error {
+	var markerIDs []int
+	if err := s.DB.Select(&markerIDs, getMarkersWithExpiredStoriesQuery, since, time.Now()); err != nil {
+		return fmt.Errorf("error fetching markers with expired stories: %w", err)
+	}
+
+	for _, markerID := range markerIDs {
+		if err := s.SyncMarker(markerID); err != nil {
+			s.Logger.Error("Failed to sync marker search index", zap.Int("markerID", markerID), zap.Error(err))
+		}
+	}
+	return nil
+}
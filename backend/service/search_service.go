@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/Alfex4936/chulbong-kr/config"
@@ -14,15 +15,52 @@ import (
 	sonic "github.com/bytedance/sonic"
 )
 
+// MarkerSearcher is implemented by every marker search backend (bleve, zincsearch)
+type MarkerSearcher interface {
+	// states limit the hits to markers in one of them, none means every state
+	SearchMarkerAddress(term string, states ...string) (dto.MarkerSearchResponse, error)
+	AutoComplete(term string) ([]string, error)
+	SearchMarkersNearLocation(term string, states ...string) (dto.MarkerSearchResponse, error)
+	InsertMarkerIndex(indexBody dto.MarkerIndexData) error
+	DeleteMarkerIndex(markerID int) error
+	MarkerExists(markerID int) (bool, error)
+}
+
+// AreaMarkerSearcher is implemented by backends that can combine text search with a map area (bleve only)
+type AreaMarkerSearcher interface {
+	SearchMarkerAddressInArea(term string, area *dto.GeoFilter, states ...string) (dto.MarkerSearchResponse, error)
+}
+
+var (
+	_ MarkerSearcher     = (*BleveSearchService)(nil)
+	_ MarkerSearcher     = (*ZincSearchService)(nil)
+	_ AreaMarkerSearcher = (*BleveSearchService)(nil)
+)
+
+// NewMarkerSearcher picks the search backend from config
+func NewMarkerSearcher(searchConfig *config.SearchConfig, bleve *BleveSearchService, zinc *ZincSearchService) (MarkerSearcher, error) {
+	switch searchConfig.Backend {
+	case config.SearchBackendBleve:
+		return bleve, nil
+	case config.SearchBackendZinc:
+		return zinc, nil
+	default:
+		return nil, fmt.Errorf("unknown search backend: %q", searchConfig.Backend)
+	}
+}
+
 type ZincSearchService struct {
 	ZincConfig *config.ZincSearchConfig
 	HTTPClient *http.Client
+
+	stationMap map[string]dto.KoreaStation
 }
 
-func NewZincSearchService(zconfig *config.ZincSearchConfig, httpClient *http.Client) *ZincSearchService {
+func NewZincSearchService(zconfig *config.ZincSearchConfig, httpClient *http.Client, stationMap map[string]dto.KoreaStation) *ZincSearchService {
 	return &ZincSearchService{
 		ZincConfig: zconfig,
 		HTTPClient: httpClient,
+		stationMap: stationMap,
 	}
 }
 
@@ -34,9 +72,13 @@ type (
 )
 
 // SearchMarkerAddress calls ZincSearch (ElasticSearch-like) client.
-func (s *ZincSearchService) SearchMarkerAddress(term string) (dto.MarkerSearchResponse, error) {
+func (s *ZincSearchService) SearchMarkerAddress(term string, states ...string) (dto.MarkerSearchResponse, error) {
 	var apiResponse MarkerSearchResponse
 
+	if len(states) > 0 {
+		return s.searchMarkerAddressInStates(term, states)
+	}
+
 	body := FuzzMarkerSearch{
 		SearchType:   "fuzzy",
 		Query:        dto.Query{Term: term},
@@ -76,7 +118,68 @@ func (s *ZincSearchService) SearchMarkerAddress(term string) (dto.MarkerSearchRe
 	return customResp, nil
 }
 
-// not bulk action
+// searchMarkerAddressInStates is the fuzzy search with a state filter, which only the
+// Elasticsearch compatible API can combine, so the filter applies before max results
+func (s *ZincSearchService) searchMarkerAddressInStates(term string, states []string) (dto.MarkerSearchResponse, error) {
+	body, err := sonic.MarshalString(map[string]any{
+		"query": map[string]any{
+			"bool": map[string]any{
+				"must":   []any{map[string]any{"match": map[string]any{"_all": map[string]any{"query": term, "fuzziness": "AUTO"}}}},
+				"filter": []any{map[string]any{"terms": map[string]any{"state": states}}},
+			},
+		},
+		"from": 0,
+		"size": 10,
+	})
+	if err != nil {
+		return dto.MarkerSearchResponse{}, err
+	}
+
+	zincResp, err := s.searchAt(fmt.Sprintf("%s/es/markers/_search", s.ZincConfig.ZincAPI), body)
+	if err != nil {
+		return dto.MarkerSearchResponse{}, fmt.Errorf("error performing state search: %w", err)
+	}
+	return MarkerSearchResponse{
+		Took:    zincResp.Took,
+		Markers: convertToMarkers(zincResp.Hits.Hits),
+	}, nil
+}
+
+// AutoComplete returns up to 10 addresses starting with the term
+func (s *ZincSearchService) AutoComplete(term string) ([]string, error) {
+	body, err := sonic.MarshalString(map[string]any{
+		"search_type": "prefix",
+		"query":       map[string]string{"term": term, "field": "address"},
+		"from":        0,
+		"max_results": 10,
+		"_source":     []string{},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	zincResp, err := s.search(body)
+	if err != nil {
+		return nil, fmt.Errorf("error performing autocomplete search: %w", err)
+	}
+
+	suggestions := make([]string, 0, len(zincResp.Hits.Hits))
+	for _, hit := range zincResp.Hits.Hits {
+		suggestions = append(suggestions, hit.Source.Address)
+	}
+	return suggestions, nil
+}
+
+// SearchMarkersNearLocation has no geo query in zincsearch,
+// so it falls back to an address search around the station name (ex. "영통역" -> "영통").
+func (s *ZincSearchService) SearchMarkersNearLocation(t string, states ...string) (dto.MarkerSearchResponse, error) {
+	if _, ok := s.stationMap[t]; !ok {
+		return dto.MarkerSearchResponse{Markers: make([]dto.ZincMarker, 0)}, nil
+	}
+	return s.SearchMarkerAddress(strings.TrimSuffix(t, "역"), states...)
+}
+
+// not bulk action, replaces the document if the marker is already indexed
 func (s *ZincSearchService) InsertMarkerIndex(indexBody MarkerIndexData) error {
 	// Marshal the value to JSON
 	jsonByte, err := sonic.Marshal(indexBody)
@@ -84,8 +187,16 @@ func (s *ZincSearchService) InsertMarkerIndex(indexBody MarkerIndexData) error {
 		return err
 	}
 
-	reqURL := fmt.Sprintf("%s/api/markers/_doc", s.ZincConfig.ZincAPI)
-	resp, err := s.sendRequest(http.MethodPost, reqURL, bytes.NewBuffer(jsonByte))
+	markerIndexID, err := s.getMarkerIndexID(strconv.Itoa(indexBody.MarkerID))
+	if err != nil {
+		return fmt.Errorf("getting marker index ID: %w", err)
+	}
+
+	method, reqURL := http.MethodPost, fmt.Sprintf("%s/api/markers/_doc", s.ZincConfig.ZincAPI)
+	if markerIndexID != "" {
+		method, reqURL = http.MethodPut, fmt.Sprintf("%s/api/markers/_doc/%s", s.ZincConfig.ZincAPI, markerIndexID)
+	}
+	resp, err := s.sendRequest(method, reqURL, bytes.NewBuffer(jsonByte))
 	if err != nil {
 		return fmt.Errorf("creating request: %w", err)
 	}
@@ -98,11 +209,11 @@ func (s *ZincSearchService) InsertMarkerIndex(indexBody MarkerIndexData) error {
 	return nil
 }
 
-func (s *ZincSearchService) DeleteMarkerIndex(markerID string) error {
-	if markerID == "" {
+func (s *ZincSearchService) DeleteMarkerIndex(markerID int) error {
+	if markerID <= 0 {
 		return fmt.Errorf("missing marker id")
 	}
-	markerIndexID, err := s.getMarkerIndexID(markerID)
+	markerIndexID, err := s.getMarkerIndexID(strconv.Itoa(markerID))
 	if err != nil {
 		return fmt.Errorf("getting marker index ID: %w", err)
 	}
@@ -113,6 +224,14 @@ func (s *ZincSearchService) DeleteMarkerIndex(markerID string) error {
 	return s.deleteDocument(markerIndexID)
 }
 
+func (s *ZincSearchService) MarkerExists(markerID int) (bool, error) {
+	markerIndexID, err := s.getMarkerIndexID(strconv.Itoa(markerID))
+	if err != nil {
+		return false, fmt.Errorf("getting marker index ID: %w", err)
+	}
+	return markerIndexID != "", nil
+}
+
 func (s *ZincSearchService) getMarkerIndexID(markerID string) (string, error) {
 	query := fmt.Sprintf(`
 	{
@@ -127,27 +246,40 @@ func (s *ZincSearchService) getMarkerIndexID(markerID string) (string, error) {
 		"_source": []
 	}`, markerID)
 
-	reqURL := fmt.Sprintf("%s/api/markers/_search", s.ZincConfig.ZincAPI)
-	resp, err := s.sendRequest(http.MethodPost, reqURL, strings.NewReader(query))
+	zincResp, err := s.search(query)
 	if err != nil {
 		return "", fmt.Errorf("searching for marker index: %w", err)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("search response status code: %d", resp.StatusCode)
+	if zincResp.Hits.Total.Value == 0 || len(zincResp.Hits.Hits) == 0 {
+		return "", nil // No result found
 	}
 
+	return zincResp.Hits.Hits[0].ID, nil
+}
+
+func (s *ZincSearchService) search(query string) (ElasticsearchResponse, error) {
+	return s.searchAt(fmt.Sprintf("%s/api/markers/_search", s.ZincConfig.ZincAPI), query)
+}
+
+// searchAt posts the query to a search endpoint, both the zinc and the Elasticsearch compatible API answer in the same shape
+func (s *ZincSearchService) searchAt(reqURL, query string) (ElasticsearchResponse, error) {
 	var zincResp ElasticsearchResponse
-	if err := json.NewDecoder(resp.Body).Decode(&zincResp); err != nil {
-		return "", fmt.Errorf("decoding response: %w", err)
+
+	resp, err := s.sendRequest(http.MethodPost, reqURL, strings.NewReader(query))
+	if err != nil {
+		return zincResp, err
 	}
+	defer resp.Body.Close()
 
-	if zincResp.Hits.Total.Value == 0 {
-		return "", nil // No result found
+	if resp.StatusCode != http.StatusOK {
+		return zincResp, fmt.Errorf("search response status code: %d", resp.StatusCode)
 	}
 
-	return zincResp.Hits.Hits[0].ID, nil
+	if err := json.NewDecoder(resp.Body).Decode(&zincResp); err != nil {
+		return zincResp, fmt.Errorf("decoding response: %w", err)
+	}
+	return zincResp, nil
 }
 
 func (s *ZincSearchService) deleteDocument(docID string) error {
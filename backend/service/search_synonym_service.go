@@ -0,0 +1,276 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Alfex4936/chulbong-kr/dto"
+	"github.com/jmoiron/sqlx"
+	"github.com/redis/rueidis"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+const (
+	// the message is "reload", or the id of a marker whose aliases changed and that every instance re-indexes
+	SearchDictionaryReloadChannel = "search:dictionary:reload"
+
+	maxSynonymExpansions = 3
+
+	getAllSearchSynonymsQuery = "SELECT SynonymID, Term, Synonym FROM SearchSynonyms ORDER BY Term"
+	insertSearchSynonymQuery  = "INSERT INTO SearchSynonyms (Term, Synonym) VALUES (?, ?)"
+	deleteSearchSynonymQuery  = "DELETE FROM SearchSynonyms WHERE SynonymID = ?"
+
+	getAllMarkerAliasesQuery = "SELECT AliasID, MarkerID, Alias FROM MarkerAliases ORDER BY MarkerID"
+	insertMarkerAliasQuery   = "INSERT INTO MarkerAliases (MarkerID, Alias) VALUES (?, ?)"
+	getMarkerAliasQuery      = "SELECT AliasID, MarkerID, Alias FROM MarkerAliases WHERE AliasID = ?"
+	deleteMarkerAliasQuery   = "DELETE FROM MarkerAliases WHERE AliasID = ?"
+)
+
+// SearchDictionary is an immutable snapshot of the admin-managed synonyms and landmark aliases.
+type SearchDictionary struct {
+	Synonyms map[string][]string // term -> address-like expansions (ex. "올림픽공원" -> "서울 송파구 방이동")
+	Aliases  map[int][]string    // markerID -> landmark names
+}
+
+// Expand returns alternative queries for t, either for the whole term or by replacing single words.
+func (d *SearchDictionary) Expand(t string) []string {
+	if d == nil || len(d.Synonyms) == 0 {
+		return nil
+	}
+
+	key := strings.ToLower(strings.TrimSpace(t))
+	expanded := make([]string, 0, maxSynonymExpansions)
+	expanded = append(expanded, d.Synonyms[key]...)
+
+	words := strings.Fields(key)
+	if len(words) > 1 {
+		for i, word := range words {
+			for _, synonym := range d.Synonyms[word] {
+				replaced := make([]string, len(words))
+				copy(replaced, words)
+				replaced[i] = synonym
+				expanded = append(expanded, strings.Join(replaced, " "))
+			}
+		}
+	}
+
+	if len(expanded) > maxSynonymExpansions {
+		expanded = expanded[:maxSynonymExpansions]
+	}
+	return expanded
+}
+
+// AliasesOf returns the landmark names of a marker joined for indexing.
+func (d *SearchDictionary) AliasesOf(markerID int) string {
+	if d == nil {
+		return ""
+	}
+	return strings.Join(d.Aliases[markerID], " ")
+}
+
+func (d *SearchDictionary) HasAliases() bool {
+	return d != nil && len(d.Aliases) > 0
+}
+
+type SearchSynonymService struct {
+	DB                 *sqlx.DB
+	Redis              *RedisService
+	BleveSearchService *BleveSearchService
+	SearchIndexService *SearchIndexService
+	Logger             *zap.Logger
+
+	cancelSubscription func()
+}
+
+func NewSearchSynonymService(db *sqlx.DB, redis *RedisService, bleve *BleveSearchService, searchIndex *SearchIndexService, logger *zap.Logger) *SearchSynonymService {
+	return &SearchSynonymService{
+		DB:                 db,
+		Redis:              redis,
+		BleveSearchService: bleve,
+		SearchIndexService: searchIndex,
+		Logger:             logger,
+	}
+}
+
+func RegisterSearchSynonymLifecycle(lifecycle fx.Lifecycle, service *SearchSynonymService) {
+	lifecycle.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			if err := service.Reload(); err != nil {
+				service.Logger.Error("Failed to load search dictionary", zap.Error(err))
+			}
+			return service.SubscribeReload()
+		},
+		OnStop: func(context.Context) error {
+			if service.cancelSubscription != nil {
+				service.cancelSubscription()
+			}
+			return nil
+		},
+	})
+}
+
+// Reload reads the whole dictionary from the database and swaps it into bleve.
+func (s *SearchSynonymService) Reload() error {
+	var synonyms []dto.SearchSynonym
+	if err := s.DB.Select(&synonyms, getAllSearchSynonymsQuery); err != nil {
+		return fmt.Errorf("error fetching synonyms: %w", err)
+	}
+
+	var aliases []dto.MarkerAlias
+	if err := s.DB.Select(&aliases, getAllMarkerAliasesQuery); err != nil {
+		return fmt.Errorf("error fetching marker aliases: %w", err)
+	}
+
+	dict := &SearchDictionary{
+		Synonyms: make(map[string][]string, len(synonyms)),
+		Aliases:  make(map[int][]string, len(aliases)),
+	}
+	for _, synonym := range synonyms {
+		term := strings.ToLower(synonym.Term)
+		dict.Synonyms[term] = append(dict.Synonyms[term], synonym.Synonym)
+	}
+	for _, alias := range aliases {
+		dict.Aliases[alias.MarkerID] = append(dict.Aliases[alias.MarkerID], alias.Alias)
+	}
+
+	s.BleveSearchService.ReloadDictionary(dict)
+	return nil
+}
+
+// SubscribeReload listens for reload events so every instance picks up admin edits.
+func (s *SearchSynonymService) SubscribeReload() error {
+	dedicatedClient, cancel := s.Redis.Core.Client.Dedicate()
+
+	dedicatedClient.SetPubSubHooks(rueidis.PubSubHooks{
+		OnMessage: func(m rueidis.PubSubMessage) {
+			if err := s.handleReload(m.Message); err != nil {
+				s.Logger.Error("Failed to reload search dictionary", zap.String("message", m.Message), zap.Error(err))
+			}
+		},
+	})
+
+	if err := dedicatedClient.Do(context.Background(), dedicatedClient.B().Subscribe().Channel(SearchDictionaryReloadChannel).Build()).Error(); err != nil {
+		cancel()
+		return fmt.Errorf("error subscribing to dictionary reload: %w", err)
+	}
+
+	s.cancelSubscription = cancel
+	return nil
+}
+
+func (s *SearchSynonymService) GetDictionary() (dto.SearchDictionaryResponse, error) {
+	response := dto.SearchDictionaryResponse{
+		Synonyms: make([]dto.SearchSynonym, 0),
+		Aliases:  make([]dto.MarkerAlias, 0),
+	}
+	if err := s.DB.Select(&response.Synonyms, getAllSearchSynonymsQuery); err != nil {
+		return response, fmt.Errorf("error fetching synonyms: %w", err)
+	}
+	if err := s.DB.Select(&response.Aliases, getAllMarkerAliasesQuery); err != nil {
+		return response, fmt.Errorf("error fetching marker aliases: %w", err)
+	}
+	return response, nil
+}
+
+func (s *SearchSynonymService) AddSynonym(term, synonym string) error {
+	term = strings.TrimSpace(term)
+	synonym = strings.TrimSpace(synonym)
+	if term == "" || synonym == "" {
+		return ErrInvalidSynonym
+	}
+
+	if _, err := s.DB.Exec(insertSearchSynonymQuery, term, synonym); err != nil {
+		return fmt.Errorf("error inserting synonym: %w", err)
+	}
+	return s.publishReload(0)
+}
+
+func (s *SearchSynonymService) RemoveSynonym(synonymID int) error {
+	if _, err := s.DB.Exec(deleteSearchSynonymQuery, synonymID); err != nil {
+		return fmt.Errorf("error deleting synonym: %w", err)
+	}
+	return s.publishReload(0)
+}
+
+// AddMarkerAlias attaches a landmark name to a marker and re-indexes it.
+func (s *SearchSynonymService) AddMarkerAlias(markerID int, alias string) error {
+	alias = strings.TrimSpace(alias)
+	if alias == "" {
+		return ErrInvalidSynonym
+	}
+
+	if _, err := s.SearchIndexService.GetMarkerIndexData(markerID); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrMarkerNotFound
+		}
+		return fmt.Errorf("error fetching marker: %w", err)
+	}
+
+	if _, err := s.DB.Exec(insertMarkerAliasQuery, markerID, alias); err != nil {
+		return fmt.Errorf("error inserting marker alias: %w", err)
+	}
+	return s.publishReload(markerID)
+}
+
+func (s *SearchSynonymService) RemoveMarkerAlias(aliasID int) error {
+	var alias dto.MarkerAlias
+	if err := s.DB.Get(&alias, getMarkerAliasQuery, aliasID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return fmt.Errorf("error fetching marker alias: %w", err)
+	}
+
+	if _, err := s.DB.Exec(deleteMarkerAliasQuery, aliasID); err != nil {
+		return fmt.Errorf("error deleting marker alias: %w", err)
+	}
+	return s.publishReload(alias.MarkerID)
+}
+
+// handleReload reloads the dictionary and re-indexes the marker the message names, if any.
+// Every instance has its own bleve index, so each one does both.
+func (s *SearchSynonymService) handleReload(message string) error {
+	if err := s.Reload(); err != nil {
+		return err
+	}
+	if markerID, err := strconv.Atoi(message); err == nil && markerID > 0 {
+		return s.reindexMarker(markerID)
+	}
+	return nil
+}
+
+// reindexMarker runs after the reload so the new aliases end up in the document.
+func (s *SearchSynonymService) reindexMarker(markerID int) error {
+	indexData, err := s.SearchIndexService.GetMarkerIndexData(markerID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil // marker is gone, nothing to re-index
+		}
+		return fmt.Errorf("error fetching marker: %w", err)
+	}
+	if err := s.BleveSearchService.InsertMarkerIndex(indexData); err != nil {
+		return err
+	}
+	return s.BleveSearchService.FlushAllBatches()
+}
+
+// publishReload tells every instance, this one included, to reload and re-index the marker when markerID isn't 0
+func (s *SearchSynonymService) publishReload(markerID int) error {
+	message := "reload"
+	if markerID > 0 {
+		message = strconv.Itoa(markerID)
+	}
+
+	client := s.Redis.Core.Client
+	err := client.Do(context.Background(), client.B().Publish().Channel(SearchDictionaryReloadChannel).Message(message).Build()).Error()
+	if err != nil {
+		// Still reload this instance even if others can't be told
+		s.Logger.Error("Failed to publish dictionary reload", zap.Error(err))
+		return s.handleReload(message)
+	}
+	return nil
+}
@@ -1,7 +1,9 @@
 package service
 
 import (
+	"encoding/json"
 	"fmt"
+	"html"
 	"net/smtp"
 	"strings"
 
@@ -106,6 +108,8 @@ var emailTemplateForPendingReports = `<!DOCTYPE html>
                     <tr style="background-color: #e5b000;">
                         <th style="padding: 10px; border: 1px solid #ddd; color: #fff;">Report ID</th>
                         <th style="padding: 10px; border: 1px solid #ddd; color: #fff;">Description</th>
+                        <th style="padding: 10px; border: 1px solid #ddd; color: #fff;">SLA</th>
+                        <th style="padding: 10px; border: 1px solid #ddd; color: #fff;">Assignee</th>
                         <th style="padding: 10px; border: 1px solid #ddd; color: #fff;">Link</th>
                     </tr>
                 </thead>
@@ -171,17 +175,30 @@ func (s *SmtpService) SendPasswordResetEmail(to, token string) error {
 	return nil
 }
 
-func (s *SmtpService) SendPendingReportsEmail(to string, reports []dto.MarkerReportResponse) error {
+// SendPendingReportsEmail mails the oldest pending reports with their SLA, the overdue ones first as the queue sorts them
+func (s *SmtpService) SendPendingReportsEmail(to string, queue dto.ReportQueue) error {
 	// Define email headers
-	headers := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: Daily Pending Reports\r\nMIME-Version: 1.0;\r\nContent-Type: text/html; charset=\"UTF-8\";\r\n\r\n", s.Config.SmtpUsername, to)
+	subject := fmt.Sprintf("Daily Pending Reports: %d pending, %d overdue", queue.Summary.Pending, queue.Summary.Overdue)
+	headers := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nMIME-Version: 1.0;\r\nContent-Type: text/html; charset=\"UTF-8\";\r\n\r\n", s.Config.SmtpUsername, to, subject)
 
 	// Build the reports table rows for email
 	var reportRows string
 	var slackReportRows string
-	for _, report := range reports {
+	for _, report := range queue.Reports {
 		link := fmt.Sprintf("https://k-pullup.com/pullup/%d", report.MarkerID)
-		reportRows += fmt.Sprintf("<tr><td style=\"padding: 8px; border: 1px solid #ddd;\">%d</td><td style=\"padding: 8px; border: 1px solid #ddd;\">%s</td><td style=\"padding: 8px; border: 1px solid #ddd;\"><a href=\"%s\" style=\"color: #e5b000; text-decoration: none;\">View Report</a></td></tr>", report.ReportID, report.Description, link)
-		slackReportRows += fmt.Sprintf("*Report ID:* %d\n*Description:* %s\n*Link:* <%s|View Report>\n\n", report.ReportID, report.Description, link)
+		sla := "due " + report.DueAt.In(kst).Format("01-02 15:04")
+		slaCell := sla
+		if report.Overdue {
+			sla = "overdue"
+			slaCell = "<b style=\"color: #d32f2f;\">overdue</b>"
+		}
+		assignee := report.AssigneeName
+		if assignee == "" {
+			assignee = "-"
+		}
+		reportRows += fmt.Sprintf("<tr><td style=\"padding: 8px; border: 1px solid #ddd;\">%d (%s)</td><td style=\"padding: 8px; border: 1px solid #ddd;\">%s</td><td style=\"padding: 8px; border: 1px solid #ddd;\">%s</td><td style=\"padding: 8px; border: 1px solid #ddd;\">%s</td><td style=\"padding: 8px; border: 1px solid #ddd;\"><a href=\"%s\" style=\"color: #e5b000; text-decoration: none;\">View Report</a></td></tr>",
+			report.ReportID, report.Type, html.EscapeString(report.Description), slaCell, html.EscapeString(assignee), link)
+		slackReportRows += fmt.Sprintf("*Report ID:* %d (%s)\n*Description:* %s\n*SLA:* %s\n*Link:* <%s|View Report>\n\n", report.ReportID, report.Type, report.Description, sla, link)
 	}
 
 	// Replace the {{REPORTS}} placeholder in the template with the actual report rows
@@ -208,3 +225,114 @@ func (s *SmtpService) SendPendingReportsEmail(to string, reports []dto.MarkerRep
 
 	return nil
 }
+
+var emailTemplateForNotification = `<!DOCTYPE html>
+<html lang="ko">
+<head>
+    <title>{{TITLE}}</title>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+</head>
+<body style="margin:0; padding:0; font-family: Arial, sans-serif; background-color: #f3f3f3; color: #333; text-align: center;">
+<table width="100%" cellspacing="0" cellpadding="0" style="background-color: #f3f3f3; margin: 0; padding: 0;">
+    <tr>
+        <td align="center">
+            <table width="600" cellspacing="0" cellpadding="0" style="margin: 40px auto; border-collapse: collapse; background-color: #fff; border: 1px solid #ddd;">
+                <tr>
+                    <td style="padding: 20px; background-color: #e5b000; color: #fff;" align="center">
+                        <h1 style="margin: 0; font-size: 22px;">{{TITLE}}</h1>
+                    </td>
+                </tr>
+                <tr>
+                    <td style="padding: 20px;" align="center">
+                        <p>{{MESSAGE}}</p>
+                        <a href="{{LINK}}" style="display: inline-block; margin-top: 10px; padding: 10px 20px; background-color: #e5b000; color: #fff; text-decoration: none; border-radius: 5px;">확인하기</a>
+                    </td>
+                </tr>
+                <tr>
+                    <td style="padding: 10px; font-size: 12px; color: #999;" align="center">알림 설정에서 이메일 알림을 끌 수 있어요.</td>
+                </tr>
+            </table>
+        </td>
+    </tr>
+</table>
+</body>
+</html>`
+
+var emailTemplateForNotificationDigest = `<!DOCTYPE html>
+<html lang="ko">
+<head>
+    <title>{{TITLE}}</title>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+</head>
+<body style="margin:0; padding:0; font-family: Arial, sans-serif; background-color: #f3f3f3; color: #333; text-align: center;">
+<table width="100%" cellspacing="0" cellpadding="0" style="background-color: #f3f3f3; margin: 0; padding: 0;">
+    <tr>
+        <td align="center">
+            <h1 style="color: #e5b000;">{{TITLE}}</h1>
+            <p>{{GREETING}}</p>
+            <table width="600" cellspacing="0" cellpadding="0" style="margin: 20px auto 40px; border-collapse: collapse; background-color: #fff; border: 1px solid #ddd;">
+                <thead>
+                    <tr style="background-color: #e5b000;">
+                        <th style="padding: 10px; border: 1px solid #ddd; color: #fff;">시간</th>
+                        <th style="padding: 10px; border: 1px solid #ddd; color: #fff;">알림</th>
+                        <th style="padding: 10px; border: 1px solid #ddd; color: #fff;">Link</th>
+                    </tr>
+                </thead>
+                <tbody>
+                    {{NOTIFICATIONS}}
+                </tbody>
+            </table>
+            <p style="font-size: 12px; color: #999;">알림 설정에서 요약 메일 주기를 바꾸거나 끌 수 있어요.</p>
+        </td>
+    </tr>
+</table>
+</body>
+</html>`
+
+// SendNotificationEmail sends one personal notification to a user who gets them by email right away
+func (s *SmtpService) SendNotificationEmail(to, title, message, link string) error {
+	htmlBody := strings.NewReplacer(
+		"{{TITLE}}", html.EscapeString(title),
+		"{{MESSAGE}}", html.EscapeString(message),
+		"{{LINK}}", html.EscapeString(link),
+	).Replace(emailTemplateForNotification)
+
+	return s.sendHTMLEmail(to, "k-pullup "+title, htmlBody)
+}
+
+// SendNotificationDigestEmail sends the unread notifications of a day or a week in one email
+func (s *SmtpService) SendNotificationDigestEmail(to, username, mode string, notifications []Notification) error {
+	title := "k-pullup 오늘의 알림"
+	if mode == EmailModeWeekly {
+		title = "k-pullup 이번 주 알림"
+	}
+
+	htmlBody := strings.NewReplacer(
+		"{{TITLE}}", title,
+		"{{GREETING}}", html.EscapeString(fmt.Sprintf("%s님, 확인하지 않은 알림이 %d개 있어요.", username, len(notifications))),
+		"{{NOTIFICATIONS}}", notificationDigestRows(notifications),
+	).Replace(emailTemplateForNotificationDigest)
+
+	return s.sendHTMLEmail(to, title, htmlBody)
+}
+
+// notificationDigestRows builds the table rows of a digest, newest first as given
+func notificationDigestRows(notifications []Notification) string {
+	var rows strings.Builder
+	for _, n := range notifications {
+		link := notificationLink(json.RawMessage(n.Metadata))
+		rows.WriteString(fmt.Sprintf("<tr><td style=\"padding: 8px; border: 1px solid #ddd; white-space: nowrap;\">%s</td><td style=\"padding: 8px; border: 1px solid #ddd; text-align: left;\"><b>%s</b><br>%s</td><td style=\"padding: 8px; border: 1px solid #ddd;\"><a href=\"%s\" style=\"color: #e5b000; text-decoration: none;\">보기</a></td></tr>",
+			n.CreatedAt.In(kst).Format("01/02 15:04"), html.EscapeString(n.Title), html.EscapeString(n.Message), html.EscapeString(link)))
+	}
+	return rows.String()
+}
+
+func (s *SmtpService) sendHTMLEmail(to, subject, htmlBody string) error {
+	headers := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nMIME-Version: 1.0;\r\nContent-Type: text/html; charset=\"UTF-8\";\r\n\r\n", s.Config.SmtpUsername, to, subject)
+	message := append([]byte(headers), htmlBody...)
+
+	auth := smtp.PlainAuth("", s.Config.SmtpUsername, s.Config.SmtpPassword, s.Config.SmtpServer)
+	return smtp.SendMail(s.Config.SmtpServer+":"+s.Config.SmtpPort, auth, s.Config.SmtpUsername, []string{to}, message)
+}
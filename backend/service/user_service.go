@@ -64,7 +64,7 @@ ORDER BY
 SELECT Markers.MarkerID, ST_X(Markers.Location) AS Latitude, ST_Y(Markers.Location) AS Longitude, Markers.Description, Markers.Address
 FROM Favorites
 JOIN Markers ON Favorites.MarkerID = Markers.MarkerID
-WHERE Favorites.UserID = ?
+WHERE Favorites.UserID = ? AND Markers.State <> 'removed'
 ORDER BY Markers.CreatedAt DESC` // Order by CreatedAt in descending order
 
 	getPhotoByUserIdQuery = "SELECT PhotoURL FROM Photos WHERE MarkerID IN (SELECT MarkerID FROM Markers WHERE UserID = ?)"
@@ -82,7 +82,7 @@ ORDER BY Markers.CreatedAt DESC` // Order by CreatedAt in descending order
 	// Count query to get how many markers a user makes by UserID
 	countQueryHowManyMarkersAUserMakesQuery = "SELECT COUNT(*) AS MarkerCount FROM Markers WHERE UserID = ?"
 
-	sumContributionScoresForAUserQuery = "SELECT SUM(Points) AS TotalPoints FROM UserContributions WHERE UserID = ?"
+	sumContributionScoresForAUserQuery = "SELECT COALESCE(SUM(Points), 0) AS TotalPoints FROM UserContributions WHERE UserID = ?"
 
 	getUsernameByIdQuery = "SELECT Username FROM Users WHERE UserID = ?"
 )
@@ -0,0 +1,399 @@
+package service
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Alfex4936/chulbong-kr/config"
+	"github.com/Alfex4936/chulbong-kr/dto/notification"
+	sonic "github.com/bytedance/sonic"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	// one aes128gcm record (RFC 8188) carries the whole message
+	pushRecordSize   = 4096
+	pushHeaderSize   = 16 + 4 + 1 + 65 // salt, record size, key id length, key id
+	maxPushPayload   = pushRecordSize - pushHeaderSize - 16 - 1
+	maxPushBodyRunes = 200
+
+	vapidTokenLifetime = 12 * time.Hour
+
+	upsertPushSubscriptionQuery = `
+INSERT INTO PushSubscriptions (UserID, Endpoint, P256dh, Auth, ExpiresAt, CreatedAt)
+VALUES (?, ?, ?, ?, ?, NOW())
+ON DUPLICATE KEY UPDATE UserID = VALUES(UserID), P256dh = VALUES(P256dh), Auth = VALUES(Auth), ExpiresAt = VALUES(ExpiresAt)`
+
+	deletePushSubscriptionQuery           = "DELETE FROM PushSubscriptions WHERE UserID = ? AND Endpoint = ?"
+	deletePushSubscriptionByEndpointQuery = "DELETE FROM PushSubscriptions WHERE Endpoint = ?"
+	deleteExpiredPushSubscriptionsQuery   = "DELETE FROM PushSubscriptions WHERE ExpiresAt IS NOT NULL AND ExpiresAt < NOW()"
+	getPushSubscriptionsQuery             = "SELECT Endpoint, P256dh, Auth FROM PushSubscriptions WHERE UserID = ? AND (ExpiresAt IS NULL OR ExpiresAt > NOW())"
+)
+
+// errPushSubscriptionGone is returned when the push service forgot the subscription, it can be deleted
+var errPushSubscriptionGone = errors.New("push subscription expired or unsubscribed")
+
+type pushSubscription struct {
+	Endpoint string `db:"Endpoint"`
+	P256dh   string `db:"P256dh"`
+	Auth     string `db:"Auth"`
+}
+
+// WebPushService delivers notifications to browsers that don't have the site open (RFC 8030).
+// Payloads are encrypted for the subscription (RFC 8291) and requests signed with the VAPID key (RFC 8292).
+type WebPushService struct {
+	DB     *sqlx.DB
+	Config *config.WebPushConfig
+	Client *http.Client
+	Logger *zap.Logger
+
+	vapidKey       *ecdsa.PrivateKey // nil when Web Push is off
+	vapidPublicKey string
+}
+
+func NewWebPushService(db *sqlx.DB, cfg *config.WebPushConfig, logger *zap.Logger) *WebPushService {
+	s := &WebPushService{
+		DB:     db,
+		Config: cfg,
+		Client: &http.Client{Timeout: 10 * time.Second},
+		Logger: logger,
+	}
+
+	if cfg.VAPIDPrivateKey == "" {
+		logger.Warn("VAPID_PRIVATE_KEY is not set, Web Push is disabled")
+		return s
+	}
+	key, publicKey, err := parseVAPIDKey(cfg.VAPIDPrivateKey)
+	if err != nil {
+		logger.Error("Invalid VAPID private key, Web Push is disabled", zap.Error(err))
+		return s
+	}
+	if cfg.VAPIDPublicKey != "" {
+		configured, err := decodeBase64URL(cfg.VAPIDPublicKey)
+		if err != nil || base64.RawURLEncoding.EncodeToString(configured) != publicKey {
+			logger.Error("VAPID_PUBLIC_KEY doesn't belong to VAPID_PRIVATE_KEY, Web Push is disabled")
+			return s
+		}
+	}
+
+	s.vapidKey, s.vapidPublicKey = key, publicKey
+	return s
+}
+
+// Enabled is false when no VAPID key is configured
+func (s *WebPushService) Enabled() bool {
+	return s != nil && s.vapidKey != nil
+}
+
+// PublicKey is the applicationServerKey browsers subscribe with
+func (s *WebPushService) PublicKey() string {
+	return s.vapidPublicKey
+}
+
+// Subscribe saves the browser's subscription, an endpoint belongs to whoever subscribed with it last
+func (s *WebPushService) Subscribe(userID int, sub notification.PushSubscription) error {
+	if !s.Enabled() {
+		return ErrWebPushDisabled
+	}
+	if err := validatePushSubscription(sub); err != nil {
+		return err
+	}
+
+	var expiresAt *time.Time
+	if sub.ExpirationTime != nil {
+		t := time.UnixMilli(*sub.ExpirationTime)
+		expiresAt = &t
+	}
+	if _, err := s.DB.Exec(upsertPushSubscriptionQuery, userID, sub.Endpoint, sub.Keys.P256dh, sub.Keys.Auth, expiresAt); err != nil {
+		return fmt.Errorf("error saving push subscription: %w", err)
+	}
+	return nil
+}
+
+// Unsubscribe removes one of the user's subscriptions
+func (s *WebPushService) Unsubscribe(userID int, endpoint string) error {
+	if _, err := s.DB.Exec(deletePushSubscriptionQuery, userID, endpoint); err != nil {
+		return fmt.Errorf("error deleting push subscription: %w", err)
+	}
+	return nil
+}
+
+// Push sends the message to every browser of the user and returns how many accepted it.
+// Subscriptions the push service no longer knows are deleted.
+func (s *WebPushService) Push(userID int, message notification.NotificationPush) (int, error) {
+	if !s.Enabled() {
+		return 0, nil
+	}
+
+	message.Body = previewText(message.Body, maxPushBodyRunes)
+	payload, err := sonic.Marshal(message)
+	if err != nil {
+		return 0, err
+	}
+
+	var subscriptions []pushSubscription
+	if err := s.DB.Select(&subscriptions, getPushSubscriptionsQuery, userID); err != nil {
+		return 0, fmt.Errorf("error fetching push subscriptions: %w", err)
+	}
+
+	delivered := 0
+	for _, sub := range subscriptions {
+		err := s.send(sub, payload)
+		switch {
+		case err == nil:
+			delivered++
+		case errors.Is(err, errPushSubscriptionGone):
+			if _, err := s.DB.Exec(deletePushSubscriptionByEndpointQuery, sub.Endpoint); err != nil {
+				s.Logger.Error("Failed to delete gone push subscription", zap.Error(err))
+			}
+		default:
+			s.Logger.Warn("Failed to deliver web push", zap.Int("userID", userID), zap.Error(err))
+		}
+	}
+	return delivered, nil
+}
+
+// PruneExpiredSubscriptions deletes the subscriptions past the expiration time the browser gave
+func (s *WebPushService) PruneExpiredSubscriptions() (int64, error) {
+	result, err := s.DB.Exec(deleteExpiredPushSubscriptionsQuery)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// send encrypts the payload for one subscription and posts it to its push service
+func (s *WebPushService) send(sub pushSubscription, payload []byte) error {
+	if len(payload) > maxPushPayload {
+		return fmt.Errorf("push payload is %d bytes, at most %d fit", len(payload), maxPushPayload)
+	}
+
+	endpoint, err := url.Parse(sub.Endpoint)
+	if err != nil {
+		return err
+	}
+	body, err := encryptPushPayload(payload, sub.P256dh, sub.Auth)
+	if err != nil {
+		return err
+	}
+	token, err := s.vapidToken(endpoint.Scheme+"://"+endpoint.Host, time.Now())
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("TTL", strconv.Itoa(int(s.Config.TTL.Seconds())))
+	req.Header.Set("Urgency", "normal")
+	req.Header.Set("Authorization", "vapid t="+token+", k="+s.vapidPublicKey)
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return errPushSubscriptionGone
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		return fmt.Errorf("push service responded %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// vapidToken is the ES256 JWT that identifies us to the push service of the audience origin
+func (s *WebPushService) vapidToken(audience string, now time.Time) (string, error) {
+	claims, err := sonic.Marshal(map[string]any{
+		"aud": audience,
+		"exp": now.Add(vapidTokenLifetime).Unix(),
+		"sub": s.Config.Subject,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString([]byte(`{"typ":"JWT","alg":"ES256"}`)) + "." +
+		base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	r, sig, err := ecdsa.Sign(rand.Reader, s.vapidKey, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	// JWS wants r and s as two fixed size big endian numbers, not ASN.1
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	sig.FillBytes(signature[32:])
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// encryptPushPayload encrypts with a fresh key pair and salt, as every message must be
+func encryptPushPayload(payload []byte, p256dh, auth string) ([]byte, error) {
+	uaPublic, err := decodeBase64URL(p256dh)
+	if err != nil {
+		return nil, err
+	}
+	authSecret, err := decodeBase64URL(auth)
+	if err != nil {
+		return nil, err
+	}
+
+	asKey, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return encryptPushRecord(payload, uaPublic, authSecret, asKey, salt)
+}
+
+// encryptPushRecord builds the aes128gcm body of RFC 8291 section 3.4, a header and one record
+func encryptPushRecord(payload, uaPublic, authSecret []byte, asKey *ecdh.PrivateKey, salt []byte) ([]byte, error) {
+	uaKey, err := ecdh.P256().NewPublicKey(uaPublic)
+	if err != nil {
+		return nil, err
+	}
+	ecdhSecret, err := asKey.ECDH(uaKey)
+	if err != nil {
+		return nil, err
+	}
+	asPublic := asKey.PublicKey().Bytes()
+
+	keyInfo := append(append([]byte("WebPush: info\x00"), uaPublic...), asPublic...)
+	ikm, err := hkdfExpand(ecdhSecret, authSecret, keyInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+	cek, err := hkdfExpand(ikm, salt, []byte("Content-Encoding: aes128gcm\x00"), 16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hkdfExpand(ikm, salt, []byte("Content-Encoding: nonce\x00"), 12)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	body := make([]byte, 0, pushHeaderSize+len(payload)+1+gcm.Overhead())
+	body = append(body, salt...)
+	body = binary.BigEndian.AppendUint32(body, pushRecordSize)
+	body = append(body, byte(len(asPublic)))
+	body = append(body, asPublic...)
+
+	plaintext := append(append([]byte{}, payload...), 0x02) // last record delimiter, no padding
+	return gcm.Seal(body, nonce, plaintext, nil), nil
+}
+
+func hkdfExpand(secret, salt, info []byte, length int) ([]byte, error) {
+	out := make([]byte, length)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, salt, info), out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// parseVAPIDKey reads the base64url private scalar and returns the key with its base64url public point
+func parseVAPIDKey(encoded string) (*ecdsa.PrivateKey, string, error) {
+	raw, err := decodeBase64URL(encoded)
+	if err != nil {
+		return nil, "", err
+	}
+	key, err := ecdh.P256().NewPrivateKey(raw)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// ecdh keys can't sign, go through PKCS #8 to get the ecdsa one
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, "", err
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, "", err
+	}
+	signer, ok := parsed.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, "", errors.New("VAPID key is not an ECDSA key")
+	}
+	return signer, base64.RawURLEncoding.EncodeToString(key.PublicKey().Bytes()), nil
+}
+
+// pushServiceHosts are the push services of the browsers we support, the server posts to the endpoint
+// so anything else could point it at internal addresses. A leading dot matches subdomains.
+var pushServiceHosts = []string{
+	"fcm.googleapis.com",         // Chrome, Edge, Samsung Internet
+	".push.services.mozilla.com", // Firefox
+	".push.apple.com",            // Safari
+	".notify.windows.com",        // legacy Edge
+}
+
+func isPushServiceHost(host string) bool {
+	host = strings.ToLower(host)
+	for _, allowed := range pushServiceHosts {
+		if host == allowed || (strings.HasPrefix(allowed, ".") && strings.HasSuffix(host, allowed)) {
+			return true
+		}
+	}
+	return false
+}
+
+func validatePushSubscription(sub notification.PushSubscription) error {
+	endpoint, err := url.Parse(sub.Endpoint)
+	if err != nil || endpoint.Scheme != "https" || endpoint.Host == "" {
+		return fmt.Errorf("%w: endpoint must be an https URL", ErrInvalidPushSubscription)
+	}
+	if !isPushServiceHost(endpoint.Hostname()) || (endpoint.Port() != "" && endpoint.Port() != "443") {
+		return fmt.Errorf("%w: endpoint is not a known push service", ErrInvalidPushSubscription)
+	}
+	p256dh, err := decodeBase64URL(sub.Keys.P256dh)
+	if err != nil {
+		return fmt.Errorf("%w: p256dh", ErrInvalidPushSubscription)
+	}
+	if _, err := ecdh.P256().NewPublicKey(p256dh); err != nil {
+		return fmt.Errorf("%w: p256dh is not a P-256 key", ErrInvalidPushSubscription)
+	}
+	if auth, err := decodeBase64URL(sub.Keys.Auth); err != nil || len(auth) != 16 {
+		return fmt.Errorf("%w: auth must be 16 bytes", ErrInvalidPushSubscription)
+	}
+	return nil
+}
+
+// decodeBase64URL accepts the unpadded base64url browsers give and padded keys from config
+func decodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
@@ -0,0 +1,240 @@
+package service
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Alfex4936/chulbong-kr/config"
+	"github.com/Alfex4936/chulbong-kr/dto/notification"
+	sonic "github.com/bytedance/sonic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func b64(t *testing.T, s string) []byte {
+	t.Helper()
+	raw, err := decodeBase64URL(s)
+	require.NoError(t, err)
+	return raw
+}
+
+// decryptPushRecord is what the browser does with the body, RFC 8291 section 3.4 in reverse
+func decryptPushRecord(t *testing.T, body []byte, uaKey *ecdh.PrivateKey, authSecret []byte) []byte {
+	t.Helper()
+	require.Greater(t, len(body), pushHeaderSize)
+	salt := body[:16]
+	assert.Equal(t, uint32(pushRecordSize), binary.BigEndian.Uint32(body[16:20]))
+	require.Equal(t, byte(65), body[20])
+	asPublic := body[21:86]
+
+	asKey, err := ecdh.P256().NewPublicKey(asPublic)
+	require.NoError(t, err)
+	ecdhSecret, err := uaKey.ECDH(asKey)
+	require.NoError(t, err)
+
+	keyInfo := append(append([]byte("WebPush: info\x00"), uaKey.PublicKey().Bytes()...), asPublic...)
+	ikm, err := hkdfExpand(ecdhSecret, authSecret, keyInfo, 32)
+	require.NoError(t, err)
+	cek, err := hkdfExpand(ikm, salt, []byte("Content-Encoding: aes128gcm\x00"), 16)
+	require.NoError(t, err)
+	nonce, err := hkdfExpand(ikm, salt, []byte("Content-Encoding: nonce\x00"), 12)
+	require.NoError(t, err)
+
+	block, err := aes.NewCipher(cek)
+	require.NoError(t, err)
+	gcm, err := cipher.NewGCM(block)
+	require.NoError(t, err)
+	plaintext, err := gcm.Open(nil, nonce, body[86:], nil)
+	require.NoError(t, err)
+
+	require.Equal(t, byte(0x02), plaintext[len(plaintext)-1], "last record delimiter")
+	return plaintext[:len(plaintext)-1]
+}
+
+func newTestWebPushService(t *testing.T) *WebPushService {
+	t.Helper()
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	cfg := &config.WebPushConfig{
+		VAPIDPrivateKey: base64.RawURLEncoding.EncodeToString(key.Bytes()),
+		Subject:         "mailto:admin@k-pullup.com",
+		TTL:             time.Hour,
+	}
+	s := NewWebPushService(nil, cfg, zap.NewNop())
+	require.True(t, s.Enabled())
+	return s
+}
+
+func TestWebPush(t *testing.T) {
+	t.Run("RFC8291Vector", func(t *testing.T) {
+		asKey, err := ecdh.P256().NewPrivateKey(b64(t, "yfWPiYE-n46HLnH0KqZOF1fJJU3MYrct3AELtAQ-oRw"))
+		require.NoError(t, err)
+
+		body, err := encryptPushRecord(
+			[]byte("When I grow up, I want to be a watermelon"),
+			b64(t, "BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4"),
+			b64(t, "BTBZMqHH6r4Tts7J_aSIgg"),
+			asKey,
+			b64(t, "DGv6ra1nlYgDCS1FRnbzlw"),
+		)
+		require.NoError(t, err)
+		assert.Equal(t, "DGv6ra1nlYgDCS1FRnbzlwAAEABBBP4z9KsN6nGRTbVYI_c7VJSPQTBtkgcy27mlmlMoZIIgDll6e3vCYLocInmYWAmS6TlzAC8wEqKK6PBru3jl7A_yl95bQpu6cVPTpK4Mqgkf1CXztLVBSt2Ks3oZwbuwXPXLWyouBWLVWGNWQexSgSxsj_Qulcy4a-fN",
+			base64.RawURLEncoding.EncodeToString(body))
+	})
+
+	t.Run("Keys", func(t *testing.T) {
+		s := newTestWebPushService(t)
+		assert.Len(t, b64(t, s.PublicKey()), 65)
+
+		// a matching public key is fine, padded or not
+		cfg := *s.Config
+		cfg.VAPIDPublicKey = s.PublicKey() + "="
+		assert.True(t, NewWebPushService(nil, &cfg, zap.NewNop()).Enabled())
+
+		other := newTestWebPushService(t)
+		cfg.VAPIDPublicKey = other.PublicKey()
+		assert.False(t, NewWebPushService(nil, &cfg, zap.NewNop()).Enabled())
+
+		assert.False(t, NewWebPushService(nil, &config.WebPushConfig{}, zap.NewNop()).Enabled())
+		assert.False(t, NewWebPushService(nil, &config.WebPushConfig{VAPIDPrivateKey: "nope"}, zap.NewNop()).Enabled())
+
+		var none *WebPushService
+		assert.False(t, none.Enabled())
+	})
+
+	t.Run("ValidateSubscription", func(t *testing.T) {
+		uaKey, err := ecdh.P256().GenerateKey(rand.Reader)
+		require.NoError(t, err)
+
+		sub := notification.PushSubscription{Endpoint: "https://fcm.googleapis.com/fcm/send/abc"}
+		sub.Keys.P256dh = base64.RawURLEncoding.EncodeToString(uaKey.PublicKey().Bytes())
+		sub.Keys.Auth = base64.RawURLEncoding.EncodeToString(make([]byte, 16))
+		require.NoError(t, validatePushSubscription(sub))
+
+		for _, endpoint := range []string{"https://updates.push.services.mozilla.com/wpush/v2/abc", "https://web.push.apple.com/abc"} {
+			allowed := sub
+			allowed.Endpoint = endpoint
+			assert.NoError(t, validatePushSubscription(allowed), endpoint)
+		}
+
+		invalid := []func(s *notification.PushSubscription){
+			func(s *notification.PushSubscription) { s.Endpoint = "http://fcm.googleapis.com/fcm/send/abc" },
+			func(s *notification.PushSubscription) { s.Endpoint = "not a url" },
+			func(s *notification.PushSubscription) { s.Endpoint = "https://push.example.com/send/abc" },
+			func(s *notification.PushSubscription) { s.Endpoint = "https://169.254.169.254/latest/meta-data" },
+			func(s *notification.PushSubscription) { s.Endpoint = "https://fcm.googleapis.com.evil.com/send" },
+			func(s *notification.PushSubscription) { s.Endpoint = "https://fcm.googleapis.com:6379/send" },
+			func(s *notification.PushSubscription) {
+				s.Keys.P256dh = base64.RawURLEncoding.EncodeToString(make([]byte, 65))
+			},
+			func(s *notification.PushSubscription) {
+				s.Keys.Auth = base64.RawURLEncoding.EncodeToString(make([]byte, 8))
+			},
+		}
+		for _, mutate := range invalid {
+			broken := sub
+			mutate(&broken)
+			assert.ErrorIs(t, validatePushSubscription(broken), ErrInvalidPushSubscription)
+		}
+	})
+
+	t.Run("Send", func(t *testing.T) {
+		s := newTestWebPushService(t)
+		uaKey, err := ecdh.P256().GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		authSecret := make([]byte, 16)
+		_, err = rand.Read(authSecret)
+		require.NoError(t, err)
+
+		var got *http.Request
+		var body []byte
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = r
+			body, _ = io.ReadAll(r.Body)
+			w.WriteHeader(http.StatusCreated)
+		}))
+		defer server.Close()
+
+		sub := pushSubscription{
+			Endpoint: server.URL + "/push/abc",
+			P256dh:   base64.RawURLEncoding.EncodeToString(uaKey.PublicKey().Bytes()),
+			Auth:     base64.RawURLEncoding.EncodeToString(authSecret),
+		}
+		payload, _ := sonic.Marshal(notification.NotificationPush{NotificationId: 1, Type: NotificationComment, Title: "새 댓글", Body: "좋아요", URL: "https://k-pullup.com/pullup/7"})
+		require.NoError(t, s.send(sub, payload))
+
+		require.NotNil(t, got)
+		assert.Equal(t, "/push/abc", got.URL.Path)
+		assert.Equal(t, "aes128gcm", got.Header.Get("Content-Encoding"))
+		assert.Equal(t, "3600", got.Header.Get("TTL"))
+		assert.Equal(t, payload, decryptPushRecord(t, body, uaKey, authSecret))
+
+		// the VAPID token is for the push service's origin and signed by our key
+		auth := got.Header.Get("Authorization")
+		require.True(t, strings.HasPrefix(auth, "vapid t="), auth)
+		token, publicKey, ok := strings.Cut(strings.TrimPrefix(auth, "vapid t="), ", k=")
+		require.True(t, ok)
+		assert.Equal(t, s.PublicKey(), publicKey)
+
+		parts := strings.Split(token, ".")
+		require.Len(t, parts, 3)
+		var claims struct {
+			Aud string `json:"aud"`
+			Exp int64  `json:"exp"`
+			Sub string `json:"sub"`
+		}
+		require.NoError(t, sonic.Unmarshal(b64(t, parts[1]), &claims))
+		assert.Equal(t, server.URL, claims.Aud)
+		assert.Equal(t, "mailto:admin@k-pullup.com", claims.Sub)
+		assert.Greater(t, claims.Exp, time.Now().Unix())
+
+		signature := b64(t, parts[2])
+		require.Len(t, signature, 64)
+		digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		r, sig := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+		assert.True(t, ecdsa.Verify(&s.vapidKey.PublicKey, digest[:], r, sig))
+	})
+
+	t.Run("Gone", func(t *testing.T) {
+		s := newTestWebPushService(t)
+		uaKey, err := ecdh.P256().GenerateKey(rand.Reader)
+		require.NoError(t, err)
+
+		status := http.StatusGone
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+		}))
+		defer server.Close()
+
+		sub := pushSubscription{
+			Endpoint: server.URL,
+			P256dh:   base64.RawURLEncoding.EncodeToString(uaKey.PublicKey().Bytes()),
+			Auth:     base64.RawURLEncoding.EncodeToString(make([]byte, 16)),
+		}
+		assert.ErrorIs(t, s.send(sub, []byte("{}")), errPushSubscriptionGone)
+
+		status = http.StatusNotFound
+		assert.ErrorIs(t, s.send(sub, []byte("{}")), errPushSubscriptionGone)
+
+		status = http.StatusTooManyRequests
+		err = s.send(sub, []byte("{}"))
+		require.Error(t, err)
+		assert.NotErrorIs(t, err, errPushSubscriptionGone)
+
+		assert.Error(t, s.send(sub, make([]byte, maxPushPayload+1)))
+	})
+}
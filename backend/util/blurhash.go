@@ -11,6 +11,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/rwcarlsen/goexif/exif"
 )
@@ -640,6 +641,38 @@ func GetOrientationByReader(file io.ReadSeeker) int {
 	return orientation
 }
 
+// PhotoMetadata is where and when a photo was taken according to its EXIF.
+type PhotoMetadata struct {
+	Latitude    float64
+	Longitude   float64
+	TakenAt     time.Time
+	HasLocation bool
+	HasTime     bool
+}
+
+// GetPhotoMetadataByReader retrieves the EXIF GPS location and capture time of the image.
+func GetPhotoMetadataByReader(file io.ReadSeeker) PhotoMetadata {
+	var meta PhotoMetadata
+
+	file.Seek(0, 0)
+	x, err := exif.Decode(file)
+	if err != nil {
+		return meta // No EXIF, screenshots and edited photos usually have none
+	}
+
+	if lat, lng, err := x.LatLong(); err == nil && !(lat == 0 && lng == 0) &&
+		!math.IsNaN(lat) && !math.IsNaN(lng) {
+		meta.Latitude, meta.Longitude, meta.HasLocation = lat, lng, true
+	}
+
+	// DateTimeOriginal has no time zone, goexif reads it in the server's local time
+	if takenAt, err := x.DateTime(); err == nil && !takenAt.IsZero() {
+		meta.TakenAt, meta.HasTime = takenAt, true
+	}
+
+	return meta
+}
+
 // PixelsToImage converts raw RGB pixel data into an *image.RGBA.
 func PixelsToImage(pixels []uint8, width, height int) *image.RGBA {
 	img := image.NewRGBA(image.Rect(0, 0, width, height))